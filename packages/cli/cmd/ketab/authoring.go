@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/bookfile"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/ledger"
+	core "github.com/joinnextblock/ketab-protocol/go-core"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// authoring flags
+	flag_act       int
+	flag_act_title string
+	flag_position  int
+	flag_lines     string
+	flag_titles    []string
+)
+
+// ketab_ref_help explains how authoring commands name ketabs.
+const ketab_ref_help = "A ketab is named by its UUID or by <chapter>/<position>, such as 03/2 for the second ketab of chapter 03. "
+
+// init_command builds the `ketab init` command.
+func init_command() *cobra.Command {
+	init_cmd := &cobra.Command{
+		Use:   "init <book-dir>",
+		Short: "Start a new book directory",
+		Long:  "Creates <book-dir>/book.json with a random book UUID and a first, empty act. Add chapters and ketabs with ketab add.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  run_init,
+	}
+	init_cmd.Flags().StringVar(&flag_title, "title", "", "Book title (default: the folder name)")
+	init_cmd.Flags().StringVar(&flag_author, "author", "", "Author name (required)")
+	init_cmd.Flags().StringVar(&flag_description, "description", "", "Book description (required)")
+	init_cmd.Flags().StringVar(&flag_act_title, "act", "Act 1", "Title of the first act")
+	return init_cmd
+}
+
+// add_command builds the `ketab add` command group.
+func add_command() *cobra.Command {
+	add_cmd := &cobra.Command{
+		Use:   "add",
+		Short: "Add an act, chapter or ketab to a book directory",
+		Long:  "New chapters and ketabs get random UUIDs; existing ones are never renumbered, so their published coordinates stay valid.",
+	}
+
+	act_cmd := &cobra.Command{
+		Use:   "act <book-dir> <title>",
+		Short: "Append an act",
+		Args:  cobra.ExactArgs(2),
+		RunE:  run_add_act,
+	}
+
+	chapter_cmd := &cobra.Command{
+		Use:   "chapter <book-dir> <title>",
+		Short: "Append a chapter to an act and create its folder",
+		Long:  "The chapter is numbered one past the highest chapter number in the book.",
+		Args:  cobra.ExactArgs(2),
+		RunE:  run_add_chapter,
+	}
+	chapter_cmd.Flags().IntVar(&flag_act, "act", 0, "Act to add the chapter to, 1-based (default: the last act)")
+
+	ketab_cmd := &cobra.Command{
+		Use:   "ketab <book-dir> <chapter> <title>",
+		Short: "Add a ketab to a chapter and create its file",
+		Long:  "The chapter is named by its number or UUID. The new file is empty; write the ketab's text into it.",
+		Args:  cobra.ExactArgs(3),
+		RunE:  run_add_ketab,
+	}
+	ketab_cmd.Flags().IntVar(&flag_position, "position", 0, "Position in the chapter, 1-based (default: last)")
+
+	add_cmd.AddCommand(act_cmd, chapter_cmd, ketab_cmd)
+	return add_cmd
+}
+
+// move_command builds the `ketab move` command.
+func move_command() *cobra.Command {
+	move_cmd := &cobra.Command{
+		Use:   "move <book-dir> <ketab> <chapter>",
+		Short: "Move a ketab to another chapter or position",
+		Long: ketab_ref_help + "Give the ketab's own chapter to reorder it. The ketab keeps its UUID; " +
+			"moved to another chapter, its file moves to that chapter's folder.",
+		Args: cobra.ExactArgs(3),
+		RunE: run_move,
+	}
+	move_cmd.Flags().IntVar(&flag_position, "position", 0, "Position in the chapter, 1-based (default: last)")
+	return move_cmd
+}
+
+// split_command builds the `ketab split` command.
+func split_command() *cobra.Command {
+	split_cmd := &cobra.Command{
+		Use:   "split <book-dir> <ketab>",
+		Short: "Split a ketab in two or more",
+		Long: ketab_ref_help + "Without --lines the ketab is split at its --- rules (a sources section stays with the last piece). " +
+			"The first piece keeps the ketab's UUID, title and file; the others become new ketabs after it.",
+		Args: cobra.ExactArgs(2),
+		RunE: run_split,
+	}
+	split_cmd.Flags().StringVar(&flag_lines, "lines", "", "Comma-separated line numbers of the file to start new ketabs at")
+	split_cmd.Flags().StringArrayVar(&flag_titles, "title", nil, "Title of a new ketab, in order (repeatable; default: <title> (2), ...)")
+	return split_cmd
+}
+
+// merge_command builds the `ketab merge` command.
+func merge_command() *cobra.Command {
+	merge_cmd := &cobra.Command{
+		Use:   "merge <book-dir> <ketab> <ketab>...",
+		Short: "Merge ketabs into the first one",
+		Long: ketab_ref_help + "The first ketab keeps its UUID, position and file; the texts are joined by --- rules and their sources sections combined. " +
+			"The other ketabs are removed from book.json and their files deleted.",
+		Args: cobra.MinimumNArgs(3),
+		RunE: run_merge,
+	}
+	merge_cmd.Flags().StringVar(&flag_title, "title", "", "Title of the merged ketab (default: the first ketab's)")
+	return merge_cmd
+}
+
+func run_init(cmd *cobra.Command, args []string) error {
+	if strings.TrimSpace(flag_author) == "" {
+		return fmt.Errorf("a book needs an author: pass --author \"<name>\"")
+	}
+	if strings.TrimSpace(flag_description) == "" {
+		return fmt.Errorf("a book needs a description: pass --description \"<text>\"")
+	}
+	title := flag_title
+	if title == "" {
+		abs_dir, err := filepath.Abs(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid directory: %w", err)
+		}
+		title = filepath.Base(abs_dir)
+	}
+	f, err := bookfile.Init(args[0], title, flag_author, flag_description, flag_act_title)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("📚 Created \"%s\" in %s\n", f.Book.Title, args[0])
+	fmt.Printf("   UUID: %s\n", f.Book.UUID)
+	fmt.Printf("   Next: ketab add chapter %s \"<title>\"\n", args[0])
+	return nil
+}
+
+func run_add_act(cmd *cobra.Command, args []string) error {
+	f, err := bookfile.Open(args[0])
+	if err != nil {
+		return err
+	}
+	f.AddAct(args[1])
+	if err := f.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Added act %d: %s\n", len(f.Book.Acts), args[1])
+	return nil
+}
+
+func run_add_chapter(cmd *cobra.Command, args []string) error {
+	f, err := bookfile.Open(args[0])
+	if err != nil {
+		return err
+	}
+	ch, err := f.AddChapter(flag_act, args[1])
+	if err != nil {
+		return err
+	}
+	if err := f.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Added chapter %s: %s\n", ch.Number, ch.Title)
+	fmt.Printf("   UUID: %s\n", ch.UUID)
+	fmt.Printf("   Next: ketab add ketab %s %s \"<title>\"\n", args[0], ch.Number)
+	return nil
+}
+
+func run_add_ketab(cmd *cobra.Command, args []string) error {
+	f, err := bookfile.Open(args[0])
+	if err != nil {
+		return err
+	}
+	k, err := f.AddKetab(args[1], flag_position, args[2], "")
+	if err != nil {
+		return err
+	}
+	if err := f.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Added ketab \"%s\"\n", k.Title)
+	fmt.Printf("   UUID: %s\n", k.UUID)
+	fmt.Printf("   File: %s\n", filepath.Join(args[0], filepath.FromSlash(k.File)))
+	print_chapter_ketabs(args[1], f)
+	return nil
+}
+
+func run_move(cmd *cobra.Command, args []string) error {
+	f, err := bookfile.Open(args[0])
+	if err != nil {
+		return err
+	}
+	ref, err := f.Ketab(args[1])
+	if err != nil {
+		return err
+	}
+	k := *ref.Ketab()
+	from := ref.Chapter.Number
+	if err := f.MoveKetab(ref, args[2], flag_position); err != nil {
+		return err
+	}
+	if err := f.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Moved \"%s\" (%s)\n", k.Title, k.UUID)
+	print_chapter_ketabs(from, f)
+	if to, err := f.Chapter(args[2]); err == nil && to.Number != from {
+		print_chapter_ketabs(to.Number, f)
+	}
+	print_republish_hint(args[0])
+	return nil
+}
+
+func run_split(cmd *cobra.Command, args []string) error {
+	var lines []int
+	if flag_lines != "" {
+		for _, s := range strings.Split(flag_lines, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return fmt.Errorf("invalid --lines %q: %w", flag_lines, err)
+			}
+			lines = append(lines, n)
+		}
+	}
+
+	f, err := bookfile.Open(args[0])
+	if err != nil {
+		return err
+	}
+	ref, err := f.Ketab(args[1])
+	if err != nil {
+		return err
+	}
+	title := ref.Ketab().Title
+	added, err := f.SplitKetab(ref, lines, flag_titles)
+	if err != nil {
+		return err
+	}
+	if err := f.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Split \"%s\" into %d ketabs\n", title, len(added)+1)
+	for _, k := range added {
+		fmt.Printf("   + %s (%s) → %s\n", k.Title, k.UUID, k.File)
+	}
+	print_chapter_ketabs(ref.Chapter.Number, f)
+	print_republish_hint(args[0])
+	return nil
+}
+
+func run_merge(cmd *cobra.Command, args []string) error {
+	f, err := bookfile.Open(args[0])
+	if err != nil {
+		return err
+	}
+	var refs []bookfile.KetabRef
+	for _, arg := range args[1:] {
+		ref, err := f.Ketab(arg)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, ref)
+	}
+	into := *refs[0].Ketab()
+	chapter := refs[0].Chapter.Number
+	removed, err := f.MergeKetabs(refs, flag_title)
+	if err != nil {
+		return err
+	}
+	if flag_title != "" {
+		into.Title = flag_title
+	}
+	if err := f.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Merged %d ketabs into \"%s\" (%s)\n", len(removed)+1, into.Title, into.UUID)
+	for _, k := range removed {
+		fmt.Printf("   - %s (%s)\n", k.Title, k.UUID)
+	}
+	print_chapter_ketabs(chapter, f)
+
+	// Merged-away ketabs that were published stay on relays until deleted
+	var published []string
+	if state, err := ledger.Load(f.Dir); err == nil {
+		for _, k := range removed {
+			for _, entry := range state.Entries {
+				if entry.Kind == core.KindKetab && entry.DTag == k.UUID {
+					published = append(published, k.UUID)
+					break
+				}
+			}
+		}
+	}
+	if len(published) > 0 {
+		fmt.Printf("\n⚠️  %d merged ketabs were published; delete them with:\n", len(published))
+		fmt.Printf("   ketab unpublish %s --ketabs %s\n", args[0], strings.Join(published, ","))
+	}
+	print_republish_hint(args[0])
+	return nil
+}
+
+// print_chapter_ketabs lists a chapter's ketabs in order.
+func print_chapter_ketabs(chapter string, f *bookfile.File) {
+	ch, err := f.Chapter(chapter)
+	if err != nil {
+		return
+	}
+	fmt.Printf("\n📖 Chapter %s: %s\n", ch.Number, ch.Title)
+	for i, k := range ch.Ketabs {
+		fmt.Printf("  %2d. %s  %s\n", i+1, k.Title, k.File)
+	}
+}
+
+// print_republish_hint reminds that published chapters and ketab indexes
+// change only when the book is published again.
+func print_republish_hint(dir string) {
+	fmt.Printf("\n💡 Published events keep the old order until you run: ketab publish %s\n", dir)
+}
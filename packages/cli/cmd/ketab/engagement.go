@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/fetch"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/types"
+	core "github.com/joinnextblock/ketab-protocol/go-core"
+	"github.com/joinnextblock/ketab-protocol/go-core/engagement"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/spf13/cobra"
+)
+
+// engagement_excerpt is the number of runes of a comment or highlight shown
+// in the report.
+const engagement_excerpt = 120
+
+// engagement_command builds the `ketab engagement` command.
+func engagement_command() *cobra.Command {
+	engagement_cmd := &cobra.Command{
+		Use:   "engagement <book-naddr>",
+		Short: "Report the comments, highlights, zaps and reposts a published book received",
+		Long: "Fetches the book, its chapters and ketabs, then queries relays for the NIP-22 comments (kind 1111), NIP-84 highlights (kind 9802), NIP-57 zap receipts (kind 9735) and reposts (kinds 6 and 16) that reference them. " +
+			"Engagement is reported per ketab, chapter and book; chapter and book totals include their ketabs.",
+		Args: cobra.ExactArgs(1),
+		RunE: run_engagement,
+	}
+	engagement_cmd.Flags().StringVar(&flag_relays, "relays", strings.Join(types.DefaultRelays, ","), "Comma-separated relay URLs (in addition to the naddr relay hints)")
+	engagement_cmd.Flags().DurationVar(&flag_timeout, "timeout", 30*time.Second, "Overall timeout for relay queries")
+	return engagement_cmd
+}
+
+func run_engagement(cmd *cobra.Command, args []string) error {
+	pointer, err := fetch.DecodeBookNaddr(args[0])
+	if err != nil {
+		return err
+	}
+	relays := fetch.MergeRelays(pointer.Relays, strings.Split(flag_relays, ","))
+
+	ctx, cancel := context.WithTimeout(context.Background(), flag_timeout)
+	defer cancel()
+	pool := nostr.NewSimplePool(ctx)
+	defer pool.Close("engagement done")
+
+	fmt.Printf("📖 Fetching book %s\n", pointer.Identifier)
+	bk, err := fetch.FetchBook(ctx, pool, relays, pointer)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("🔍 Querying %d relays for engagement...\n\n", len(relays))
+	report, err := engagement.Fetch(ctx, pool, relays, engagement_targets(bk))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("📚 %s\n", report.Target.Title)
+	fmt.Printf("   %s\n", format_stats(report.Total))
+	print_engagement(report, "   ")
+
+	chapters := 0
+	for _, act := range bk.Acts {
+		if act.Title != "" {
+			fmt.Printf("\n═══ %s ═══\n", act.Title)
+		}
+		for range act.Chapters {
+			ch_node := report.Children[chapters]
+			chapters++
+			fmt.Printf("\n  📖 %s\n", ch_node.Target.Title)
+			fmt.Printf("     %s\n", format_stats(ch_node.Total))
+			print_engagement(ch_node, "     ")
+			for _, k_node := range ch_node.Children {
+				if k_node.Total.Total() == 0 {
+					continue
+				}
+				fmt.Printf("     📝 %s\n", k_node.Target.Title)
+				fmt.Printf("        %s\n", format_stats(k_node.Total))
+				print_engagement(k_node, "        ")
+			}
+		}
+	}
+
+	if report.Total.Total() == 0 {
+		fmt.Printf("\n💤 No engagement found on %d relays\n", len(relays))
+	} else {
+		fmt.Printf("\n🏁 %s\n", format_stats(report.Total))
+	}
+	return nil
+}
+
+// engagement_targets builds the book → chapter → ketab target tree of a
+// fetched book.
+func engagement_targets(bk *fetch.Book) *engagement.Target {
+	author := bk.Pointer.PublicKey
+	book := &engagement.Target{
+		Coordinate: fmt.Sprintf("%d:%s:%s", core.KindBook, author, bk.Pointer.Identifier),
+		EventID:    bk.Event.ID,
+		Title:      bk.Content.Title,
+	}
+	if book.Title == "" {
+		book.Title = bk.Pointer.Identifier
+	}
+	for _, ch := range bk.Chapters() {
+		ch_target := &engagement.Target{
+			Coordinate: fmt.Sprintf("%d:%s:%s", core.KindChapter, author, ch.DTag),
+			Title:      ch.Title,
+		}
+		if ch.Event != nil {
+			ch_target.EventID = ch.Event.ID
+			ch_target.Body = ch.Event.Content
+		}
+		for _, k := range ch.Ketabs {
+			title := k.Content.Title
+			if title == "" {
+				title = k.DTag
+			}
+			ch_target.Children = append(ch_target.Children, &engagement.Target{
+				Coordinate: fmt.Sprintf("%d:%s:%s", core.KindKetab, author, k.DTag),
+				EventID:    k.Event.ID,
+				Title:      title,
+				Body:       k.Content.Body,
+			})
+		}
+		book.Children = append(book.Children, ch_target)
+	}
+	return book
+}
+
+// format_stats formats engagement counts on one line.
+func format_stats(s engagement.Stats) string {
+	return fmt.Sprintf("💬 %d comments · ✨ %d highlights · ⚡ %d zaps (%s sats) · 🔁 %d reposts",
+		s.Comments, s.Highlights, s.Zaps, format_sats(s.ZapMsats), s.Reposts)
+}
+
+func format_sats(msats int64) string {
+	if msats%1000 == 0 {
+		return fmt.Sprintf("%d", msats/1000)
+	}
+	return fmt.Sprintf("%.3f", float64(msats)/1000)
+}
+
+// print_engagement prints the highlights, zaps and comment threads of a node.
+func print_engagement(n *engagement.Node, indent string) {
+	for _, h := range n.Highlights {
+		where := "not found in current text"
+		if a := h.Anchor; a != nil {
+			where = fmt.Sprintf("%s, runes %d–%d", a.Ketab.Title, a.Start, a.End)
+			if !a.Exact() {
+				where += fmt.Sprintf(", %.0f%% match", a.Score*100)
+			}
+		}
+		fmt.Printf("%s✨ \"%s\" (%s, %s)\n", indent, excerpt(h.Text), short_pubkey(h.Event.PubKey), where)
+	}
+	for _, z := range n.Zaps {
+		sender := "anonymous"
+		if z.Sender != "" {
+			sender = short_pubkey(z.Sender)
+		}
+		fmt.Printf("%s⚡ %s sats from %s\n", indent, format_sats(z.Msats), sender)
+	}
+	var print_thread func(c *engagement.Comment, depth int)
+	print_thread = func(c *engagement.Comment, depth int) {
+		marker := "💬"
+		if depth > 0 {
+			marker = "↳"
+		}
+		fmt.Printf("%s%s%s %s: %s\n", indent, strings.Repeat("   ", depth), marker, short_pubkey(c.Event.PubKey), excerpt(c.Event.Content))
+		for _, reply := range c.Replies {
+			print_thread(reply, depth+1)
+		}
+	}
+	for _, c := range n.Comments {
+		print_thread(c, 0)
+	}
+}
+
+// excerpt collapses whitespace and truncates s for display.
+func excerpt(s string) string {
+	runes := []rune(strings.Join(strings.Fields(s), " "))
+	if len(runes) > engagement_excerpt {
+		return string(runes[:engagement_excerpt]) + "…"
+	}
+	return string(runes)
+}
+
+func short_pubkey(pubkey string) string {
+	if len(pubkey) > 12 {
+		return pubkey[:8] + "…" + pubkey[len(pubkey)-4:]
+	}
+	return pubkey
+}
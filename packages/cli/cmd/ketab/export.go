@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/epub"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/fetch"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/keyring"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/ledger"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/types"
+	core "github.com/joinnextblock/ketab-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// export flags
+	flag_output   string
+	flag_language string
+	flag_author   string
+	flag_no_cover bool
+)
+
+// export_command builds the `ketab export` command group.
+func export_command() *cobra.Command {
+	export_cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export a book to other formats",
+	}
+
+	epub_cmd := &cobra.Command{
+		Use:   "epub <book-dir|book-naddr>",
+		Short: "Export a book directory or a published book as EPUB 3",
+		Long: "Acts become parts, chapters become XHTML documents and ketabs become sections with stable anchors " +
+			"(#k-<ketab-d-tag>) and a nostr: link to their naddr. Footnotes from each ketab's sources section become endnotes. " +
+			"A book directory is exported in publishing order; its naddr links use the author from --author, " +
+			"the publish ledger or the author keyring profile, in that order.",
+		Args: cobra.ExactArgs(1),
+		RunE: run_export_epub,
+	}
+	epub_cmd.Flags().StringVarP(&flag_output, "output", "o", "", "Output file (default: <book-slug>.epub)")
+	epub_cmd.Flags().StringVar(&flag_language, "lang", "en", "Language of the book (BCP 47 tag)")
+	epub_cmd.Flags().StringVar(&flag_author, "author", "", "Author pubkey (npub or hex) for the naddr links of a book directory")
+	epub_cmd.Flags().StringVar(&flag_profile, "profile", "", "Keyring profile whose pubkey the naddr links of a book directory use (default: the author profile)")
+	epub_cmd.Flags().BoolVar(&flag_no_cover, "no-cover", false, "Leave out the cover image")
+	epub_cmd.Flags().StringVar(&flag_relays, "relays", strings.Join(types.DefaultRelays, ","), "Comma-separated relay URLs (for a naddr: in addition to its relay hints)")
+	epub_cmd.Flags().DurationVar(&flag_timeout, "timeout", 30*time.Second, "Overall timeout for relay queries and the cover download")
+
+	export_cmd.AddCommand(epub_cmd)
+	return export_cmd
+}
+
+func run_export_epub(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), flag_timeout)
+	defer cancel()
+	relays := strings.Split(flag_relays, ",")
+
+	var (
+		eb        *epub.Book
+		cover     string
+		cover_dir string
+	)
+	if strings.HasPrefix(args[0], "naddr1") {
+		pointer, err := fetch.DecodeBookNaddr(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("📖 Fetching book %s\n", pointer.Identifier)
+		pool := nostr.NewSimplePool(ctx)
+		defer pool.Close("export done")
+		fb, err := fetch.FetchBook(ctx, pool, relays, pointer)
+		if err != nil {
+			return err
+		}
+		for _, ch := range fb.Chapters() {
+			if ch.Event == nil && len(ch.Ketabs) == 0 {
+				fmt.Printf("  ⚠️  %s: not found on relays, skipping\n", ch.Title)
+			}
+		}
+		eb = epub.FromFetched(fb)
+		cover = fb.Content.Image
+	} else {
+		bk, err := book.Load(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to load book: %w", err)
+		}
+		pubkey, source, err := export_author(bk)
+		if err != nil {
+			return err
+		}
+		if pubkey == "" {
+			fmt.Println("⚠️  No author pubkey (use --author); sections will have no naddr links")
+		} else {
+			fmt.Printf("🔑 Author %s (from %s)\n", short_pubkey(pubkey), source)
+		}
+		eb = epub.FromLocal(bk, pubkey, export_relay_hints(bk, pubkey, relays))
+		cover, cover_dir = bk.Metadata.Image, bk.Dir
+	}
+	eb.Language = flag_language
+
+	if cover != "" && !flag_no_cover {
+		c, err := epub.LoadCover(ctx, cover, cover_dir)
+		if err != nil {
+			fmt.Printf("⚠️  Leaving out the cover: %v\n", err)
+		} else {
+			eb.Cover = c
+		}
+	}
+
+	out := flag_output
+	if out == "" {
+		out = fetch.Slugify(eb.Title) + ".epub"
+		if out == ".epub" {
+			out = "book.epub"
+		}
+	}
+	if err := epub.WriteFile(out, eb); err != nil {
+		return err
+	}
+
+	var chapters, sections int
+	for _, part := range eb.Parts {
+		for _, ch := range part.Chapters {
+			if len(ch.Sections) > 0 {
+				chapters++
+				sections += len(ch.Sections)
+			}
+		}
+	}
+	info, err := os.Stat(out)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🏁 Wrote %s: %d chapters, %d ketabs (%d KB)\n", out, chapters, sections, (info.Size()+1023)/1024)
+	return nil
+}
+
+// export_author returns the pubkey whose naddrs a book directory is exported
+// with, and where it came from: --author, the publish ledger (the account
+// that last published the book), or the author keyring profile. It returns
+// "" when none is available.
+func export_author(bk *book.Book) (string, string, error) {
+	if flag_author != "" {
+		pubkey := flag_author
+		if strings.HasPrefix(pubkey, "npub1") {
+			_, data, err := nip19.Decode(pubkey)
+			if err != nil {
+				return "", "", fmt.Errorf("invalid --author: %w", err)
+			}
+			pubkey = data.(string)
+		}
+		if !nostr.IsValid32ByteHex(pubkey) {
+			return "", "", fmt.Errorf("invalid --author %q: want an npub or 64 hex characters", flag_author)
+		}
+		return pubkey, "--author", nil
+	}
+
+	if state, err := ledger.Load(bk.Dir); err == nil {
+		var newest int64
+		pubkey := ""
+		for coord, entry := range state.Entries {
+			parts := strings.SplitN(coord, ":", 3)
+			if entry.Kind == core.KindBook && entry.DTag == bk.Metadata.BookUUID && len(parts) == 3 && entry.CreatedAt > newest {
+				newest, pubkey = entry.CreatedAt, parts[1]
+			}
+		}
+		if pubkey != "" {
+			return pubkey, "the publish ledger", nil
+		}
+	}
+
+	if ring, err := keyring.Open(); err == nil {
+		name := flag_profile
+		if name == "" {
+			name = os.Getenv("KETAB_PROFILE")
+		}
+		if name == "" {
+			name = ring.Profile(keyring.RoleAuthor)
+		}
+		if entry, err := ring.Get(name); name != "" && err == nil {
+			return entry.Pubkey, fmt.Sprintf("keyring profile %q", name), nil
+		}
+	}
+	return "", "", nil
+}
+
+// export_relay_hints returns the relays to put in a book directory's naddrs:
+// those that accepted the book when it was last published, else the first
+// of --relays.
+func export_relay_hints(bk *book.Book, pubkey string, relays []string) []string {
+	if state, err := ledger.Load(bk.Dir); err == nil && pubkey != "" {
+		coord := fmt.Sprintf("%d:%s:%s", core.KindBook, pubkey, bk.Metadata.BookUUID)
+		if entry, ok := state.Entries[coord]; ok {
+			var accepted []string
+			for url, status := range entry.Relays {
+				if status.Accepted {
+					accepted = append(accepted, url)
+				}
+			}
+			sort.Strings(accepted)
+			if len(accepted) > 2 {
+				accepted = accepted[:2]
+			}
+			if len(accepted) > 0 {
+				return accepted
+			}
+		}
+	}
+	if len(relays) > 0 && strings.TrimSpace(relays[0]) != "" {
+		return []string{strings.TrimSpace(relays[0])}
+	}
+	return nil
+}
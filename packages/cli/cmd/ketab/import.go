@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/importer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// import flags
+	flag_title       string
+	flag_description string
+	flag_levels      string
+	flag_split_rules bool
+)
+
+// import_command builds the `ketab import` command group.
+func import_command() *cobra.Command {
+	import_cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Create a book directory from other formats",
+	}
+
+	markdown_cmd := &cobra.Command{
+		Use:   "markdown <source> <book-dir>",
+		Short: "Import a markdown file or folder (such as an Obsidian vault) as a book directory",
+		Long: "A single file is split into acts, chapters and ketabs by heading levels: with three levels in use " +
+			"the top three are acts, chapters and ketabs, with two chapters and ketabs (a lone top heading is the book title). " +
+			"A folder maps <chapter>/<file>.md or <act>/<chapter>/<file>.md to ketabs, or each file to a chapter. " +
+			"Ketabs are also split at --- rules, except before a sources section. " +
+			"UUIDs are derived from titles, so importing again yields the same d-tags; with --force an existing " +
+			"book.json keeps the UUIDs of chapters and ketabs whose titles did not change.",
+		Args: cobra.ExactArgs(2),
+		RunE: run_import_markdown,
+	}
+	markdown_cmd.Flags().StringVar(&flag_title, "title", "", "Book title (default: the front matter title, the top heading or the file or folder name)")
+	markdown_cmd.Flags().StringVar(&flag_author, "author", "", "Author name (default: the front matter author; required when it has none)")
+	markdown_cmd.Flags().StringVar(&flag_description, "description", "", "Book description (default: the front matter description, else the text before the first chapter; required when there is none)")
+	markdown_cmd.Flags().StringVar(&flag_levels, "levels", "", "Heading levels of acts, chapters and ketabs, - for none (e.g. 1,2,3 or -,1,2; default: detected)")
+	markdown_cmd.Flags().BoolVar(&flag_split_rules, "split-rules", true, "Start a new ketab at each --- rule")
+	markdown_cmd.Flags().BoolVar(&flag_force, "force", false, "Overwrite an existing book.json in <book-dir>")
+	markdown_cmd.Flags().BoolVar(&flag_dry_run, "dry-run", false, "Show how the source would be split without writing anything")
+
+	import_cmd.AddCommand(markdown_cmd)
+	return import_cmd
+}
+
+func run_import_markdown(cmd *cobra.Command, args []string) error {
+	source, out_dir := args[0], args[1]
+	opts := importer.Options{
+		Title:       flag_title,
+		Author:      flag_author,
+		Description: flag_description,
+		SplitRules:  flag_split_rules,
+		Exclude:     out_dir,
+	}
+	if flag_levels != "" {
+		levels, err := importer.ParseLevels(flag_levels)
+		if err != nil {
+			return err
+		}
+		opts.Levels = &levels
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", source, err)
+	}
+	var b *importer.Book
+	if info.IsDir() {
+		fmt.Printf("📂 Importing folder %s\n", source)
+		b, err = importer.FromDir(source, opts)
+	} else {
+		fmt.Printf("📄 Importing %s\n", filepath.Base(source))
+		b, err = importer.FromFile(source, opts)
+	}
+	if err != nil {
+		return err
+	}
+	if b.Levels != (importer.Levels{}) {
+		fmt.Printf("   Heading levels (act,chapter,ketab): %s\n", b.Levels)
+	}
+	chapters, ketabs := b.Counts()
+	if chapters == 0 {
+		return fmt.Errorf("no text found in %s", source)
+	}
+
+	fmt.Printf("\n📚 %s\n", b.Title)
+	for _, act := range b.Acts {
+		fmt.Printf("\n═══ %s ═══\n", act.Title)
+		for _, ch := range act.Chapters {
+			fmt.Printf("  📖 %s (%d ketabs)\n", ch.Title, len(ch.Ketabs))
+			for _, k := range ch.Ketabs {
+				fmt.Printf("       %s\n", k.Title)
+			}
+		}
+	}
+	if len(b.Warnings) > 0 {
+		fmt.Println()
+		for _, warning := range b.Warnings {
+			fmt.Printf("⚠️  %s\n", warning)
+		}
+	}
+
+	if flag_dry_run {
+		fmt.Printf("\n🔍 Dry run: %d chapters and %d ketabs, nothing written\n", chapters, ketabs)
+		return nil
+	}
+	if _, err := importer.Write(b, out_dir, flag_force); err != nil {
+		return err
+	}
+	if _, err := book.Load(out_dir); err != nil {
+		return fmt.Errorf("wrote %s but it does not load: %w", out_dir, err)
+	}
+
+	fmt.Printf("\n🏁 Wrote %d chapters and %d ketabs to %s\n", chapters, ketabs, out_dir)
+	fmt.Printf("   Next: ketab preview %s\n", out_dir)
+	return nil
+}
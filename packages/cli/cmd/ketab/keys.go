@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/keyring"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/nbd-wtf/go-nostr/nip49"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// keys flags
+	flag_keys_role        string
+	flag_keys_export_nsec bool
+)
+
+// keys_command builds the `ketab keys` command group.
+func keys_command() *cobra.Command {
+	keys_cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Manage signing keys in the local keyring (NIP-49 encrypted)",
+		Long:  "Keys are stored as NIP-49 ncryptsec in keyring.json under $KETAB_HOME (default: the user config directory). Commands sign with the profile chosen by --profile, else the one set with `keys use`.",
+	}
+
+	generate_cmd := &cobra.Command{
+		Use:   "generate <name>",
+		Short: "Generate a new key and store it encrypted under <name>",
+		Args:  cobra.ExactArgs(1),
+		RunE:  run_keys_generate,
+	}
+	generate_cmd.Flags().StringVar(&flag_keys_role, "as", "", "Also make it the profile for a role: author or librarian")
+
+	import_cmd := &cobra.Command{
+		Use:   "import <name>",
+		Short: "Import an nsec or ncryptsec (read from a prompt, never from arguments)",
+		Args:  cobra.ExactArgs(1),
+		RunE:  run_keys_import,
+	}
+	import_cmd.Flags().StringVar(&flag_keys_role, "as", "", "Also make it the profile for a role: author or librarian")
+
+	export_cmd := &cobra.Command{
+		Use:   "export <name>",
+		Short: "Print a key's ncryptsec (or, with --nsec, its plaintext nsec)",
+		Args:  cobra.ExactArgs(1),
+		RunE:  run_keys_export,
+	}
+	export_cmd.Flags().BoolVar(&flag_keys_export_nsec, "nsec", false, "Decrypt and print the plaintext nsec")
+
+	list_cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List stored keys",
+		Args:  cobra.NoArgs,
+		RunE:  run_keys_list,
+	}
+
+	use_cmd := &cobra.Command{
+		Use:   "use <name>",
+		Short: "Make <name> the default profile (or, with --as, the profile for a role)",
+		Args:  cobra.ExactArgs(1),
+		RunE:  run_keys_use,
+	}
+	use_cmd.Flags().StringVar(&flag_keys_role, "as", "", "Role to set: author or librarian (default: the default profile)")
+
+	keys_cmd.AddCommand(generate_cmd, import_cmd, export_cmd, list_cmd, use_cmd)
+	return keys_cmd
+}
+
+func run_keys_generate(cmd *cobra.Command, args []string) error {
+	ring, err := keyring.Open()
+	if err != nil {
+		return err
+	}
+	password, err := read_new_password()
+	if err != nil {
+		return err
+	}
+	entry, err := ring.Add(args[0], nostr.GeneratePrivateKey(), password, nip49.NotKnownToHaveBeenHandledInsecurely)
+	if err != nil {
+		return err
+	}
+	return save_new_key(ring, entry)
+}
+
+func run_keys_import(cmd *cobra.Command, args []string) error {
+	ring, err := keyring.Open()
+	if err != nil {
+		return err
+	}
+	secret, err := read_secret("🔑 nsec or ncryptsec: ")
+	if err != nil {
+		return err
+	}
+	secret = strings.TrimSpace(secret)
+
+	var entry *keyring.Entry
+	switch {
+	case strings.HasPrefix(secret, "ncryptsec1"):
+		password, err := read_password("🔒 Passphrase of the ncryptsec: ")
+		if err != nil {
+			return err
+		}
+		entry, err = ring.AddEncrypted(args[0], secret, password)
+		if err != nil {
+			return err
+		}
+	case strings.HasPrefix(secret, "nsec1"):
+		prefix, data, err := nip19.Decode(secret)
+		if err != nil || prefix != "nsec" {
+			return fmt.Errorf("invalid nsec")
+		}
+		sk, ok := data.(string)
+		if !ok {
+			return fmt.Errorf("unexpected nsec data type: %T", data)
+		}
+		password, err := read_new_password()
+		if err != nil {
+			return err
+		}
+		// The key existed in plaintext, so NIP-49 says to flag it as such.
+		entry, err = ring.Add(args[0], sk, password, nip49.KnownToHaveBeenHandledInsecurely)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("expected an nsec1... or ncryptsec1... string")
+	}
+	return save_new_key(ring, entry)
+}
+
+func run_keys_export(cmd *cobra.Command, args []string) error {
+	ring, err := keyring.Open()
+	if err != nil {
+		return err
+	}
+	entry, err := ring.Get(args[0])
+	if err != nil {
+		return err
+	}
+	if !flag_keys_export_nsec {
+		fmt.Println(entry.Ncryptsec)
+		return nil
+	}
+	password, err := read_password(fmt.Sprintf("🔒 Passphrase for key %q: ", entry.Name))
+	if err != nil {
+		return err
+	}
+	sk, err := entry.Decrypt(password)
+	if err != nil {
+		return err
+	}
+	nsec, err := nip19.EncodePrivateKey(sk)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "⚠️  This is your plaintext secret key. Do not paste it into shells, chats or issues.")
+	fmt.Println(nsec)
+	return nil
+}
+
+func run_keys_list(cmd *cobra.Command, args []string) error {
+	ring, err := keyring.Open()
+	if err != nil {
+		return err
+	}
+	entries := ring.List()
+	if len(entries) == 0 {
+		fmt.Println("No keys yet — run `ketab keys generate author`")
+		return nil
+	}
+	fmt.Printf("🔑 %s\n\n", ring.Path())
+	for _, e := range entries {
+		marker := " "
+		if e.Name == ring.Default {
+			marker = "*"
+		}
+		npub, _ := nip19.EncodePublicKey(e.Pubkey)
+		var roles []string
+		for _, role := range []string{keyring.RoleAuthor, keyring.RoleLibrarian} {
+			if ring.Roles[role] == e.Name {
+				roles = append(roles, role)
+			}
+		}
+		line := fmt.Sprintf("  %s %-12s %s", marker, e.Name, npub)
+		if len(roles) > 0 {
+			line += fmt.Sprintf("  (%s)", strings.Join(roles, ", "))
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+func run_keys_use(cmd *cobra.Command, args []string) error {
+	ring, err := keyring.Open()
+	if err != nil {
+		return err
+	}
+	if err := ring.Use(args[0], flag_keys_role); err != nil {
+		return err
+	}
+	if err := ring.Save(); err != nil {
+		return err
+	}
+	if flag_keys_role != "" {
+		fmt.Printf("✅ %s now signs as %s\n", args[0], flag_keys_role)
+	} else {
+		fmt.Printf("✅ %s is now the default profile\n", args[0])
+	}
+	return nil
+}
+
+// read_new_password prompts for a new passphrase twice (or takes KETAB_PASSWORD).
+func read_new_password() (string, error) {
+	if v := os.Getenv("KETAB_PASSWORD"); v != "" {
+		return v, nil
+	}
+	password, err := read_secret("🔒 New passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	confirm, err := read_secret("🔒 Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if password != confirm {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+	return password, nil
+}
+
+// save_new_key applies --as to a newly added key, saves the keyring and prints the key.
+func save_new_key(ring *keyring.Keyring, entry *keyring.Entry) error {
+	if flag_keys_role != "" {
+		if err := ring.Use(entry.Name, flag_keys_role); err != nil {
+			return err
+		}
+	}
+	if err := ring.Save(); err != nil {
+		return err
+	}
+	npub, _ := nip19.EncodePublicKey(entry.Pubkey)
+	fmt.Printf("✅ Stored key %q\n", entry.Name)
+	fmt.Printf("   npub: %s\n", npub)
+	fmt.Printf("   keyring: %s\n", ring.Path())
+	return nil
+}
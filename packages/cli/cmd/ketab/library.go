@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/events"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/fetch"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/keyring"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/library"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/publisher"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/signer"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/types"
+	core "github.com/joinnextblock/ketab-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/spf13/cobra"
+)
+
+// library_sync_timeout bounds fetching a library and its book titles from relays.
+const library_sync_timeout = 15 * time.Second
+
+var (
+	// library flags
+	flag_library_description string
+	flag_library_d           string
+	flag_library_position    int
+	flag_library_title       string
+)
+
+// library_command builds the `ketab library` command group.
+func library_command() *cobra.Command {
+	library_cmd := &cobra.Command{
+		Use:   "library",
+		Short: "Manage the libraries (kind 38890) you publish as a librarian",
+		Long:  "Each library is kept as a local manifest in libraries.json under $KETAB_HOME (default: the user config directory). Before publishing, the manifest is merged with the latest library event on relays, so books added elsewhere are kept.",
+	}
+	library_cmd.PersistentFlags().StringVar(&flag_library_id, "library", "", "Library d-tag (default: the default library, see ketab library show)")
+	library_cmd.PersistentFlags().StringVar(&flag_relays, "relays", strings.Join(types.DefaultRelays, ","), "Comma-separated relay URLs")
+
+	create_cmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create a library and publish it (the first one becomes the default)",
+		Args:  cobra.ExactArgs(1),
+		RunE:  run_library_create,
+	}
+	create_cmd.Flags().StringVar(&flag_library_description, "description", "", "Library description")
+	create_cmd.Flags().StringVar(&flag_library_d, "id", "", "Library d-tag (default: a new UUID)")
+
+	add_book_cmd := &cobra.Command{
+		Use:   "add-book <book-naddr|38891-coordinate>",
+		Short: "Add a book to the library, or move it with --position",
+		Args:  cobra.ExactArgs(1),
+		RunE:  run_library_add_book,
+	}
+	add_book_cmd.Flags().IntVar(&flag_library_position, "position", 0, "1-based position in the library (default: last)")
+	add_book_cmd.Flags().StringVar(&flag_library_title, "title", "", "Book title (default: the title of the book event)")
+
+	remove_book_cmd := &cobra.Command{
+		Use:   "remove-book <book>",
+		Short: "Remove a book (naddr, coordinate or d-tag) from the library",
+		Args:  cobra.ExactArgs(1),
+		RunE:  run_library_remove_book,
+	}
+
+	reorder_cmd := &cobra.Command{
+		Use:   "reorder <book>...",
+		Short: "Put the given books first, in that order; the others follow",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  run_library_reorder,
+	}
+
+	show_cmd := &cobra.Command{
+		Use:   "show",
+		Short: "List local libraries and the books of the selected one",
+		Args:  cobra.NoArgs,
+		RunE:  run_library_show,
+	}
+
+	for _, c := range []*cobra.Command{create_cmd, add_book_cmd, remove_book_cmd, reorder_cmd} {
+		c.Flags().StringVar(&flag_profile, "profile", "", "Keyring profile to sign with (default: the librarian profile, see ketab keys use)")
+		c.Flags().StringVar(&flag_signer, "signer", "", "Signer: keyring (default), bunker://<pubkey>?relay=..., keyfile:<ncryptsec-file> or env (or set KETAB_SIGNER)")
+		c.Flags().StringVar(&flag_block, "block", "", "City Protocol block coordinate to anchor the library to (default: the last one used)")
+		c.Flags().BoolVar(&flag_dry_run, "dry-run", false, "Build and sign the library event without publishing or saving the manifest")
+		c.Flags().BoolVar(&flag_strict, "strict", false, "Abort if the library event fails protocol validation (default: warn and publish)")
+	}
+
+	library_cmd.AddCommand(create_cmd, add_book_cmd, remove_book_cmd, reorder_cmd, show_cmd)
+	return library_cmd
+}
+
+func run_library_create(cmd *cobra.Command, args []string) error {
+	store, err := library.Open()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	sgn, err := resolve_signer(ctx, keyring.RoleLibrarian)
+	if err != nil {
+		return err
+	}
+	defer sgn.Close()
+
+	lib, err := store.Create(flag_library_d, args[0], flag_library_description, sgn.PublicKey(), flag_block)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("📐 Librarian pubkey: %s\n", lib.Pubkey)
+	fmt.Printf("📚 Creating library %q (%s)\n\n", lib.Name, lib.D)
+	// Keep the manifest even if no relay takes the event: the next edit publishes it.
+	if !flag_dry_run {
+		if err := store.Save(); err != nil {
+			return err
+		}
+	}
+	return publish_library(ctx, sgn, store, lib)
+}
+
+func run_library_add_book(cmd *cobra.Command, args []string) error {
+	bk, err := parse_book_arg(args[0])
+	if err != nil {
+		return err
+	}
+	bk.Title = flag_library_title
+	return edit_library(func(lib *library.Library) error {
+		lib.AddBook(bk, flag_library_position-1)
+		fmt.Printf("➕ %s\n\n", bk.Coordinate())
+		return nil
+	})
+}
+
+func run_library_remove_book(cmd *cobra.Command, args []string) error {
+	ref := book_ref(args[0])
+	return edit_library(func(lib *library.Library) error {
+		removed, err := lib.RemoveBook(ref)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("➖ %s\n\n", removed.Coordinate())
+		return nil
+	})
+}
+
+func run_library_reorder(cmd *cobra.Command, args []string) error {
+	refs := make([]string, len(args))
+	for i, arg := range args {
+		refs[i] = book_ref(arg)
+	}
+	return edit_library(func(lib *library.Library) error {
+		return lib.Reorder(refs)
+	})
+}
+
+func run_library_show(cmd *cobra.Command, args []string) error {
+	store, err := library.Open()
+	if err != nil {
+		return err
+	}
+	libs := store.List()
+	if len(libs) == 0 {
+		fmt.Println("No libraries yet — run `ketab library create <name>`")
+		return nil
+	}
+	fmt.Printf("📚 %s\n\n", store.Path())
+	for _, lib := range libs {
+		marker := " "
+		if lib.D == store.Default {
+			marker = "*"
+		}
+		fmt.Printf("  %s %-24s %s (%d books)\n", marker, lib.Name, lib.D, len(lib.Books))
+	}
+	lib, err := store.Get(flag_library_id)
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+	print_library(lib)
+	return nil
+}
+
+// edit_library applies op to the selected library after merging it with the
+// latest copy on relays, then publishes it and saves the manifest.
+func edit_library(op func(lib *library.Library) error) error {
+	store, err := library.Open()
+	if err != nil {
+		return err
+	}
+	lib, err := store.Get(flag_library_id)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	sgn, err := resolve_signer(ctx, keyring.RoleLibrarian)
+	if err != nil {
+		return err
+	}
+	defer sgn.Close()
+	if sgn.PublicKey() != lib.Pubkey {
+		return fmt.Errorf("library %q belongs to %s, but the signer is %s — sign with its librarian key (--profile)", lib.Name, lib.Pubkey, sgn.PublicKey())
+	}
+
+	fmt.Printf("📐 Librarian pubkey: %s\n", lib.Pubkey)
+	fmt.Printf("📚 Library %q (%s)\n\n", lib.Name, lib.D)
+
+	sync_library(ctx, strings.Split(flag_relays, ","), lib)
+	if err := op(lib); err != nil {
+		return err
+	}
+	if flag_block != "" {
+		lib.Block = flag_block
+	}
+	return publish_library(ctx, sgn, store, lib)
+}
+
+// sync_library merges the latest library event on relays into lib and looks
+// up missing book titles. Relay failures only print a warning: the local
+// manifest still holds every book added from this machine.
+func sync_library(ctx context.Context, relays []string, lib *library.Library) {
+	ctx, cancel := context.WithTimeout(ctx, library_sync_timeout)
+	defer cancel()
+	pool := nostr.NewSimplePool(ctx)
+	defer pool.Close("library synced")
+
+	remote, err := library.FetchLatest(ctx, pool, relays, lib.Pubkey, lib.D)
+	switch {
+	case err != nil:
+		fmt.Printf("⚠️  Ignoring the library on relays: %v\n", err)
+	case remote == nil:
+		fmt.Println("🔎 Library not on relays yet")
+	case remote.UpdatedAt <= lib.UpdatedAt:
+		fmt.Println("🔎 Library on relays is not newer than the manifest")
+	default:
+		fmt.Printf("🔎 Merged library from relays (%d books)\n", len(remote.Books))
+		lib.Merge(remote)
+	}
+	library.FillTitles(ctx, pool, relays, lib)
+}
+
+// publish_library builds, signs and publishes lib, then saves the manifest.
+// In --dry-run mode nothing is published or saved.
+func publish_library(ctx context.Context, sgn signer.Signer, store *library.Store, lib *library.Library) error {
+	relays := strings.Split(flag_relays, ",")
+	print_library(lib)
+
+	builder := events.NewBuilder(sgn.PublicKey(), relays[0])
+	event := builder.BuildLibrary(lib, lib.Block)
+	event.PubKey = sgn.PublicKey()
+	if err := check_conformance([]planned_event{{section: "LIBRARY", label: "Library", event: event}}); err != nil {
+		return err
+	}
+	if err := sgn.Sign(ctx, &event); err != nil {
+		return fmt.Errorf("sign library failed: %w", err)
+	}
+
+	fmt.Println("═══ LIBRARY ═══")
+	fmt.Printf("\n📤 Library: \"%s\" (id: %s)\n", lib.Name, event.ID[:12])
+	if flag_dry_run {
+		fmt.Println("  [DRY RUN] Event would be published")
+		fmt.Printf("\n📋 Event JSON:\n%s\n", event.Content)
+		return nil
+	}
+
+	pub := publisher.New(relays, publish_options(sgn))
+	defer pub.Close()
+	result := pub.Publish(ctx, &event, nil)
+	print_relay_results(result)
+	if !result.Confirmed() {
+		return fmt.Errorf("library was not accepted by any relay")
+	}
+	lib.Published(&event)
+	if err := store.Save(); err != nil {
+		return err
+	}
+
+	naddr, err := nip19.EncodeEntity(lib.Pubkey, core.KindLibrary, lib.D, relays)
+	if err == nil {
+		fmt.Printf("\n📚 naddr: %s\n", naddr)
+	}
+	return nil
+}
+
+// print_library prints a library's books in order.
+func print_library(lib *library.Library) {
+	fmt.Printf("📚 %s — %d books\n", lib.Name, len(lib.Books))
+	for i, b := range lib.Books {
+		title := b.Title
+		if title == "" {
+			title = "(untitled)"
+		}
+		fmt.Printf("  %2d. %s\n      %s\n", i+1, title, b.Coordinate())
+	}
+	if lib.Block == "" {
+		fmt.Println("  ⚠️  No block coordinate: pass --block 38808:<clock_pubkey>:org.cityprotocol:block:<height>:<hash>")
+	}
+	fmt.Println()
+}
+
+// parse_book_arg parses a book naddr or 38891 coordinate.
+func parse_book_arg(arg string) (library.Book, error) {
+	if strings.HasPrefix(arg, "naddr1") {
+		pointer, err := fetch.DecodeBookNaddr(arg)
+		if err != nil {
+			return library.Book{}, err
+		}
+		return library.Book{Author: pointer.PublicKey, D: pointer.Identifier}, nil
+	}
+	if bk, ok := library.ParseBookRef(arg); ok {
+		return bk, nil
+	}
+	return library.Book{}, fmt.Errorf("expected a book naddr or 38891:<pubkey>:<d-tag>, got %q", arg)
+}
+
+// book_ref turns a book naddr into its coordinate; coordinates and d-tags are
+// returned unchanged.
+func book_ref(arg string) string {
+	if bk, err := parse_book_arg(arg); err == nil {
+		return bk.Coordinate()
+	}
+	return arg
+}
+
+// book_library returns the library `ketab publish` lists the book in: --library
+// or the default library, merged with its latest copy on relays and with the
+// book added. It returns nil when there is no library, or when the library
+// belongs to another librarian than the book author (who then adds the book
+// with `ketab library add-book`).
+func book_library(ctx context.Context, relays []string, pk string, bk *book.Book) (*library.Store, *library.Library) {
+	store, lib := author_library(ctx, relays, pk)
+	if lib == nil {
+		return nil, nil
+	}
+	lib.AddBook(library.Book{D: bk.Metadata.BookUUID, Title: bk.Metadata.BookTitle, Author: pk}, -1)
+	if flag_block != "" {
+		lib.Block = flag_block
+	} else if lib.Block == "" {
+		lib.Block = resolve_block_coordinate(bk)
+	}
+	return store, lib
+}
+
+// author_library returns --library or the default library, merged with its
+// latest copy on relays, when pk is its librarian; otherwise it prints why
+// not and returns nil.
+func author_library(ctx context.Context, relays []string, pk string) (*library.Store, *library.Library) {
+	store, err := library.Open()
+	if err != nil {
+		fmt.Printf("  ⚠️  %v\n", err)
+		return nil, nil
+	}
+	lib, err := store.Get(flag_library_id)
+	if err != nil {
+		fmt.Printf("  ⚠️  Not updating a library: %v\n\n", err)
+		return nil, nil
+	}
+	if lib.Pubkey != pk {
+		fmt.Printf("  ⚠️  Library %q belongs to another librarian; update it with `ketab library`\n\n", lib.Name)
+		return nil, nil
+	}
+	sync_library(ctx, relays, lib)
+	return store, lib
+}
+
+// record_library marks lib published by the accepted library event among
+// results, and saves the manifest.
+func record_library(results []*publisher.Result, store *library.Store, lib *library.Library) error {
+	for _, r := range results {
+		if r.Event.Kind == core.KindLibrary && r.Confirmed() {
+			lib.Published(r.Event)
+			return store.Save()
+		}
+	}
+	return nil
+}
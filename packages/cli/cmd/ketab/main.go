@@ -1,29 +1,46 @@
 package main
 
 import (
+	"bufio"
 	"context"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/bookfile"
 	"github.com/joinnextblock/ketab-protocol/cli/internal/events"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/fetch"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/keyring"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/ledger"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/library"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/publisher"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/signer"
 	"github.com/joinnextblock/ketab-protocol/cli/internal/types"
 	core "github.com/joinnextblock/ketab-protocol/go-core"
+	"github.com/joinnextblock/ketab-protocol/go-core/validation"
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/nbd-wtf/go-nostr/nip19"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 var (
-	flag_nsec          string
+	flag_signer        string
+	flag_profile       string
 	flag_chapters      string
 	flag_dry_run       bool
 	flag_relays        string
 	flag_ketabs_only   bool
+	flag_strict        bool
+	flag_block         string
+	flag_concurrency   int
+	flag_max_attempts  int
+	flag_resume        bool
 	flag_clean_metadata bool
 	// add-to-library flags
 	flag_library_id    string
@@ -31,6 +48,9 @@ var (
 	flag_rating        int
 	flag_status        string
 	flag_tags          string
+	// fetch/publish flags
+	flag_force         bool
+	flag_timeout       time.Duration
 )
 
 func main() {
@@ -43,20 +63,28 @@ func main() {
 	publish_cmd := &cobra.Command{
 		Use:   "publish <book-dir>",
 		Short: "Publish book events (ketabs, chapters, book, library) to relays",
-		Long:  "Publish book events to relays. Use --ketabs-only to skip chapters (30023) and only publish ketabs (38893), book (38891), and library (38890).",
+		Long:  "Publish book events to relays. Use --ketabs-only to skip chapters (30023) and only publish ketabs (38893), book (38891), and library (38890). Events some relays did not accept are queued; --resume sends them again.",
 		Args:  cobra.ExactArgs(1),
 		RunE:  run_publish,
 	}
-	publish_cmd.Flags().StringVar(&flag_nsec, "nsec", "", "Author nsec (or set KETAB_NSEC env)")
-	publish_cmd.Flags().StringVar(&flag_chapters, "chapters", "", "Comma-separated chapter numbers (default: all)")
+	publish_cmd.Flags().StringVar(&flag_profile, "profile", "", "Keyring profile to sign with (default: the author profile, see ketab keys use)")
+	publish_cmd.Flags().StringVar(&flag_signer, "signer", "", "Signer: keyring (default), bunker://<pubkey>?relay=..., keyfile:<ncryptsec-file> or env (or set KETAB_SIGNER)")
+	publish_cmd.Flags().StringVar(&flag_chapters, "chapters", "", "Comma-separated chapter numbers (default: all but unpublished ones; listing an unpublished chapter publishes it again)")
 	publish_cmd.Flags().BoolVar(&flag_dry_run, "dry-run", false, "Generate events without publishing")
 	publish_cmd.Flags().StringVar(&flag_relays, "relays", strings.Join(types.DefaultRelays, ","), "Comma-separated relay URLs")
 	publish_cmd.Flags().BoolVar(&flag_ketabs_only, "ketabs-only", false, "Publish only ketabs (38893), skip chapters (30023)")
+	publish_cmd.Flags().BoolVar(&flag_force, "force", false, "Re-emit every event, even if unchanged since the last publish")
+	publish_cmd.Flags().BoolVar(&flag_strict, "strict", false, "Abort if any event fails protocol validation (default: warn and publish)")
+	publish_cmd.Flags().IntVar(&flag_concurrency, "concurrency", publisher.DefaultConcurrency, "Maximum number of events in flight at once")
+	publish_cmd.Flags().IntVar(&flag_max_attempts, "max-attempts", publisher.DefaultRetryPolicy.MaxAttempts, "Tries per event per relay before giving up (1 disables retries)")
+	publish_cmd.Flags().BoolVar(&flag_resume, "resume", false, "Re-send the events a previous run left queued in <book-dir>/.ketab/queue.json")
+	publish_cmd.Flags().StringVar(&flag_block, "block", "", "City Protocol block coordinate for the library event (default: the library's, else book ref_block_id)")
+	publish_cmd.Flags().StringVar(&flag_library_id, "library", "", "Library d-tag to list the book in (default: the default library, see ketab library show)")
 
 	// validate
 	validate_cmd := &cobra.Command{
 		Use:   "validate <book-dir>",
-		Short: "Validate book directory structure",
+		Short: "Validate a book directory and the events it would publish",
 		Args:  cobra.ExactArgs(1),
 		RunE:  run_validate,
 	}
@@ -73,14 +101,17 @@ func main() {
 	delete_threads_cmd := &cobra.Command{
 		Use:   "delete-threads <book-dir>",
 		Short: "Delete discussion threads referenced in book metadata",
-		Long:  "Send NIP-09 deletion requests for discussion threads. Use --clean-metadata to also remove thread IDs from book metadata and republish.",
+		Long:  "Send NIP-09 deletion requests for the discussion threads recorded as discussion_id on chapters (an event id, nevent, naddr or <kind>:<pubkey>:<d-tag> coordinate). Addressable threads are deleted by `a` coordinate. Use --clean-metadata to also remove thread IDs from book metadata and republish.",
 		Args:  cobra.ExactArgs(1),
 		RunE:  run_delete_threads,
 	}
-	delete_threads_cmd.Flags().StringVar(&flag_nsec, "nsec", "", "Author nsec (or set KETAB_NSEC env)")
-	delete_threads_cmd.Flags().StringVar(&flag_chapters, "chapters", "", "Comma-separated chapter numbers (default: all)")
+	delete_threads_cmd.Flags().StringVar(&flag_profile, "profile", "", "Keyring profile to sign with (default: the author profile, see ketab keys use)")
+	delete_threads_cmd.Flags().StringVar(&flag_signer, "signer", "", "Signer: keyring (default), bunker://<pubkey>?relay=..., keyfile:<ncryptsec-file> or env (or set KETAB_SIGNER)")
+	delete_threads_cmd.Flags().StringVar(&flag_chapters, "chapters", "", "Comma-separated chapter numbers or d-tags (default: all)")
 	delete_threads_cmd.Flags().BoolVar(&flag_dry_run, "dry-run", false, "Show what would be deleted without sending deletion events")
 	delete_threads_cmd.Flags().StringVar(&flag_relays, "relays", strings.Join(types.DefaultRelays, ","), "Comma-separated relay URLs")
+	delete_threads_cmd.Flags().IntVar(&flag_concurrency, "concurrency", publisher.DefaultConcurrency, "Maximum number of events in flight at once")
+	delete_threads_cmd.Flags().IntVar(&flag_max_attempts, "max-attempts", publisher.DefaultRetryPolicy.MaxAttempts, "Tries per event per relay before giving up (1 disables retries)")
 	delete_threads_cmd.Flags().BoolVar(&flag_clean_metadata, "clean-metadata", false, "Remove discussion_id fields from metadata and republish book")
 
 	// add-to-library
@@ -91,88 +122,336 @@ func main() {
 		Args:  cobra.ExactArgs(1),
 		RunE:  run_add_to_library,
 	}
-	add_to_library_cmd.Flags().StringVar(&flag_nsec, "nsec", "", "Librarian's nsec (or set KETAB_NSEC env)")
-	add_to_library_cmd.Flags().StringVar(&flag_library_id, "library-id", "a5213b36-5ad4-41c0-93d4-06b2adddcea8", "Library UUID")
+	add_to_library_cmd.Flags().StringVar(&flag_profile, "profile", "", "Keyring profile to sign with (default: the librarian profile, see ketab keys use)")
+	add_to_library_cmd.Flags().StringVar(&flag_signer, "signer", "", "Signer: keyring (default), bunker://<pubkey>?relay=..., keyfile:<ncryptsec-file> or env (or set KETAB_SIGNER)")
+	add_to_library_cmd.Flags().StringVar(&flag_library_id, "library-id", "", "Library UUID (default: the default library, see ketab library show)")
 	add_to_library_cmd.Flags().StringVar(&flag_notes, "notes", "", "Personal notes about the book")
 	add_to_library_cmd.Flags().IntVar(&flag_rating, "rating", 0, "Rating 1-5 (optional)")
 	add_to_library_cmd.Flags().StringVar(&flag_status, "status", "reading", "Status: want-to-read, reading, finished, abandoned")
 	add_to_library_cmd.Flags().StringVar(&flag_tags, "tags", "", "Comma-separated tags")
 	add_to_library_cmd.Flags().StringVar(&flag_relays, "relays", strings.Join(types.DefaultRelays, ","), "Comma-separated relay URLs")
 	add_to_library_cmd.Flags().BoolVar(&flag_dry_run, "dry-run", false, "Generate event without publishing")
+	add_to_library_cmd.Flags().BoolVar(&flag_strict, "strict", false, "Abort if the event fails protocol validation (default: warn and publish)")
+
+	// fetch
+	fetch_cmd := &cobra.Command{
+		Use:   "fetch <book-naddr> <out-dir>",
+		Short: "Reconstruct a published book from relays into a local book directory",
+		Long:  "Follows the KETAB-01 discovery algorithm (book → chapters → ketabs by #a, sorted by index) and writes book.json plus one markdown file per ketab.",
+		Args:  cobra.ExactArgs(2),
+		RunE:  run_fetch,
+	}
+	fetch_cmd.Flags().StringVar(&flag_relays, "relays", strings.Join(types.DefaultRelays, ","), "Comma-separated relay URLs (in addition to the naddr relay hints)")
+	fetch_cmd.Flags().BoolVar(&flag_force, "force", false, "Overwrite an existing book.json in <out-dir>")
+	fetch_cmd.Flags().DurationVar(&flag_timeout, "timeout", 30*time.Second, "Overall timeout for relay queries")
 
-	root.AddCommand(publish_cmd, validate_cmd, status_cmd, delete_threads_cmd, add_to_library_cmd)
+	root.AddCommand(publish_cmd, validate_cmd, status_cmd, delete_threads_cmd, add_to_library_cmd, fetch_cmd, keys_command(), library_command(), unpublish_command(), engagement_command(), verify_command(), relay_command(), preview_command(), export_command(), import_command(), init_command(), add_command(), move_command(), split_command(), merge_command(), migrate_command(), schema_command())
 
 	if err := root.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
 
-func resolve_nsec() (string, error) {
-	if flag_nsec != "" {
-		return flag_nsec, nil
+// resolve_signer opens the signer selected with --signer (or KETAB_SIGNER):
+//
+//	(default)            the keyring profile from --profile, KETAB_PROFILE, or
+//	                     the one `ketab keys use` chose for role
+//	bunker://<pubkey>?…  a NIP-46 remote signer
+//	keyfile:<path>       a file holding a NIP-49 ncryptsec
+//	env                  a plaintext nsec in KETAB_NSEC, for automation only
+//
+// Passphrases are read from KETAB_PASSWORD or prompted for.
+func resolve_signer(ctx context.Context, role string) (signer.Signer, error) {
+	spec := flag_signer
+	if spec == "" {
+		spec = os.Getenv("KETAB_SIGNER")
 	}
-	if v := os.Getenv("KETAB_NSEC"); v != "" {
-		return v, nil
+	switch {
+	case spec == "" || spec == "keyring":
+		return unlock_profile(role)
+	case spec == "env":
+		nsec_str := os.Getenv("KETAB_NSEC")
+		if nsec_str == "" {
+			return nil, fmt.Errorf("--signer env: KETAB_NSEC is not set")
+		}
+		return signer.FromNsec(nsec_str)
+	case strings.HasPrefix(spec, "bunker://"):
+		fmt.Println("🔌 Connecting to remote signer...")
+		return signer.ConnectBunker(ctx, spec, func(auth_url string) {
+			fmt.Printf("🔑 Approve this session in your signer: %s\n", auth_url)
+		})
+	case strings.HasPrefix(spec, "keyfile:"):
+		path := strings.TrimPrefix(spec, "keyfile:")
+		password, err := read_password(fmt.Sprintf("🔒 Passphrase for %s: ", path))
+		if err != nil {
+			return nil, err
+		}
+		return signer.OpenKeyfile(path, password)
 	}
-	return "", fmt.Errorf("no nsec found — use --nsec flag or KETAB_NSEC env")
+	return nil, fmt.Errorf("unknown --signer %q (want keyring, bunker://..., keyfile:<path> or env)", spec)
 }
 
-func decode_nsec(nsec_str string) (string, string, error) {
-	prefix, data, err := nip19.Decode(nsec_str)
+// signer_configured reports whether a signer was chosen explicitly, by flag or env.
+func signer_configured() bool {
+	return flag_signer != "" || flag_profile != "" || os.Getenv("KETAB_SIGNER") != "" || os.Getenv("KETAB_PROFILE") != ""
+}
+
+// unlock_profile decrypts the keyring profile to sign with for role.
+func unlock_profile(role string) (signer.Signer, error) {
+	ring, err := keyring.Open()
+	if err != nil {
+		return nil, err
+	}
+	name := flag_profile
+	if name == "" {
+		name = os.Getenv("KETAB_PROFILE")
+	}
+	if name == "" {
+		name = ring.Profile(role)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no signing key — run `ketab keys generate %s` (or `ketab keys import %s`), or use --signer", role, role)
+	}
+	entry, err := ring.Get(name)
 	if err != nil {
-		return "", "", fmt.Errorf("invalid nsec: %w", err)
-	}
-	if prefix != "nsec" {
-		return "", "", fmt.Errorf("expected nsec, got %s", prefix)
-	}
-	// go-nostr nip19.Decode returns hex string for nsec
-	var sk string
-	switch v := data.(type) {
-	case string:
-		sk = v
-	case []byte:
-		sk = hex.EncodeToString(v)
-	default:
-		return "", "", fmt.Errorf("unexpected nsec data type: %T", data)
-	}
-	pk, err := nostr.GetPublicKey(sk)
+		return nil, err
+	}
+	password, err := read_password(fmt.Sprintf("🔒 Passphrase for key %q: ", name))
 	if err != nil {
-		return "", "", fmt.Errorf("failed to derive pubkey: %w", err)
+		return nil, err
+	}
+	return entry.Unlock(password)
+}
+
+// stdin is shared by every prompt, so that buffered input is not lost between them.
+var stdin = bufio.NewReader(os.Stdin)
+
+// read_password returns KETAB_PASSWORD, or prompts for a passphrase.
+func read_password(prompt string) (string, error) {
+	if v := os.Getenv("KETAB_PASSWORD"); v != "" {
+		return v, nil
 	}
-	return sk, pk, nil
+	return read_secret(prompt)
 }
 
-func publish_event(ctx context.Context, event *nostr.Event, relays []string) error {
-	for _, url := range relays {
-		relay, err := nostr.RelayConnect(ctx, url)
+// read_secret prompts for a secret on stdin. On a terminal it is not echoed.
+func read_secret(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		secret, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
 		if err != nil {
-			fmt.Printf("  ⚠️  %s: %v\n", url, err)
+			return "", fmt.Errorf("failed to read input: %w", err)
+		}
+		return string(secret), nil
+	}
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("no input on stdin: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// print_relay_results prints one line per relay for a published event.
+func print_relay_results(r *publisher.Result) {
+	for _, rr := range r.Relays {
+		switch rr.Status {
+		case publisher.StatusAccepted:
+			auth := ""
+			if rr.Authenticated {
+				auth = " 🔐"
+			}
+			fmt.Printf("  ✅ %s%s%s\n", rr.URL, auth, attempts_note(rr))
+		case publisher.StatusRejected:
+			fmt.Printf("  ❌ %s: rejected: %s%s\n", rr.URL, rr.Message, attempts_note(rr))
+		default:
+			fmt.Printf("  ⚠️  %s: %s%s\n", rr.URL, rr.Message, attempts_note(rr))
+		}
+		for _, n := range rr.Notices {
+			fmt.Printf("     NOTICE: %s\n", n)
+		}
+	}
+}
+
+// attempts_note returns " (after N attempts)" for results that needed retries.
+func attempts_note(rr *publisher.RelayResult) string {
+	if rr.Attempts <= 1 {
+		return ""
+	}
+	return fmt.Sprintf(" (after %d attempts)", rr.Attempts)
+}
+
+// queue_result queues an event for the relays that may still accept it on
+// --resume, or drops it from the queue when none are left.
+func queue_result(queue *ledger.Queue, section, label string, r *publisher.Result) {
+	item := &ledger.QueueItem{Section: section, Label: label, Event: r.Event}
+	for _, rr := range r.Relays {
+		if rr.Resumable() {
+			item.Relays = append(item.Relays, rr.URL)
+			item.LastError = rr.Message
+		}
+	}
+	if len(item.Relays) == 0 {
+		queue.Remove(r.Event)
+		return
+	}
+	queue.Put(item)
+}
+
+// print_queue_hint tells the user how to finish a partial publish.
+func print_queue_hint(queue *ledger.Queue, book_dir string) {
+	if queue.Len() > 0 {
+		fmt.Printf("⏸️  %d events queued for relays that did not accept them; run `ketab publish %s --resume` to retry\n", queue.Len(), book_dir)
+	}
+}
+
+// print_summary prints the confirmed/partial/failed counts of a publish run.
+func print_summary(summary publisher.Summary, unchanged int) {
+	fmt.Printf("🏁 Done: %d events published — %d confirmed by every relay, %d partially, %d failed", summary.Events, summary.Confirmed, summary.Partial, summary.Failed)
+	if unchanged > 0 {
+		fmt.Printf(", %d unchanged", unchanged)
+	}
+	fmt.Println()
+}
+
+// planned_event is an unsigned event queued for publishing.
+type planned_event struct {
+	section string // KETABS, CHAPTERS, BOOK, LIBRARY
+	label   string
+	event   nostr.Event
+}
+
+// build_plan builds the unsigned ketab, chapter and book events of a book, in
+// publishing order. Chapters missing on disk are reported and skipped.
+func build_plan(bk *book.Book, builder *events.Builder, chapter_nums []string) []planned_event {
+	var plan []planned_event
+
+	// 1. Ketabs
+	for _, ch_num := range chapter_nums {
+		ch, ok := bk.GetChapter(ch_num)
+		if !ok {
+			fmt.Printf("  ⚠️  Chapter %s not found on disk, skipping\n", ch_num)
 			continue
 		}
-		err = relay.Publish(ctx, *event)
-		relay.Close()
-		if err != nil {
-			fmt.Printf("  ⚠️  %s: %v\n", url, err)
-		} else {
-			fmt.Printf("  ✅ %s\n", url)
+		for _, ketab := range ch.Ketabs {
+			plan = append(plan, planned_event{
+				section: "KETABS",
+				label:   fmt.Sprintf("Ketab: ch%s #%d \"%s\"", ch_num, ketab.Item.Number, ketab.Item.Title),
+				event:   builder.BuildKetab(ch, ketab),
+			})
 		}
 	}
+
+	// 2. Chapters (skip if --ketabs-only)
+	if !flag_ketabs_only {
+		for _, ch_num := range chapter_nums {
+			ch, ok := bk.GetChapter(ch_num)
+			if !ok {
+				continue
+			}
+			plan = append(plan, planned_event{
+				section: "CHAPTERS",
+				label:   fmt.Sprintf("Chapter %s: \"%s\"", ch_num, ch.Metadata.ChapterTitle),
+				event:   builder.BuildChapter(bk, ch),
+			})
+		}
+	}
+
+	// 3. Book
+	plan = append(plan, planned_event{
+		section: "BOOK",
+		label:   fmt.Sprintf("Book: \"%s\"", bk.Metadata.BookTitle),
+		event:   builder.BuildBook(bk, chapter_nums),
+	})
+	return plan
+}
+
+// check_conformance runs every planned event through go-core validation.
+// Violations are printed; in --strict mode any error aborts before signing.
+func check_conformance(plan []planned_event) error {
+	fmt.Println("═══ CONFORMANCE ═══")
+	invalid := print_violations(plan)
+	if invalid == 0 {
+		fmt.Printf("  ✅ All %d events conform to the protocol\n\n", len(plan))
+		return nil
+	}
+	if flag_strict {
+		return fmt.Errorf("%d of %d events failed validation (--strict)", invalid, len(plan))
+	}
+	fmt.Printf("\n  ⚠️  %d of %d events failed validation; publishing anyway (use --strict to abort)\n\n", invalid, len(plan))
 	return nil
 }
 
+// print_violations prints each planned event's go-core violations with their
+// severity, code and location, and returns how many events have errors.
+func print_violations(plan []planned_event) int {
+	var invalid int
+	for i := range plan {
+		report := validation.CheckEvent(&plan[i].event)
+		if len(report.Violations) == 0 {
+			continue
+		}
+		if !report.Valid() {
+			invalid++
+		}
+		fmt.Printf("\n%s\n", plan[i].label)
+		for _, v := range report.Violations {
+			marker := "⚠️ "
+			if v.Severity == validation.SeverityError {
+				marker = "❌"
+			}
+			fmt.Printf("  %s %s\n", marker, v)
+		}
+	}
+	return invalid
+}
+
+// event_published_at returns the NIP-23 published_at of a chapter event (tag) or
+// book event (content field), or 0 for other kinds.
+func event_published_at(event *nostr.Event) int64 {
+	switch event.Kind {
+	case core.KindChapter:
+		if tag := event.Tags.Find("published_at"); tag != nil {
+			ts, _ := strconv.ParseInt(tag[1], 10, 64)
+			return ts
+		}
+	case core.KindBook:
+		var content struct {
+			PublishedAt int64 `json:"published_at"`
+		}
+		if json.Unmarshal([]byte(event.Content), &content) == nil {
+			return content.PublishedAt
+		}
+	}
+	return 0
+}
+
+// resolve_block_coordinate returns the City Protocol block coordinate for the library event,
+// from --block or the book's ref_block_id.
+func resolve_block_coordinate(bk *book.Book) string {
+	if flag_block != "" {
+		return flag_block
+	}
+	if strings.HasPrefix(bk.Metadata.RefBlockID, "38808:") {
+		return bk.Metadata.RefBlockID
+	}
+	return ""
+}
+
 func run_publish(cmd *cobra.Command, args []string) error {
 	book_dir := args[0]
 	relays := strings.Split(flag_relays, ",")
-
-	nsec_str, err := resolve_nsec()
-	if err != nil {
-		return err
+	if flag_resume {
+		return run_resume(book_dir)
 	}
 
-	sk, pk, err := decode_nsec(nsec_str)
+	ctx := context.Background()
+	sgn, err := resolve_signer(ctx, keyring.RoleAuthor)
 	if err != nil {
 		return err
 	}
+	defer sgn.Close()
+	pk := sgn.PublicKey()
 
 	fmt.Printf("📐 Pubkey: %s\n", pk)
 	fmt.Printf("📖 Loading book from %s\n\n", book_dir)
@@ -182,13 +461,24 @@ func run_publish(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to load book: %w", err)
 	}
 
+	state, err := ledger.Load(bk.Dir)
+	if err != nil {
+		return err
+	}
+	queue, err := ledger.LoadQueue(bk.Dir)
+	if err != nil {
+		return err
+	}
+
 	// Determine chapters
 	var chapter_nums []string
 	if flag_chapters != "" {
 		for _, c := range strings.Split(flag_chapters, ",") {
 			chapter_nums = append(chapter_nums, strings.TrimSpace(c))
 		}
-	} else {
+	}
+	omit_unpublished(bk, state, pk, chapter_nums)
+	if flag_chapters == "" {
 		chapter_nums = bk.GetChapterNumbers()
 	}
 
@@ -196,113 +486,294 @@ func run_publish(cmd *cobra.Command, args []string) error {
 	fmt.Printf("Dry run: %v\n\n", flag_dry_run)
 
 	builder := events.NewBuilder(pk, relays[0])
-	ctx := context.Background()
+	builder.PreservePublishedAt(state.PublishedAt())
+
+	// Build every event first so they can be validated before anything is signed.
+	plan := build_plan(bk, builder, chapter_nums)
+
+	// 4. Library, merged with its copy on relays so that the other books stay listed
+	store, lib := book_library(ctx, relays, pk, bk)
+	if lib != nil {
+		plan = append(plan, planned_event{
+			section: "LIBRARY",
+			label:   fmt.Sprintf("Library: \"%s\" (%d books)", lib.Name, len(lib.Books)),
+			event:   builder.BuildLibrary(lib, lib.Block),
+		})
+	}
 
-	var success, total int
+	for i := range plan {
+		plan[i].event.PubKey = pk
+	}
+	if err := check_conformance(plan); err != nil {
+		return err
+	}
 
-	// 1. Ketabs
-	fmt.Println("═══ KETABS ═══")
-	for _, ch_num := range chapter_nums {
-		ch, ok := bk.GetChapter(ch_num)
-		if !ok {
-			fmt.Printf("  ⚠️  Chapter %s not found on disk, skipping\n", ch_num)
+	pub := publisher.New(relays, publish_options(sgn))
+	defer pub.Close()
+
+	results, signed, unchanged, err := publish_plan(ctx, sgn, pub, plan, relays, state, queue)
+	if err != nil {
+		return err
+	}
+	if lib != nil {
+		if err := record_library(results, store, lib); err != nil {
+			return err
+		}
+	}
+
+	// Summary
+	if flag_dry_run {
+		fmt.Printf("🏁 Dry run: %d events signed, %d unchanged\n", signed, unchanged)
+	} else {
+		print_summary(publisher.Summarize(results), unchanged)
+		print_queue_hint(queue, book_dir)
+	}
+
+	// Print naddr
+	naddr, err := nip19.EncodeEntity(pk, 38891, bk.Metadata.BookUUID, relays)
+	if err == nil {
+		fmt.Printf("\n📚 naddr: %s\n", naddr)
+		fmt.Printf("   /book/%s\n", naddr)
+	}
+
+	return nil
+}
+
+// publish_plan signs and publishes planned events section by section (ketabs,
+// chapters, book, library), recording each result in the ledger and queuing
+// events some relays did not accept. Events unchanged since the last publish
+// and held by every relay are skipped, unless --force is given.
+func publish_plan(ctx context.Context, sgn signer.Signer, pub *publisher.Publisher, plan []planned_event, relays []string, state *ledger.Ledger, queue *ledger.Queue) (results []*publisher.Result, signed, unchanged int, err error) {
+	for _, section := range []string{"KETABS", "CHAPTERS", "BOOK", "LIBRARY"} {
+		if !plan_has_section(plan, section) && !(section == "CHAPTERS" && flag_ketabs_only) {
 			continue
 		}
-		for _, ketab := range ch.Ketabs {
-			event := builder.BuildKetab(ch, ketab)
-			event.PubKey = pk
-			if err := events.SignEvent(&event, sk); err != nil {
-				fmt.Printf("  ❌ Sign failed: %v\n", err)
-				continue
-			}
-			total++
-			fmt.Printf("\n📤 Ketab: ch%s #%d \"%s\" (id: %s)\n", ch_num, ketab.Item.Number, ketab.Item.Title, event.ID[:12])
-			if !flag_dry_run {
-				publish_event(ctx, &event, relays)
-			}
-			success++
+		fmt.Printf("═══ %s ═══\n", section)
+		if section == "CHAPTERS" && flag_ketabs_only {
+			fmt.Println("  🚫 Skipped (--ketabs-only mode)")
+			fmt.Println()
+			continue
 		}
-	}
 
-	// 2. Chapters (skip if --ketabs-only)
-	if !flag_ketabs_only {
-		fmt.Println("\n═══ CHAPTERS ═══")
-		for _, ch_num := range chapter_nums {
-			ch, ok := bk.GetChapter(ch_num)
-			if !ok {
+		// Sign the section's events, skipping those whose content is unchanged and
+		// already accepted by every relay. When some relays are still missing one,
+		// re-sign with the recorded created_at: the event ID is then identical to
+		// the one the other relays hold.
+		var jobs []publisher.Job
+		labels := make(map[string]string)
+		for i := range plan {
+			p := &plan[i]
+			if p.section != section {
 				continue
 			}
-			event := builder.BuildChapter(bk, ch)
-			event.PubKey = pk
-			if err := events.SignEvent(&event, sk); err != nil {
+			targets := relays
+			entry := state.Get(&p.event)
+			if !flag_force && entry.Unchanged(&p.event) && entry.DeletedAt == 0 {
+				targets = entry.PendingRelays(relays)
+				if len(targets) == 0 {
+					fmt.Printf("  ⏭️  %s unchanged (id: %s)\n", p.label, entry.EventID[:12])
+					unchanged++
+					continue
+				}
+				p.event.CreatedAt = nostr.Timestamp(entry.CreatedAt)
+			}
+			if err := sgn.Sign(ctx, &p.event); err != nil {
+				if section == "BOOK" || section == "LIBRARY" {
+					return results, signed, unchanged, fmt.Errorf("sign %s failed: %w", strings.ToLower(section), err)
+				}
 				fmt.Printf("  ❌ Sign failed: %v\n", err)
 				continue
 			}
-			total++
-			fmt.Printf("\n📤 Chapter %s: \"%s\" (id: %s)\n", ch_num, ch.Metadata.ChapterTitle, event.ID[:12])
-			if !flag_dry_run {
-				publish_event(ctx, &event, relays)
+			signed++
+			labels[p.event.ID] = p.label
+			if len(targets) < len(relays) {
+				labels[p.event.ID] += fmt.Sprintf(" — retrying %d relay(s)", len(targets))
+			}
+			if flag_dry_run {
+				fmt.Printf("\n📤 %s (id: %s)\n", p.label, p.event.ID[:12])
+				continue
 			}
-			success++
+			jobs = append(jobs, publisher.Job{Event: &p.event, Relays: targets})
 		}
-	} else {
-		fmt.Println("\n═══ CHAPTERS ═══")
-		fmt.Println("  🚫 Skipped (--ketabs-only mode)")
+
+		// Publish the section concurrently; sections stay sequential so that
+		// chapters, books and libraries only reference events already sent.
+		var save_err error
+		section_results := pub.PublishBatch(ctx, jobs, func(r *publisher.Result) {
+			fmt.Printf("\n📤 %s (id: %s)\n", labels[r.Event.ID], r.Event.ID[:12])
+			print_relay_results(r)
+			state.Record(r.Event, event_published_at(r.Event), r.Errors())
+			queue_result(queue, section, labels[r.Event.ID], r)
+			if err := state.Save(); err != nil && save_err == nil {
+				save_err = err
+			}
+			if err := queue.Save(); err != nil && save_err == nil {
+				save_err = err
+			}
+		})
+		if save_err != nil {
+			return results, signed, unchanged, save_err
+		}
+		results = append(results, section_results...)
+		fmt.Println()
 	}
+	return results, signed, unchanged, nil
+}
 
-	// 3. Book
-	fmt.Println("\n═══ BOOK ═══")
-	book_event := builder.BuildBook(bk, chapter_nums)
-	book_event.PubKey = pk
-	if err := events.SignEvent(&book_event, sk); err != nil {
-		return fmt.Errorf("sign book failed: %w", err)
-	}
-	total++
-	fmt.Printf("\n📤 Book: \"%s\" (id: %s)\n", bk.Metadata.BookTitle, book_event.ID[:12])
-	if !flag_dry_run {
-		publish_event(ctx, &book_event, relays)
+// plan_has_section reports whether plan has events in section.
+func plan_has_section(plan []planned_event, section string) bool {
+	for _, p := range plan {
+		if p.section == section {
+			return true
+		}
 	}
-	success++
+	return false
+}
 
-	// 4. Library
-	fmt.Println("\n═══ LIBRARY ═══")
-	library_id := "a5213b36-5ad4-41c0-93d4-06b2adddcea8"
-	library_event := builder.BuildLibrary(bk, library_id, "the library")
-	library_event.PubKey = pk
-	if err := events.SignEvent(&library_event, sk); err != nil {
-		return fmt.Errorf("sign library failed: %w", err)
+// publish_options returns the publisher options from the command-line flags.
+// Relays that require NIP-42 AUTH are answered with sgn; a nil sgn disables AUTH.
+func publish_options(sgn signer.Signer) publisher.Options {
+	retry := publisher.DefaultRetryPolicy
+	if flag_max_attempts > 0 {
+		retry.MaxAttempts = flag_max_attempts
 	}
-	total++
-	fmt.Printf("\n📤 Library (id: %s)\n", library_event.ID[:12])
-	if !flag_dry_run {
-		publish_event(ctx, &library_event, relays)
+	return publisher.Options{Concurrency: flag_concurrency, Retry: retry, Auth: auth_signer(sgn)}
+}
+
+// auth_signer returns a signer for NIP-42 AUTH events, or nil for a nil sgn.
+func auth_signer(sgn signer.Signer) func(*nostr.Event) error {
+	if sgn == nil {
+		return nil
 	}
-	success++
+	return func(event *nostr.Event) error {
+		return sgn.Sign(context.Background(), event)
+	}
+}
 
-	// Summary
-	fmt.Printf("\n🏁 Done: %d/%d events published\n", success, total)
+// run_resume re-sends the signed events queued by an earlier publish to the
+// relays that have not accepted them, section by section. No key is needed:
+// the events are already signed.
+func run_resume(book_dir string) error {
+	queue, err := ledger.LoadQueue(book_dir)
+	if err != nil {
+		return err
+	}
+	if queue.Len() == 0 {
+		fmt.Println("✅ Nothing to resume: every event was accepted")
+		return nil
+	}
+	state, err := ledger.Load(book_dir)
+	if err != nil {
+		return err
+	}
 
-	// Print naddr
-	naddr, err := nip19.EncodeEntity(pk, 38891, bk.Metadata.BookUUID, relays)
-	if err == nil {
-		fmt.Printf("\n📚 naddr: %s\n", naddr)
-		fmt.Printf("   /book/%s\n", naddr)
+	fmt.Printf("⏯️  Resuming %d queued events from %s\n\n", queue.Len(), ledger.QueuePath(book_dir))
+	if flag_dry_run {
+		for _, item := range queue.Items {
+			fmt.Printf("📤 %s (id: %s) → %s\n", item.Label, item.Event.ID[:12], strings.Join(item.Relays, ", "))
+		}
+		return nil
+	}
+
+	// The events are already signed; a signer, when one is configured, only
+	// answers AUTH challenges.
+	ctx := context.Background()
+	var sgn signer.Signer
+	if signer_configured() {
+		if sgn, err = resolve_signer(ctx, keyring.RoleAuthor); err != nil {
+			return err
+		}
+		defer sgn.Close()
+	}
+
+	// Every job names its relays, so the publisher needs no default set.
+	pub := publisher.New(nil, publish_options(sgn))
+	defer pub.Close()
+
+	items := append([]*ledger.QueueItem(nil), queue.Items...)
+	var results []*publisher.Result
+	for _, section := range []string{"KETABS", "CHAPTERS", "BOOK", "LIBRARY"} {
+		var jobs []publisher.Job
+		labels := make(map[string]string)
+		for _, item := range items {
+			if item.Section != section {
+				continue
+			}
+			if !item.Event.CheckID() {
+				fmt.Printf("  ❌ %s: queued event has a bad id, dropping it\n", item.Label)
+				queue.Remove(item.Event)
+				continue
+			}
+			labels[item.Event.ID] = item.Label
+			jobs = append(jobs, publisher.Job{Event: item.Event, Relays: item.Relays})
+		}
+		if len(jobs) == 0 {
+			continue
+		}
+		fmt.Printf("═══ %s ═══\n", section)
+		var save_err error
+		section_results := pub.PublishBatch(ctx, jobs, func(r *publisher.Result) {
+			fmt.Printf("\n📤 %s (id: %s)\n", labels[r.Event.ID], r.Event.ID[:12])
+			print_relay_results(r)
+			state.Record(r.Event, event_published_at(r.Event), r.Errors())
+			queue_result(queue, section, labels[r.Event.ID], r)
+			if err := state.Save(); err != nil && save_err == nil {
+				save_err = err
+			}
+			if err := queue.Save(); err != nil && save_err == nil {
+				save_err = err
+			}
+		})
+		if save_err != nil {
+			return save_err
+		}
+		results = append(results, section_results...)
+		fmt.Println()
+	}
+	if err := queue.Save(); err != nil {
+		return err
 	}
 
+	print_summary(publisher.Summarize(results), 0)
+	print_queue_hint(queue, book_dir)
 	return nil
 }
 
+// validate_pubkey stands in for the author's key in the events ketab validate
+// builds: they are checked but never signed, so no signer is needed.
+var validate_pubkey = strings.Repeat("0", 64)
+
 func run_validate(cmd *cobra.Command, args []string) error {
 	errors := book.Validate(args[0])
-	if len(errors) == 0 {
-		fmt.Println("✅ Book directory is valid")
-		return nil
+	_, single_err := os.Stat(filepath.Join(args[0], "book.json"))
+	_, legacy_err := os.Stat(filepath.Join(args[0], "book-metadata.json"))
+	if os.IsNotExist(single_err) && legacy_err == nil {
+		fmt.Printf("💡 Legacy format: convert it to book.json with ketab migrate %s\n", args[0])
 	}
-	fmt.Printf("❌ %d issues found:\n", len(errors))
-	for _, e := range errors {
-		fmt.Printf("  - %s\n", e)
+	if len(errors) > 0 {
+		fmt.Printf("❌ %d issues found:\n", len(errors))
+		for _, e := range errors {
+			fmt.Printf("  - %s\n", e)
+		}
+		return fmt.Errorf("%d validation errors", len(errors))
+	}
+
+	// Build the events publish would build and check them against the protocol.
+	bk, err := book.Load(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load book: %w", err)
 	}
-	return fmt.Errorf("%d validation errors", len(errors))
+	builder := events.NewBuilder(validate_pubkey, types.DefaultRelays[0])
+	plan := build_plan(bk, builder, bk.GetChapterNumbers())
+	for i := range plan {
+		plan[i].event.PubKey = validate_pubkey
+	}
+	if invalid := print_violations(plan); invalid > 0 {
+		fmt.Printf("\n❌ %d of %d events do not conform to the protocol\n", invalid, len(plan))
+		return fmt.Errorf("%d of %d events failed validation", invalid, len(plan))
+	}
+	fmt.Printf("✅ Book directory is valid (%d events conform to the protocol)\n", len(plan))
+	return nil
 }
 
 func run_status(cmd *cobra.Command, args []string) error {
@@ -337,239 +808,148 @@ func run_delete_threads(cmd *cobra.Command, args []string) error {
 	book_dir := args[0]
 	relays := strings.Split(flag_relays, ",")
 
-	nsec_str, err := resolve_nsec()
-	if err != nil {
-		return err
-	}
-
-	sk, pk, err := decode_nsec(nsec_str)
+	ctx := context.Background()
+	sgn, err := resolve_signer(ctx, keyring.RoleAuthor)
 	if err != nil {
 		return err
 	}
+	defer sgn.Close()
+	pk := sgn.PublicKey()
 
 	fmt.Printf("📐 Pubkey: %s\n", pk)
 	fmt.Printf("📖 Loading book from %s\n\n", book_dir)
 
-	// Load book metadata
-	book_file := filepath.Join(book_dir, "book.json")
-	book_data, err := os.ReadFile(book_file)
+	bk, err := book.Load(book_dir)
 	if err != nil {
-		return fmt.Errorf("failed to read book.json: %w", err)
-	}
-
-	var book_metadata map[string]interface{}
-	if err := json.Unmarshal(book_data, &book_metadata); err != nil {
-		return fmt.Errorf("failed to parse book.json: %w", err)
-	}
-
-	// Extract discussion IDs
-	discussion_ids := make(map[string]string) // chapter_number -> discussion_id
-	
-	// Try to extract from "shape" field first (new format)
-	if shape, ok := book_metadata["shape"].([]interface{}); ok {
-		for _, act_interface := range shape {
-			if act, ok := act_interface.([]interface{}); ok {
-				for _, chapter_interface := range act {
-					if chapter, ok := chapter_interface.(map[string]interface{}); ok {
-						if discussion_id, ok := chapter["discussion_id"].(string); ok && discussion_id != "" {
-							// Need to derive chapter number from d_tag or title
-							if title, ok := chapter["title"].(string); ok {
-								// This is a simplified mapping - in a real implementation you'd need better logic
-								chapter_num := derive_chapter_number_from_title(title)
-								if chapter_num != "" {
-									discussion_ids[chapter_num] = discussion_id
-								}
-							}
-						}
-					}
-				}
-			}
-		}
-	}
-
-	// Also try "acts" field (legacy format)
-	if acts, ok := book_metadata["acts"].([]interface{}); ok {
-		for _, act_interface := range acts {
-			if act, ok := act_interface.(map[string]interface{}); ok {
-				if chapters, ok := act["chapters"].([]interface{}); ok {
-					for _, chapter_interface := range chapters {
-						if chapter, ok := chapter_interface.(map[string]interface{}); ok {
-							if discussion_id, ok := chapter["discussion_id"].(string); ok && discussion_id != "" {
-								if number, ok := chapter["number"].(string); ok {
-									discussion_ids[number] = discussion_id
-								}
-							}
-						}
-					}
-				}
-			}
-		}
+		return fmt.Errorf("failed to load book: %w", err)
 	}
 
-	if len(discussion_ids) == 0 {
+	threads := bk.Threads()
+	if len(threads) == 0 {
 		fmt.Println("No discussion threads found in book metadata")
 		return nil
 	}
 
-	// Filter by chapters if specified
-	var target_chapters []string
+	// Filter by chapters (numbers or d-tags) if specified
 	if flag_chapters != "" {
-		target_chapters = strings.Split(flag_chapters, ",")
-		for i, ch := range target_chapters {
-			target_chapters[i] = strings.TrimSpace(ch)
+		wanted := make(map[string]bool)
+		for _, ch := range strings.Split(flag_chapters, ",") {
+			wanted[strings.TrimSpace(ch)] = true
 		}
-	} else {
-		for ch := range discussion_ids {
-			target_chapters = append(target_chapters, ch)
+		var selected []book.Thread
+		for _, t := range threads {
+			if wanted[t.ChapterNumber] || wanted[t.ChapterUUID] {
+				selected = append(selected, t)
+				delete(wanted, t.ChapterNumber)
+				delete(wanted, t.ChapterUUID)
+			}
 		}
+		for ch := range wanted {
+			fmt.Printf("⚠️  Chapter %s: no discussion thread found\n", ch)
+		}
+		threads = selected
 	}
 
-	fmt.Printf("Found discussion threads for chapters: %v\n", target_chapters)
+	var chapter_nums []string
+	for _, t := range threads {
+		chapter_nums = append(chapter_nums, t.ChapterNumber)
+	}
+	fmt.Printf("Found discussion threads for chapters: %v\n", chapter_nums)
 	fmt.Printf("Dry run: %v\n\n", flag_dry_run)
 
-	// Delete discussion threads
+	// Delete discussion threads: one NIP-09 request per thread, by `e` id or,
+	// for addressable threads, by `a` coordinate.
 	fmt.Println("═══ DELETING THREADS ═══")
-	ctx := context.Background()
-	var deleted_count int
-
-	for _, ch_num := range target_chapters {
-		discussion_id, exists := discussion_ids[ch_num]
-		if !exists {
-			fmt.Printf("⚠️  Chapter %s: no discussion thread found\n", ch_num)
+	builder := events.NewBuilder(pk, relays[0])
+	var jobs []publisher.Job
+	thread_of := make(map[string]book.Thread) // deletion event id -> thread
+	var deleted []book.Thread
+	for _, t := range threads {
+		target, err := events.ParseDeletionTarget(t.Ref)
+		if err != nil {
+			fmt.Printf("\n⚠️  Chapter %s: %v\n", t.ChapterNumber, err)
 			continue
 		}
+		fmt.Printf("\n🗑️  Chapter %s \"%s\": %s\n", t.ChapterNumber, t.ChapterTitle, target)
+		if author := target.Pubkey(); author != "" && author != pk {
+			fmt.Printf("  ⚠️  Thread belongs to %s; relays only honor deletions by the author\n", author)
+		}
 
-		fmt.Printf("\n🗑️  Chapter %s: %s\n", ch_num, discussion_id[:12]+"...")
-		
 		if flag_dry_run {
 			fmt.Printf("  [DRY RUN] Would send deletion event\n")
-			deleted_count++
+			deleted = append(deleted, t)
 			continue
 		}
 
-		// Create NIP-09 deletion event
-		deletion_event := nostr.Event{
-			Kind:      5, // NIP-09 Event Deletion
-			CreatedAt: nostr.Now(),
-			Tags: nostr.Tags{
-				{"e", discussion_id},
-			},
-			Content: "Deleting discussion thread - superseded by improved version",
-		}
+		deletion_event := builder.BuildDeletion([]events.DeletionTarget{target}, "Deleting discussion thread - superseded by improved version")
 		deletion_event.PubKey = pk
-
-		if err := events.SignEvent(&deletion_event, sk); err != nil {
+		if err := sgn.Sign(ctx, &deletion_event); err != nil {
 			fmt.Printf("  ❌ Sign failed: %v\n", err)
 			continue
 		}
+		thread_of[deletion_event.ID] = t
+		jobs = append(jobs, publisher.Job{Event: &deletion_event})
+	}
 
-		// Publish to relays
-		for _, url := range relays {
-			relay, err := nostr.RelayConnect(ctx, url)
-			if err != nil {
-				fmt.Printf("  ⚠️  %s: %v\n", url, err)
-				continue
-			}
-			err = relay.Publish(ctx, deletion_event)
-			relay.Close()
-			if err != nil {
-				fmt.Printf("  ⚠️  %s: %v\n", url, err)
-			} else {
-				fmt.Printf("  ✅ %s\n", url)
-			}
+	pub := publisher.New(relays, publish_options(sgn))
+	defer pub.Close()
+	pub.PublishBatch(ctx, jobs, func(r *publisher.Result) {
+		t := thread_of[r.Event.ID]
+		fmt.Printf("\n📤 Deletion: chapter %s (id: %s)\n", t.ChapterNumber, r.Event.ID[:12])
+		print_relay_results(r)
+		if r.Confirmed() {
+			deleted = append(deleted, t)
 		}
-		deleted_count++
-	}
+	})
 
-	fmt.Printf("\n🏁 Deletion requests sent for %d threads\n", deleted_count)
+	fmt.Printf("\n🏁 Deletion requests accepted for %d threads\n", len(deleted))
 
-	// Clean metadata if requested
-	if flag_clean_metadata {
+	// Clean metadata if requested, for the threads whose deletion was accepted
+	if flag_clean_metadata && len(deleted) > 0 {
 		fmt.Println("\n═══ CLEANING METADATA ═══")
-		
-		// Remove discussion_id fields from the specified chapters
-		cleaned := false
-		
-		// Clean "shape" field
-		if shape, ok := book_metadata["shape"].([]interface{}); ok {
-			for _, act_interface := range shape {
-				if act, ok := act_interface.([]interface{}); ok {
-					for _, chapter_interface := range act {
-						if chapter, ok := chapter_interface.(map[string]interface{}); ok {
-							if title, ok := chapter["title"].(string); ok {
-								chapter_num := derive_chapter_number_from_title(title)
-								for _, target_ch := range target_chapters {
-									if chapter_num == target_ch {
-										delete(chapter, "discussion_id")
-										cleaned = true
-									}
-								}
-							}
-						}
-					}
-				}
+		if flag_dry_run {
+			fmt.Println("✅ [DRY RUN] Would clean metadata, removing discussion_id fields")
+			fmt.Println("✅ [DRY RUN] Would republish book with cleaned metadata")
+		} else {
+			files, err := bookfile.RemoveThreads(bk.Dir, deleted)
+			if err != nil {
+				return err
 			}
-		}
+			fmt.Printf("✅ Metadata cleaned, discussion_id fields removed from %s\n", strings.Join(files, ", "))
 
-		// Clean "acts" field
-		if acts, ok := book_metadata["acts"].([]interface{}); ok {
-			for _, act_interface := range acts {
-				if act, ok := act_interface.(map[string]interface{}); ok {
-					if chapters, ok := act["chapters"].([]interface{}); ok {
-						for _, chapter_interface := range chapters {
-							if chapter, ok := chapter_interface.(map[string]interface{}); ok {
-								if number, ok := chapter["number"].(string); ok {
-									for _, target_ch := range target_chapters {
-										if number == target_ch {
-											delete(chapter, "discussion_id")
-											cleaned = true
-										}
-									}
-								}
-							}
-						}
-					}
-				}
+			// Republish the book as ketab publish would: keeping its first
+			// publish time and recording it in the ledger
+			fmt.Println()
+			bk, err := book.Load(book_dir)
+			if err != nil {
+				return fmt.Errorf("failed to reload book: %w", err)
 			}
-		}
-
-		if cleaned {
-			if flag_dry_run {
-				fmt.Println("✅ [DRY RUN] Would clean metadata, removing discussion_id fields")
-				fmt.Println("✅ [DRY RUN] Would republish book with cleaned metadata")
-			} else {
-				// Write updated metadata
-				updated_data, err := json.MarshalIndent(book_metadata, "", "  ")
-				if err != nil {
-					return fmt.Errorf("failed to marshal updated metadata: %w", err)
-				}
-
-				if err := os.WriteFile(book_file, updated_data, 0644); err != nil {
-					return fmt.Errorf("failed to write updated book.json: %w", err)
-				}
-
-				fmt.Println("✅ Metadata cleaned, discussion_id fields removed")
-
-				// Republish book
-				fmt.Println("\n═══ REPUBLISHING BOOK ═══")
-				
-				bk, err := book.Load(book_dir)
-				if err != nil {
-					return fmt.Errorf("failed to reload book: %w", err)
-				}
-
-				builder := events.NewBuilder(pk, relays[0])
-				book_event := builder.BuildBook(bk, bk.GetChapterNumbers())
-				book_event.PubKey = pk
-				if err := events.SignEvent(&book_event, sk); err != nil {
-					return fmt.Errorf("sign book failed: %w", err)
-				}
-
-				fmt.Printf("\n📤 Book: \"%s\" (id: %s)\n", bk.Metadata.BookTitle, book_event.ID[:12])
-				publish_event(ctx, &book_event, relays)
-
-				fmt.Println("✅ Book republished with cleaned metadata")
+			state, err := ledger.Load(bk.Dir)
+			if err != nil {
+				return err
+			}
+			queue, err := ledger.LoadQueue(bk.Dir)
+			if err != nil {
+				return err
+			}
+			builder.PreservePublishedAt(state.PublishedAt())
+			omit_unpublished(bk, state, pk, nil)
+
+			plan := []planned_event{{
+				section: "BOOK",
+				label:   fmt.Sprintf("Book: \"%s\"", bk.Metadata.BookTitle),
+				event:   builder.BuildBook(bk, bk.GetChapterNumbers()),
+			}}
+			plan[0].event.PubKey = pk
+			if err := check_conformance(plan); err != nil {
+				return err
+			}
+			results, _, unchanged, err := publish_plan(ctx, sgn, pub, plan, relays, state, queue)
+			if err != nil {
+				return err
 			}
+			print_summary(publisher.Summarize(results), unchanged)
+			print_queue_hint(queue, book_dir)
 		}
 	}
 
@@ -578,40 +958,29 @@ func run_delete_threads(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-// Helper function to derive chapter number from title
-// This is a simplified implementation - you might want to make this more robust
-func derive_chapter_number_from_title(title string) string {
-	chapter_map := map[string]string{
-		"21 Sats":                     "01",
-		"Shittier Twitter":            "02", 
-		"Permission Granted":          "03",
-		"Can't Steal What's Free":     "04",
-		"Obviously, I Checked":        "04", // Alternative title
-		"Congrats on Fifteen Years":   "05",
-		"GM ☕":                       "06",
-		"My Muse":                     "07",
-		"Tick Tock":                   "08",
-	}
-	
-	if num, ok := chapter_map[title]; ok {
-		return num
-	}
-	return ""
-}
-
 func run_add_to_library(cmd *cobra.Command, args []string) error {
 	book_naddr := args[0]
 	relays := strings.Split(flag_relays, ",")
 
-	// Resolve nsec
-	nsec_str, err := resolve_nsec()
+	// Resolve signer
+	ctx := context.Background()
+	sgn, err := resolve_signer(ctx, keyring.RoleLibrarian)
 	if err != nil {
 		return err
 	}
+	defer sgn.Close()
+	pk := sgn.PublicKey()
 
-	sk, pk, err := decode_nsec(nsec_str)
-	if err != nil {
-		return err
+	if flag_library_id == "" {
+		store, err := library.Open()
+		if err != nil {
+			return err
+		}
+		lib, err := store.Get("")
+		if err != nil {
+			return fmt.Errorf("%w, or pass --library-id", err)
+		}
+		flag_library_id = lib.D
 	}
 
 	fmt.Printf("📐 Librarian pubkey: %s\n", pk)
@@ -688,24 +1057,35 @@ func run_add_to_library(cmd *cobra.Command, args []string) error {
 			{"d", d_tag},
 			{"a", book_coordinate},
 			{"a", library_coordinate},
+			{"p", pk},
+			{"p", book_author_pubkey},
 		},
 		Content: string(content_json),
 		PubKey:  pk,
 	}
 
+	if err := check_conformance([]planned_event{{section: "LIBRARY ENTRY", label: "Library Entry", event: library_entry_event}}); err != nil {
+		return err
+	}
+
 	// Sign the event
-	if err := events.SignEvent(&library_entry_event, sk); err != nil {
+	if err := sgn.Sign(ctx, &library_entry_event); err != nil {
 		return fmt.Errorf("sign library entry failed: %w", err)
 	}
 
 	fmt.Println("═══ LIBRARY ENTRY ═══")
 	fmt.Printf("\n📤 Library Entry: book \"%s\" → library %s (id: %s)\n", 
-		book_d_tag[:12]+"...", flag_library_id[:8]+"...", library_entry_event.ID[:12])
+		book_d_tag, flag_library_id, library_entry_event.ID[:12])
 
 	// Publish event
 	if !flag_dry_run {
-		ctx := context.Background()
-		publish_event(ctx, &library_entry_event, relays)
+		pub := publisher.New(relays, publisher.Options{Auth: auth_signer(sgn)})
+		defer pub.Close()
+		result := pub.Publish(ctx, &library_entry_event, nil)
+		print_relay_results(result)
+		if !result.Confirmed() {
+			return fmt.Errorf("library entry was not accepted by any relay")
+		}
 	} else {
 		fmt.Println("  [DRY RUN] Event would be published")
 	}
@@ -719,3 +1099,53 @@ func run_add_to_library(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+func run_fetch(cmd *cobra.Command, args []string) error {
+	book_naddr, out_dir := args[0], args[1]
+	relays := strings.Split(flag_relays, ",")
+
+	pointer, err := fetch.DecodeBookNaddr(book_naddr)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("📖 Fetching book %s\n", pointer.Identifier)
+	fmt.Printf("   Author: %s\n\n", pointer.PublicKey)
+
+	ctx, cancel := context.WithTimeout(context.Background(), flag_timeout)
+	defer cancel()
+	pool := nostr.NewSimplePool(ctx)
+	defer pool.Close("fetch done")
+
+	bk, err := fetch.FetchBook(ctx, pool, relays, pointer)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("📚 %s\n", bk.Content.Title)
+	var total int
+	for _, act := range bk.Acts {
+		fmt.Printf("\n═══ %s ═══\n", act.Title)
+		for _, ch := range act.Chapters {
+			marker := "✅"
+			if ch.Event == nil || len(ch.Ketabs) == 0 {
+				marker = "⚠️"
+			}
+			fmt.Printf("  %s %s (%d ketabs)\n", marker, ch.Title, len(ch.Ketabs))
+			if ch.Event == nil {
+				fmt.Printf("       chapter event (30023) not found\n")
+			}
+			if len(ch.Ketabs) == 0 {
+				fmt.Printf("       no ketabs found\n")
+			}
+			total += len(ch.Ketabs)
+		}
+	}
+
+	if _, err := fetch.WriteBookDir(bk, out_dir, flag_force); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n🏁 Wrote %d chapters and %d ketabs to %s\n", len(bk.Chapters()), total, out_dir)
+	return nil
+}
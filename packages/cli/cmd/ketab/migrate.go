@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// migrate flags
+	flag_remove_legacy bool
+)
+
+// migrate_command builds the `ketab migrate` command.
+func migrate_command() *cobra.Command {
+	migrate_cmd := &cobra.Command{
+		Use:   "migrate <book-dir>",
+		Short: "Convert a legacy book directory (book-metadata.json, chapter-metadata.json) to book.json",
+		Long: "Writes a book.json holding what book-metadata.json, book-shape.json and each chapter's chapter-metadata.json held: " +
+			"UUIDs, scene numbers, tags, published_at and discussion ids. Ketab files stay where they are. " +
+			"The book is loaded both ways and any difference is reported. --dry-run prints the diff without writing anything.",
+		Args: cobra.ExactArgs(1),
+		RunE: run_migrate,
+	}
+	migrate_cmd.Flags().BoolVar(&flag_dry_run, "dry-run", false, "Show the book.json that would be written and the files it replaces")
+	migrate_cmd.Flags().BoolVar(&flag_remove_legacy, "remove-legacy", false, "Delete the legacy metadata files once book.json is written")
+	return migrate_cmd
+}
+
+func run_migrate(cmd *cobra.Command, args []string) error {
+	m, err := book.Migrate(args[0])
+	if err != nil {
+		return err
+	}
+	data, err := m.JSON()
+	if err != nil {
+		return err
+	}
+
+	var chapters, ketabs int
+	for _, act := range m.Single.Acts {
+		chapters += len(act.Chapters)
+		for _, ch := range act.Chapters {
+			ketabs += len(ch.Ketabs)
+		}
+	}
+	fmt.Printf("📖 Migrating \"%s\" (%d chapters, %d ketabs)\n", m.Single.Title, chapters, ketabs)
+
+	if flag_dry_run {
+		fmt.Println()
+		for _, name := range m.Legacy {
+			fmt.Printf("--- %s\n", name)
+			if flag_remove_legacy {
+				for _, line := range file_lines(filepath.Join(m.Dir, filepath.FromSlash(name))) {
+					fmt.Printf("-%s\n", line)
+				}
+			}
+		}
+		fmt.Println("+++ book.json")
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			fmt.Printf("+%s\n", line)
+		}
+		fmt.Println()
+	}
+
+	if len(m.Notes) == 0 {
+		fmt.Println("✅ Lossless: the book loads the same from book.json")
+	} else {
+		fmt.Printf("⚠️  %d differences from the legacy files:\n", len(m.Notes))
+		for _, n := range m.Notes {
+			fmt.Printf("  - %s\n", n)
+		}
+	}
+
+	if flag_dry_run {
+		fmt.Println("\n🔍 Dry run: nothing written")
+		return nil
+	}
+	if err := m.Write(flag_remove_legacy); err != nil {
+		return err
+	}
+	fmt.Printf("\n🏁 Wrote %s\n", filepath.Join(args[0], "book.json"))
+	if flag_remove_legacy {
+		fmt.Printf("   Removed %s\n", strings.Join(m.Legacy, ", "))
+	} else {
+		fmt.Println("   The legacy files are kept but no longer read; remove them with --remove-legacy or by hand")
+	}
+	return nil
+}
+
+// file_lines returns a file's lines, or none if it cannot be read.
+func file_lines(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/preview"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// preview flags
+	flag_preview_listen string
+)
+
+// preview_command builds the `ketab preview` command.
+func preview_command() *cobra.Command {
+	preview_cmd := &cobra.Command{
+		Use:   "preview <book-dir>",
+		Short: "Serve a local web reader for a book directory",
+		Long: "Renders the book as it would be published: the cover and acts → chapters table of contents, " +
+			"then each chapter with its ketabs in order, footnotes from the sources section after `---`, " +
+			"and prev/next navigation. Open pages reload when files in the book directory change.",
+		Args: cobra.ExactArgs(1),
+		RunE: run_preview,
+	}
+	preview_cmd.Flags().StringVar(&flag_preview_listen, "listen", "127.0.0.1:8080", "Address to listen on")
+	return preview_cmd
+}
+
+func run_preview(cmd *cobra.Command, args []string) error {
+	// Fail early on a book that cannot be loaded at all
+	bk, err := book.Load(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load book: %w", err)
+	}
+
+	server, err := preview.New(bk.Dir)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", flag_preview_listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", flag_preview_listen, err)
+	}
+	http_server := &http.Server{Handler: server}
+
+	fmt.Printf("📖 Previewing \"%s\" (%d chapters)\n", bk.Metadata.BookTitle, len(bk.Chapters))
+	fmt.Printf("🌐 Open http://%s\n", listener.Addr())
+	fmt.Println("   Pages reload when files change. Press Ctrl+C to stop.")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go server.Watch(ctx.Done())
+	errs := make(chan error, 1)
+	go func() { errs <- http_server.Serve(listener) }()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	case <-ctx.Done():
+		// Open reload streams never finish on their own
+		shutdown, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := http_server.Shutdown(shutdown); err != nil {
+			http_server.Close()
+		}
+	}
+	fmt.Println("\n🏁 Preview stopped")
+	return nil
+}
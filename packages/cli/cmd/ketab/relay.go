@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/relay"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/signer"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// relay flags
+	flag_listen     string
+	flag_relay_data string
+	flag_memory     bool
+	flag_quiet      bool
+	flag_relay_auth bool
+)
+
+// relay_command builds the `ketab relay` command group.
+func relay_command() *cobra.Command {
+	relay_cmd := &cobra.Command{
+		Use:   "relay",
+		Short: "Run a local relay for offline development",
+	}
+
+	serve_cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run a minimal Nostr relay in-process",
+		Long: "Serves NIP-01 over websocket with replaceable and addressable event semantics, NIP-09 deletions and tag filters. " +
+			"Events are kept in a JSON-lines file (compacted on start) unless --memory is set. " +
+			"Point any command at it with --relays ws://<listen-address>. " +
+			"With --auth it asks for NIP-42 AUTH before accepting events, as many public relays do.",
+		Args: cobra.NoArgs,
+		RunE: run_relay_serve,
+	}
+	serve_cmd.Flags().StringVar(&flag_listen, "listen", "127.0.0.1:7777", "Address to listen on")
+	serve_cmd.Flags().StringVar(&flag_relay_data, "data", "", "Event file (default: relay/events.jsonl in the ketab config directory)")
+	serve_cmd.Flags().BoolVar(&flag_memory, "memory", false, "Keep events in memory only")
+	serve_cmd.Flags().BoolVar(&flag_quiet, "quiet", false, "Do not log accepted events")
+	serve_cmd.Flags().BoolVar(&flag_relay_auth, "auth", false, "Require NIP-42 AUTH before accepting events")
+
+	relay_cmd.AddCommand(serve_cmd)
+	return relay_cmd
+}
+
+func run_relay_serve(cmd *cobra.Command, args []string) error {
+	path := flag_relay_data
+	if flag_memory {
+		path = ""
+	} else if path == "" {
+		dir, err := signer.ConfigDir()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(dir, "relay", "events.jsonl")
+	}
+
+	store, err := relay.Open(path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	rl := relay.New(store)
+	rl.RequireAuth = flag_relay_auth
+	if !flag_quiet {
+		rl.OnEvent = func(event *nostr.Event) {
+			label := fmt.Sprintf("kind %d", event.Kind)
+			if d := event.Tags.GetD(); d != "" {
+				label += " " + d
+			}
+			fmt.Printf("  📥 %s (id: %s)\n", label, event.ID[:12])
+		}
+	}
+
+	listener, err := net.Listen("tcp", flag_listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", flag_listen, err)
+	}
+	server := &http.Server{Handler: rl}
+
+	if path == "" {
+		fmt.Println("🗄️  Storage: memory only")
+	} else {
+		fmt.Printf("🗄️  Storage: %s (%d events)\n", path, store.Len())
+	}
+	fmt.Printf("🛰️  Relay listening on ws://%s\n", listener.Addr())
+	if flag_relay_auth {
+		fmt.Println("🔐 NIP-42 AUTH required to publish")
+	}
+	fmt.Printf("   Try: ketab publish <book-dir> --relays ws://%s\n\n", listener.Addr())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errs := make(chan error, 1)
+	go func() { errs <- server.Serve(listener) }()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	case <-ctx.Done():
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}
+	fmt.Printf("\n🏁 Relay stopped (%d events stored)\n", store.Len())
+	return nil
+}
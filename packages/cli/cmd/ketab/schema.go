@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/bookfile"
+	"github.com/spf13/cobra"
+)
+
+// schema_file is the name ketab schema gives the schema inside a book
+// directory.
+const schema_file = "book.schema.json"
+
+// schema_command builds the `ketab schema` command.
+func schema_command() *cobra.Command {
+	schema_cmd := &cobra.Command{
+		Use:   "schema [book-dir]",
+		Short: "Print the JSON Schema of book.json, or link it into a book directory",
+		Long: fmt.Sprintf("Prints the JSON Schema (version %d) that book.json files are checked against, so editors can "+
+			"autocomplete and check them. Given a book directory, writes the schema to %s there and points the book.json's "+
+			"$schema field at it.", book.SchemaVersion, schema_file),
+		Args: cobra.MaximumNArgs(1),
+		RunE: run_schema,
+	}
+	schema_cmd.Flags().StringVarP(&flag_output, "output", "o", "", "Write the schema to a file instead of stdout")
+	return schema_cmd
+}
+
+func run_schema(cmd *cobra.Command, args []string) error {
+	data, err := book.SchemaJSON()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		if flag_output == "" {
+			_, err := os.Stdout.Write(data)
+			return err
+		}
+		if err := os.WriteFile(flag_output, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", flag_output, err)
+		}
+		fmt.Printf("✅ Wrote the book.json schema (%s) to %s\n", book.SchemaID, flag_output)
+		return nil
+	}
+
+	f, err := bookfile.Open(args[0])
+	if err != nil {
+		return err
+	}
+	out := flag_output
+	if out == "" {
+		out = filepath.Join(f.Dir, schema_file)
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", out, err)
+	}
+	ref, err := filepath.Rel(f.Dir, out)
+	if err != nil {
+		ref = out
+	}
+	f.Book.Schema = filepath.ToSlash(ref)
+	if err := f.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Wrote %s and set \"$schema\": %q in book.json\n", filepath.Join(args[0], filepath.Base(out)), f.Book.Schema)
+	return nil
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/events"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/fetch"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/keyring"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/ledger"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/library"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/publisher"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/types"
+	core "github.com/joinnextblock/ketab-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/spf13/cobra"
+)
+
+// relay_lookup_timeout bounds looking up on relays the event ids the ledger
+// does not have.
+const relay_lookup_timeout = 15 * time.Second
+
+// deletion_batch is the number of events one deletion request covers.
+const deletion_batch = 50
+
+var (
+	// unpublish flags
+	flag_unpublish_ketabs string
+)
+
+// unpublish_command builds the `ketab unpublish` command.
+func unpublish_command() *cobra.Command {
+	unpublish_cmd := &cobra.Command{
+		Use:   "unpublish <book-dir>",
+		Short: "Send NIP-09 deletion requests for a book, or some of its chapters or ketabs",
+		Long: "Without --chapters or --ketabs the whole book is retracted: its ketabs, chapters, book event and library entries are deleted and the book is removed from your library. " +
+			"Otherwise only the given chapters (with their ketabs) or ketabs are deleted, and the remaining chapters and book are republished without them; " +
+			"ketabs after a deleted one are renumbered and republished with their new index. " +
+			"Deletion requests name each event both by id (`e`) and by coordinate (`a`); ids come from the publish ledger, else from relays. " +
+			"Unpublished chapters and ketabs stay out of `ketab publish` until a chapter is listed with --chapters.",
+		Args: cobra.ExactArgs(1),
+		RunE: run_unpublish,
+	}
+	unpublish_cmd.Flags().StringVar(&flag_profile, "profile", "", "Keyring profile to sign with (default: the author profile, see ketab keys use)")
+	unpublish_cmd.Flags().StringVar(&flag_signer, "signer", "", "Signer: keyring (default), bunker://<pubkey>?relay=..., keyfile:<ncryptsec-file> or env (or set KETAB_SIGNER)")
+	unpublish_cmd.Flags().StringVar(&flag_chapters, "chapters", "", "Comma-separated chapter numbers or d-tags to unpublish, with their ketabs")
+	unpublish_cmd.Flags().StringVar(&flag_unpublish_ketabs, "ketabs", "", "Comma-separated ketab d-tags (UUIDs) to unpublish")
+	unpublish_cmd.Flags().BoolVar(&flag_dry_run, "dry-run", false, "Show the deletion requests and republished events without sending anything")
+	unpublish_cmd.Flags().StringVar(&flag_relays, "relays", strings.Join(types.DefaultRelays, ","), "Comma-separated relay URLs")
+	unpublish_cmd.Flags().StringVar(&flag_library_id, "library", "", "Library to remove a retracted book from (default: the default library)")
+	unpublish_cmd.Flags().IntVar(&flag_concurrency, "concurrency", publisher.DefaultConcurrency, "Maximum number of events in flight at once")
+	unpublish_cmd.Flags().IntVar(&flag_max_attempts, "max-attempts", publisher.DefaultRetryPolicy.MaxAttempts, "Tries per event per relay before giving up (1 disables retries)")
+	unpublish_cmd.Flags().BoolVar(&flag_strict, "strict", false, "Abort if a republished event fails protocol validation (default: warn and publish)")
+	return unpublish_cmd
+}
+
+// unpublish_target is an event to delete.
+type unpublish_target struct {
+	label  string
+	target events.DeletionTarget
+	d_tag  string
+}
+
+func run_unpublish(cmd *cobra.Command, args []string) error {
+	book_dir := args[0]
+	relays := strings.Split(flag_relays, ",")
+
+	ctx := context.Background()
+	sgn, err := resolve_signer(ctx, keyring.RoleAuthor)
+	if err != nil {
+		return err
+	}
+	defer sgn.Close()
+	pk := sgn.PublicKey()
+
+	fmt.Printf("📐 Pubkey: %s\n", pk)
+	fmt.Printf("📖 Loading book from %s\n\n", book_dir)
+
+	bk, err := book.Load(book_dir)
+	if err != nil {
+		return fmt.Errorf("failed to load book: %w", err)
+	}
+	state, err := ledger.Load(bk.Dir)
+	if err != nil {
+		return err
+	}
+	queue, err := ledger.LoadQueue(bk.Dir)
+	if err != nil {
+		return err
+	}
+
+	// Select what to delete
+	whole := flag_chapters == "" && flag_unpublish_ketabs == ""
+	omit_chapters := make(map[string]bool)
+	omit_ketabs := make(map[string]bool)
+	var targets []unpublish_target
+	add := func(label string, kind int, d_tag string) {
+		coord := fmt.Sprintf("%d:%s:%s", kind, pk, d_tag)
+		targets = append(targets, unpublish_target{
+			label:  label,
+			target: events.DeletionTarget{Coordinate: coord, Kind: kind},
+			d_tag:  d_tag,
+		})
+	}
+	add_chapter := func(ch_ref types.ChapterRef) {
+		if ch, ok := bk.GetChapter(ch_ref.ChapterNumber); ok {
+			for _, k := range ch.Ketabs {
+				add(fmt.Sprintf("Ketab: ch%s #%d \"%s\"", ch_ref.ChapterNumber, k.Item.Number, k.Item.Title), core.KindKetab, k.Item.UUID)
+			}
+		}
+		add(fmt.Sprintf("Chapter %s: \"%s\"", ch_ref.ChapterNumber, ch_ref.ChapterTitle), core.KindChapter, ch_ref.ChapterUUID)
+		omit_chapters[ch_ref.ChapterUUID] = true
+	}
+
+	if whole {
+		for _, ch_ref := range bk.Metadata.GetAllChapters() {
+			add_chapter(ch_ref)
+		}
+		add(fmt.Sprintf("Book: \"%s\"", bk.Metadata.BookTitle), core.KindBook, bk.Metadata.BookUUID)
+	}
+	if flag_chapters != "" {
+		for _, c := range strings.Split(flag_chapters, ",") {
+			c = strings.TrimSpace(c)
+			found := false
+			for _, ch_ref := range bk.Metadata.GetAllChapters() {
+				if ch_ref.ChapterNumber == c || ch_ref.ChapterUUID == c {
+					add_chapter(ch_ref)
+					found = true
+				}
+			}
+			if !found {
+				return fmt.Errorf("chapter %s is not in %s", c, bk.Dir)
+			}
+		}
+	}
+	if flag_unpublish_ketabs != "" {
+		for _, uuid := range strings.Split(flag_unpublish_ketabs, ",") {
+			uuid = strings.TrimSpace(uuid)
+			label := fmt.Sprintf("Ketab: %s", uuid)
+			for _, ch := range bk.Chapters {
+				for _, k := range ch.Ketabs {
+					if k.Item.UUID == uuid {
+						label = fmt.Sprintf("Ketab: ch%s #%d \"%s\"", ch.Number, k.Item.Number, k.Item.Title)
+					}
+				}
+			}
+			if !omit_ketabs[uuid] {
+				add(label, core.KindKetab, uuid)
+				omit_ketabs[uuid] = true
+			}
+		}
+	}
+
+	// Event ids: from the ledger, else from relays
+	resolve_event_ids(ctx, relays, pk, state, targets)
+	if whole {
+		targets = append(targets, library_entry_targets(ctx, relays, pk, fmt.Sprintf("%d:%s:%s", core.KindBook, pk, bk.Metadata.BookUUID))...)
+	}
+
+	fmt.Printf("Unpublishing %d events\n", len(targets))
+	fmt.Printf("Dry run: %v\n\n", flag_dry_run)
+
+	// Send the deletion requests
+	fmt.Println("═══ DELETIONS ═══")
+	for _, t := range targets {
+		id := "no event id — deleting by coordinate only"
+		if t.target.ID != "" {
+			id = "id: " + t.target.ID[:12]
+		}
+		fmt.Printf("  🗑️  %s (%s)\n", t.label, id)
+	}
+
+	builder := events.NewBuilder(pk, relays[0])
+	builder.PreservePublishedAt(state.PublishedAt())
+	pub := publisher.New(relays, publish_options(sgn))
+	defer pub.Close()
+
+	var jobs []publisher.Job
+	batch_of := make(map[string][]unpublish_target) // deletion event id -> targets
+	for start := 0; start < len(targets); start += deletion_batch {
+		batch := targets[start:min(start+deletion_batch, len(targets))]
+		var batch_targets []events.DeletionTarget
+		for _, t := range batch {
+			batch_targets = append(batch_targets, t.target)
+		}
+		deletion := builder.BuildDeletion(batch_targets, fmt.Sprintf("Unpublished from \"%s\"", bk.Metadata.BookTitle))
+		deletion.PubKey = pk
+		if err := sgn.Sign(ctx, &deletion); err != nil {
+			return fmt.Errorf("sign deletion failed: %w", err)
+		}
+		batch_of[deletion.ID] = batch
+		if flag_dry_run {
+			fmt.Printf("\n📤 Deletion request: %d events (id: %s)\n", len(batch), deletion.ID[:12])
+			continue
+		}
+		jobs = append(jobs, publisher.Job{Event: &deletion})
+	}
+
+	var deleted int
+	var save_err error
+	deletion_results := pub.PublishBatch(ctx, jobs, func(r *publisher.Result) {
+		batch := batch_of[r.Event.ID]
+		fmt.Printf("\n📤 Deletion request: %d events (id: %s)\n", len(batch), r.Event.ID[:12])
+		print_relay_results(r)
+		if !r.Confirmed() {
+			return
+		}
+		coords := make(map[string]bool)
+		for _, t := range batch {
+			state.MarkDeleted(t.target.Coordinate, t.target.Kind, t.d_tag, r.Event)
+			coords[t.target.Coordinate] = true
+		}
+		queue.RemoveCoordinates(coords)
+		deleted += len(batch)
+		if err := state.Save(); err != nil && save_err == nil {
+			save_err = err
+		}
+		if err := queue.Save(); err != nil && save_err == nil {
+			save_err = err
+		}
+	})
+	if save_err != nil {
+		return save_err
+	}
+	fmt.Println()
+	if !flag_dry_run && deleted < len(targets) {
+		print_summary(publisher.Summarize(deletion_results), 0)
+		return fmt.Errorf("%d of %d deletions were not accepted by any relay; nothing was republished", len(targets)-deleted, len(targets))
+	}
+
+	// Republish the structure without the removed items
+	var plan []planned_event
+	var store *library.Store
+	var lib *library.Library
+	if whole {
+		store, lib = author_library(ctx, relays, pk)
+		book_coord := fmt.Sprintf("%d:%s:%s", core.KindBook, pk, bk.Metadata.BookUUID)
+		if lib != nil && lib.Index(book_coord) >= 0 {
+			lib.RemoveBook(book_coord)
+			plan = append(plan, planned_event{
+				section: "LIBRARY",
+				label:   fmt.Sprintf("Library: \"%s\" (%d books)", lib.Name, len(lib.Books)),
+				event:   builder.BuildLibrary(lib, lib.Block),
+			})
+		} else {
+			lib = nil
+		}
+	} else {
+		numbers := make(map[string]int) // ketab d-tag -> number before omitting
+		for _, ch := range bk.Chapters {
+			for _, k := range ch.Ketabs {
+				numbers[k.Item.UUID] = k.Item.Number
+			}
+		}
+		bk.Omit(omit_chapters, omit_ketabs)
+		omit_unpublished(bk, state, pk, nil)
+		for _, ch_num := range bk.GetChapterNumbers() {
+			ch, _ := bk.GetChapter(ch_num)
+			// Ketabs after a removed one move up; republish them with their
+			// new index
+			for _, k := range ch.Ketabs {
+				if numbers[k.Item.UUID] != k.Item.Number {
+					plan = append(plan, planned_event{
+						section: "KETABS",
+						label:   fmt.Sprintf("Ketab: ch%s #%d \"%s\" (was #%d)", ch_num, k.Item.Number, k.Item.Title, numbers[k.Item.UUID]),
+						event:   builder.BuildKetab(ch, k),
+					})
+				}
+			}
+			plan = append(plan, planned_event{
+				section: "CHAPTERS",
+				label:   fmt.Sprintf("Chapter %s: \"%s\"", ch_num, ch.Metadata.ChapterTitle),
+				event:   builder.BuildChapter(bk, ch),
+			})
+		}
+		plan = append(plan, planned_event{
+			section: "BOOK",
+			label:   fmt.Sprintf("Book: \"%s\"", bk.Metadata.BookTitle),
+			event:   builder.BuildBook(bk, bk.GetChapterNumbers()),
+		})
+	}
+	if len(plan) == 0 {
+		fmt.Printf("🏁 Unpublished %d events\n", len(targets))
+		return nil
+	}
+
+	for i := range plan {
+		plan[i].event.PubKey = pk
+	}
+	if err := check_conformance(plan); err != nil {
+		return err
+	}
+	results, signed, unchanged, err := publish_plan(ctx, sgn, pub, plan, relays, state, queue)
+	if err != nil {
+		return err
+	}
+	if lib != nil {
+		if err := record_library(results, store, lib); err != nil {
+			return err
+		}
+	}
+
+	if flag_dry_run {
+		fmt.Printf("🏁 Dry run: %d deletion requests for %d events, %d events to republish, %d unchanged\n", len(batch_of), len(targets), signed, unchanged)
+		return nil
+	}
+	fmt.Printf("🏁 Unpublished %d events\n", len(targets))
+	print_summary(publisher.Summarize(results), unchanged)
+	print_queue_hint(queue, book_dir)
+	fmt.Println("\nNote: Event deletion is not guaranteed - some relays may ignore deletion requests")
+	return nil
+}
+
+// resolve_event_ids fills in the ids of targets from the ledger, and looks up
+// on relays those the ledger has no live entry for.
+func resolve_event_ids(ctx context.Context, relays []string, pk string, state *ledger.Ledger, targets []unpublish_target) {
+	missing := make(map[int][]string) // kind -> d-tags
+	for i := range targets {
+		t := &targets[i]
+		if entry := state.Entries[t.target.Coordinate]; entry != nil && entry.EventID != "" && entry.DeletedAt == 0 {
+			t.target.ID = entry.EventID
+			continue
+		}
+		missing[t.target.Kind] = append(missing[t.target.Kind], t.d_tag)
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	fmt.Println("🔎 Looking up events missing from the ledger on relays...")
+	ctx, cancel := context.WithTimeout(ctx, relay_lookup_timeout)
+	defer cancel()
+	pool := nostr.NewSimplePool(ctx)
+	defer pool.Close("lookup done")
+	for kind, d_tags := range missing {
+		found := fetch.FetchLatest(ctx, pool, relays, nostr.Filter{
+			Kinds:   []int{kind},
+			Authors: []string{pk},
+			Tags:    nostr.TagMap{"d": d_tags},
+		})
+		for i := range targets {
+			t := &targets[i]
+			if event, ok := found[t.d_tag]; ok && t.target.Kind == kind && t.target.ID == "" {
+				t.target.ID = event.ID
+			}
+		}
+	}
+}
+
+// library_entry_targets returns the library entries (kind 38892) pk published
+// for a book.
+func library_entry_targets(ctx context.Context, relays []string, pk, book_coord string) []unpublish_target {
+	ctx, cancel := context.WithTimeout(ctx, relay_lookup_timeout)
+	defer cancel()
+	pool := nostr.NewSimplePool(ctx)
+	defer pool.Close("lookup done")
+
+	var targets []unpublish_target
+	found := fetch.FetchLatest(ctx, pool, relays, nostr.Filter{
+		Kinds:   []int{core.KindLibraryEntry},
+		Authors: []string{pk},
+		Tags:    nostr.TagMap{"a": []string{book_coord}},
+	})
+	for d_tag, event := range found {
+		targets = append(targets, unpublish_target{
+			label: "Library entry",
+			target: events.DeletionTarget{
+				ID:         event.ID,
+				Coordinate: fmt.Sprintf("%d:%s:%s", core.KindLibraryEntry, pk, d_tag),
+				Kind:       core.KindLibraryEntry,
+			},
+			d_tag: d_tag,
+		})
+	}
+	return targets
+}
+
+// omit_unpublished removes from bk the chapters and ketabs a previous
+// `ketab unpublish` deleted, except the chapters in keep (and their ketabs),
+// which are being published again. Nothing is omitted once the whole book was
+// unpublished: publishing it again brings it back complete.
+func omit_unpublished(bk *book.Book, state *ledger.Ledger, pk string, keep []string) {
+	deleted := state.Deleted()
+	if deleted[fmt.Sprintf("%d:%s:%s", core.KindBook, pk, bk.Metadata.BookUUID)] {
+		return
+	}
+	kept := make(map[string]bool)
+	for _, c := range keep {
+		kept[c] = true
+	}
+
+	chapters := make(map[string]bool)
+	ketabs := make(map[string]bool)
+	for _, ch_ref := range bk.Metadata.GetAllChapters() {
+		if kept[ch_ref.ChapterNumber] || kept[ch_ref.ChapterUUID] {
+			continue
+		}
+		if deleted[fmt.Sprintf("%d:%s:%s", core.KindChapter, pk, ch_ref.ChapterUUID)] {
+			chapters[ch_ref.ChapterUUID] = true
+		}
+		if ch, ok := bk.GetChapter(ch_ref.ChapterNumber); ok {
+			for _, k := range ch.Ketabs {
+				if deleted[fmt.Sprintf("%d:%s:%s", core.KindKetab, pk, k.Item.UUID)] {
+					ketabs[k.Item.UUID] = true
+				}
+			}
+		}
+	}
+	if len(chapters) == 0 && len(ketabs) == 0 {
+		return
+	}
+	fmt.Printf("⏭️  Leaving out %d unpublished chapters and %d unpublished ketabs (list a chapter in --chapters to publish it again)\n\n", len(chapters), len(ketabs))
+	bk.Omit(chapters, ketabs)
+}
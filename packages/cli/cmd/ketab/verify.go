@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/fetch"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/keyring"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/publisher"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/types"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/spf13/cobra"
+)
+
+// verify_diff_lines caps the diff lines printed per drifted chapter.
+const verify_diff_lines = 40
+
+var (
+	// verify flags
+	flag_fix bool
+)
+
+// verify_command builds the `ketab verify` command.
+func verify_command() *cobra.Command {
+	verify_cmd := &cobra.Command{
+		Use:   "verify <book-naddr>",
+		Short: "Check that published chapters match their ketabs",
+		Long: "Fetches the book, its chapters (30023) and ketabs (38893), recompiles each chapter from its ketabs and compares it with the published chapter (the compiled-view rule of PROTOCOL.md). " +
+			"Reports missing and unlisted ketabs, ketabs by another author, index gaps and duplicates, and text drift. " +
+			"With --fix, chapters that drifted are recompiled, signed and republished; chapters with missing ketabs are only fixed with --force.",
+		Args: cobra.ExactArgs(1),
+		RunE: run_verify,
+	}
+	verify_cmd.Flags().StringVar(&flag_relays, "relays", strings.Join(types.DefaultRelays, ","), "Comma-separated relay URLs (in addition to the naddr relay hints)")
+	verify_cmd.Flags().DurationVar(&flag_timeout, "timeout", 30*time.Second, "Overall timeout for relay queries")
+	verify_cmd.Flags().BoolVar(&flag_fix, "fix", false, "Republish the chapters that do not match their ketabs")
+	verify_cmd.Flags().BoolVar(&flag_force, "force", false, "With --fix, also republish chapters with missing ketabs (dropping them from the chapter)")
+	verify_cmd.Flags().BoolVar(&flag_dry_run, "dry-run", false, "With --fix, show the recompiled chapters without publishing")
+	verify_cmd.Flags().StringVar(&flag_profile, "profile", "", "Keyring profile to sign with (default: the author profile, see ketab keys use)")
+	verify_cmd.Flags().StringVar(&flag_signer, "signer", "", "Signer: keyring (default), bunker://<pubkey>?relay=..., keyfile:<ncryptsec-file> or env (or set KETAB_SIGNER)")
+	verify_cmd.Flags().IntVar(&flag_max_attempts, "max-attempts", publisher.DefaultRetryPolicy.MaxAttempts, "Tries per event per relay before giving up (1 disables retries)")
+	return verify_cmd
+}
+
+func run_verify(cmd *cobra.Command, args []string) error {
+	pointer, err := fetch.DecodeBookNaddr(args[0])
+	if err != nil {
+		return err
+	}
+	relays := fetch.MergeRelays(pointer.Relays, strings.Split(flag_relays, ","))
+
+	ctx, cancel := context.WithTimeout(context.Background(), flag_timeout)
+	defer cancel()
+	pool := nostr.NewSimplePool(ctx)
+	defer pool.Close("verify done")
+
+	fmt.Printf("📖 Fetching book %s\n", pointer.Identifier)
+	fmt.Printf("   Author: %s\n\n", pointer.PublicKey)
+	bk, err := fetch.FetchBook(ctx, pool, relays, pointer)
+	if err != nil {
+		return err
+	}
+	checks := fetch.Verify(ctx, pool, relays, bk)
+
+	fmt.Printf("📚 %s\n", bk.Content.Title)
+	var failed []*fetch.ChapterCheck
+	for _, check := range checks {
+		ch := check.Chapter
+		if check.OK() {
+			fmt.Printf("  ✅ %s (%d ketabs)\n", ch.Title, len(ch.Ketabs))
+			continue
+		}
+		failed = append(failed, check)
+		fmt.Printf("  ❌ %s (%d ketabs)\n", ch.Title, len(ch.Ketabs))
+		for _, issue := range check.Issues {
+			fmt.Printf("       [%s] %s\n", issue.Code, issue.Message)
+		}
+		for i, line := range check.Diff {
+			if i == verify_diff_lines {
+				fmt.Printf("       … %d more diff lines\n", len(check.Diff)-i)
+				break
+			}
+			fmt.Printf("       %s\n", line)
+		}
+	}
+
+	if len(failed) == 0 {
+		fmt.Printf("\n🏁 All %d chapters match their ketabs\n", len(checks))
+		return nil
+	}
+	if !flag_fix {
+		fmt.Printf("\n❌ %d of %d chapters have issues (run with --fix to republish them)\n", len(failed), len(checks))
+		return fmt.Errorf("%d chapters failed verification", len(failed))
+	}
+	return fix_chapters(bk, failed, relays)
+}
+
+// fix_chapters recompiles and republishes the chapters of failed that
+// republishing can fix.
+func fix_chapters(bk *fetch.Book, failed []*fetch.ChapterCheck, relays []string) error {
+	ctx := context.Background()
+	sgn, err := resolve_signer(ctx, keyring.RoleAuthor)
+	if err != nil {
+		return err
+	}
+	defer sgn.Close()
+	if sgn.PublicKey() != bk.Pointer.PublicKey {
+		return fmt.Errorf("--fix must be signed by the book author %s, not %s", bk.Pointer.PublicKey, sgn.PublicKey())
+	}
+
+	var plan []planned_event
+	skipped := 0
+	for _, check := range failed {
+		ch := check.Chapter
+		// Index and authorship issues are in the ketabs; republishing the
+		// chapter only fixes its content and ketab list.
+		if !check.Has(fetch.IssueDrift) && !check.Has(fetch.IssueUnlistedKetab) &&
+			!check.Has(fetch.IssueMissingChapter) && !check.Has(fetch.IssueMissingKetab) {
+			fmt.Printf("  ⚠️  %s: republishing the chapter cannot fix its issues\n", ch.Title)
+			skipped++
+			continue
+		}
+		if check.Has(fetch.IssueMissingKetab) && !flag_force {
+			fmt.Printf("  ⚠️  %s: ketabs are missing, not republishing (use --force to drop them)\n", ch.Title)
+			skipped++
+			continue
+		}
+		if len(ch.Ketabs) == 0 {
+			fmt.Printf("  ⚠️  %s: no ketabs found, not republishing an empty chapter\n", ch.Title)
+			skipped++
+			continue
+		}
+		plan = append(plan, planned_event{
+			section: "CHAPTERS",
+			label:   fmt.Sprintf("Chapter: \"%s\"", ch.Title),
+			event:   bk.RecompiledChapter(ch, relays[0]),
+		})
+	}
+	if len(plan) == 0 {
+		return fmt.Errorf("no chapter could be fixed (%d skipped)", skipped)
+	}
+	if err := check_conformance(plan); err != nil {
+		return err
+	}
+
+	fmt.Println("\n═══ CHAPTERS ═══")
+	var jobs []publisher.Job
+	for i := range plan {
+		p := &plan[i]
+		if err := sgn.Sign(ctx, &p.event); err != nil {
+			return fmt.Errorf("sign %s failed: %w", p.label, err)
+		}
+		fmt.Printf("\n📤 %s (id: %s)\n", p.label, p.event.ID[:12])
+		if flag_dry_run {
+			fmt.Println("  [DRY RUN] Event would be published")
+			continue
+		}
+		jobs = append(jobs, publisher.Job{Event: &p.event})
+	}
+	if flag_dry_run {
+		return nil
+	}
+
+	pub := publisher.New(relays, publish_options(sgn))
+	defer pub.Close()
+	results := pub.PublishBatch(ctx, jobs, nil)
+	confirmed := 0
+	for i, r := range results {
+		fmt.Printf("\n%s\n", plan[i].label)
+		print_relay_results(r)
+		if r.Confirmed() {
+			confirmed++
+		}
+	}
+	fmt.Printf("\n🏁 Republished %d of %d chapters (%d skipped)\n", confirmed, len(plan), skipped)
+	if confirmed < len(plan) {
+		return fmt.Errorf("%d chapters were not accepted by any relay", len(plan)-confirmed)
+	}
+	return nil
+}
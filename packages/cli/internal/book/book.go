@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/joinnextblock/ketab-protocol/cli/internal/types"
+	"github.com/joinnextblock/ketab-protocol/go-core/footnotes"
 )
 
 // Book represents a loaded book directory.
@@ -33,6 +34,8 @@ type Chapter struct {
 type Ketab struct {
 	Item types.KetabItem
 	Body string // Markdown content with scene headers stripped
+	Path string // The ketab file
+	Line int    // The line of the file Body starts on
 }
 
 // Load loads a book from a directory.
@@ -50,26 +53,11 @@ func Load(dir string) (*Book, error) {
 	// Try loading from single book.json first
 	single_path := filepath.Join(abs_dir, "book.json")
 	if single_data, err := os.ReadFile(single_path); err == nil {
-		single_book := &types.SingleBookFile{}
-		if err := json.Unmarshal(single_data, single_book); err != nil {
-			return nil, fmt.Errorf("failed to parse book.json: %w", err)
-		}
-		
-		// Convert to legacy formats for compatibility
-		book.Metadata = single_book.ToBookMetadata()
-		book.Shape = single_book.ToBookShape()
-		
-		// Load chapters using single file metadata
-		for _, ch_ref := range book.Metadata.GetAllChapters() {
-			ch, err := load_chapter_from_single(abs_dir, ch_ref.ChapterNumber, single_book)
-			if err != nil {
-				// Skip chapters that don't exist on disk
-				continue
-			}
-			book.Chapters[ch_ref.ChapterNumber] = ch
+		single_book, err := ParseBookJSON(single_data)
+		if err != nil {
+			return nil, err
 		}
-		
-		return book, nil
+		return load_single(abs_dir, single_book), nil
 	}
 
 	// Fallback: Load legacy format (book-metadata.json + book-shape.json)
@@ -105,6 +93,29 @@ func Load(dir string) (*Book, error) {
 	return book, nil
 }
 
+// load_single loads a book from its parsed book.json.
+func load_single(abs_dir string, single_book *types.SingleBookFile) *Book {
+	book := &Book{
+		Dir:      abs_dir,
+		Chapters: make(map[string]*Chapter),
+	}
+
+	// Convert to legacy formats for compatibility
+	book.Metadata = single_book.ToBookMetadata()
+	book.Shape = single_book.ToBookShape()
+
+	// Load chapters using single file metadata
+	for _, ch_ref := range book.Metadata.GetAllChapters() {
+		ch, err := load_chapter_from_single(abs_dir, ch_ref.ChapterNumber, single_book)
+		if err != nil {
+			// Skip chapters that don't exist on disk
+			continue
+		}
+		book.Chapters[ch_ref.ChapterNumber] = ch
+	}
+	return book
+}
+
 // load_chapter loads a single chapter from disk.
 func load_chapter(book_dir, chapter_num string) (*Chapter, error) {
 	ch_dir := filepath.Join(book_dir, chapter_num)
@@ -140,6 +151,8 @@ func load_chapter(book_dir, chapter_num string) (*Chapter, error) {
 		ch.Ketabs = append(ch.Ketabs, Ketab{
 			Item: item,
 			Body: cleaned,
+			Path: ketab_path,
+			Line: body_line(string(body), cleaned),
 		})
 	}
 
@@ -176,12 +189,22 @@ func load_chapter_from_single(book_dir, chapter_num string, single_book *types.S
 		ch.Ketabs = append(ch.Ketabs, Ketab{
 			Item: item,
 			Body: cleaned,
+			Path: ketab_path,
+			Line: body_line(string(body), cleaned),
 		})
 	}
 
 	return ch, nil
 }
 
+// body_line returns the line of a ketab file its cleaned body starts on.
+func body_line(file, body string) int {
+	if i := strings.Index(file, body); i > 0 {
+		return strings.Count(file[:i], "\n") + 1
+	}
+	return 1
+}
+
 // strip_scene_header removes the scene header line from ketab content.
 var scene_header_re = regexp.MustCompile(`^#\s*Scene\s*\d+[^\n]*\n+`)
 
@@ -206,6 +229,60 @@ func (b *Book) GetChapter(num string) (*Chapter, bool) {
 	return ch, ok
 }
 
+// Omit removes chapters (by number or d-tag) and ketabs (by d-tag) from the
+// loaded book, so that the events built from it no longer list them. The
+// remaining ketabs of a chapter that lost any are renumbered 1, 2, ... so
+// their indexes have no gaps. Nothing is changed on disk.
+func (b *Book) Omit(chapters, ketabs map[string]bool) {
+	omitted_uuids := make(map[string]bool)
+	for i := range b.Metadata.Acts {
+		act := &b.Metadata.Acts[i]
+		var kept []types.ChapterRef
+		for _, ch_ref := range act.Chapters {
+			if chapters[ch_ref.ChapterNumber] || chapters[ch_ref.ChapterUUID] {
+				delete(b.Chapters, ch_ref.ChapterNumber)
+				omitted_uuids[ch_ref.ChapterUUID] = true
+				continue
+			}
+			kept = append(kept, ch_ref)
+		}
+		act.Chapters = kept
+	}
+	for _, ch := range b.Chapters {
+		var kept []Ketab
+		for _, k := range ch.Ketabs {
+			if !ketabs[k.Item.UUID] {
+				kept = append(kept, k)
+			}
+		}
+		if len(kept) < len(ch.Ketabs) {
+			for i := range kept {
+				kept[i].Item.Number = i + 1
+			}
+		}
+		ch.Ketabs = kept
+	}
+	if b.Shape != nil {
+		for i, act := range b.Shape.Shape {
+			var kept []types.ShapeChapter
+			for _, shape_ch := range act {
+				if chapters[shape_ch.DTag] || omitted_uuids[shape_ch.DTag] {
+					continue
+				}
+				var kept_ketabs []types.ShapeKetab
+				for _, k := range shape_ch.Ketabs {
+					if !ketabs[k.DTag] {
+						kept_ketabs = append(kept_ketabs, k)
+					}
+				}
+				shape_ch.Ketabs = kept_ketabs
+				kept = append(kept, shape_ch)
+			}
+			b.Shape.Shape[i] = kept
+		}
+	}
+}
+
 // CompileChapterBody combines all ketabs into a single chapter body.
 func (c *Chapter) CompileChapterBody() string {
 	var bodies []string
@@ -223,6 +300,11 @@ func Validate(dir string) []string {
 		return []string{fmt.Sprintf("invalid directory: %v", err)}
 	}
 
+	// A book.json replaces the legacy metadata files
+	if single_data, err := os.ReadFile(filepath.Join(abs_dir, "book.json")); err == nil {
+		return append(validate_single(abs_dir, single_data), validate_footnotes(abs_dir)...)
+	}
+
 	// Check book-metadata.json
 	meta_path := filepath.Join(abs_dir, "book-metadata.json")
 	if _, err := os.Stat(meta_path); os.IsNotExist(err) {
@@ -305,6 +387,82 @@ func Validate(dir string) []string {
 		}
 	}
 
+	return append(errors, validate_footnotes(abs_dir)...)
+}
+
+// validate_single checks a book.json against its schema, then the chapter
+// numbers, UUIDs and ketab files it lists. Schema problems are reported with
+// their line and column.
+func validate_single(abs_dir string, data []byte) []string {
+	var errors []string
+	for _, e := range ValidateSchema(data) {
+		errors = append(errors, fmt.Sprintf("book.json:%s", e))
+		if e.Keyword == "syntax" {
+			return errors
+		}
+	}
+
+	// Decode leniently so the checks below still run on a book.json with
+	// unknown fields; the schema errors above already cover those
+	single := &types.SingleBookFile{}
+	if err := json.Unmarshal(data, single); err != nil {
+		return errors
+	}
+
+	numbers := make(map[string]bool)
+	uuids := make(map[string]string)
+	claim := func(uuid, what string) {
+		if other, ok := uuids[uuid]; ok && uuid != "" {
+			errors = append(errors, fmt.Sprintf("%s: uuid %s is also used by %s", what, uuid, other))
+			return
+		}
+		uuids[uuid] = what
+	}
+	claim(single.UUID, "the book")
+	for _, act := range single.Acts {
+		for _, ch := range act.Chapters {
+			if ch.Number != "" && numbers[ch.Number] {
+				errors = append(errors, fmt.Sprintf("chapter %s: number is used by another chapter", ch.Number))
+			}
+			numbers[ch.Number] = true
+			claim(ch.UUID, "chapter "+ch.Number)
+
+			// Check ketab files
+			for i, k := range ch.Ketabs {
+				label := fmt.Sprintf("ketab %d", i+1)
+				if k.File != "" {
+					label = k.File
+					if _, err := os.Stat(filepath.Join(abs_dir, k.File)); os.IsNotExist(err) {
+						errors = append(errors, fmt.Sprintf("chapter %s: missing ketab file %s", ch.Number, k.File))
+					}
+				}
+				claim(k.UUID, fmt.Sprintf("chapter %s ketab %s", ch.Number, label))
+			}
+		}
+	}
+	return errors
+}
+
+// validate_footnotes checks each ketab's citations: every marker needs an
+// entry in the sources section and every entry a marker. Problems are
+// located by file, line and column.
+func validate_footnotes(abs_dir string) []string {
+	b, err := Load(abs_dir)
+	if err != nil {
+		return nil
+	}
+	var errors []string
+	for _, num := range b.GetChapterNumbers() {
+		for _, k := range b.Chapters[num].Ketabs {
+			file, err := filepath.Rel(abs_dir, k.Path)
+			if err != nil {
+				file = k.Path
+			}
+			for _, p := range footnotes.Parse(k.Body).Check() {
+				errors = append(errors, fmt.Sprintf("chapter %s: %s:%d:%d: %s", num, filepath.ToSlash(file), k.Line+p.Line-1, p.Column, p.Message))
+			}
+		}
+	}
 	return errors
 }
 
@@ -344,9 +502,9 @@ func GetStatus(dir string) (*BookStatus, error) {
 	
 	single_path := filepath.Join(abs_dir, "book.json")
 	if single_data, err := os.ReadFile(single_path); err == nil {
-		single_book = &types.SingleBookFile{}
-		if err := json.Unmarshal(single_data, single_book); err != nil {
-			return nil, fmt.Errorf("failed to parse book.json: %w", err)
+		single_book, err = ParseBookJSON(single_data)
+		if err != nil {
+			return nil, err
 		}
 		meta = single_book.ToBookMetadata()
 		using_single_file = true
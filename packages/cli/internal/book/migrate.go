@@ -0,0 +1,282 @@
+package book
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/types"
+)
+
+// Migration is the book.json that replaces a legacy book directory's
+// book-metadata.json, book-shape.json and chapter-metadata.json files.
+type Migration struct {
+	Dir    string
+	Single *types.SingleBookFile
+
+	// Legacy lists the files book.json replaces, relative to Dir.
+	Legacy []string
+
+	// Notes lists what book.json does not carry over as it was: legacy
+	// fields it has no place for, and any difference between the book as
+	// loaded from the legacy files and from book.json.
+	Notes []string
+}
+
+// Migrate converts a legacy book directory into the book.json format. It
+// keeps UUIDs, scene numbers (when they are not simply positions), tags,
+// published_at and discussion ids, and leaves ketab files where they are.
+// Nothing is written; see (*Migration).Write.
+func Migrate(dir string) (*Migration, error) {
+	abs_dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid directory: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(abs_dir, "book.json")); err == nil {
+		return nil, fmt.Errorf("%s already has a book.json", dir)
+	}
+	legacy, err := Load(abs_dir)
+	if err != nil {
+		return nil, err
+	}
+	m := &Migration{Dir: abs_dir, Legacy: []string{"book-metadata.json"}}
+	note := func(format string, args ...any) {
+		m.Notes = append(m.Notes, fmt.Sprintf(format, args...))
+	}
+
+	meta := legacy.Metadata
+	m.Single = &types.SingleBookFile{
+		Title:       meta.BookTitle,
+		Slug:        meta.BookSlug,
+		UUID:        meta.BookUUID,
+		Author:      meta.Author,
+		Description: meta.Description,
+		Summary:     meta.Summary,
+		Image:       meta.Image,
+		Thumb:       meta.Thumb,
+		RefBlockID:  meta.RefBlockID,
+		Signer:      meta.Signer,
+	}
+	if shape := legacy.Shape; shape != nil {
+		m.Legacy = append(m.Legacy, "book-shape.json")
+		for _, field := range [][3]string{
+			{"title", shape.Title, meta.BookTitle},
+			{"description", shape.Description, meta.Description},
+			{"image", shape.Image, meta.Image},
+		} {
+			if field[1] != "" && field[1] != field[2] {
+				note("book-shape.json %s %q differs from book-metadata.json's and is dropped", field[0], field[1])
+			}
+		}
+	}
+
+	threads := make(map[string]string)
+	for _, t := range legacy.Threads() {
+		threads[t.ChapterNumber] = t.Ref
+	}
+
+	for ai, act := range meta.Acts {
+		single_act := types.SingleAct{Title: act.Title, Chapters: []types.SingleChapter{}}
+		for _, ref := range act.Chapters {
+			single_ch := types.SingleChapter{
+				Number:       ref.ChapterNumber,
+				Title:        ref.ChapterTitle,
+				UUID:         ref.ChapterUUID,
+				Coordinate:   ref.Coordinate,
+				DiscussionID: threads[ref.ChapterNumber],
+				Ketabs:       []types.SingleKetab{},
+			}
+			ch_meta_file := path.Join(ref.ChapterNumber, "chapter-metadata.json")
+			ch_meta := &types.ChapterMetadata{}
+			data, err := os.ReadFile(filepath.Join(abs_dir, filepath.FromSlash(ch_meta_file)))
+			if err != nil {
+				note("chapter %s has no chapter-metadata.json; it is kept without ketabs", ref.ChapterNumber)
+				single_act.Chapters = append(single_act.Chapters, single_ch)
+				continue
+			}
+			if err := json.Unmarshal(data, ch_meta); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", ch_meta_file, err)
+			}
+			m.Legacy = append(m.Legacy, ch_meta_file)
+
+			// The chapter event is built from chapter-metadata.json, so its
+			// values win over the book's reference
+			if ch_meta.ChapterTitle != "" {
+				single_ch.Title = ch_meta.ChapterTitle
+			}
+			if ch_meta.ChapterUUID != "" {
+				single_ch.UUID = ch_meta.ChapterUUID
+			}
+			if ch_meta.ChapterNumber != "" && ch_meta.ChapterNumber != ref.ChapterNumber {
+				note("chapter %s: chapter_number %q in chapter-metadata.json is dropped (the folder's number is kept)", ref.ChapterNumber, ch_meta.ChapterNumber)
+			}
+			if ch_meta.Act != 0 && ch_meta.Act != ai+1 {
+				note("chapter %s: act %d in chapter-metadata.json is dropped (the chapter is listed in act %d)", ref.ChapterNumber, ch_meta.Act, ai+1)
+			}
+			if len(ch_meta.Scenes) > 0 && len(ch_meta.Ketabs) > 0 {
+				note("chapter %s: the ketabs array of chapter-metadata.json is dropped (its scenes array was used)", ref.ChapterNumber)
+			}
+			single_ch.PublishedAt = ch_meta.PublishedAt
+			for _, tag := range ch_meta.Tags {
+				if len(tag) >= 2 && tag[0] == "t" && tag[1] != "" {
+					single_ch.Topics = append(single_ch.Topics, tag[1])
+				} else {
+					single_ch.Tags = append(single_ch.Tags, tag)
+				}
+			}
+
+			items := ch_meta.GetKetabs()
+			positional := true
+			for i, item := range items {
+				positional = positional && item.Number == i+1
+			}
+			for _, item := range items {
+				single_k := types.SingleKetab{
+					Title:  item.Title,
+					UUID:   item.UUID,
+					File:   path.Join(ref.ChapterNumber, filepath.ToSlash(item.File)),
+					Topics: item.Topics,
+				}
+				if !positional {
+					single_k.Number = item.Number
+				}
+				single_ch.Ketabs = append(single_ch.Ketabs, single_k)
+			}
+			single_act.Chapters = append(single_act.Chapters, single_ch)
+		}
+		m.Single.Acts = append(m.Single.Acts, single_act)
+	}
+
+	m.Notes = append(m.Notes, compare_books(legacy, load_single(abs_dir, m.Single))...)
+	return m, nil
+}
+
+// JSON returns the book.json contents.
+func (m *Migration) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(m.Single, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal book.json: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// Write writes book.json and, if remove_legacy is set, deletes the legacy
+// files it replaces. Ketab files are not touched.
+func (m *Migration) Write(remove_legacy bool) error {
+	data, err := m.JSON()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(m.Dir, "book.json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write book.json: %w", err)
+	}
+	if !remove_legacy {
+		return nil
+	}
+	for _, name := range m.Legacy {
+		if err := os.Remove(filepath.Join(m.Dir, filepath.FromSlash(name))); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// compare_books lists the differences between a book as loaded from its
+// legacy files and from its migrated book.json.
+func compare_books(old, new *Book) []string {
+	var diffs []string
+	diff := func(what string, a, b any) {
+		if as, ok := a.([]string); ok && slices.Equal(as, b.([]string)) {
+			return
+		}
+		if !reflect.DeepEqual(a, b) {
+			diffs = append(diffs, fmt.Sprintf("%s changes from %v to %v", what, describe(a), describe(b)))
+		}
+	}
+
+	om, nm := old.Metadata, new.Metadata
+	diff("book title", om.BookTitle, nm.BookTitle)
+	diff("book uuid", om.BookUUID, nm.BookUUID)
+	diff("author", om.Author, nm.Author)
+	diff("description", om.Description, nm.Description)
+	diff("image", om.Image, nm.Image)
+	diff("acts", len(om.Acts), len(nm.Acts))
+	for i := range min(len(om.Acts), len(nm.Acts)) {
+		diff(fmt.Sprintf("act %d title", i+1), om.Acts[i].Title, nm.Acts[i].Title)
+	}
+
+	old_threads, new_threads := make(map[string]string), make(map[string]string)
+	for _, t := range old.Threads() {
+		old_threads[t.ChapterNumber] = t.Ref
+	}
+	for _, t := range new.Threads() {
+		new_threads[t.ChapterNumber] = t.Ref
+	}
+	old_refs, new_refs := om.GetAllChapters(), nm.GetAllChapters()
+	diff("chapters", len(old_refs), len(new_refs))
+	for i := range min(len(old_refs), len(new_refs)) {
+		o, n := old_refs[i], new_refs[i]
+		label := "chapter " + o.ChapterNumber
+		diff(label+" title in the book event", o.ChapterTitle, n.ChapterTitle)
+		diff(label+" uuid in the book event", o.ChapterUUID, n.ChapterUUID)
+		diff(label+" discussion_id in the book event", o.DiscussionID, n.DiscussionID)
+		diff(label+" discussion thread", old_threads[o.ChapterNumber], new_threads[n.ChapterNumber])
+	}
+
+	numbers := make(map[string]bool)
+	for num := range old.Chapters {
+		numbers[num] = true
+	}
+	for num := range new.Chapters {
+		numbers[num] = true
+	}
+	for _, num := range slices.Sorted(maps.Keys(numbers)) {
+		o, in_old := old.Chapters[num]
+		n, in_new := new.Chapters[num]
+		label := "chapter " + num
+		if !in_old || !in_new {
+			diff(label+" loading", in_old, in_new)
+			continue
+		}
+		diff(label+" title", o.Metadata.ChapterTitle, n.Metadata.ChapterTitle)
+		diff(label+" uuid", o.Metadata.ChapterUUID, n.Metadata.ChapterUUID)
+		diff(label+" published_at", o.Metadata.PublishedAt, n.Metadata.PublishedAt)
+		diff(label+" topics", o.Metadata.GetTopics(), n.Metadata.GetTopics())
+		diff(label+" ketabs", len(o.Ketabs), len(n.Ketabs))
+		for i := range min(len(o.Ketabs), len(n.Ketabs)) {
+			ok, nk := o.Ketabs[i], n.Ketabs[i]
+			klabel := fmt.Sprintf("%s ketab %d", label, i+1)
+			diff(klabel+" number", ok.Item.Number, nk.Item.Number)
+			diff(klabel+" title", ok.Item.Title, nk.Item.Title)
+			diff(klabel+" uuid", ok.Item.UUID, nk.Item.UUID)
+			diff(klabel+" topics", ok.Item.Topics, nk.Item.Topics)
+			if ok.Body != nk.Body {
+				diffs = append(diffs, klabel+" text differs")
+			}
+		}
+	}
+	return diffs
+}
+
+// describe formats a compared value for a note.
+func describe(v any) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case bool:
+		if v {
+			return "loaded"
+		}
+		return "skipped"
+	case []string:
+		return "[" + strings.Join(v, ", ") + "]"
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,129 @@
+package book
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/schema"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/types"
+)
+
+// SchemaVersion is the version of the book.json schema. It changes when a
+// field is added, removed or changes meaning.
+const SchemaVersion = 1
+
+// SchemaID identifies the book.json schema.
+var SchemaID = fmt.Sprintf("urn:ketab:book.json:v%d", SchemaVersion)
+
+// json_field turns a schema error path ("acts[0].title") into the field
+// path encoding/json reports ("acts.0.title").
+var json_field = strings.NewReplacer("[", ".", "]", "")
+
+// schema_fields documents book.json's fields and marks the required ones.
+var schema_fields = map[string]schema.Field{
+	"SingleBookFile.Schema":      {Description: "The JSON Schema this file follows, for editors (see ketab schema)."},
+	"SingleBookFile.Title":       {Description: "The book's title.", Required: true},
+	"SingleBookFile.Slug":        {Description: "The book's URL slug.", Required: true},
+	"SingleBookFile.UUID":        {Description: "The book's UUID: the d tag of its book event. Never change it once published.", Required: true},
+	"SingleBookFile.Author":      {Description: "The author's name.", Required: true},
+	"SingleBookFile.Description": {Description: "A short description of the book, published in the book event.", Required: true},
+	"SingleBookFile.Summary":     {Description: "A longer summary of the book."},
+	"SingleBookFile.Image":       {Description: "The cover image URL."},
+	"SingleBookFile.Thumb":       {Description: "The cover thumbnail URL."},
+	"SingleBookFile.RefBlockID":  {Description: "The block reference published in the book content, such as \"org.cityprotocol:block:862626:...\"."},
+	"SingleBookFile.Signer":      {Description: "The book's signer, carried over from book-metadata.json."},
+	"SingleBookFile.Acts":        {Description: "The book's acts, in order.", Required: true},
+	"SingleBookFile.Shape":       {Description: "Deprecated: the book-shape layout of older files. Only its discussion_id fields are read."},
+
+	"SingleAct.Title":    {Description: "The act's title."},
+	"SingleAct.Chapters": {Description: "The act's chapters, in order.", Required: true},
+
+	"SingleChapter.Number":       {Description: "The chapter's number, which is also its folder name, such as \"03\".", Required: true},
+	"SingleChapter.Title":        {Description: "The chapter's title."},
+	"SingleChapter.UUID":         {Description: "The chapter's UUID: the d tag of its chapter event. Never change it once published.", Required: true},
+	"SingleChapter.Topics":       {Description: "Topics published as t tags."},
+	"SingleChapter.Ketabs":       {Description: "The chapter's ketabs, in reading order.", Required: true},
+	"SingleChapter.DiscussionID": {Description: "The chapter's discussion thread: an event id or naddr."},
+	"SingleChapter.PublishedAt":  {Description: "The chapter's first publish time, as a unix timestamp."},
+	"SingleChapter.Tags":         {Description: "Extra tags published on the chapter event."},
+	"SingleChapter.Coordinate":   {Description: "The chapter event's coordinate (kind:pubkey:d-tag)."},
+
+	"SingleKetab.Title":  {Description: "The ketab's title."},
+	"SingleKetab.UUID":   {Description: "The ketab's UUID: the d tag of its ketab event. Never change it once published.", Required: true},
+	"SingleKetab.File":   {Description: "The ketab's markdown file, relative to the book directory.", Required: true},
+	"SingleKetab.Topics": {Description: "Topics published as t tags."},
+	"SingleKetab.Number": {Description: "The ketab's 1-based number when it is not its position in the chapter."},
+
+	"ShapeChapter.DTag":         {Description: "The chapter's UUID."},
+	"ShapeChapter.DiscussionID": {Description: "The chapter's discussion thread."},
+}
+
+// Schema returns the JSON Schema of book.json, generated from
+// types.SingleBookFile.
+func Schema() *schema.Schema {
+	s := schema.Generate(reflect.TypeOf(types.SingleBookFile{}), schema_fields)
+	s.Dialect = schema.Draft
+	s.ID = SchemaID
+	s.Title = "Ketab book.json"
+	s.Description = fmt.Sprintf("A ketab book directory's book.json (version %d).", SchemaVersion)
+	return s
+}
+
+// SchemaJSON returns the book.json schema, indented, as ketab schema prints it.
+func SchemaJSON() ([]byte, error) {
+	data, err := json.MarshalIndent(Schema(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the book.json schema: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// ValidateSchema checks book.json's contents against the schema.
+func ValidateSchema(data []byte) []schema.Error {
+	return schema.Validate(Schema(), data)
+}
+
+// ParseBookJSON decodes book.json strictly: unknown fields (typos like
+// "ketab" for "ketabs") are errors rather than silently dropped. Errors
+// carry the line and column of the problem.
+func ParseBookJSON(data []byte) (*types.SingleBookFile, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	single := &types.SingleBookFile{}
+	err := dec.Decode(single)
+	if err == nil && dec.More() {
+		err = errors.New("unexpected data after the top-level value")
+	}
+	if err == nil {
+		return single, nil
+	}
+
+	var syntax *json.SyntaxError
+	var mismatch *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntax):
+		line, column := schema.Position(data, int(syntax.Offset))
+		return nil, fmt.Errorf("book.json:%d:%d: %s", line, column, syntax.Error())
+	case errors.As(err, &mismatch):
+		// The schema check reports where the value starts rather than ends
+		for _, e := range ValidateSchema(data) {
+			if e.Keyword == "type" && json_field.Replace(e.Path) == mismatch.Field {
+				return nil, fmt.Errorf("book.json:%s", e)
+			}
+		}
+		line, column := schema.Position(data, int(mismatch.Offset))
+		return nil, fmt.Errorf("book.json:%d:%d: %s: expected %s, found %s", line, column, mismatch.Field, mismatch.Type, mismatch.Value)
+	}
+	// Unknown fields and trailing data come without an offset; the schema
+	// check locates them
+	for _, e := range ValidateSchema(data) {
+		if e.Keyword == "additionalProperties" || e.Keyword == "syntax" {
+			return nil, fmt.Errorf("book.json:%s", e)
+		}
+	}
+	return nil, fmt.Errorf("failed to parse book.json: %w", err)
+}
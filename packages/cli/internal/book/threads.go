@@ -0,0 +1,40 @@
+package book
+
+// Thread is the discussion thread recorded for a chapter.
+type Thread struct {
+	ChapterNumber string
+	ChapterUUID   string // Chapter d-tag
+	ChapterTitle  string
+	Ref           string // Event id, nevent, naddr or coordinate
+}
+
+// Threads returns the discussion threads recorded in the book's metadata, in
+// chapter order. They are read from the chapters' discussion_id fields in
+// book.json or book-metadata.json, and from the shape (book-shape.json or a
+// legacy shape in book.json), whose entries are matched to chapters by d_tag,
+// or by title when they have none.
+func (b *Book) Threads() []Thread {
+	var threads []Thread
+	for _, ch_ref := range b.Metadata.GetAllChapters() {
+		ref := ch_ref.DiscussionID
+		if ref == "" && b.Shape != nil {
+			for _, act := range b.Shape.Shape {
+				for _, shape_ch := range act {
+					if shape_ch.DTag == ch_ref.ChapterUUID || (shape_ch.DTag == "" && shape_ch.Title == ch_ref.ChapterTitle) {
+						ref = shape_ch.DiscussionID
+					}
+				}
+			}
+		}
+		if ref == "" {
+			continue
+		}
+		threads = append(threads, Thread{
+			ChapterNumber: ch_ref.ChapterNumber,
+			ChapterUUID:   ch_ref.ChapterUUID,
+			ChapterTitle:  ch_ref.ChapterTitle,
+			Ref:           ref,
+		})
+	}
+	return threads
+}
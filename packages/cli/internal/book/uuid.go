@@ -0,0 +1,63 @@
+package book
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// uuid_namespace is the root namespace of StableUUID.
+var uuid_namespace = [16]byte{0x6b, 0x65, 0x74, 0x61, 0x62, 0x2d, 0x40, 0x75, 0x80, 0x69, 0x64, 0x2d, 0x6e, 0x73, 0x00, 0x01}
+
+// StableUUID derives a name-based (version 5) UUID from namespace and name,
+// so that generating the same book twice yields the same d-tags. namespace
+// is usually the UUID of the parent (book or chapter); any other string is
+// hashed into one first.
+func StableUUID(namespace, name string) string {
+	ns, ok := parse_uuid(namespace)
+	if !ok {
+		ns = uuid_v5(uuid_namespace, namespace)
+	}
+	return format_uuid(uuid_v5(ns, name))
+}
+
+// NewUUID returns a random (version 4) UUID, for new books, chapters and
+// ketabs.
+func NewUUID() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return format_uuid(u)
+}
+
+func uuid_v5(namespace [16]byte, name string) [16]byte {
+	h := sha1.New()
+	h.Write(namespace[:])
+	h.Write([]byte(name))
+	var u [16]byte
+	copy(u[:], h.Sum(nil))
+	u[6] = (u[6] & 0x0f) | 0x50 // version 5
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return u
+}
+
+func parse_uuid(s string) ([16]byte, bool) {
+	var u [16]byte
+	raw := strings.ReplaceAll(s, "-", "")
+	if len(s) != 36 || len(raw) != 32 {
+		return u, false
+	}
+	b, err := hex.DecodeString(raw)
+	if err != nil {
+		return u, false
+	}
+	copy(u[:], b)
+	return u, true
+}
+
+func format_uuid(u [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
@@ -0,0 +1,277 @@
+// Package bookfile edits a book directory's book.json and its ketab files:
+// creating books, acts, chapters and ketabs, and moving, splitting and
+// merging ketabs.
+//
+// UUIDs are never derived from positions or titles here: a chapter or ketab
+// keeps its UUID (and so its published coordinate) however it is retitled,
+// reordered or moved. Ketab order is the order in book.json; the number
+// prefixes of file names are only picked to keep files sorted when created,
+// and files are not renamed when ketabs are reordered.
+package bookfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/fetch"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/types"
+)
+
+// File is a book directory's book.json, open for editing.
+type File struct {
+	Dir  string
+	Book *types.SingleBookFile
+}
+
+// Open reads dir/book.json.
+func Open(dir string) (*File, error) {
+	abs_dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid directory: %w", err)
+	}
+	data, err := os.ReadFile(filepath.Join(abs_dir, "book.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no book.json in %s (see ketab init)", dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read book.json: %w", err)
+	}
+	single, err := book.ParseBookJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return &File{Dir: abs_dir, Book: single}, nil
+}
+
+// Init creates dir/book.json for a new book with a random UUID and a single,
+// empty act. It fails if the book.json already exists.
+func Init(dir, title, author, description, act_title string) (*File, error) {
+	abs_dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid directory: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(abs_dir, "book.json")); err == nil {
+		return nil, fmt.Errorf("%s already exists", filepath.Join(dir, "book.json"))
+	}
+	if err := os.MkdirAll(abs_dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	f := &File{Dir: abs_dir, Book: &types.SingleBookFile{
+		Title:       title,
+		Slug:        fetch.Slugify(title),
+		UUID:        book.NewUUID(),
+		Author:      author,
+		Description: description,
+	}}
+	f.AddAct(act_title)
+	return f, f.Save()
+}
+
+// Save writes book.json.
+func (f *File) Save() error {
+	return write_json(f.Dir, "book.json", f.Book)
+}
+
+// AddAct appends an act.
+func (f *File) AddAct(title string) *types.SingleAct {
+	f.Book.Acts = append(f.Book.Acts, types.SingleAct{Title: title, Chapters: []types.SingleChapter{}})
+	return &f.Book.Acts[len(f.Book.Acts)-1]
+}
+
+// AddChapter appends a chapter with a random UUID to the act-th act
+// (1-based; 0 for the last act) and creates its folder. The chapter is
+// numbered one past the highest chapter number in the book, so existing
+// chapters keep their numbers and folders.
+func (f *File) AddChapter(act int, title string) (*types.SingleChapter, error) {
+	if len(f.Book.Acts) == 0 {
+		f.AddAct("Act 1")
+	}
+	if act == 0 {
+		act = len(f.Book.Acts)
+	}
+	if act < 1 || act > len(f.Book.Acts) {
+		return nil, fmt.Errorf("act %d does not exist (the book has %d)", act, len(f.Book.Acts))
+	}
+
+	highest := 0
+	for _, a := range f.Book.Acts {
+		for _, ch := range a.Chapters {
+			if n, err := strconv.Atoi(ch.Number); err == nil {
+				highest = max(highest, n)
+			}
+		}
+	}
+	ch := types.SingleChapter{
+		Number: fmt.Sprintf("%02d", highest+1),
+		Title:  title,
+		UUID:   book.NewUUID(),
+		Ketabs: []types.SingleKetab{},
+	}
+	if err := os.MkdirAll(filepath.Join(f.Dir, ch.Number), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create chapter %s: %w", ch.Number, err)
+	}
+	a := &f.Book.Acts[act-1]
+	a.Chapters = append(a.Chapters, ch)
+	return &a.Chapters[len(a.Chapters)-1], nil
+}
+
+// Chapter finds a chapter by number ("03") or UUID.
+func (f *File) Chapter(ref string) (*types.SingleChapter, error) {
+	for ai := range f.Book.Acts {
+		for ci := range f.Book.Acts[ai].Chapters {
+			ch := &f.Book.Acts[ai].Chapters[ci]
+			if ch.Number == ref || ch.UUID == ref {
+				return ch, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("chapter %s is not in book.json", ref)
+}
+
+// KetabRef locates a ketab: its chapter and 0-based position.
+type KetabRef struct {
+	Chapter *types.SingleChapter
+	Index   int
+}
+
+// Ketab returns the ketab r points at.
+func (r KetabRef) Ketab() *types.SingleKetab {
+	return &r.Chapter.Ketabs[r.Index]
+}
+
+// Ketab finds a ketab by UUID or by "<chapter>/<position>" (1-based), such
+// as "03/2".
+func (f *File) Ketab(ref string) (KetabRef, error) {
+	if chapter, position, ok := strings.Cut(ref, "/"); ok {
+		ch, err := f.Chapter(chapter)
+		if err != nil {
+			return KetabRef{}, err
+		}
+		n, err := strconv.Atoi(position)
+		if err != nil || n < 1 || n > len(ch.Ketabs) {
+			return KetabRef{}, fmt.Errorf("chapter %s has no ketab %s (it has %d)", ch.Number, position, len(ch.Ketabs))
+		}
+		return KetabRef{Chapter: ch, Index: n - 1}, nil
+	}
+	for ai := range f.Book.Acts {
+		for ci := range f.Book.Acts[ai].Chapters {
+			ch := &f.Book.Acts[ai].Chapters[ci]
+			for ki, k := range ch.Ketabs {
+				if k.UUID == ref {
+					return KetabRef{Chapter: ch, Index: ki}, nil
+				}
+			}
+		}
+	}
+	return KetabRef{}, fmt.Errorf("ketab %s is not in book.json (use a UUID or <chapter>/<position>)", ref)
+}
+
+// AddKetab inserts a ketab with a random UUID into a chapter at position
+// (1-based; 0 appends) and creates its file with body.
+func (f *File) AddKetab(chapter string, position int, title, body string) (*types.SingleKetab, error) {
+	ch, err := f.Chapter(chapter)
+	if err != nil {
+		return nil, err
+	}
+	index, err := insert_index(ch, position)
+	if err != nil {
+		return nil, err
+	}
+	k := types.SingleKetab{
+		Title: title,
+		UUID:  book.NewUUID(),
+		File:  f.new_file(ch, title),
+	}
+	if err := f.write_ketab(k.File, body); err != nil {
+		return nil, err
+	}
+	ch.Ketabs = insert(ch.Ketabs, index, k)
+	renumber(ch)
+	return &ch.Ketabs[index], nil
+}
+
+// Body reads a ketab's file.
+func (f *File) Body(k *types.SingleKetab) (string, error) {
+	data, err := os.ReadFile(filepath.Join(f.Dir, filepath.FromSlash(k.File)))
+	if err != nil {
+		return "", fmt.Errorf("failed to read ketab file %s: %w", k.File, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (f *File) write_ketab(file, body string) error {
+	path := filepath.Join(f.Dir, filepath.FromSlash(file))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(file), err)
+	}
+	if body = strings.TrimSpace(body); body != "" {
+		body += "\n"
+	}
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		return fmt.Errorf("failed to write ketab %s: %w", file, err)
+	}
+	return nil
+}
+
+// new_file picks an unused "<chapter>/<NN>-<slug>.md" path for a new ketab
+// of ch, numbered after the chapter's highest file number.
+func (f *File) new_file(ch *types.SingleChapter, title string) string {
+	highest := 0
+	for _, k := range ch.Ketabs {
+		prefix, _, _ := strings.Cut(filepath.Base(k.File), "-")
+		if n, err := strconv.Atoi(prefix); err == nil && strings.HasPrefix(k.File, ch.Number+"/") {
+			highest = max(highest, n)
+		}
+	}
+	for n := highest + 1; ; n++ {
+		file := fmt.Sprintf("%s/%02d-%s.md", ch.Number, n, fetch.Slugify(title))
+		if _, err := os.Stat(filepath.Join(f.Dir, filepath.FromSlash(file))); errors.Is(err, os.ErrNotExist) && !f.listed(file) {
+			return file
+		}
+	}
+}
+
+// listed reports whether a ketab in book.json uses file.
+func (f *File) listed(file string) bool {
+	for _, act := range f.Book.Acts {
+		for _, ch := range act.Chapters {
+			for _, k := range ch.Ketabs {
+				if k.File == file {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// insert_index turns a 1-based position (0 appends) into a slice index.
+func insert_index(ch *types.SingleChapter, position int) (int, error) {
+	if position == 0 {
+		return len(ch.Ketabs), nil
+	}
+	if position < 1 || position > len(ch.Ketabs)+1 {
+		return 0, fmt.Errorf("position %d is out of range: chapter %s has %d ketabs", position, ch.Number, len(ch.Ketabs))
+	}
+	return position - 1, nil
+}
+
+// renumber drops a chapter's explicit ketab numbers (migrated scene numbers
+// with gaps) once its ketabs change: positions number them from then on.
+func renumber(ch *types.SingleChapter) {
+	for i := range ch.Ketabs {
+		ch.Ketabs[i].Number = 0
+	}
+}
+
+func insert(ketabs []types.SingleKetab, index int, k ...types.SingleKetab) []types.SingleKetab {
+	out := make([]types.SingleKetab, 0, len(ketabs)+len(k))
+	out = append(out, ketabs[:index]...)
+	out = append(out, k...)
+	return append(out, ketabs[index:]...)
+}
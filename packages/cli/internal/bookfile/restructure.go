@@ -0,0 +1,218 @@
+package bookfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/markdown"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/types"
+	"github.com/joinnextblock/ketab-protocol/go-core/footnotes"
+)
+
+// MoveKetab moves a ketab to position (1-based; 0 appends) in chapter, which
+// may be its own chapter to reorder it. A ketab moved to another chapter
+// has its file moved into that chapter's folder; its UUID is kept.
+func (f *File) MoveKetab(ref KetabRef, chapter string, position int) error {
+	to, err := f.Chapter(chapter)
+	if err != nil {
+		return err
+	}
+	k := *ref.Ketab()
+	from := ref.Chapter
+	from.Ketabs = append(from.Ketabs[:ref.Index:ref.Index], from.Ketabs[ref.Index+1:]...)
+
+	index, err := insert_index(to, position)
+	if err != nil {
+		from.Ketabs = insert(from.Ketabs, ref.Index, k)
+		return err
+	}
+	if to != from && !strings.HasPrefix(k.File, to.Number+"/") {
+		file := f.new_file(to, k.Title)
+		if err := os.MkdirAll(filepath.Join(f.Dir, to.Number), 0755); err != nil {
+			from.Ketabs = insert(from.Ketabs, ref.Index, k)
+			return fmt.Errorf("failed to create chapter %s: %w", to.Number, err)
+		}
+		if err := os.Rename(filepath.Join(f.Dir, filepath.FromSlash(k.File)), filepath.Join(f.Dir, filepath.FromSlash(file))); err != nil {
+			from.Ketabs = insert(from.Ketabs, ref.Index, k)
+			return fmt.Errorf("failed to move %s: %w", k.File, err)
+		}
+		k.File = file
+	}
+	to.Ketabs = insert(to.Ketabs, index, k)
+	renumber(from)
+	renumber(to)
+	return nil
+}
+
+// SplitKetab splits a ketab into pieces: before each of the given 1-based
+// line numbers of its file or, with no lines, at its `---` rules (see
+// markdown.SplitScenes). The first piece keeps the ketab's UUID, title and
+// file; the others become new ketabs after it, titled from titles in order,
+// else "<title> (n)". It returns the new ketabs.
+func (f *File) SplitKetab(ref KetabRef, lines []int, titles []string) ([]types.SingleKetab, error) {
+	k := ref.Ketab()
+	data, err := os.ReadFile(filepath.Join(f.Dir, filepath.FromSlash(k.File)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ketab file %s: %w", k.File, err)
+	}
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	var pieces []string
+	if len(lines) == 0 {
+		pieces = markdown.SplitScenes(text)
+	} else {
+		file_lines := strings.Split(text, "\n")
+		start := 0
+		for _, n := range lines {
+			if n <= start+1 || n > len(file_lines) {
+				return nil, fmt.Errorf("line %d is out of order or outside %s (%d lines)", n, k.File, len(file_lines))
+			}
+			pieces = append(pieces, strings.Join(file_lines[start:n-1], "\n"))
+			start = n - 1
+		}
+		pieces = append(pieces, strings.Join(file_lines[start:], "\n"))
+	}
+	var kept []string
+	for _, piece := range pieces {
+		if strings.TrimSpace(piece) != "" {
+			kept = append(kept, piece)
+		}
+	}
+	if len(kept) < 2 {
+		return nil, fmt.Errorf("nothing to split: %s has no --- rules between text (give line numbers to split at)", k.File)
+	}
+
+	var added []types.SingleKetab
+	for i, piece := range kept[1:] {
+		title := fmt.Sprintf("%s (%d)", k.Title, i+2)
+		if i < len(titles) && titles[i] != "" {
+			title = titles[i]
+		}
+		// Files written so far are on disk, so new_file passes them over
+		nk := types.SingleKetab{
+			Title:  title,
+			UUID:   book.NewUUID(),
+			File:   f.new_file(ref.Chapter, title),
+			Topics: k.Topics,
+		}
+		if err := f.write_ketab(nk.File, piece); err != nil {
+			return nil, err
+		}
+		added = append(added, nk)
+	}
+	if err := f.write_ketab(k.File, kept[0]); err != nil {
+		return nil, err
+	}
+	ref.Chapter.Ketabs = insert(ref.Chapter.Ketabs, ref.Index+1, added...)
+	renumber(ref.Chapter)
+	return added, nil
+}
+
+// MergeKetabs merges ketabs into the first of them, which keeps its UUID,
+// position and file (and takes title, if set). Their texts are joined by
+// `---` rules, as a compiled chapter joins ketabs, and their sources
+// entries are combined at the end under the first ketab's heading (such as
+// "**Sources**"). When footnote labels clash, every
+// ketab's footnotes are renumbered in sequence. The other ketabs are
+// removed from book.json and their files deleted. It returns the removed
+// ketabs.
+func (f *File) MergeKetabs(refs []KetabRef, title string) ([]types.SingleKetab, error) {
+	if len(refs) < 2 {
+		return nil, fmt.Errorf("merge needs at least two ketabs")
+	}
+	var bodies []*footnotes.Body
+	clash := false
+	labels := make(map[string]bool)
+	seen := make(map[*types.SingleKetab]bool)
+	for _, ref := range refs {
+		k := ref.Ketab()
+		if seen[k] {
+			return nil, fmt.Errorf("ketab %q is listed twice", k.Title)
+		}
+		seen[k] = true
+		text, err := f.Body(k)
+		if err != nil {
+			return nil, err
+		}
+		body := footnotes.Parse(text)
+		for _, label := range body.Labels() {
+			clash = clash || labels[label]
+			labels[label] = true
+		}
+		bodies = append(bodies, body)
+	}
+
+	// One sources section: the first heading, then every body's entries
+	var texts, sources []string
+	heading := ""
+	spaced := false
+	next := 1
+	for _, body := range bodies {
+		if clash {
+			next = body.Renumber(next)
+		}
+		if body.Section != "" {
+			head, entries := body.SectionParts()
+			if heading == "" {
+				heading = head
+			}
+			spaced = spaced || strings.Contains(entries, "\n\n")
+			sources = append(sources, entries)
+		}
+		if text := strings.TrimSpace(body.Prose); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	merged := strings.Join(texts, "\n\n---\n\n")
+	if len(sources) > 0 {
+		sep := "\n"
+		if spaced {
+			sep = "\n\n"
+		}
+		section := strings.Join(sources, sep)
+		if heading != "" {
+			section = heading + "\n\n" + section
+		}
+		merged += "\n\n---\n\n" + section
+	}
+
+	first := refs[0].Ketab()
+	first_file := first.File
+	if err := f.write_ketab(first_file, merged); err != nil {
+		return nil, err
+	}
+	if title != "" {
+		first.Title = title
+	}
+
+	var removed []types.SingleKetab
+	drop := make(map[*types.SingleKetab]bool)
+	for _, ref := range refs[1:] {
+		removed = append(removed, *ref.Ketab())
+		drop[ref.Ketab()] = true
+	}
+	for _, ref := range refs {
+		renumber(ref.Chapter)
+	}
+	for ai := range f.Book.Acts {
+		for ci := range f.Book.Acts[ai].Chapters {
+			ch := &f.Book.Acts[ai].Chapters[ci]
+			kept := ch.Ketabs[:0]
+			for i := range ch.Ketabs {
+				if !drop[&ch.Ketabs[i]] {
+					kept = append(kept, ch.Ketabs[i])
+				}
+			}
+			ch.Ketabs = kept
+		}
+	}
+	for _, k := range removed {
+		if k.File != first_file {
+			os.Remove(filepath.Join(f.Dir, filepath.FromSlash(k.File)))
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,50 @@
+package bookfile
+
+import "testing"
+
+func TestMergeKetabsSources(t *testing.T) {
+	f, err := Init(t.TempDir(), "Book", "Author", "A book.", "Act 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := f.AddChapter(0, "Chapter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bodies := []string{
+		"Alpha cites [1] and [2].\n\n---\n\n**Sources**\n\n1. First A\n2. Second A",
+		"Beta cites [1].\n\n---\n\n**Sources**\n\n1. Only B\n   continued",
+		"Gamma cites nothing.",
+	}
+	for _, body := range bodies {
+		if _, err := f.AddKetab(ch.Number, 0, "Ketab", body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var refs []KetabRef
+	for _, ref := range []string{ch.Number + "/1", ch.Number + "/2", ch.Number + "/3"} {
+		r, err := f.Ketab(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, r)
+	}
+	first := refs[0].Ketab()
+	if _, err := f.MergeKetabs(refs, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := f.Body(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Alpha cites [1] and [2].\n\n---\n\nBeta cites [3].\n\n---\n\nGamma cites nothing.\n\n---\n\n" +
+		"**Sources**\n\n1. First A\n2. Second A\n3. Only B\n   continued"
+	if got != want {
+		t.Errorf("merged body =\n%s\n\nwant\n%s", got, want)
+	}
+	if n := len(f.Book.Acts[0].Chapters[0].Ketabs); n != 1 {
+		t.Errorf("chapter has %d ketabs after merging, want 1", n)
+	}
+}
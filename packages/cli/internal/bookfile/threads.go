@@ -0,0 +1,155 @@
+package bookfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/types"
+)
+
+// RemoveThreads deletes the discussion_id fields of the given threads from
+// the metadata files of the book in dir (book.json, and book-metadata.json
+// and book-shape.json in the legacy layout) and returns the files it
+// rewrote. Chapters are matched by d-tag, else by number, else by title.
+// The files are rewritten through their types, so fields keep their order.
+func RemoveThreads(dir string, threads []book.Thread) ([]string, error) {
+	var written []string
+
+	if _, err := os.Stat(filepath.Join(dir, "book.json")); err == nil {
+		f, err := Open(dir)
+		if err != nil {
+			return written, err
+		}
+		removed := false
+		for ai := range f.Book.Acts {
+			for ci := range f.Book.Acts[ai].Chapters {
+				ch := &f.Book.Acts[ai].Chapters[ci]
+				if ch.DiscussionID != "" && matches_thread(threads, ch.UUID, ch.Number, ch.Title) {
+					ch.DiscussionID = ""
+					removed = true
+				}
+			}
+		}
+		if remove_shape_threads(f.Book.Shape, threads) || removed {
+			if err := f.Save(); err != nil {
+				return written, err
+			}
+			written = append(written, "book.json")
+		}
+	}
+
+	var metadata types.BookMetadata
+	if ok, err := read_json(dir, "book-metadata.json", &metadata); err != nil {
+		return written, err
+	} else if ok {
+		removed := false
+		for ai := range metadata.Acts {
+			for ci := range metadata.Acts[ai].Chapters {
+				ch := &metadata.Acts[ai].Chapters[ci]
+				if ch.DiscussionID != "" && matches_thread(threads, ch.ChapterUUID, ch.ChapterNumber, ch.ChapterTitle) {
+					ch.DiscussionID = ""
+					removed = true
+				}
+			}
+		}
+		if removed {
+			if err := write_json(dir, "book-metadata.json", &metadata); err != nil {
+				return written, err
+			}
+			written = append(written, "book-metadata.json")
+		}
+	}
+
+	var shape types.BookShape
+	if ok, err := read_json(dir, "book-shape.json", &shape); err != nil {
+		return written, err
+	} else if ok && remove_shape_threads(shape.Shape, threads) {
+		if err := write_json(dir, "book-shape.json", &shape); err != nil {
+			return written, err
+		}
+		written = append(written, "book-shape.json")
+	}
+	return written, nil
+}
+
+// remove_shape_threads clears the discussion_id of the shape entries matching
+// threads, reporting whether any was cleared.
+func remove_shape_threads(shape [][]types.ShapeChapter, threads []book.Thread) bool {
+	removed := false
+	for ai := range shape {
+		for ci := range shape[ai] {
+			ch := &shape[ai][ci]
+			if ch.DiscussionID != "" && matches_thread(threads, ch.DTag, "", ch.Title) {
+				ch.DiscussionID = ""
+				removed = true
+			}
+		}
+	}
+	return removed
+}
+
+// matches_thread reports whether a chapter entry is one of threads: by d-tag
+// when it has one, else by number, else by title.
+func matches_thread(threads []book.Thread, uuid, number, title string) bool {
+	for _, t := range threads {
+		switch {
+		case uuid != "":
+			if uuid == t.ChapterUUID {
+				return true
+			}
+		case number != "":
+			if number == t.ChapterNumber {
+				return true
+			}
+		case title == t.ChapterTitle:
+			return true
+		}
+	}
+	return false
+}
+
+// read_json decodes dir/name into v, reporting false if the file does not
+// exist.
+func read_json(dir, name string, v any) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// write_json writes v to dir/name (see marshal).
+func write_json(dir, name string, v any) error {
+	data, err := marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", name, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// marshal encodes v indented, with a trailing newline. Characters such as &
+// and < are written as they are rather than as \u0026 and \u003c.
+func marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
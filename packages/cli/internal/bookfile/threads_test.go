@@ -0,0 +1,76 @@
+package bookfile
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/types"
+)
+
+func TestRemoveThreads(t *testing.T) {
+	dir := t.TempDir()
+	f, err := Init(dir, "Salt & Light", "A <Writer>", "Salt & light.", "Act 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"One", "Two"} {
+		if _, err := f.AddChapter(0, title); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chapters := f.Book.Acts[0].Chapters
+	chapters[0].DiscussionID = "note1one"
+	chapters[1].DiscussionID = "note1two"
+	f.Book.Shape = [][]types.ShapeChapter{{{Title: "One", DiscussionID: "note1one"}}}
+	if err := f.Save(); err != nil {
+		t.Fatal(err)
+	}
+	metadata := types.BookMetadata{BookTitle: "Salt & Light", Acts: []types.ActRef{{Chapters: []types.ChapterRef{
+		{ChapterNumber: "01", ChapterTitle: "One", ChapterUUID: chapters[0].UUID, DiscussionID: "note1one"},
+		{ChapterNumber: "02", ChapterTitle: "Two", ChapterUUID: chapters[1].UUID, DiscussionID: "note1two"},
+	}}}}
+	if err := write_json(dir, "book-metadata.json", &metadata); err != nil {
+		t.Fatal(err)
+	}
+
+	threads := []book.Thread{{ChapterNumber: "01", ChapterUUID: chapters[0].UUID, ChapterTitle: "One", Ref: "note1one"}}
+	written, err := RemoveThreads(dir, threads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(written, []string{"book.json", "book-metadata.json"}) {
+		t.Errorf("written = %v, want book.json and book-metadata.json", written)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "book.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	if strings.Contains(text, "note1one") || !strings.Contains(text, "note1two") {
+		t.Errorf("book.json discussion ids not updated:\n%s", text)
+	}
+	if !strings.Contains(text, `"Salt & Light"`) || !strings.Contains(text, `"A <Writer>"`) {
+		t.Errorf("book.json escapes HTML characters:\n%s", text)
+	}
+	if strings.Index(text, `"title"`) > strings.Index(text, `"uuid"`) {
+		t.Errorf("book.json fields were reordered:\n%s", text)
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, "book-metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := string(data); strings.Contains(text, "note1one") || !strings.Contains(text, "note1two") {
+		t.Errorf("book-metadata.json discussion ids not updated:\n%s", text)
+	}
+
+	// Nothing left to remove
+	if written, err := RemoveThreads(dir, threads); err != nil || len(written) != 0 {
+		t.Errorf("second RemoveThreads = %v, %v; want no files rewritten", written, err)
+	}
+}
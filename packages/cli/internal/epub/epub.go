@@ -0,0 +1,393 @@
+// Package epub writes books as EPUB 3: acts become parts, chapters become
+// XHTML content documents, ketabs become sections with stable anchors and a
+// link back to their Nostr address, and footnotes become endnotes.
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/markdown"
+	"github.com/joinnextblock/ketab-protocol/go-core/footnotes"
+)
+
+// Book is a book ready to be written as an EPUB.
+type Book struct {
+	// Identifier is the unique identifier of the publication (dc:identifier),
+	// such as "urn:uuid:<book-uuid>".
+	Identifier  string
+	Title       string
+	Author      string
+	Description string
+	Language    string
+	Modified    time.Time
+
+	// Naddr is the book's Nostr address (NIP-19), or "" when unknown.
+	Naddr string
+
+	Cover *Cover
+	Parts []Part
+}
+
+// Part is an act of the book.
+type Part struct {
+	Title    string
+	Chapters []Chapter
+}
+
+// Chapter is one chapter; it becomes one XHTML content document.
+type Chapter struct {
+	ID       string
+	Title    string
+	Naddr    string
+	Sections []Section
+}
+
+// Section is one ketab of a chapter.
+type Section struct {
+	ID    string
+	Title string
+	Naddr string
+
+	// Body is the ketab's markdown, including its sources section.
+	Body string
+}
+
+// Cover is the cover image.
+type Cover struct {
+	Data      []byte
+	MediaType string
+}
+
+// extension returns the file extension for the cover's media type.
+func (c *Cover) extension() string {
+	switch c.MediaType {
+	case "image/png":
+		return "png"
+	case "image/gif":
+		return "gif"
+	case "image/webp":
+		return "webp"
+	case "image/svg+xml":
+		return "svg"
+	}
+	return "jpg"
+}
+
+// id_re matches the characters allowed in the anchors this package makes.
+var id_re = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// ID returns a valid XML id from prefix and a d-tag or other key.
+func ID(prefix, key string) string {
+	return prefix + "-" + strings.Trim(id_re.ReplaceAllString(key, "-"), "-")
+}
+
+// WriteFile writes the book to path.
+func WriteFile(path string, b *Book) error {
+	var buf bytes.Buffer
+	if err := Write(&buf, b); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// item is a manifest entry.
+type item struct {
+	ID         string
+	Href       string
+	MediaType  string
+	Properties string
+	Spine      bool // read in order, after the items before it
+	Content    []byte
+}
+
+// nav_entry is an entry of the table of contents.
+type nav_entry struct {
+	Title    string
+	Href     string
+	Children []nav_entry
+}
+
+// endnote is a footnote of a ketab, collected in the notes document.
+type endnote struct {
+	ID       string
+	Label    string
+	Text     string
+	Backlink string
+}
+
+// endnote_group is the notes of one ketab. Chapter is only set on the first
+// group of each chapter.
+type endnote_group struct {
+	Chapter string
+	Section string
+	Notes   []endnote
+}
+
+// notes_file is the content document holding every endnote.
+const notes_file = "notes.xhtml"
+
+// Write writes the book as an EPUB 3 container. Chapters and parts without
+// content are left out.
+func Write(w io.Writer, b *Book) error {
+	if b.Title == "" {
+		return fmt.Errorf("book has no title")
+	}
+	if b.Language == "" {
+		b.Language = "en"
+	}
+	if b.Modified.IsZero() {
+		b.Modified = time.Now()
+	}
+	if b.Identifier == "" {
+		return fmt.Errorf("book has no identifier")
+	}
+
+	var items []*item
+	add := func(it *item) *item {
+		items = append(items, it)
+		return it
+	}
+	page := func(id, href, title, body string) *item {
+		return add(&item{ID: id, Href: href, MediaType: "application/xhtml+xml", Spine: true,
+			Content: render(document_template, map[string]any{"Lang": b.Language, "Title": title, "Body": body})})
+	}
+
+	add(&item{ID: "style", Href: "style.css", MediaType: "text/css", Content: []byte(style)})
+	if b.Cover != nil {
+		href := "images/cover." + b.Cover.extension()
+		add(&item{ID: "cover-image", Href: href, MediaType: b.Cover.MediaType, Properties: "cover-image", Content: b.Cover.Data})
+		page("cover", "cover.xhtml", b.Title, string(render(cover_template, map[string]any{"Src": href, "Title": b.Title})))
+	}
+	title_page := page("title", "title.xhtml", b.Title, string(render(title_template, map[string]any{
+		"Title":       b.Title,
+		"Author":      b.Author,
+		"Description": template_html((&markdown.Renderer{XHTML: true, Image: image_link}).Render(b.Description)),
+		"Naddr":       b.Naddr,
+	})))
+	nav := add(&item{ID: "nav", Href: "nav.xhtml", MediaType: "application/xhtml+xml", Properties: "nav", Spine: true})
+
+	// Parts only get their own page when there is more than one
+	var parts []Part
+	for _, part := range b.Parts {
+		var chapters []Chapter
+		for _, ch := range part.Chapters {
+			if len(ch.Sections) > 0 {
+				chapters = append(chapters, ch)
+			}
+		}
+		if len(chapters) > 0 {
+			parts = append(parts, Part{Title: part.Title, Chapters: chapters})
+		}
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("book has no chapters with content")
+	}
+	with_parts := len(parts) > 1
+
+	var toc []nav_entry
+	var groups []endnote_group
+	first_chapter := ""
+	chapter_count := 0
+	for p, part := range parts {
+		var part_entry *nav_entry
+		if with_parts {
+			href := fmt.Sprintf("part-%02d.xhtml", p+1)
+			title := part.Title
+			if title == "" {
+				title = fmt.Sprintf("Part %d", p+1)
+			}
+			page(fmt.Sprintf("part-%02d", p+1), href, title, string(render(part_template, map[string]any{"Title": title})))
+			toc = append(toc, nav_entry{Title: title, Href: href})
+			part_entry = &toc[len(toc)-1]
+		}
+		for _, ch := range part.Chapters {
+			chapter_count++
+			href := fmt.Sprintf("chapter-%03d.xhtml", chapter_count)
+			if first_chapter == "" {
+				first_chapter = href
+			}
+			body, chapter_groups := render_chapter(ch, href)
+			groups = append(groups, chapter_groups...)
+			page(fmt.Sprintf("chapter-%03d", chapter_count), href, ch.Title, body)
+
+			entry := nav_entry{Title: ch.Title, Href: href}
+			for _, sec := range ch.Sections {
+				if sec.Title != "" {
+					entry.Children = append(entry.Children, nav_entry{Title: sec.Title, Href: href + "#" + sec.ID})
+				}
+			}
+			if part_entry != nil {
+				part_entry.Children = append(part_entry.Children, entry)
+			} else {
+				toc = append(toc, entry)
+			}
+		}
+	}
+	if len(groups) > 0 {
+		page("notes", notes_file, "Notes", string(render(notes_template, map[string]any{"Groups": groups})))
+		toc = append(toc, nav_entry{Title: "Notes", Href: notes_file})
+	}
+	nav.Content = render(nav_template, map[string]any{
+		"Lang":      b.Language,
+		"Title":     b.Title,
+		"TOC":       toc,
+		"Start":     first_chapter,
+		"TitlePage": title_page.Href,
+	})
+
+	opf := render(package_template, map[string]any{"Book": b, "Items": items, "Modified": b.Modified.UTC().Format("2006-01-02T15:04:05Z")})
+	return write_container(w, b.Modified, opf, items)
+}
+
+// render_chapter renders a chapter's sections, separated as their bodies are
+// when the chapter is compiled, and returns their endnotes.
+func render_chapter(ch Chapter, href string) (string, []endnote_group) {
+	var out strings.Builder
+	var groups []endnote_group
+	fmt.Fprintf(&out, "<section epub:type=\"chapter\" id=\"%s\">\n<h1>%s</h1>\n", ch.ID, esc(ch.Title))
+	if ch.Naddr != "" {
+		fmt.Fprintf(&out, "<p class=\"nostr\"><a href=\"nostr:%s\">View chapter on Nostr</a></p>\n", ch.Naddr)
+	}
+	for i, sec := range ch.Sections {
+		if i > 0 {
+			out.WriteString("<hr class=\"ketab-break\"/>\n")
+		}
+		body := footnotes.Parse(sec.Body)
+		text, notes := body.Prose, body.Sources
+		group := endnote_group{Chapter: ch.Title, Section: sec.Title}
+		note_ids := make(map[string]string)
+		for _, note := range notes {
+			note_ids[note.Label] = ID("note", sec.ID+"-"+note.Label)
+		}
+		referenced := make(map[string]bool)
+		md := &markdown.Renderer{XHTML: true, Image: image_link, NoteRef: func(label string) string {
+			id, ok := note_ids[label]
+			if !ok {
+				return ""
+			}
+			ref_attr := ""
+			if !referenced[label] {
+				referenced[label] = true
+				ref_attr = fmt.Sprintf(` id="%s"`, ID("ref", sec.ID+"-"+label))
+			}
+			return fmt.Sprintf(`<a epub:type="noteref" class="noteref" href="%s#%s"%s>%s</a>`, notes_file, id, ref_attr, label)
+		}}
+
+		fmt.Fprintf(&out, "<section class=\"ketab\" id=\"%s\">\n", sec.ID)
+		if sec.Title != "" {
+			fmt.Fprintf(&out, "<h2 class=\"ketab-title\">%s</h2>\n", esc(sec.Title))
+		}
+		out.WriteString(md.Render(text))
+		if sec.Naddr != "" {
+			fmt.Fprintf(&out, "<p class=\"nostr\"><a href=\"nostr:%s\">%s</a></p>\n", sec.Naddr, esc(short_naddr(sec.Naddr)))
+		}
+		out.WriteString("</section>\n")
+
+		for _, note := range notes {
+			n := endnote{ID: note_ids[note.Label], Label: note.Label, Text: md.Inline(note.Text)}
+			if referenced[note.Label] {
+				n.Backlink = href + "#" + ID("ref", sec.ID+"-"+note.Label)
+			}
+			group.Notes = append(group.Notes, n)
+		}
+		if len(group.Notes) > 0 {
+			if len(groups) > 0 {
+				group.Chapter = ""
+			}
+			groups = append(groups, group)
+		}
+	}
+	out.WriteString("</section>\n")
+	return out.String(), groups
+}
+
+// image_link renders an image as a link to it: EPUB content may only embed
+// images packaged in the container.
+func image_link(src, alt string) string {
+	if alt == "" {
+		alt = "image"
+	}
+	return fmt.Sprintf(`<a class="image" href="%s">[%s]</a>`, src, alt)
+}
+
+// short_naddr abbreviates a naddr for display.
+func short_naddr(naddr string) string {
+	if len(naddr) <= 24 {
+		return "nostr:" + naddr
+	}
+	return "nostr:" + naddr[:14] + "…" + naddr[len(naddr)-8:]
+}
+
+// write_container writes the zip container: the uncompressed mimetype entry
+// first, as the OCF specification requires, then the package files.
+func write_container(w io.Writer, modified time.Time, opf []byte, items []*item) error {
+	zw := zip.NewWriter(w)
+	mimetype := []byte("application/epub+zip")
+	header := &zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(mimetype),
+		CompressedSize64:   uint64(len(mimetype)),
+		UncompressedSize64: uint64(len(mimetype)),
+	}
+	f, err := zw.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(mimetype); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"META-INF/container.xml", []byte(container_xml)},
+		{"OEBPS/content.opf", opf},
+	}
+	for _, it := range items {
+		files = append(files, struct {
+			name string
+			data []byte
+		}{"OEBPS/" + it.Href, it.Content})
+	}
+	for _, file := range files {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(file.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// template_html marks already rendered markup so templates do not escape it.
+type template_html string
+
+func esc(s string) string {
+	return html.EscapeString(s)
+}
+
+func render(t *template.Template, data any) []byte {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		// The templates are fixed; a failure here is a bug
+		panic(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,70 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteWellFormed(t *testing.T) {
+	b := &Book{
+		Identifier: "urn:uuid:00000000-0000-4000-8000-000000000001",
+		Title:      "Test & Book",
+		Author:     "Tester",
+		Modified:   time.Unix(1700000000, 0),
+		Parts: []Part{{
+			Title: "One",
+			Chapters: []Chapter{{
+				ID:    ID("c", "one"),
+				Title: "First <chapter>",
+				Sections: []Section{{
+					ID:    ID("k", "one"),
+					Title: "First",
+					Body: "Read [docs](https://example.com/_private_/x) and *a **b* c** then ~~x *y~~ z*.\n\n" +
+						"See ![pic_1](https://example.com/a_b_.png), `code_x_` and snake_case.[1]\n\n" +
+						"**bold *mixed** end* and [**b** link](https://a.example/q_r_s).\n\n" +
+						"---\n\n**Sources**\n\n1. [A_source_](https://example.com/_s_)\n",
+				}},
+			}},
+		}},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, b); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checked := 0
+	for _, f := range zr.File {
+		if !strings.HasSuffix(f.Name, ".xhtml") && !strings.HasSuffix(f.Name, ".opf") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec := xml.NewDecoder(rc)
+		for {
+			_, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("%s is not well-formed: %v", f.Name, err)
+				break
+			}
+		}
+		rc.Close()
+		checked++
+	}
+	if checked == 0 {
+		t.Fatal("no XHTML documents in the EPUB")
+	}
+}
@@ -0,0 +1,202 @@
+package epub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/fetch"
+	core "github.com/joinnextblock/ketab-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// max_cover caps the size of a downloaded cover image.
+const max_cover = 20 << 20
+
+var uuid_re = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// FromLocal converts a book directory, with acts, chapters and ketabs in the
+// order `ketab publish` lists them. pubkey (hex) and relays are used for the
+// Nostr addresses of the book, chapters and ketabs; without a pubkey the
+// EPUB has none. The cover is not loaded (see LoadCover).
+func FromLocal(bk *book.Book, pubkey string, relays []string) *Book {
+	m := bk.Metadata
+	b := &Book{
+		Identifier:  identifier(m.BookUUID),
+		Title:       m.BookTitle,
+		Author:      m.Author,
+		Description: first_nonempty(m.Description, m.Summary),
+		Naddr:       naddr(pubkey, core.KindBook, m.BookUUID, relays),
+	}
+	for _, act := range m.Acts {
+		part := Part{Title: act.Title}
+		for _, ref := range act.Chapters {
+			ch, ok := bk.Chapters[ref.ChapterNumber]
+			if !ok {
+				continue
+			}
+			chapter := Chapter{
+				ID:    ID("chapter", ch.Metadata.ChapterUUID),
+				Title: fmt.Sprintf("Chapter %s: %s", ch.Metadata.ChapterNumber, ch.Metadata.ChapterTitle),
+				Naddr: naddr(pubkey, core.KindChapter, ch.Metadata.ChapterUUID, relays),
+			}
+			for _, k := range ch.Ketabs {
+				key := k.Item.UUID
+				if key == "" {
+					key = fmt.Sprintf("%s-%d", ch.Number, k.Item.Number)
+				}
+				chapter.Sections = append(chapter.Sections, Section{
+					ID:    ID("k", key),
+					Title: k.Item.Title,
+					Naddr: naddr(pubkey, core.KindKetab, k.Item.UUID, relays),
+					Body:  k.Body,
+				})
+			}
+			part.Chapters = append(part.Chapters, chapter)
+		}
+		b.Parts = append(b.Parts, part)
+	}
+	return b
+}
+
+// FromFetched converts a book fetched from relays. A chapter whose ketabs
+// were not found is exported from the chapter event's content as a single
+// section. The cover is not loaded (see LoadCover).
+func FromFetched(fb *fetch.Book) *Book {
+	pubkey := fb.Pointer.PublicKey
+	relays := fb.Pointer.Relays
+	b := &Book{
+		Identifier:  identifier(fb.Pointer.Identifier),
+		Title:       fb.Content.Title,
+		Author:      fb.Content.Author,
+		Description: first_nonempty(fb.Content.Description, fb.Content.Summary),
+		Naddr:       naddr(pubkey, core.KindBook, fb.Pointer.Identifier, relays),
+	}
+	position := 0
+	for _, act := range fb.Acts {
+		part := Part{Title: act.Title}
+		for _, ch := range act.Chapters {
+			position++
+			// The chapter event's title, as published, before the book's listing
+			title := ch.Title
+			if ch.Event != nil {
+				if tag := ch.Event.Tags.Find("title"); len(tag) >= 2 && tag[1] != "" {
+					title = tag[1]
+				}
+			}
+			if title == "" {
+				title = fmt.Sprintf("Chapter %d", position)
+			}
+			chapter := Chapter{
+				ID:    ID("chapter", ch.DTag),
+				Title: title,
+				Naddr: naddr(pubkey, core.KindChapter, ch.DTag, relays),
+			}
+			for _, k := range ch.Ketabs {
+				chapter.Sections = append(chapter.Sections, Section{
+					ID:    ID("k", k.DTag),
+					Title: k.Content.Title,
+					Naddr: naddr(pubkey, core.KindKetab, k.DTag, relays),
+					Body:  k.Content.Body,
+				})
+			}
+			if len(chapter.Sections) == 0 && ch.Event != nil && strings.TrimSpace(ch.Event.Content) != "" {
+				chapter.Sections = append(chapter.Sections, Section{
+					ID:   ID("k", ch.DTag),
+					Body: ch.Event.Content,
+				})
+			}
+			part.Chapters = append(part.Chapters, chapter)
+		}
+		b.Parts = append(b.Parts, part)
+	}
+	return b
+}
+
+// LoadCover reads a cover image from an http(s) URL or a path relative to
+// dir; with an empty dir only URLs are accepted. The media type is sniffed from the data; only JPEG, PNG, GIF, WebP
+// and SVG images are accepted.
+func LoadCover(ctx context.Context, ref, dir string) (*Cover, error) {
+	var data []byte
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ref, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download cover: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to download cover: %s", resp.Status)
+		}
+		if data, err = io.ReadAll(io.LimitReader(resp.Body, max_cover+1)); err != nil {
+			return nil, fmt.Errorf("failed to download cover: %w", err)
+		}
+		if len(data) > max_cover {
+			return nil, fmt.Errorf("cover is larger than %d MB", max_cover>>20)
+		}
+	} else if dir == "" {
+		return nil, fmt.Errorf("cover %q is not an http(s) URL", ref)
+	} else {
+		path := ref
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read cover: %w", err)
+		}
+	}
+
+	media_type := http.DetectContentType(data)
+	if i := strings.Index(media_type, ";"); i >= 0 {
+		media_type = media_type[:i]
+	}
+	switch {
+	case media_type == "image/jpeg" || media_type == "image/png" || media_type == "image/gif" || media_type == "image/webp":
+	case strings.Contains(string(data[:min(len(data), 512)]), "<svg"):
+		media_type = "image/svg+xml"
+	default:
+		return nil, fmt.Errorf("cover is %s, not a JPEG, PNG, GIF, WebP or SVG image", media_type)
+	}
+	return &Cover{Data: data, MediaType: media_type}, nil
+}
+
+// identifier returns the dc:identifier for a book d-tag: a urn:uuid when it
+// is a UUID.
+func identifier(d string) string {
+	if uuid_re.MatchString(d) {
+		return "urn:uuid:" + strings.ToLower(d)
+	}
+	return "urn:ketab:" + d
+}
+
+// naddr encodes an addressable event's NIP-19 address, or returns "" without
+// a pubkey.
+func naddr(pubkey string, kind int, d string, relays []string) string {
+	if pubkey == "" || d == "" {
+		return ""
+	}
+	s, err := nip19.EncodeEntity(pubkey, kind, d, relays)
+	if err != nil {
+		return ""
+	}
+	return s
+}
+
+func first_nonempty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+package epub
+
+import "text/template"
+
+// Templates print strings through x, which escapes them; rendered markup
+// (template_html and bodies) is printed as it is.
+var funcs = template.FuncMap{"x": esc}
+
+const container_xml = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+const style = `body { font-family: serif; line-height: 1.5; margin: 0 5%; }
+h1 { text-align: center; margin: 2em 0 1em; }
+h2.ketab-title { font-size: 0.8em; letter-spacing: 0.08em; text-transform: uppercase; margin-top: 2em; }
+hr.ketab-break { border: 0; margin: 2em 0; text-align: center; }
+hr.ketab-break:after { content: "* * *"; }
+blockquote { margin-left: 1em; font-style: italic; }
+a.noteref { vertical-align: super; font-size: 0.7em; line-height: 0; text-decoration: none; }
+p.nostr { font-size: 0.7em; text-align: right; }
+section.cover { text-align: center; }
+section.cover img { max-width: 100%; max-height: 100%; }
+section.titlepage { text-align: center; margin-top: 20%; }
+section.titlepage .author { font-style: italic; }
+section.part h1 { margin-top: 40%; }
+`
+
+var document_template = template.Must(template.New("document").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{x .Lang}}" xml:lang="{{x .Lang}}">
+<head>
+<meta charset="utf-8"/>
+<title>{{x .Title}}</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+{{.Body}}</body>
+</html>
+`))
+
+var cover_template = template.Must(template.New("cover").Funcs(funcs).Parse(`<section class="cover" epub:type="cover">
+<img src="{{x .Src}}" alt="Cover of {{x .Title}}"/>
+</section>
+`))
+
+var title_template = template.Must(template.New("title").Funcs(funcs).Parse(`<section class="titlepage" epub:type="titlepage">
+<h1>{{x .Title}}</h1>
+{{if .Author}}<p class="author">{{x .Author}}</p>
+{{end}}{{.Description}}{{if .Naddr}}<p class="nostr"><a href="nostr:{{x .Naddr}}">Read on Nostr</a></p>
+{{end}}</section>
+`))
+
+var part_template = template.Must(template.New("part").Funcs(funcs).Parse(`<section class="part" epub:type="part">
+<h1>{{x .Title}}</h1>
+</section>
+`))
+
+var notes_template = template.Must(template.New("notes").Funcs(funcs).Parse(`<section epub:type="endnotes">
+<h1>Notes</h1>
+{{range .Groups}}{{if .Chapter}}<h2>{{x .Chapter}}</h2>
+{{end}}{{if .Section}}<h3>{{x .Section}}</h3>
+{{end}}<ol>
+{{range .Notes}}<li id="{{.ID}}" epub:type="endnote"><p>{{.Text}}{{if .Backlink}} <a href="{{x .Backlink}}">↩</a>{{end}}</p></li>
+{{end}}</ol>
+{{end}}</section>
+`))
+
+var nav_template = template.Must(template.New("nav").Funcs(funcs).Parse(`{{define "entries"}}<ol>
+{{range .}}<li><a href="{{x .Href}}">{{x .Title}}</a>{{if .Children}}
+{{template "entries" .Children}}{{end}}</li>
+{{end}}</ol>{{end}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{x .Lang}}" xml:lang="{{x .Lang}}">
+<head>
+<meta charset="utf-8"/>
+<title>{{x .Title}}</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+<nav epub:type="toc" id="toc">
+<h1>Contents</h1>
+{{template "entries" .TOC}}
+</nav>
+<nav epub:type="landmarks" hidden="hidden">
+<ol>
+<li><a epub:type="titlepage" href="{{x .TitlePage}}">Title page</a></li>
+<li><a epub:type="toc" href="#toc">Contents</a></li>
+<li><a epub:type="bodymatter" href="{{x .Start}}">Start of content</a></li>
+</ol>
+</nav>
+</body>
+</html>
+`))
+
+var package_template = template.Must(template.New("package").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="{{x .Book.Language}}">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="book-id">{{x .Book.Identifier}}</dc:identifier>
+<dc:title>{{x .Book.Title}}</dc:title>
+{{if .Book.Author}}<dc:creator>{{x .Book.Author}}</dc:creator>
+{{end}}<dc:language>{{x .Book.Language}}</dc:language>
+{{if .Book.Description}}<dc:description>{{x .Book.Description}}</dc:description>
+{{end}}{{if .Book.Naddr}}<dc:source>nostr:{{x .Book.Naddr}}</dc:source>
+{{end}}<meta property="dcterms:modified">{{.Modified}}</meta>
+{{if .Book.Cover}}<meta name="cover" content="cover-image"/>
+{{end}}</metadata>
+<manifest>
+{{range .Items}}<item id="{{.ID}}" href="{{x .Href}}" media-type="{{.MediaType}}"{{if .Properties}} properties="{{.Properties}}"{{end}}/>
+{{end}}</manifest>
+<spine>
+{{range .Items}}{{if .Spine}}<itemref idref="{{.ID}}"/>
+{{end}}{{end}}</spine>
+</package>
+`))
@@ -0,0 +1,95 @@
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// KindDeletion is the NIP-09 deletion request kind.
+const KindDeletion = 5
+
+// DeletionTarget is an event to delete: by id (`e` tag), by coordinate (`a`
+// tag, which covers every version of a replaceable event), or both.
+type DeletionTarget struct {
+	ID         string
+	Coordinate string // <kind>:<pubkey>:<d-tag>
+	Kind       int    // 0 if unknown
+}
+
+// String returns the coordinate, else the id.
+func (t DeletionTarget) String() string {
+	if t.Coordinate != "" {
+		return t.Coordinate
+	}
+	return t.ID
+}
+
+// Pubkey returns the author in the coordinate, or "" for id-only targets.
+func (t DeletionTarget) Pubkey() string {
+	if parts := strings.SplitN(t.Coordinate, ":", 3); len(parts) == 3 {
+		return parts[1]
+	}
+	return ""
+}
+
+// ParseDeletionTarget parses a hex event id, note, nevent, naddr or
+// <kind>:<pubkey>:<d-tag> coordinate.
+func ParseDeletionTarget(ref string) (DeletionTarget, error) {
+	ref = strings.TrimSpace(ref)
+	if nostr.IsValid32ByteHex(ref) {
+		return DeletionTarget{ID: ref}, nil
+	}
+	if parts := strings.SplitN(ref, ":", 3); len(parts) == 3 {
+		kind, err := strconv.Atoi(parts[0])
+		if err != nil || !nostr.IsValidPublicKey(parts[1]) {
+			return DeletionTarget{}, fmt.Errorf("invalid coordinate %q (want <kind>:<pubkey>:<d-tag>)", ref)
+		}
+		return DeletionTarget{Coordinate: ref, Kind: kind}, nil
+	}
+	prefix, data, err := nip19.Decode(ref)
+	if err != nil {
+		return DeletionTarget{}, fmt.Errorf("invalid event reference %q: %w", ref, err)
+	}
+	switch v := data.(type) {
+	case string:
+		if prefix == "note" {
+			return DeletionTarget{ID: v}, nil
+		}
+	case nostr.EventPointer:
+		return DeletionTarget{ID: v.ID, Kind: v.Kind}, nil
+	case nostr.EntityPointer:
+		return DeletionTarget{Coordinate: v.AsTagReference(), Kind: v.Kind}, nil
+	}
+	return DeletionTarget{}, fmt.Errorf("cannot delete a %s reference", prefix)
+}
+
+// BuildDeletion builds a NIP-09 deletion request (kind 5) for targets: an `e`
+// tag per id, an `a` tag per coordinate and a `k` tag per known kind. Relays
+// only honor it for events signed by the same pubkey.
+func (b *Builder) BuildDeletion(targets []DeletionTarget, reason string) nostr.Event {
+	tags := nostr.Tags{}
+	kinds := make(map[int]bool)
+	for _, t := range targets {
+		if t.ID != "" {
+			tags = append(tags, nostr.Tag{"e", t.ID})
+		}
+		if t.Coordinate != "" {
+			tags = append(tags, nostr.Tag{"a", t.Coordinate})
+		}
+		if t.Kind != 0 && !kinds[t.Kind] {
+			kinds[t.Kind] = true
+			tags = append(tags, nostr.Tag{"k", strconv.Itoa(t.Kind)})
+		}
+	}
+	return nostr.Event{
+		Kind:      KindDeletion,
+		CreatedAt: nostr.Timestamp(time.Now().Unix()),
+		Tags:      tags,
+		Content:   reason,
+	}
+}
@@ -4,9 +4,11 @@ package events
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/library"
 	"github.com/joinnextblock/ketab-protocol/cli/internal/types"
 	core "github.com/joinnextblock/ketab-protocol/go-core"
 	"github.com/nbd-wtf/go-nostr"
@@ -14,16 +16,17 @@ import (
 
 // Event kind constants.
 const (
-	KindKetab   = 38893 // Individual scene/passage
-	KindChapter = 30023 // NIP-23 long-form content
+	KindKetab   = core.KindKetab   // Individual scene/passage
+	KindChapter = core.KindChapter // NIP-23 long-form content
 	KindBook    = core.KindBook
 	KindLibrary = core.KindLibrary
 )
 
 // Builder builds Nostr events for a book.
 type Builder struct {
-	pubkey     string
-	relay_hint string
+	pubkey       string
+	relay_hint   string
+	published_at map[string]int64 // coordinate -> first publish time
 }
 
 // NewBuilder creates a new event builder.
@@ -34,7 +37,24 @@ func NewBuilder(pubkey string, relay_hint string) *Builder {
 	}
 }
 
+// PreservePublishedAt makes the builder reuse first-publish timestamps, keyed by
+// coordinate, for chapter and book events instead of stamping the current time.
+func (b *Builder) PreservePublishedAt(timestamps map[string]int64) {
+	b.published_at = timestamps
+}
+
+// get_published_at returns the preserved publish time for coord, or fallback.
+func (b *Builder) get_published_at(coord string, fallback int64) int64 {
+	if ts, ok := b.published_at[coord]; ok && ts != 0 {
+		return ts
+	}
+	return fallback
+}
+
 // BuildKetab builds a ketab event (kind 38893).
+// The parent chapter coordinate is emitted as an `a` tag (KETAB-01) so sibling
+// ketabs can be discovered with a #a filter, followed by `t` topic tags from
+// the chapter and the ketab.
 func (b *Builder) BuildKetab(ch *book.Chapter, ketab book.Ketab) nostr.Event {
 	content := types.KetabContent{
 		Title: ketab.Item.Title,
@@ -45,26 +65,55 @@ func (b *Builder) BuildKetab(ch *book.Chapter, ketab book.Ketab) nostr.Event {
 
 	content_json, _ := json.Marshal(content)
 
+	tags := nostr.Tags{
+		{"d", ketab.Item.UUID},
+		{"a", b.ChapterCoordinate(ch), b.relay_hint},
+	}
+
+	seen := make(map[string]bool)
+	for _, topic := range append(ch.Metadata.GetTopics(), ketab.Item.Topics...) {
+		topic = strings.ToLower(strings.TrimSpace(topic))
+		if topic == "" || seen[topic] {
+			continue
+		}
+		seen[topic] = true
+		tags = append(tags, nostr.Tag{"t", topic})
+	}
+
 	return nostr.Event{
 		Kind:      KindKetab,
 		CreatedAt: nostr.Timestamp(time.Now().Unix()),
-		Tags: nostr.Tags{
-			{"d", ketab.Item.UUID},
-		},
-		Content: string(content_json),
+		Tags:      tags,
+		Content:   string(content_json),
 	}
 }
 
+// BookCoordinate returns the book's coordinate (38891:<pubkey>:<book-d-tag>).
+func (b *Builder) BookCoordinate(bk *book.Book) string {
+	return fmt.Sprintf("%d:%s:%s", KindBook, b.pubkey, bk.Metadata.BookUUID)
+}
+
+// ChapterCoordinate returns the chapter's coordinate (30023:<pubkey>:<chapter-d-tag>).
+func (b *Builder) ChapterCoordinate(ch *book.Chapter) string {
+	return fmt.Sprintf("%d:%s:%s", KindChapter, b.pubkey, ch.Metadata.ChapterUUID)
+}
+
 // BuildChapter builds a chapter event (kind 30023).
 func (b *Builder) BuildChapter(bk *book.Book, ch *book.Chapter) nostr.Event {
 	// Compile full chapter body from all ketabs
 	body := ch.CompileChapterBody()
 
+	published_at := ch.Metadata.PublishedAt
+	if published_at == 0 {
+		published_at = time.Now().Unix()
+	}
+	published_at = b.get_published_at(b.ChapterCoordinate(ch), published_at)
+
 	// Build tags
 	tags := nostr.Tags{
 		{"d", ch.Metadata.ChapterUUID},
 		{"title", fmt.Sprintf("Chapter %s: %s", ch.Metadata.ChapterNumber, ch.Metadata.ChapterTitle)},
-		{"published_at", fmt.Sprintf("%d", time.Now().Unix())},
+		{"published_at", fmt.Sprintf("%d", published_at)},
 		// Reference parent book
 		{"a", fmt.Sprintf("%d:%s:%s", KindBook, b.pubkey, bk.Metadata.BookUUID), b.relay_hint},
 	}
@@ -85,16 +134,11 @@ func (b *Builder) BuildChapter(bk *book.Book, ch *book.Chapter) nostr.Event {
 }
 
 // BookContent is the JSON content for a book event.
+// It is the go-core BookContent (validated by go-core) plus the legacy
+// 3-level acts hierarchy still read by older clients.
 type BookContent struct {
-	Title         string       `json:"title"`
-	Description   string       `json:"description"`
-	Author        string       `json:"author"`
-	CoverImageURL string       `json:"cover_image_url,omitempty"`
-	PublishedAt   int64        `json:"published_at"`
-	Shape         any          `json:"shape,omitempty"` // From book-shape.json (optional)
-	Acts          []PublishAct `json:"acts"`            // 3-level hierarchy: acts → chapters → ketabs
-	RefBookPubkey string       `json:"ref_book_pubkey"`
-	RefBookID     string       `json:"ref_book_id"`
+	core.BookContent
+	Acts []PublishAct `json:"acts"` // 3-level hierarchy: acts → chapters → ketabs
 }
 
 // PublishAct represents an act in the published book event.
@@ -128,12 +172,15 @@ func (b *Builder) BuildBook(bk *book.Book, chapter_nums []string) nostr.Event {
 	}
 
 	var acts []PublishAct
+	shape := [][]core.BookShapeChapter{}
 	for _, act_ref := range bk.Metadata.Acts {
 		publishAct := PublishAct{
 			Title:    act_ref.Title,
 			Chapters: []PublishChapter{}, // Initialize as empty array, not nil
 		}
 
+		shape_act := []core.BookShapeChapter{}
+
 		// Add chapters from this act
 		for _, ch_ref := range act_ref.Chapters {
 			publishChapter := PublishChapter{
@@ -142,6 +189,12 @@ func (b *Builder) BuildBook(bk *book.Book, chapter_nums []string) nostr.Event {
 				UUID:   ch_ref.ChapterUUID,
 				Ketabs: []PublishKetab{}, // Initialize as empty array, not nil
 			}
+			shape_chapter := core.BookShapeChapter{
+				Title:        ch_ref.ChapterTitle,
+				DTag:         ch_ref.ChapterUUID,
+				DiscussionID: ch_ref.DiscussionID,
+				Ketabs:       []core.BookShapeKetab{},
+			}
 
 			// Only add ketabs if this chapter is being published
 			if published_chapters[ch_ref.ChapterNumber] {
@@ -151,31 +204,35 @@ func (b *Builder) BuildBook(bk *book.Book, chapter_nums []string) nostr.Event {
 							Title: ketab.Item.Title,
 							UUID:  ketab.Item.UUID,
 						})
+						shape_chapter.Ketabs = append(shape_chapter.Ketabs, core.BookShapeKetab{
+							Title: ketab.Item.Title,
+							DTag:  ketab.Item.UUID,
+						})
 					}
 				}
 			}
 			
 			publishAct.Chapters = append(publishAct.Chapters, publishChapter)
+			shape_act = append(shape_act, shape_chapter)
 		}
 
 		acts = append(acts, publishAct)
+		shape = append(shape, shape_act)
 	}
 
 	// Build content
 	content := BookContent{
-		Title:         bk.Metadata.BookTitle,
-		Description:   bk.Metadata.Description,
-		Author:        bk.Metadata.Author,
-		CoverImageURL: bk.Metadata.Image,
-		PublishedAt:   now,
-		Acts:          acts, // Use the constructed 3-level hierarchy
-		RefBookPubkey: b.pubkey,
-		RefBookID:     bk.Metadata.BookUUID,
-	}
-
-	// Optionally include book-shape.json data if available
-	if bk.Shape != nil {
-		content.Shape = bk.Shape.Shape
+		BookContent: core.BookContent{
+			Title:         bk.Metadata.BookTitle,
+			Description:   bk.Metadata.Description,
+			Author:        bk.Metadata.Author,
+			CoverImageURL: bk.Metadata.Image,
+			PublishedAt:   b.get_published_at(b.BookCoordinate(bk), now),
+			Shape:         shape, // Shape mirrors acts, restricted to published chapters
+			RefBookPubkey: b.pubkey,
+			RefBookID:     bk.Metadata.BookUUID,
+		},
+		Acts: acts, // Use the constructed 3-level hierarchy
 	}
 
 	content_json, _ := json.Marshal(content)
@@ -200,8 +257,7 @@ func (b *Builder) BuildBook(bk *book.Book, chapter_nums []string) nostr.Event {
 	// Add chapter references
 	for _, ch_num := range chapter_nums {
 		if ch, ok := bk.GetChapter(ch_num); ok {
-			addr := fmt.Sprintf("%d:%s:%s", KindChapter, b.pubkey, ch.Metadata.ChapterUUID)
-			tags = append(tags, nostr.Tag{"a", addr, b.relay_hint})
+			tags = append(tags, nostr.Tag{"a", b.ChapterCoordinate(ch), b.relay_hint})
 		}
 	}
 
@@ -213,29 +269,45 @@ func (b *Builder) BuildBook(bk *book.Book, chapter_nums []string) nostr.Event {
 	}
 }
 
-// LibraryContent is the JSON content for a library event.
-type LibraryContent struct {
-	Name        string   `json:"name"`
-	Description string   `json:"description"`
-	Books       []string `json:"books"`
-}
-
-// BuildLibrary builds a library event (kind 38890).
-func (b *Builder) BuildLibrary(bk *book.Book, library_id string, library_name string) nostr.Event {
-	book_coord := fmt.Sprintf("%d:%s:%s", KindBook, b.pubkey, bk.Metadata.BookUUID)
+// BuildLibrary builds a library event (kind 38890) listing every book of lib,
+// in order. block_coordinate is the City Protocol block the library is
+// anchored to (38808:<clock_pubkey>:org.cityprotocol:block:<height>:<hash>);
+// the clock pubkey is taken from it.
+func (b *Builder) BuildLibrary(lib *library.Library, block_coordinate string) nostr.Event {
+	clock_pubkey := ClockPubkeyFromBlock(block_coordinate)
+	books := make([]core.LibraryBook, 0, len(lib.Books))
+	for _, bk := range lib.Books {
+		books = append(books, core.LibraryBook{D: bk.D, Title: bk.Title})
+	}
 
-	content := LibraryContent{
-		Name:        library_name,
-		Description: "Books published on Nostr. Read by citizens.",
-		Books:       []string{book_coord},
+	content := core.LibraryContent{
+		Name:             lib.Name,
+		Description:      lib.Description,
+		RelayURL:         b.relay_hint,
+		FounderPubkey:    b.pubkey,
+		ProtocolVersion:  core.Version,
+		RefLibraryPubkey: b.pubkey,
+		RefLibraryID:     lib.D,
+		RefClockPubkey:   clock_pubkey,
+		BookCount:        len(books),
+		Books:            books,
 	}
 
 	content_json, _ := json.Marshal(content)
 
 	tags := nostr.Tags{
-		{"d", library_id},
-		{"title", library_name},
-		{"a", book_coord, b.relay_hint},
+		{"d", lib.D},
+		{"title", lib.Name},
+		{"p", b.pubkey},
+	}
+	if block_coordinate != "" {
+		tags = append(tags, nostr.Tag{"a", block_coordinate})
+	}
+	if clock_pubkey != "" {
+		tags = append(tags, nostr.Tag{"p", clock_pubkey})
+	}
+	for _, bk := range lib.Books {
+		tags = append(tags, nostr.Tag{"a", bk.Coordinate(), b.relay_hint})
 	}
 
 	return nostr.Event{
@@ -246,7 +318,13 @@ func (b *Builder) BuildLibrary(bk *book.Book, library_id string, library_name st
 	}
 }
 
-// SignEvent signs an event with the given secret key.
-func SignEvent(event *nostr.Event, sk string) error {
-	return event.Sign(sk)
+// ClockPubkeyFromBlock returns the clock pubkey of a City Protocol block
+// coordinate (38808:<clock_pubkey>:...), or "" if it is not one.
+func ClockPubkeyFromBlock(block_coordinate string) string {
+	parts := strings.SplitN(block_coordinate, ":", 3)
+	if len(parts) < 3 || parts[0] != "38808" {
+		return ""
+	}
+	return parts[1]
 }
+
@@ -0,0 +1,406 @@
+// Package fetch reconstructs books from relays following the KETAB-01 discovery algorithm.
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	core "github.com/joinnextblock/ketab-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// Book is a book reconstructed from relays.
+type Book struct {
+	Pointer nostr.EntityPointer
+	Event   *nostr.Event
+	Content BookContent
+	Acts    []Act
+}
+
+// Act is an act of a fetched book.
+type Act struct {
+	Title    string
+	Chapters []*Chapter
+}
+
+// Chapter is a chapter of a fetched book.
+// Event is nil if the chapter (kind 30023) was not found on any relay.
+type Chapter struct {
+	DTag   string
+	Title  string
+	Event  *nostr.Event
+	Ketabs []*Ketab
+}
+
+// Ketab is a ketab (kind 38893) of a fetched chapter.
+type Ketab struct {
+	DTag    string
+	Event   *nostr.Event
+	Content core.KetabContent
+	Topics  []string
+}
+
+// ContentChapter is a chapter reference in the KETAB-01 `chapters` array.
+type ContentChapter struct {
+	D     string `json:"d"`
+	Title string `json:"title"`
+}
+
+// ContentAct is an act in the legacy `acts` hierarchy published by older CLIs.
+type ContentAct struct {
+	Title    string `json:"title"`
+	Chapters []struct {
+		Number string `json:"number"`
+		Title  string `json:"title"`
+		UUID   string `json:"uuid"`
+		Ketabs []struct {
+			Title string `json:"title"`
+			UUID  string `json:"uuid"`
+		} `json:"ketabs"`
+	} `json:"chapters"`
+}
+
+// BookContent is the union of every book content layout seen on relays:
+// KETAB-01 `chapters`, LIBRARY-01 `shape` and the legacy `acts` hierarchy.
+// Fields that fail to parse are left empty.
+type BookContent struct {
+	Title       string
+	Subtitle    string
+	Description string
+	Summary     string
+	Author      string
+	Image       string
+	Chapters    []ContentChapter
+	Shape       [][]core.BookShapeChapter
+	Acts        []ContentAct
+	PublishedAt int64
+	RefBlockID  string
+}
+
+// DecodeBookNaddr decodes a book naddr (kind 38891).
+func DecodeBookNaddr(naddr string) (nostr.EntityPointer, error) {
+	prefix, data, err := nip19.Decode(naddr)
+	if err != nil {
+		return nostr.EntityPointer{}, fmt.Errorf("invalid naddr: %w", err)
+	}
+	if prefix != "naddr" {
+		return nostr.EntityPointer{}, fmt.Errorf("expected naddr, got %s", prefix)
+	}
+	pointer, ok := data.(nostr.EntityPointer)
+	if !ok {
+		return nostr.EntityPointer{}, fmt.Errorf("invalid naddr data")
+	}
+	if pointer.Kind != core.KindBook {
+		return nostr.EntityPointer{}, fmt.Errorf("expected book event (kind %d), got kind %d", core.KindBook, pointer.Kind)
+	}
+	return pointer, nil
+}
+
+// FetchBook fetches a book and all of its chapters and ketabs:
+//
+//  1. Fetch the kind 38891 event addressed by pointer
+//  2. Read the ordered chapter list from `chapters`, `shape` or `acts`
+//  3. Fetch the chapters (kind 30023) by #d
+//  4. Fetch their ketabs (kind 38893) by #a, falling back to the ketab
+//     d-tags listed in the book for ketabs published without a parent tag
+//  5. Sort ketabs by `index`
+//
+// Only events signed by the book author are accepted.
+func FetchBook(ctx context.Context, pool *nostr.SimplePool, relays []string, pointer nostr.EntityPointer) (*Book, error) {
+	relays = MergeRelays(pointer.Relays, relays)
+	author := pointer.PublicKey
+
+	book_events := FetchLatest(ctx, pool, relays, nostr.Filter{
+		Kinds:   []int{core.KindBook},
+		Authors: []string{author},
+		Tags:    nostr.TagMap{"d": []string{pointer.Identifier}},
+	})
+	book_event, ok := book_events[pointer.Identifier]
+	if !ok {
+		return nil, fmt.Errorf("book %d:%s:%s not found on %d relays", core.KindBook, author, pointer.Identifier, len(relays))
+	}
+
+	bk := &Book{
+		Pointer: pointer,
+		Event:   book_event,
+		Content: parse_book_content(book_event),
+	}
+	bk.Acts = bk.outline()
+
+	// Fetch chapters by #d
+	var chapter_ds []string
+	for _, ch := range bk.Chapters() {
+		chapter_ds = append(chapter_ds, ch.DTag)
+	}
+	if len(chapter_ds) == 0 {
+		return bk, nil
+	}
+	chapter_events := FetchLatest(ctx, pool, relays, nostr.Filter{
+		Kinds:   []int{core.KindChapter},
+		Authors: []string{author},
+		Tags:    nostr.TagMap{"d": chapter_ds},
+	})
+
+	// Fetch ketabs by parent #a
+	var chapter_coords []string
+	by_coord := make(map[string]*Chapter)
+	for _, ch := range bk.Chapters() {
+		ch.Event = chapter_events[ch.DTag]
+		if ch.Title == "" && ch.Event != nil {
+			ch.Title = tag_value(ch.Event.Tags, "title")
+		}
+		coord := fmt.Sprintf("%d:%s:%s", core.KindChapter, author, ch.DTag)
+		chapter_coords = append(chapter_coords, coord)
+		by_coord[coord] = ch
+	}
+	ketab_events := FetchLatest(ctx, pool, relays, nostr.Filter{
+		Kinds:   []int{core.KindKetab},
+		Authors: []string{author},
+		Tags:    nostr.TagMap{"a": chapter_coords},
+	})
+	placed := make(map[string]bool)
+	for d, event := range ketab_events {
+		for _, tag := range event.Tags {
+			if len(tag) < 2 || tag[0] != "a" {
+				continue
+			}
+			if ch, ok := by_coord[tag[1]]; ok {
+				ch.Ketabs = append(ch.Ketabs, new_ketab(event))
+				placed[d] = true
+				break
+			}
+		}
+	}
+
+	// Fall back to ketab d-tags listed in the book (ketabs without a parent a tag)
+	listed := bk.listed_ketabs()
+	var missing []string
+	for d := range listed {
+		if !placed[d] {
+			missing = append(missing, d)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		for d, event := range FetchLatest(ctx, pool, relays, nostr.Filter{
+			Kinds:   []int{core.KindKetab},
+			Authors: []string{author},
+			Tags:    nostr.TagMap{"d": missing},
+		}) {
+			if ch := listed[d]; ch != nil && !placed[d] {
+				ch.Ketabs = append(ch.Ketabs, new_ketab(event))
+				placed[d] = true
+			}
+		}
+	}
+
+	for _, ch := range bk.Chapters() {
+		sort.SliceStable(ch.Ketabs, func(i, j int) bool {
+			a, b := ch.Ketabs[i], ch.Ketabs[j]
+			if a.Content.Index != b.Content.Index {
+				return a.Content.Index < b.Content.Index
+			}
+			return a.Event.CreatedAt < b.Event.CreatedAt
+		})
+	}
+
+	return bk, nil
+}
+
+// Chapters returns every chapter across all acts, in order.
+func (b *Book) Chapters() []*Chapter {
+	var chapters []*Chapter
+	for _, act := range b.Acts {
+		chapters = append(chapters, act.Chapters...)
+	}
+	return chapters
+}
+
+// Coordinate returns the book's coordinate (38891:<pubkey>:<d-tag>).
+func (b *Book) Coordinate() string {
+	return fmt.Sprintf("%d:%s:%s", core.KindBook, b.Pointer.PublicKey, b.Pointer.Identifier)
+}
+
+// outline builds the act/chapter skeleton from the book content.
+// Order of preference: `shape` (has acts), `acts`, `chapters`, then `a` tag order.
+func (b *Book) outline() []Act {
+	c := b.Content
+	switch {
+	case len(c.Shape) > 0:
+		var acts []Act
+		for i, shape_act := range c.Shape {
+			act := Act{Title: fmt.Sprintf("Act %d", i+1)}
+			if i < len(c.Acts) && c.Acts[i].Title != "" {
+				act.Title = c.Acts[i].Title
+			}
+			for _, ch := range shape_act {
+				act.Chapters = append(act.Chapters, &Chapter{DTag: ch.DTag, Title: ch.Title})
+			}
+			acts = append(acts, act)
+		}
+		return acts
+	case len(c.Acts) > 0:
+		var acts []Act
+		for _, content_act := range c.Acts {
+			act := Act{Title: content_act.Title}
+			for _, ch := range content_act.Chapters {
+				act.Chapters = append(act.Chapters, &Chapter{DTag: ch.UUID, Title: ch.Title})
+			}
+			acts = append(acts, act)
+		}
+		return acts
+	case len(c.Chapters) > 0:
+		act := Act{Title: "Act 1"}
+		for _, ch := range c.Chapters {
+			act.Chapters = append(act.Chapters, &Chapter{DTag: ch.D, Title: ch.Title})
+		}
+		return []Act{act}
+	default:
+		act := Act{Title: "Act 1"}
+		prefix := fmt.Sprintf("%d:%s:", core.KindChapter, b.Pointer.PublicKey)
+		for _, tag := range b.Event.Tags {
+			if len(tag) >= 2 && tag[0] == "a" && strings.HasPrefix(tag[1], prefix) {
+				act.Chapters = append(act.Chapters, &Chapter{DTag: strings.TrimPrefix(tag[1], prefix)})
+			}
+		}
+		return []Act{act}
+	}
+}
+
+// listed_ketabs maps the ketab d-tags listed in `shape` or `acts` to their chapter.
+func (b *Book) listed_ketabs() map[string]*Chapter {
+	by_d := make(map[string]*Chapter)
+	for _, ch := range b.Chapters() {
+		by_d[ch.DTag] = ch
+	}
+	listed := make(map[string]*Chapter)
+	for _, act := range b.Content.Shape {
+		for _, ch := range act {
+			for _, k := range ch.Ketabs {
+				if by_d[ch.DTag] != nil {
+					listed[k.DTag] = by_d[ch.DTag]
+				}
+			}
+		}
+	}
+	for _, act := range b.Content.Acts {
+		for _, ch := range act.Chapters {
+			for _, k := range ch.Ketabs {
+				if by_d[ch.UUID] != nil {
+					listed[k.UUID] = by_d[ch.UUID]
+				}
+			}
+		}
+	}
+	return listed
+}
+
+// parse_book_content decodes each known field of the book content independently,
+// so one malformed field does not hide the others.
+func parse_book_content(event *nostr.Event) BookContent {
+	var c BookContent
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(event.Content), &raw); err != nil {
+		raw = map[string]json.RawMessage{}
+	}
+	decode := func(key string, into any) {
+		if v, ok := raw[key]; ok {
+			_ = json.Unmarshal(v, into)
+		}
+	}
+	decode("title", &c.Title)
+	decode("subtitle", &c.Subtitle)
+	decode("description", &c.Description)
+	decode("summary", &c.Summary)
+	decode("author", &c.Author)
+	decode("image", &c.Image)
+	if c.Image == "" {
+		decode("cover_image_url", &c.Image)
+	}
+	decode("chapters", &c.Chapters)
+	decode("shape", &c.Shape)
+	decode("acts", &c.Acts)
+	decode("published_at", &c.PublishedAt)
+	decode("ref_block_id", &c.RefBlockID)
+
+	// Fall back to NIP-23 style tags for older book events
+	if c.Title == "" {
+		c.Title = tag_value(event.Tags, "title")
+	}
+	if c.Summary == "" {
+		c.Summary = tag_value(event.Tags, "summary")
+	}
+	if c.Image == "" {
+		c.Image = tag_value(event.Tags, "image")
+	}
+	return c
+}
+
+// new_ketab parses a ketab event. Unparseable content leaves Content zero-valued.
+func new_ketab(event *nostr.Event) *Ketab {
+	k := &Ketab{
+		DTag:  event.Tags.GetD(),
+		Event: event,
+	}
+	_ = json.Unmarshal([]byte(event.Content), &k.Content)
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "t" {
+			k.Topics = append(k.Topics, tag[1])
+		}
+	}
+	return k
+}
+
+// FetchLatest queries relays and keeps only the newest event per d-tag
+// (the replaceable-event rule for kinds 30000–39999).
+func FetchLatest(ctx context.Context, pool *nostr.SimplePool, relays []string, filter nostr.Filter) map[string]*nostr.Event {
+	latest := make(map[string]*nostr.Event)
+	for ie := range pool.FetchMany(ctx, relays, filter) {
+		d := ie.Event.Tags.GetD()
+		if cur, ok := latest[d]; ok && (cur.CreatedAt > ie.Event.CreatedAt ||
+			(cur.CreatedAt == ie.Event.CreatedAt && cur.ID < ie.Event.ID)) {
+			continue
+		}
+		latest[d] = ie.Event
+	}
+	return latest
+}
+
+// MergeRelays returns the normalized URLs of a followed by those of b not already in a.
+func MergeRelays(a, b []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, url := range append(append([]string{}, a...), b...) {
+		url = nostr.NormalizeURL(strings.TrimSpace(url))
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		out = append(out, url)
+	}
+	return out
+}
+
+// tag_value returns the first value of a tag with the given name.
+func tag_value(tags nostr.Tags, name string) string {
+	for _, tag := range tags {
+		if len(tag) >= 2 && tag[0] == name {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+// chapter_number formats a 1-based chapter position as a directory name ("01", "02", ...).
+func chapter_number(position int) string {
+	s := strconv.Itoa(position)
+	if len(s) < 2 {
+		s = "0" + s
+	}
+	return s
+}
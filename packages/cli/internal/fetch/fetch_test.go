@@ -0,0 +1,258 @@
+package fetch_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/events"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/fetch"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/relay"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/types"
+	core "github.com/joinnextblock/ketab-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// serve starts an in-memory relay and returns its store and websocket URL.
+func serve(t *testing.T) (*relay.Store, string) {
+	t.Helper()
+	store, err := relay.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(relay.New(store))
+	t.Cleanup(server.Close)
+	return store, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// save signs event with sk and stores it on the relay.
+func save(t *testing.T, store *relay.Store, sk string, event nostr.Event) {
+	t.Helper()
+	if event.CreatedAt == 0 {
+		event.CreatedAt = nostr.Now()
+	}
+	if err := event.Sign(sk); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Save(&event); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fetch_book fetches the book d by pk from url.
+func fetch_book(t *testing.T, url, pk, d string) *fetch.Book {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	pointer := nostr.EntityPointer{PublicKey: pk, Kind: core.KindBook, Identifier: d, Relays: []string{url}}
+	bk, err := fetch.FetchBook(ctx, nostr.NewSimplePool(ctx), nil, pointer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bk
+}
+
+func write_file(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func read_book_file(t *testing.T, dir string) *types.SingleBookFile {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "book.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	single := &types.SingleBookFile{}
+	if err := json.Unmarshal(data, single); err != nil {
+		t.Fatal(err)
+	}
+	return single
+}
+
+func TestRoundTrip(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	store, url := serve(t)
+
+	src := t.TempDir()
+	original := &types.SingleBookFile{
+		Title:       "Salt & Light",
+		Slug:        "salt-light",
+		UUID:        "11111111-1111-4111-8111-111111111111",
+		Author:      "A Writer",
+		Description: "A book.",
+		Summary:     "A longer summary.",
+		Acts: []types.SingleAct{
+			{Title: "Beginnings", Chapters: []types.SingleChapter{
+				{Number: "01", Title: "Salt", UUID: "c1", Ketabs: []types.SingleKetab{
+					{Title: "First", UUID: "k1", File: "01/01-first.md", Topics: []string{"salt"}},
+					{Title: "Second", UUID: "k2", File: "01/02-second.md"},
+				}},
+			}},
+			{Title: "Endings", Chapters: []types.SingleChapter{
+				{Number: "02", Title: "Light", UUID: "c2", Ketabs: []types.SingleKetab{
+					{Title: "Third", UUID: "k3", File: "02/01-third.md"},
+				}},
+			}},
+		},
+	}
+	data, err := json.MarshalIndent(original, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	write_file(t, filepath.Join(src, "book.json"), string(data))
+	bodies := map[string]string{
+		"01/01-first.md":  "The first ketab.\n",
+		"01/02-second.md": "The *second* ketab.[1]\n\n---\n\n**Sources**\n\n1. A source\n",
+		"02/01-third.md":  "The third ketab.\n",
+	}
+	for file, body := range bodies {
+		write_file(t, filepath.Join(src, file), body)
+	}
+
+	bk, err := book.Load(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := events.NewBuilder(pk, url)
+	numbers := bk.GetChapterNumbers()
+	for _, num := range numbers {
+		ch, _ := bk.GetChapter(num)
+		for _, k := range ch.Ketabs {
+			save(t, store, sk, builder.BuildKetab(ch, k))
+		}
+		save(t, store, sk, builder.BuildChapter(bk, ch))
+	}
+	save(t, store, sk, builder.BuildBook(bk, numbers))
+
+	fetched := fetch_book(t, url, pk, original.UUID)
+	out := t.TempDir()
+	if _, err := fetch.WriteBookDir(fetched, out, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetch.WriteBookDir(fetched, out, false); err == nil {
+		t.Error("WriteBookDir overwrote book.json without force")
+	}
+
+	got := read_book_file(t, out)
+	if !reflect.DeepEqual(got, original) {
+		want, _ := json.MarshalIndent(original, "", "  ")
+		have, _ := json.MarshalIndent(got, "", "  ")
+		t.Errorf("book.json after the round trip:\n%s\nwant:\n%s", have, want)
+	}
+	for file, body := range bodies {
+		data, err := os.ReadFile(filepath.Join(out, file))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(data) != body {
+			t.Errorf("%s = %q, want %q", file, data, body)
+		}
+	}
+	if _, err := book.Load(out); err != nil {
+		t.Errorf("fetched book does not load: %v", err)
+	}
+}
+
+// chapter_event returns an unsigned chapter event.
+func chapter_event(d, title string) nostr.Event {
+	return nostr.Event{Kind: core.KindChapter, Content: title + " text", Tags: nostr.Tags{{"d", d}, {"title", title}}}
+}
+
+// ketab_event returns an unsigned ketab event of chapter, without a parent tag for an empty pk.
+func ketab_event(pk, chapter, d string, index int) nostr.Event {
+	content, _ := json.Marshal(core.KetabContent{Title: d, Index: index, Body: d + " body"})
+	tags := nostr.Tags{{"d", d}}
+	if pk != "" {
+		tags = append(tags, nostr.Tag{"a", fmt.Sprintf("%d:%s:%s", core.KindChapter, pk, chapter)})
+	}
+	return nostr.Event{Kind: core.KindKetab, Content: string(content), Tags: tags}
+}
+
+// outline summarizes a fetched book as "act: chapter(ketab ketab) ..." per act.
+func outline(bk *fetch.Book) []string {
+	var out []string
+	for _, act := range bk.Acts {
+		var chapters []string
+		for _, ch := range act.Chapters {
+			var ketabs []string
+			for _, k := range ch.Ketabs {
+				ketabs = append(ketabs, k.DTag)
+			}
+			chapters = append(chapters, fmt.Sprintf("%s %s(%s)", ch.DTag, ch.Title, strings.Join(ketabs, " ")))
+		}
+		out = append(out, act.Title+": "+strings.Join(chapters, ", "))
+	}
+	return out
+}
+
+func TestOutline(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	a := func(d string) nostr.Tag { return nostr.Tag{"a", fmt.Sprintf("%d:%s:%s", core.KindChapter, pk, d)} }
+	tests := []struct {
+		name    string
+		content string
+		tags    nostr.Tags
+		want    []string
+	}{
+		{
+			name: "shape",
+			content: `{"title":"B","acts":[{"title":"Opening"}],"shape":[` +
+				`[{"title":"One","d_tag":"c1","ketabs":[{"d_tag":"k1"},{"d_tag":"k2"},{"d_tag":"loose"}]}],` +
+				`[{"title":"Two","d_tag":"c2","ketabs":[{"d_tag":"k3"}]}]]}`,
+			want: []string{"Opening: c1 One(k1 k2 loose)", "Act 2: c2 Two(k3)"},
+		},
+		{
+			name: "legacy acts",
+			content: `{"title":"B","acts":[{"title":"Only","chapters":[` +
+				`{"title":"One","uuid":"c1","ketabs":[{"uuid":"loose"}]},{"title":"Two","uuid":"c2"}]}]}`,
+			want: []string{"Only: c1 One(k1 k2 loose), c2 Two(k3)"},
+		},
+		{
+			name:    "chapters",
+			content: `{"title":"B","chapters":[{"d":"c2","title":"Two"},{"d":"c1","title":"One"}]}`,
+			want:    []string{"Act 1: c2 Two(k3), c1 One(k1 k2)"},
+		},
+		{
+			name:    "a tags",
+			content: `{"title":"B"}`,
+			tags:    nostr.Tags{a("c1"), a("c2")},
+			want:    []string{"Act 1: c1 One(k1 k2), c2 Two(k3)"},
+		},
+	}
+	for i, test := range tests {
+		store, url := serve(t)
+		save(t, store, sk, chapter_event("c1", "One"))
+		save(t, store, sk, chapter_event("c2", "Two"))
+		save(t, store, sk, ketab_event(pk, "c1", "k2", 1))
+		save(t, store, sk, ketab_event(pk, "c1", "k1", 0))
+		save(t, store, sk, ketab_event(pk, "c2", "k3", 0))
+		// Without a parent tag, found only by the d-tags the book lists
+		save(t, store, sk, ketab_event("", "c1", "loose", 2))
+		// Another author's ketab in the same chapter is ignored
+		save(t, store, nostr.GeneratePrivateKey(), ketab_event(pk, "c1", "forged", 0))
+
+		d := fmt.Sprintf("book%d", i)
+		save(t, store, sk, nostr.Event{Kind: core.KindBook, Content: test.content, Tags: append(nostr.Tags{{"d", d}}, test.tags...)})
+		got := outline(fetch_book(t, url, pk, d))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: outline = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	core "github.com/joinnextblock/ketab-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Issue codes reported by Verify.
+const (
+	IssueMissingChapter = "missing_chapter" // The chapter event (30023) was not found
+	IssueMissingKetab   = "missing_ketab"   // A ketab listed by the chapter or book was not found
+	IssueUnlistedKetab  = "unlisted_ketab"  // A ketab points at the chapter but the chapter does not list it
+	IssueWrongAuthor    = "wrong_author"    // A ketab of the chapter is signed by someone else
+	IssueIndexGap       = "index_gap"       // Ketab indexes skip a position
+	IssueDuplicateIndex = "duplicate_index" // Two ketabs share an index
+	IssueDrift          = "drift"           // The chapter content differs from its compiled ketabs
+)
+
+// Issue is an inconsistency between a chapter and its ketabs.
+type Issue struct {
+	Code    string
+	Message string
+}
+
+// ChapterCheck is the result of verifying one chapter.
+type ChapterCheck struct {
+	Chapter *Chapter
+
+	// Compiled is the chapter body recompiled from the fetched ketabs.
+	Compiled string
+
+	// Diff lists the lines of the published chapter ("-") and of the
+	// compiled body ("+") that differ, with unchanged lines (" ") around them.
+	Diff []string
+
+	Issues []Issue
+}
+
+// OK reports whether the chapter has no issues.
+func (c *ChapterCheck) OK() bool {
+	return len(c.Issues) == 0
+}
+
+// Has reports whether the chapter has an issue with the given code.
+func (c *ChapterCheck) Has(code string) bool {
+	for _, issue := range c.Issues {
+		if issue.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ChapterCheck) add(code, format string, args ...any) {
+	c.Issues = append(c.Issues, Issue{Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// Verify checks the PROTOCOL.md compiled-view rule for every chapter of a
+// fetched book: the chapter content must equal the concatenation of its
+// ketabs' bodies (in index order, as CompileChapterBody joins them). It also
+// reports ketabs the chapter or book lists but relays do not have, ketabs
+// signed by another author, and gaps or duplicates in ketab indexes.
+func Verify(ctx context.Context, pool *nostr.SimplePool, relays []string, bk *Book) []*ChapterCheck {
+	relays = MergeRelays(bk.Pointer.Relays, relays)
+	author := bk.Pointer.PublicKey
+	listed := bk.listed_ketabs()
+
+	// Ketabs pointing at the chapters from other authors
+	foreign := make(map[string][]*nostr.Event) // chapter coordinate -> ketab events
+	var chapter_coords []string
+	for _, ch := range bk.Chapters() {
+		chapter_coords = append(chapter_coords, bk.ChapterCoordinate(ch))
+	}
+	if len(chapter_coords) > 0 {
+		for ie := range pool.FetchMany(ctx, relays, nostr.Filter{
+			Kinds: []int{core.KindKetab},
+			Tags:  nostr.TagMap{"a": chapter_coords},
+		}) {
+			if ie.Event.PubKey == author {
+				continue
+			}
+			for _, tag := range ie.Event.Tags {
+				if len(tag) >= 2 && tag[0] == "a" {
+					foreign[tag[1]] = append(foreign[tag[1]], ie.Event)
+				}
+			}
+		}
+	}
+
+	var checks []*ChapterCheck
+	for _, ch := range bk.Chapters() {
+		check := &ChapterCheck{Chapter: ch, Compiled: CompileChapter(ch)}
+		found := make(map[string]bool)
+		for _, k := range ch.Ketabs {
+			found[k.DTag] = true
+		}
+
+		// Ketabs the chapter lists by `a` tag, then those the book lists
+		ketab_prefix := fmt.Sprintf("%d:", core.KindKetab)
+		own_prefix := fmt.Sprintf("%d:%s:", core.KindKetab, author)
+		chapter_lists := make(map[string]bool)
+		var expected []string
+		if ch.Event != nil {
+			for _, tag := range ch.Event.Tags {
+				if len(tag) < 2 || tag[0] != "a" || !strings.HasPrefix(tag[1], ketab_prefix) {
+					continue
+				}
+				if !strings.HasPrefix(tag[1], own_prefix) {
+					check.add(IssueWrongAuthor, "chapter lists ketab %s by another author", tag[1])
+					continue
+				}
+				d := strings.TrimPrefix(tag[1], own_prefix)
+				chapter_lists[d] = true
+				expected = append(expected, d)
+			}
+		}
+		var book_listed []string
+		for d, listed_ch := range listed {
+			if listed_ch == ch && !chapter_lists[d] {
+				book_listed = append(book_listed, d)
+			}
+		}
+		sort.Strings(book_listed)
+		expected = append(expected, book_listed...)
+
+		if ch.Event == nil {
+			check.add(IssueMissingChapter, "chapter %s (kind %d) not found", ch.DTag, core.KindChapter)
+		}
+		for _, d := range expected {
+			if !found[d] {
+				check.add(IssueMissingKetab, "ketab %s is listed but was not found", d)
+			}
+		}
+		if ch.Event != nil && len(chapter_lists) > 0 {
+			for _, k := range ch.Ketabs {
+				if !chapter_lists[k.DTag] {
+					check.add(IssueUnlistedKetab, "ketab %s (%q) is not listed by the chapter", k.DTag, k.Content.Title)
+				}
+			}
+		}
+		for _, event := range foreign[bk.ChapterCoordinate(ch)] {
+			check.add(IssueWrongAuthor, "ketab %s is signed by %s, not the book author", event.Tags.GetD(), event.PubKey)
+		}
+
+		// Indexes must run 0, 1, 2, ...
+		count := make(map[int]int)
+		last := -1
+		for _, k := range ch.Ketabs {
+			count[k.Content.Index]++
+			last = max(last, k.Content.Index)
+		}
+		for i := 0; i <= last; i++ {
+			switch {
+			case count[i] == 0:
+				check.add(IssueIndexGap, "no ketab has index %d", i)
+			case count[i] > 1:
+				check.add(IssueDuplicateIndex, "%d ketabs have index %d", count[i], i)
+			}
+		}
+		for i, n := range count {
+			if i < 0 {
+				check.add(IssueIndexGap, "%d ketabs have negative index %d", n, i)
+			}
+		}
+
+		if ch.Event != nil && ch.Event.Content != check.Compiled {
+			check.Diff = DiffLines(ch.Event.Content, check.Compiled, 2)
+			check.add(IssueDrift, "chapter content differs from its %d compiled ketabs", len(ch.Ketabs))
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// CompileChapter recompiles a fetched chapter's body from its ketabs with
+// book.CompileChapterBody, the way `ketab publish` builds it.
+func CompileChapter(ch *Chapter) string {
+	compiled := &book.Chapter{}
+	for _, k := range ch.Ketabs {
+		compiled.Ketabs = append(compiled.Ketabs, book.Ketab{Body: k.Content.Body})
+	}
+	return compiled.CompileChapterBody()
+}
+
+// ChapterCoordinate returns the coordinate of a chapter of the book
+// (30023:<pubkey>:<chapter-d-tag>).
+func (b *Book) ChapterCoordinate(ch *Chapter) string {
+	return fmt.Sprintf("%d:%s:%s", core.KindChapter, b.Pointer.PublicKey, ch.DTag)
+}
+
+// RecompiledChapter returns an unsigned chapter event whose content is the
+// recompiled body and whose ketab `a` tags follow the fetched ketabs. Other
+// tags of the published chapter are kept; a missing chapter gets the tags
+// `ketab publish` would emit.
+func (b *Book) RecompiledChapter(ch *Chapter, relay_hint string) nostr.Event {
+	var tags nostr.Tags
+	if ch.Event != nil {
+		ketab_prefix := fmt.Sprintf("%d:", core.KindKetab)
+		for _, tag := range ch.Event.Tags {
+			if len(tag) >= 2 && tag[0] == "a" && strings.HasPrefix(tag[1], ketab_prefix) {
+				continue
+			}
+			tags = append(tags, tag)
+		}
+	} else {
+		tags = nostr.Tags{
+			{"d", ch.DTag},
+			{"title", ch.Title},
+			{"published_at", fmt.Sprintf("%d", time.Now().Unix())},
+			{"a", b.Coordinate(), relay_hint},
+		}
+	}
+	for _, k := range ch.Ketabs {
+		tags = append(tags, nostr.Tag{"a", fmt.Sprintf("%d:%s:%s", core.KindKetab, b.Pointer.PublicKey, k.DTag), relay_hint})
+	}
+	return nostr.Event{
+		Kind:      core.KindChapter,
+		PubKey:    b.Pointer.PublicKey,
+		CreatedAt: nostr.Timestamp(time.Now().Unix()),
+		Tags:      tags,
+		Content:   CompileChapter(ch),
+	}
+}
+
+// DiffLines returns a line diff of a and b: removed lines prefixed with "-",
+// added ones with "+", and up to context unchanged lines (" ") around each
+// change. Skipped unchanged runs are marked with "@@".
+func DiffLines(a, b string, context int) []string {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	// Longest common subsequence table
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []string
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			ops = append(ops, " "+x[i])
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, "-"+x[i])
+			i++
+		default:
+			ops = append(ops, "+"+y[j])
+			j++
+		}
+	}
+
+	// Keep changes and their context
+	keep := make([]bool, len(ops))
+	for k, op := range ops {
+		if op[0] == ' ' {
+			continue
+		}
+		for c := max(k-context, 0); c <= min(k+context, len(ops)-1); c++ {
+			keep[c] = true
+		}
+	}
+	var out []string
+	skipped := false
+	for k, op := range ops {
+		if !keep[k] {
+			skipped = true
+			continue
+		}
+		if skipped && len(out) > 0 {
+			out = append(out, "@@")
+		}
+		skipped = false
+		out = append(out, op)
+	}
+	return out
+}
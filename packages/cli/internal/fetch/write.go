@@ -0,0 +1,121 @@
+package fetch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/types"
+)
+
+// ToSingleBookFile converts a fetched book into the book.json format.
+// Chapters are numbered by position ("01", "02", ...) and each ketab gets
+// a file path "<chapter>/<NN>-<slug>.md" relative to the book directory.
+func (b *Book) ToSingleBookFile() *types.SingleBookFile {
+	single := &types.SingleBookFile{
+		Title:       b.Content.Title,
+		Slug:        Slugify(b.Content.Title),
+		UUID:        b.Pointer.Identifier,
+		Author:      b.Content.Author,
+		Description: b.Content.Description,
+		Summary:     b.Content.Summary,
+		Image:       b.Content.Image,
+		Thumb:       tag_value(b.Event.Tags, "thumb"),
+		RefBlockID:  b.Content.RefBlockID,
+	}
+
+	position := 0
+	for _, act := range b.Acts {
+		single_act := types.SingleAct{Title: act.Title}
+		for _, ch := range act.Chapters {
+			position++
+			number := chapter_number(position)
+			single_ch := types.SingleChapter{
+				Number: number,
+				Title:  chapter_title(ch.Title),
+				UUID:   ch.DTag,
+				Ketabs: []types.SingleKetab{},
+			}
+			for i, k := range ch.Ketabs {
+				single_ch.Ketabs = append(single_ch.Ketabs, types.SingleKetab{
+					Title:  k.Content.Title,
+					UUID:   k.DTag,
+					File:   ketab_file(number, i, k.Content.Title),
+					Topics: k.Topics,
+				})
+			}
+			single_act.Chapters = append(single_act.Chapters, single_ch)
+		}
+		single.Acts = append(single.Acts, single_act)
+	}
+	return single
+}
+
+// WriteBookDir writes a fetched book to out_dir as book.json plus one markdown
+// file per ketab, in the layout book.Load reads. An existing book.json is only
+// overwritten when force is set.
+func WriteBookDir(b *Book, out_dir string, force bool) (*types.SingleBookFile, error) {
+	book_path := filepath.Join(out_dir, "book.json")
+	if _, err := os.Stat(book_path); err == nil && !force {
+		return nil, fmt.Errorf("%s already exists (use --force to overwrite)", book_path)
+	}
+	if err := os.MkdirAll(out_dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", out_dir, err)
+	}
+
+	single := b.ToSingleBookFile()
+	chapters := b.Chapters()
+	position := 0
+	for _, act := range single.Acts {
+		for _, ch := range act.Chapters {
+			fetched := chapters[position]
+			position++
+			if err := os.MkdirAll(filepath.Join(out_dir, ch.Number), 0755); err != nil {
+				return nil, fmt.Errorf("failed to create chapter %s: %w", ch.Number, err)
+			}
+			for i, k := range ch.Ketabs {
+				body := strings.TrimSpace(fetched.Ketabs[i].Content.Body) + "\n"
+				if err := os.WriteFile(filepath.Join(out_dir, k.File), []byte(body), 0644); err != nil {
+					return nil, fmt.Errorf("failed to write ketab %s: %w", k.File, err)
+				}
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(single, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal book.json: %w", err)
+	}
+	if err := os.WriteFile(book_path, append(data, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write book.json: %w", err)
+	}
+	return single, nil
+}
+
+var (
+	slug_strip_re     = regexp.MustCompile(`[^\p{L}\p{M}\p{N}]+`)
+	chapter_prefix_re = regexp.MustCompile(`^Chapter\s+\S+:\s+`)
+)
+
+// Slugify lowercases s and replaces runs of characters other than letters
+// and digits (in any script) with "-".
+func Slugify(s string) string {
+	slug := strings.Trim(slug_strip_re.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if slug == "" {
+		return "untitled"
+	}
+	return slug
+}
+
+// chapter_title strips the "Chapter NN: " prefix the publisher adds to 30023 title tags.
+func chapter_title(title string) string {
+	return chapter_prefix_re.ReplaceAllString(title, "")
+}
+
+// ketab_file returns the book-relative path for the i-th (0-based) ketab of a chapter.
+func ketab_file(chapter_number string, i int, title string) string {
+	return fmt.Sprintf("%s/%02d-%s.md", chapter_number, i+1, Slugify(title))
+}
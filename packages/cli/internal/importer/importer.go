@@ -0,0 +1,125 @@
+// Package importer turns markdown into a book directory: a single long file
+// is split into acts, chapters and ketabs by heading levels and `---` rules;
+// a folder (such as an Obsidian vault) is mapped by its act/chapter/ketab
+// folders and files. Write lays the result out as book.json plus one file per
+// ketab, in the layout book.Load reads.
+package importer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Book is an imported book, before UUIDs and files are assigned.
+type Book struct {
+	Title       string
+	Author      string
+	Description string
+	Acts        []Act
+
+	// Levels are the heading levels a single file was split by.
+	Levels Levels
+
+	// Warnings lists content that was skipped or guessed at.
+	Warnings []string
+}
+
+// Act is an imported act.
+type Act struct {
+	Title    string
+	Chapters []Chapter
+}
+
+// Chapter is an imported chapter.
+type Chapter struct {
+	Title  string
+	Ketabs []Ketab
+}
+
+// Ketab is an imported ketab. Body does not include its heading.
+type Ketab struct {
+	Title string
+	Body  string
+}
+
+// Levels are the heading levels (1–6) that start acts, chapters and ketabs;
+// 0 means the level is not used.
+type Levels struct {
+	Act     int
+	Chapter int
+	Ketab   int
+}
+
+// String formats levels as ParseLevels reads them ("1,2,3", "-,1,2").
+func (l Levels) String() string {
+	var parts []string
+	for _, level := range []int{l.Act, l.Chapter, l.Ketab} {
+		if level == 0 {
+			parts = append(parts, "-")
+		} else {
+			parts = append(parts, strconv.Itoa(level))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseLevels reads "<act>,<chapter>,<ketab>" heading levels, with "-" for a
+// level that is not used: "1,2,3" splits acts at #, chapters at ## and
+// ketabs at ###; "-,1,2" has a single act.
+func ParseLevels(s string) (Levels, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return Levels{}, fmt.Errorf("invalid levels %q: want <act>,<chapter>,<ketab> such as 1,2,3 or -,1,2", s)
+	}
+	var values [3]int
+	last := 0
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "-" || part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 1 || n > 6 {
+			return Levels{}, fmt.Errorf("invalid levels %q: %q is not a heading level (1-6) or -", s, part)
+		}
+		if n <= last {
+			return Levels{}, fmt.Errorf("invalid levels %q: levels must increase from acts to ketabs", s)
+		}
+		values[i], last = n, n
+	}
+	return Levels{Act: values[0], Chapter: values[1], Ketab: values[2]}, nil
+}
+
+// Options controls how markdown is split.
+type Options struct {
+	// Title, Author and Description override those found in the source.
+	Title       string
+	Author      string
+	Description string
+
+	// Levels, if set, replaces heading level detection.
+	Levels *Levels
+
+	// SplitRules starts a new ketab at each `---` rule. A rule followed only
+	// by a sources section (footnotes) does not split.
+	SplitRules bool
+
+	// Exclude is a directory FromDir skips, such as the output directory.
+	Exclude string
+}
+
+func (b *Book) warn(format string, args ...any) {
+	b.Warnings = append(b.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Counts returns the number of chapters and ketabs.
+func (b *Book) Counts() (chapters, ketabs int) {
+	for _, act := range b.Acts {
+		chapters += len(act.Chapters)
+		for _, ch := range act.Chapters {
+			ketabs += len(ch.Ketabs)
+		}
+	}
+	return chapters, ketabs
+}
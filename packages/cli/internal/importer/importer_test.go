@@ -0,0 +1,233 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func write_file(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// outline summarizes a book as "act: chapter(ketab, ketab) ..." per act.
+func outline(b *Book) []string {
+	var out []string
+	for _, act := range b.Acts {
+		var chapters []string
+		for _, ch := range act.Chapters {
+			var ketabs []string
+			for _, k := range ch.Ketabs {
+				ketabs = append(ketabs, k.Title)
+			}
+			chapters = append(chapters, fmt.Sprintf("%s(%s)", ch.Title, strings.Join(ketabs, ", ")))
+		}
+		out = append(out, act.Title+": "+strings.Join(chapters, " "))
+	}
+	return out
+}
+
+const novel = "---\n" +
+	"author: Zoë Ørsted\n" +
+	"---\n" +
+	"# Über Café\n" +
+	"\n" +
+	"Ein Buch über Cafés.\n" +
+	"\n" +
+	"## Erstes Kapitel\n" +
+	"\n" +
+	"Der Anfang.\n" +
+	"\n" +
+	"---\n" +
+	"\n" +
+	"Nach der Linie.[1]\n" +
+	"\n" +
+	"---\n" +
+	"\n" +
+	"**Sources**\n" +
+	"\n" +
+	"1. Eine Quelle\n" +
+	"\n" +
+	"## Zweites Kapitel\n" +
+	"\n" +
+	"### Ankunft\n" +
+	"Kommen.\n" +
+	"### Abfahrt\n" +
+	"Gehen.\n" +
+	"```\n" +
+	"## not a chapter\n" +
+	"```\n"
+
+func TestFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "novel.md")
+	write_file(t, path, novel)
+
+	b, err := FromFile(path, Options{SplitRules: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Title != "Über Café" || b.Author != "Zoë Ørsted" || b.Description != "Ein Buch über Cafés." {
+		t.Errorf("title %q, author %q, description %q", b.Title, b.Author, b.Description)
+	}
+	if b.Levels.String() != "-,2,3" {
+		t.Errorf("levels = %s, want -,2,3", b.Levels)
+	}
+	want := []string{"Act 1: Erstes Kapitel(Scene 1, Scene 2) Zweites Kapitel(Ankunft, Abfahrt)"}
+	if got := outline(b); !reflect.DeepEqual(got, want) {
+		t.Errorf("outline = %q, want %q", got, want)
+	}
+	// A rule before a sources section does not split.
+	if body := b.Acts[0].Chapters[0].Ketabs[1].Body; !strings.HasSuffix(body, "1. Eine Quelle") {
+		t.Errorf("second scene = %q, want it to keep its sources", body)
+	}
+	if body := b.Acts[0].Chapters[1].Ketabs[1].Body; !strings.Contains(body, "## not a chapter") {
+		t.Errorf("fenced heading was not kept as text: %q", body)
+	}
+
+	// Without rule splitting the chapter is one ketab named after it.
+	b, err = FromFile(path, Options{Title: "Anderer Titel", Description: "Kurz."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Title != "Anderer Titel" || b.Description != "Kurz." {
+		t.Errorf("options did not override: title %q, description %q", b.Title, b.Description)
+	}
+	if got := outline(b)[0]; !strings.HasPrefix(got, "Act 1: Erstes Kapitel(Erstes Kapitel) ") {
+		t.Errorf("outline = %q", got)
+	}
+
+	// Explicit levels make the top heading an act, its text a chapter.
+	levels, err := ParseLevels("1,2,3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = FromFile(path, Options{Levels: &levels})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"Über Café: Über Café(Über Café) Erstes Kapitel(Erstes Kapitel) Zweites Kapitel(Ankunft, Abfahrt)"}
+	if got := outline(b); !reflect.DeepEqual(got, want) || b.Title != "Über Café" {
+		t.Errorf("outline = %q, title %q; want %q", got, b.Title, want)
+	}
+}
+
+func TestParseLevels(t *testing.T) {
+	for _, s := range []string{"1,2,3", "-,1,2", "-,2,-"} {
+		levels, err := ParseLevels(s)
+		if err != nil || levels.String() != s {
+			t.Errorf("ParseLevels(%q) = %s, %v", s, levels, err)
+		}
+	}
+	for _, s := range []string{"1,2", "2,1,3", "0,1,2", "1,x,3"} {
+		if _, err := ParseLevels(s); err == nil {
+			t.Errorf("ParseLevels(%q) succeeded", s)
+		}
+	}
+}
+
+func TestFromDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Mein Roman")
+	files := map[string]string{
+		"01 Erster Teil/2 Kapitel Ä/01 Szene.md":  "---\nauthor: Zoë\ndescription: Ein Roman.\n---\n# Морской берег\n\nText [[Link|mit Link]].\n",
+		"01 Erster Teil/2 Kapitel Ä/02 Zweite.md": "Ohne Überschrift.\n",
+		"01 Erster Teil/10 Kapitel Ö/Ende.md":     "Schluss.\n",
+		"02 Zweiter Teil/01 Übrig/Eins.md":        "Mehr.\n",
+		"Notizen.md":                              "Too shallow, skipped.\n",
+		".obsidian/workspace.md":                  "Hidden, skipped.\n",
+	}
+	for file, body := range files {
+		write_file(t, filepath.Join(dir, filepath.FromSlash(file)), body)
+	}
+
+	b, err := FromDir(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Title != "Mein Roman" || b.Author != "Zoë" || b.Description != "Ein Roman." {
+		t.Errorf("title %q, author %q, description %q", b.Title, b.Author, b.Description)
+	}
+	// Numbers order "2" before "10" and are dropped from titles.
+	want := []string{
+		"Erster Teil: Kapitel Ä(Морской берег, Zweite) Kapitel Ö(Ende)",
+		"Zweiter Teil: Übrig(Eins)",
+	}
+	if got := outline(b); !reflect.DeepEqual(got, want) {
+		t.Errorf("outline = %q, want %q", got, want)
+	}
+	if body := b.Acts[0].Chapters[0].Ketabs[0].Body; body != "Text mit Link." {
+		t.Errorf("wikilink body = %q", body)
+	}
+	if len(b.Warnings) != 1 || !strings.Contains(b.Warnings[0], "Notizen.md") {
+		t.Errorf("warnings = %q, want Notizen.md skipped", b.Warnings)
+	}
+
+	if _, err := FromDir(t.TempDir(), Options{}); err == nil {
+		t.Error("imported a directory without markdown files")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "novel.md")
+	write_file(t, src, novel)
+	b, err := FromFile(src, Options{SplitRules: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, opts := range map[string]Book{"author": {Description: "d"}, "description": {Author: "a"}} {
+		bare := &Book{Title: "T", Author: opts.Author, Description: opts.Description, Acts: b.Acts}
+		if _, err := Write(bare, t.TempDir(), false); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("without %s: err = %v", name, err)
+		}
+	}
+
+	out := t.TempDir()
+	single, err := Write(b, out, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if single.Slug != "über-café" {
+		t.Errorf("slug = %q, want über-café", single.Slug)
+	}
+	var files []string
+	for _, act := range single.Acts {
+		for _, ch := range act.Chapters {
+			for _, k := range ch.Ketabs {
+				files = append(files, k.File)
+			}
+		}
+	}
+	want_files := []string{"01/01-scene-1.md", "01/02-scene-2.md", "02/01-ankunft.md", "02/02-abfahrt.md"}
+	if !reflect.DeepEqual(files, want_files) {
+		t.Errorf("files = %q, want %q", files, want_files)
+	}
+	if data, err := os.ReadFile(filepath.Join(out, "02/01-ankunft.md")); err != nil || string(data) != "Kommen.\n" {
+		t.Errorf("ketab file = %q, %v", data, err)
+	}
+
+	if _, err := Write(b, out, false); err == nil {
+		t.Error("Write overwrote book.json without force")
+	}
+
+	// Importing again keeps the UUIDs and removes ketab files no longer used.
+	b.Acts[0].Chapters[0].Ketabs = b.Acts[0].Chapters[0].Ketabs[:1]
+	again, err := Write(b, out, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.UUID != single.UUID || again.Acts[0].Chapters[1].Ketabs[0].UUID != single.Acts[0].Chapters[1].Ketabs[0].UUID {
+		t.Error("UUIDs changed on import with force")
+	}
+	if _, err := os.Stat(filepath.Join(out, "01/02-scene-2.md")); !os.IsNotExist(err) {
+		t.Errorf("unused ketab file kept: %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/markdown"
+)
+
+var (
+	heading_re  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	fence_re    = regexp.MustCompile("^\\s*(```|~~~)")
+	embed_re    = regexp.MustCompile(`!\[\[[^\]]*\]\]`)
+	wikilink_re = regexp.MustCompile(`\[\[([^\]|#]*)(?:#([^\]|]*))?(?:\|([^\]]*))?\]\]`)
+	comment_re  = regexp.MustCompile(`(?s)%%.*?%%`)
+	field_re    = regexp.MustCompile(`^([A-Za-z_][\w-]*):\s*(.*?)\s*$`)
+)
+
+// line is a source line; level is its heading level, 0 for text (including
+// anything inside code fences).
+type line struct {
+	text  string
+	level int
+	title string
+}
+
+// document is a parsed markdown file.
+type document struct {
+	// fields holds the front matter's scalar fields (title, author, ...).
+	fields map[string]string
+	lines  []line
+}
+
+// parse_document strips YAML front matter and Obsidian markup (embeds,
+// comments, wikilinks) and classifies the lines of a markdown file.
+func parse_document(text string) document {
+	text = strings.ReplaceAll(strings.TrimPrefix(text, "\ufeff"), "\r\n", "\n")
+	doc := document{fields: make(map[string]string)}
+
+	if lines := strings.Split(text, "\n"); lines[0] == "---" {
+		for j := 1; j < len(lines); j++ {
+			if lines[j] != "---" && lines[j] != "..." {
+				continue
+			}
+			for _, field := range lines[1:j] {
+				if m := field_re.FindStringSubmatch(field); m != nil && m[2] != "" {
+					doc.fields[strings.ToLower(m[1])] = strings.Trim(m[2], `"'`)
+				}
+			}
+			text = strings.Join(lines[j+1:], "\n")
+			break
+		}
+	}
+
+	text = comment_re.ReplaceAllString(text, "")
+	text = embed_re.ReplaceAllString(text, "")
+	text = wikilink_re.ReplaceAllStringFunc(text, func(m string) string {
+		g := wikilink_re.FindStringSubmatch(m)
+		switch {
+		case g[3] != "":
+			return g[3]
+		case g[1] != "":
+			return g[1]
+		}
+		return g[2]
+	})
+
+	fence := ""
+	for _, t := range strings.Split(text, "\n") {
+		l := line{text: t}
+		if m := fence_re.FindStringSubmatch(t); m != nil {
+			switch fence {
+			case "":
+				fence = m[1]
+			case m[1]:
+				fence = ""
+			}
+		} else if fence == "" {
+			if m := heading_re.FindStringSubmatch(t); m != nil {
+				l.level, l.title = len(m[1]), m[2]
+			}
+		}
+		doc.lines = append(doc.lines, l)
+	}
+	return doc
+}
+
+// title_line returns the index of the document's title heading: a first
+// heading, before any text, at the document's top level and the only one at
+// that level. It returns -1 if there is none.
+func (d document) title_line() int {
+	count := make(map[int]int)
+	top := 7
+	for _, l := range d.lines {
+		if l.level > 0 {
+			count[l.level]++
+			top = min(top, l.level)
+		}
+	}
+	for i, l := range d.lines {
+		if strings.TrimSpace(l.text) == "" {
+			continue
+		}
+		if l.level > 0 && l.level == top && count[top] == 1 {
+			return i
+		}
+		return -1
+	}
+	return -1
+}
+
+// levels returns the distinct heading levels used, skipping line skip.
+func (d document) levels(skip int) []int {
+	seen := make(map[int]bool)
+	var levels []int
+	for i, l := range d.lines {
+		if i != skip && l.level > 0 && !seen[l.level] {
+			seen[l.level] = true
+			levels = append(levels, l.level)
+		}
+	}
+	sort.Ints(levels)
+	return levels
+}
+
+// detect_levels picks the heading levels of a single file: with three or
+// more levels in use the top three are acts, chapters and ketabs; with two,
+// chapters and ketabs; with one, chapters. Deeper headings stay in the text.
+func detect_levels(used []int) Levels {
+	switch {
+	case len(used) >= 3:
+		return Levels{Act: used[0], Chapter: used[1], Ketab: used[2]}
+	case len(used) == 2:
+		return Levels{Chapter: used[0], Ketab: used[1]}
+	case len(used) == 1:
+		return Levels{Chapter: used[0]}
+	}
+	return Levels{}
+}
+
+// FromFile imports a single markdown file. Text before the first chapter is
+// kept as the book description unless the front matter has one.
+func FromFile(path string, opts Options) (*Book, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	doc := parse_document(string(data))
+	b := &Book{Author: first(opts.Author, doc.fields["author"])}
+
+	title_at := doc.title_line()
+	title := ""
+	if title_at >= 0 {
+		title = doc.lines[title_at].title
+	}
+	b.Title = first(opts.Title, doc.fields["title"], title, name_title(filepath.Base(path)))
+
+	if opts.Levels != nil {
+		b.Levels = *opts.Levels
+		if title_at >= 0 {
+			// A heading at an explicit level is not the title
+			switch doc.lines[title_at].level {
+			case b.Levels.Act, b.Levels.Chapter, b.Levels.Ketab:
+				title_at = -1
+			}
+		}
+	} else {
+		b.Levels = detect_levels(doc.levels(title_at))
+	}
+
+	var preamble []string
+	var act *Act
+	var ch *Chapter
+	var k *Ketab
+	start_act := func(title string) {
+		b.Acts = append(b.Acts, Act{Title: title})
+		act, ch, k = &b.Acts[len(b.Acts)-1], nil, nil
+	}
+	start_chapter := func(title string) {
+		if act == nil {
+			start_act("Act 1")
+		}
+		act.Chapters = append(act.Chapters, Chapter{Title: title})
+		ch, k = &act.Chapters[len(act.Chapters)-1], nil
+	}
+	start_ketab := func(title string) {
+		if ch == nil {
+			chapter_title := b.Title
+			if act != nil && len(b.Acts) > 1 {
+				chapter_title = act.Title
+			}
+			start_chapter(chapter_title)
+		}
+		ch.Ketabs = append(ch.Ketabs, Ketab{Title: title})
+		k = &ch.Ketabs[len(ch.Ketabs)-1]
+	}
+	if b.Levels.Chapter == 0 {
+		start_chapter(b.Title)
+	}
+
+	for i, l := range doc.lines {
+		switch {
+		case i == title_at:
+		case l.level > 0 && l.level == b.Levels.Act:
+			start_act(l.title)
+		case l.level > 0 && l.level == b.Levels.Chapter:
+			start_chapter(l.title)
+		case l.level > 0 && l.level == b.Levels.Ketab:
+			start_ketab(l.title)
+		case k != nil:
+			k.Body += l.text + "\n"
+		case ch != nil:
+			start_ketab("")
+			k.Body += l.text + "\n"
+		case strings.TrimSpace(l.text) == "":
+		case act != nil:
+			// Text between an act heading and its first chapter
+			start_chapter(act.Title)
+			start_ketab("")
+			k.Body += l.text + "\n"
+		default:
+			preamble = append(preamble, l.text)
+		}
+	}
+	b.Description = first(opts.Description, doc.fields["description"], strings.TrimSpace(strings.Join(preamble, "\n")))
+	b.finish(opts.SplitRules)
+	return b, nil
+}
+
+// finish splits ketabs at rules, titles untitled ketabs and drops empty
+// ketabs, chapters and acts.
+func (b *Book) finish(split_rules bool) {
+	var acts []Act
+	for _, act := range b.Acts {
+		var chapters []Chapter
+		for _, ch := range act.Chapters {
+			var ketabs []Ketab
+			for _, k := range ch.Ketabs {
+				pieces := []string{k.Body}
+				if split_rules {
+					pieces = markdown.SplitScenes(k.Body)
+				}
+				n := 0
+				for _, piece := range pieces {
+					piece = strings.TrimSpace(piece)
+					if piece == "" {
+						continue
+					}
+					n++
+					title := k.Title
+					if title != "" && n > 1 {
+						title = fmt.Sprintf("%s (%d)", k.Title, n)
+					}
+					ketabs = append(ketabs, Ketab{Title: title, Body: piece})
+				}
+			}
+			for i := range ketabs {
+				if ketabs[i].Title != "" {
+					continue
+				}
+				if len(ketabs) == 1 {
+					ketabs[i].Title = ch.Title
+				} else {
+					ketabs[i].Title = fmt.Sprintf("Scene %d", i+1)
+				}
+			}
+			if len(ketabs) == 0 {
+				b.warn("chapter %q has no text, skipped", ch.Title)
+				continue
+			}
+			chapters = append(chapters, Chapter{Title: ch.Title, Ketabs: ketabs})
+		}
+		if len(chapters) > 0 {
+			acts = append(acts, Act{Title: act.Title, Chapters: chapters})
+		}
+	}
+	b.Acts = acts
+}
+
+// number_prefix_re matches ordering prefixes such as "01 ", "2. " or "03_".
+var number_prefix_re = regexp.MustCompile(`^\d+[\s._-]+`)
+
+// name_title turns a file or folder name into a title: the extension and any
+// ordering prefix are removed.
+func name_title(name string) string {
+	ext := filepath.Ext(name)
+	if ext == ".md" || ext == ".markdown" {
+		name = strings.TrimSuffix(name, ext)
+	}
+	if stripped := number_prefix_re.ReplaceAllString(name, ""); stripped != "" {
+		name = stripped
+	}
+	return strings.TrimSpace(name)
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,237 @@
+package importer
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FromDir imports a folder of markdown files, such as an Obsidian vault.
+// Its depth decides the layout:
+//
+//	<file>.md                       a chapter, split into ketabs by headings
+//	<chapter>/<file>.md             a ketab
+//	<act>/<chapter>/<file>.md       a ketab
+//
+// Files and folders are read in name order, numbers compared by value
+// ("2 …" before "10 …"); ordering prefixes are dropped from titles. Hidden
+// folders (.obsidian, .trash) are skipped, as are files shallower than the
+// rest.
+func FromDir(dir string, opts Options) (*Book, error) {
+	abs_dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid directory: %w", err)
+	}
+	exclude := ""
+	if opts.Exclude != "" {
+		if exclude, err = filepath.Abs(opts.Exclude); err != nil {
+			return nil, fmt.Errorf("invalid directory: %w", err)
+		}
+	}
+
+	var files [][]string // path parts relative to dir
+	err = filepath.WalkDir(abs_dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == abs_dir {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") || path == exclude {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(d.Name()))
+		if d.IsDir() || (ext != ".md" && ext != ".markdown") {
+			return nil
+		}
+		rel, err := filepath.Rel(abs_dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, strings.Split(filepath.ToSlash(rel), "/"))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no markdown files in %s", dir)
+	}
+	sort.Slice(files, func(i, j int) bool { return less_path(files[i], files[j]) })
+
+	depth := 0
+	for _, parts := range files {
+		depth = max(depth, len(parts))
+	}
+	b := &Book{
+		Title:       first(opts.Title, name_title(filepath.Base(abs_dir))),
+		Author:      opts.Author,
+		Description: opts.Description,
+	}
+	if depth > 3 {
+		b.warn("folders nested deeper than <act>/<chapter>/<ketab>.md are skipped")
+		depth = 3
+	}
+
+	act_index := make(map[string]int)
+	chapter_index := make(map[string]int)
+	act_for := func(key, title string) *Act {
+		i, ok := act_index[key]
+		if !ok {
+			b.Acts = append(b.Acts, Act{Title: title})
+			i = len(b.Acts) - 1
+			act_index[key] = i
+		}
+		return &b.Acts[i]
+	}
+	chapter_for := func(act *Act, key, title string) *Chapter {
+		i, ok := chapter_index[key]
+		if !ok {
+			act.Chapters = append(act.Chapters, Chapter{Title: title})
+			i = len(act.Chapters) - 1
+			chapter_index[key] = i
+		}
+		return &act.Chapters[i]
+	}
+
+	for _, parts := range files {
+		rel := strings.Join(parts, "/")
+		if len(parts) != depth {
+			b.warn("%s is not at the same depth as the other files, skipped", rel)
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(abs_dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", rel, err)
+		}
+		doc := parse_document(string(data))
+		title_at := doc.title_line()
+		title := doc.fields["title"]
+		if title == "" && title_at >= 0 {
+			title = doc.lines[title_at].title
+		}
+		title = first(title, name_title(parts[len(parts)-1]))
+		if b.Author == "" {
+			b.Author = doc.fields["author"]
+		}
+		if b.Description == "" {
+			b.Description = doc.fields["description"]
+		}
+
+		switch depth {
+		case 1:
+			// The file is a chapter; its top heading level starts ketabs
+			levels := detect_levels(doc.levels(title_at))
+			ketab_level := 0
+			if len(levels.used()) > 0 {
+				ketab_level = levels.used()[0]
+			}
+			if opts.Levels != nil {
+				ketab_level = opts.Levels.Ketab
+			}
+			act := act_for("", "Act 1")
+			ch := chapter_for(act, rel, title)
+			var k *Ketab
+			for i, l := range doc.lines {
+				switch {
+				case i == title_at:
+				case l.level > 0 && l.level == ketab_level:
+					ch.Ketabs = append(ch.Ketabs, Ketab{Title: l.title})
+					k = &ch.Ketabs[len(ch.Ketabs)-1]
+				default:
+					if k == nil {
+						ch.Ketabs = append(ch.Ketabs, Ketab{})
+						k = &ch.Ketabs[len(ch.Ketabs)-1]
+					}
+					k.Body += l.text + "\n"
+				}
+			}
+
+		case 2, 3:
+			act := act_for("", "Act 1")
+			if depth == 3 {
+				act = act_for(parts[0], name_title(parts[0]))
+			}
+			chapter_dir := parts[len(parts)-2]
+			ch := chapter_for(act, strings.Join(parts[:len(parts)-1], "/"), name_title(chapter_dir))
+			ch.Ketabs = append(ch.Ketabs, Ketab{Title: title, Body: doc.body(title_at)})
+		}
+	}
+
+	// Only single-file chapters are split at rules: a file per ketab is kept whole
+	b.finish(opts.SplitRules && depth == 1)
+	return b, nil
+}
+
+// used lists the levels in use, top first.
+func (l Levels) used() []int {
+	var levels []int
+	for _, level := range []int{l.Act, l.Chapter, l.Ketab} {
+		if level > 0 {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
+// body returns the document text without its title line.
+func (d document) body(title_at int) string {
+	var lines []string
+	for i, l := range d.lines {
+		if i != title_at {
+			lines = append(lines, l.text)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// less_path orders paths by their parts with less_name.
+func less_path(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return less_name(a[i], b[i])
+		}
+	}
+	return len(a) < len(b)
+}
+
+// less_name orders names by their leading number, if both have one, then
+// case-insensitively.
+func less_name(a, b string) bool {
+	na, ra := leading_number(a)
+	nb, rb := leading_number(b)
+	if na >= 0 && nb >= 0 && na != nb {
+		return na < nb
+	}
+	if na >= 0 && nb >= 0 {
+		a, b = ra, rb
+	}
+	if la, lb := strings.ToLower(a), strings.ToLower(b); la != lb {
+		return la < lb
+	}
+	return a < b
+}
+
+// leading_number returns the number a name starts with (-1 if none) and the
+// rest of the name.
+func leading_number(name string) (int, string) {
+	end := 0
+	for end < len(name) && name[end] >= '0' && name[end] <= '9' {
+		end++
+	}
+	if end == 0 {
+		return -1, name
+	}
+	n, err := strconv.Atoi(name[:end])
+	if err != nil {
+		return -1, name
+	}
+	return n, name[end:]
+}
@@ -0,0 +1,178 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/fetch"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/types"
+)
+
+// Write lays an imported book out in dir as book.json plus one markdown file
+// per ketab ("<chapter>/<NN>-<slug>.md"). An existing book.json is only
+// overwritten when force is set; its UUIDs are then kept for chapters and
+// ketabs whose titles match, along with the fields an import does not set
+// (image, summary, topics, discussion ids), and ketab files it listed that
+// are no longer used are removed.
+//
+// A new book gets a random UUID, as ketab init gives one; chapter and ketab
+// UUIDs are derived from it and their titles with book.StableUUID, so
+// importing again over the same book.json yields the same d-tags. It is an
+// error for neither b nor the book.json being replaced to name an author or
+// give a description, both of which book events require.
+func Write(b *Book, dir string, force bool) (*types.SingleBookFile, error) {
+	book_path := filepath.Join(dir, "book.json")
+	var old *types.SingleBookFile
+	if data, err := os.ReadFile(book_path); err == nil {
+		if !force {
+			return nil, fmt.Errorf("%s already exists (use --force to overwrite)", book_path)
+		}
+		old = &types.SingleBookFile{}
+		if err := json.Unmarshal(data, old); err != nil {
+			return nil, fmt.Errorf("failed to parse existing book.json: %w", err)
+		}
+	}
+
+	single := Layout(b, old)
+	if strings.TrimSpace(single.Author) == "" {
+		return nil, fmt.Errorf("the book has no author: add author to the front matter or pass --author")
+	}
+	if strings.TrimSpace(single.Description) == "" {
+		return nil, fmt.Errorf("the book has no description: add description to the front matter or pass --description")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	used := make(map[string]bool)
+	for ai, act := range single.Acts {
+		for ci, ch := range act.Chapters {
+			if err := os.MkdirAll(filepath.Join(dir, ch.Number), 0755); err != nil {
+				return nil, fmt.Errorf("failed to create chapter %s: %w", ch.Number, err)
+			}
+			for ki, k := range ch.Ketabs {
+				body := b.Acts[ai].Chapters[ci].Ketabs[ki].Body + "\n"
+				if err := os.WriteFile(filepath.Join(dir, k.File), []byte(body), 0644); err != nil {
+					return nil, fmt.Errorf("failed to write ketab %s: %w", k.File, err)
+				}
+				used[k.File] = true
+			}
+		}
+	}
+
+	if old != nil {
+		for _, act := range old.Acts {
+			for _, ch := range act.Chapters {
+				for _, k := range ch.Ketabs {
+					file := filepath.Clean(filepath.FromSlash(k.File))
+					if used[k.File] || k.File == "" || filepath.IsAbs(file) || strings.HasPrefix(file, "..") {
+						continue
+					}
+					if err := os.Remove(filepath.Join(dir, file)); err == nil {
+						// Drops the chapter folder too once it is empty
+						os.Remove(filepath.Dir(filepath.Join(dir, file)))
+					}
+				}
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(single, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal book.json: %w", err)
+	}
+	if err := os.WriteFile(book_path, append(data, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write book.json: %w", err)
+	}
+	return single, nil
+}
+
+// Layout builds the book.json of an imported book. Chapters are numbered by
+// position ("01", "02", ...) across acts. old, if not nil, is the book.json
+// being replaced (see Write).
+func Layout(b *Book, old *types.SingleBookFile) *types.SingleBookFile {
+	single := &types.SingleBookFile{
+		Title:       b.Title,
+		Slug:        fetch.Slugify(b.Title),
+		UUID:        book.NewUUID(),
+		Author:      b.Author,
+		Description: b.Description,
+	}
+
+	old_chapters := make(map[string][]types.SingleChapter)
+	if old != nil {
+		single.UUID = first(old.UUID, single.UUID)
+		single.Author = first(single.Author, old.Author)
+		single.Description = first(single.Description, old.Description)
+		single.Summary, single.Image, single.Thumb, single.RefBlockID = old.Summary, old.Image, old.Thumb, old.RefBlockID
+		single.Schema, single.Signer = old.Schema, old.Signer
+		for _, act := range old.Acts {
+			for _, ch := range act.Chapters {
+				old_chapters[ch.Title] = append(old_chapters[ch.Title], ch)
+			}
+		}
+	}
+
+	chapter_slugs := make(map[string]int)
+	position := 0
+	for _, act := range b.Acts {
+		single_act := types.SingleAct{Title: act.Title}
+		for _, ch := range act.Chapters {
+			position++
+			single_ch := types.SingleChapter{
+				Number: fmt.Sprintf("%02d", position),
+				Title:  ch.Title,
+				UUID:   book.StableUUID(single.UUID, "chapter:"+numbered_slug(chapter_slugs, ch.Title)),
+				Ketabs: []types.SingleKetab{},
+			}
+
+			// Chapters with the same title are matched in order
+			var previous *types.SingleChapter
+			if matches := old_chapters[ch.Title]; len(matches) > 0 {
+				previous = &matches[0]
+				old_chapters[ch.Title] = matches[1:]
+				single_ch.UUID = first(previous.UUID, single_ch.UUID)
+				single_ch.Topics, single_ch.DiscussionID = previous.Topics, previous.DiscussionID
+			}
+			old_ketabs := make(map[string][]types.SingleKetab)
+			if previous != nil {
+				for _, k := range previous.Ketabs {
+					old_ketabs[k.Title] = append(old_ketabs[k.Title], k)
+				}
+			}
+
+			ketab_slugs := make(map[string]int)
+			for i, k := range ch.Ketabs {
+				single_k := types.SingleKetab{
+					Title: k.Title,
+					UUID:  book.StableUUID(single_ch.UUID, "ketab:"+numbered_slug(ketab_slugs, k.Title)),
+					File:  fmt.Sprintf("%s/%02d-%s.md", single_ch.Number, i+1, fetch.Slugify(k.Title)),
+				}
+				if matches := old_ketabs[k.Title]; len(matches) > 0 {
+					old_ketabs[k.Title] = matches[1:]
+					single_k.UUID = first(matches[0].UUID, single_k.UUID)
+					single_k.Topics = matches[0].Topics
+				}
+				single_ch.Ketabs = append(single_ch.Ketabs, single_k)
+			}
+			single_act.Chapters = append(single_act.Chapters, single_ch)
+		}
+		single.Acts = append(single.Acts, single_act)
+	}
+	return single
+}
+
+// numbered_slug returns title's slug, suffixed with ":<n>" from its second
+// use on, so that repeated titles get UUIDs of their own.
+func numbered_slug(seen map[string]int, title string) string {
+	slug := fetch.Slugify(title)
+	seen[slug]++
+	if n := seen[slug]; n > 1 {
+		return fmt.Sprintf("%s:%d", slug, n)
+	}
+	return slug
+}
@@ -0,0 +1,224 @@
+// Package keyring stores named secret keys ("profiles" such as author or
+// librarian) encrypted with NIP-49, so that no plaintext nsec has to be passed
+// on the command line or kept in the environment.
+//
+// The keyring is one file, keyring.json, in the CLI config directory.
+package keyring
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/signer"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip49"
+)
+
+// File is the keyring file name inside signer.ConfigDir.
+const File = "keyring.json"
+
+// scrypt work factor for new keys (2^16 rounds, the NIP-49 recommendation).
+const logn = 16
+
+// Keyring is the set of stored keys.
+type Keyring struct {
+	// Default is the profile used when a command is not given --profile.
+	Default string `json:"default,omitempty"`
+
+	// Roles overrides Default per role: commands that sign as an author use
+	// Roles["author"], those that sign as a librarian Roles["librarian"].
+	Roles map[string]string `json:"roles,omitempty"`
+
+	Keys map[string]*Entry `json:"keys"`
+
+	path string
+}
+
+// Entry is one stored key. Only the pubkey is in the clear.
+type Entry struct {
+	Name      string `json:"-"`
+	Pubkey    string `json:"pubkey"`
+	Ncryptsec string `json:"ncryptsec"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+var name_re = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Open reads the keyring from the config directory. A missing keyring is not
+// an error: an empty one is returned.
+func Open() (*Keyring, error) {
+	dir, err := signer.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyring{Keys: make(map[string]*Entry), path: filepath.Join(dir, File)}
+	data, err := os.ReadFile(k.path)
+	if os.IsNotExist(err) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", k.path, err)
+	}
+	if err := json.Unmarshal(data, k); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", k.path, err)
+	}
+	if k.Keys == nil {
+		k.Keys = make(map[string]*Entry)
+	}
+	for name, e := range k.Keys {
+		e.Name = name
+	}
+	return k, nil
+}
+
+// Path returns the keyring file path.
+func (k *Keyring) Path() string {
+	return k.path
+}
+
+// Save writes the keyring atomically, readable by the owner only.
+func (k *Keyring) Save() error {
+	if err := os.MkdirAll(filepath.Dir(k.path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(k.path), err)
+	}
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal keyring: %w", err)
+	}
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, k.path)
+}
+
+// List returns the stored keys sorted by name.
+func (k *Keyring) List() []*Entry {
+	entries := make([]*Entry, 0, len(k.Keys))
+	for _, e := range k.Keys {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// Get returns the entry for a profile name.
+func (k *Keyring) Get(name string) (*Entry, error) {
+	e, ok := k.Keys[name]
+	if !ok {
+		return nil, fmt.Errorf("no key named %q in %s (see `ketab keys list`)", name, k.path)
+	}
+	return e, nil
+}
+
+// Roles commands sign as.
+const (
+	RoleAuthor    = "author"
+	RoleLibrarian = "librarian"
+)
+
+// Add encrypts a hex secret key with password and stores it as name. security
+// records how the key was handled before (see NIP-49). The first key added
+// becomes the default.
+func (k *Keyring) Add(name, sk, password string, security nip49.KeySecurityByte) (*Entry, error) {
+	if !name_re.MatchString(name) {
+		return nil, fmt.Errorf("invalid key name %q (use lowercase letters, digits, - and _)", name)
+	}
+	if _, exists := k.Keys[name]; exists {
+		return nil, fmt.Errorf("a key named %q already exists", name)
+	}
+	if password == "" {
+		return nil, fmt.Errorf("an empty passphrase is not allowed")
+	}
+	pk, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %w", err)
+	}
+	ncryptsec, err := nip49.Encrypt(sk, password, logn, security)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt key: %w", err)
+	}
+	return k.put(name, pk, ncryptsec), nil
+}
+
+// AddEncrypted stores an existing ncryptsec as name after checking that
+// password decrypts it.
+func (k *Keyring) AddEncrypted(name, ncryptsec, password string) (*Entry, error) {
+	if !name_re.MatchString(name) {
+		return nil, fmt.Errorf("invalid key name %q (use lowercase letters, digits, - and _)", name)
+	}
+	if _, exists := k.Keys[name]; exists {
+		return nil, fmt.Errorf("a key named %q already exists", name)
+	}
+	sk, err := nip49.Decrypt(ncryptsec, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt ncryptsec (wrong passphrase?): %w", err)
+	}
+	pk, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %w", err)
+	}
+	return k.put(name, pk, ncryptsec), nil
+}
+
+func (k *Keyring) put(name, pk, ncryptsec string) *Entry {
+	e := &Entry{Name: name, Pubkey: pk, Ncryptsec: ncryptsec, CreatedAt: time.Now().Unix()}
+	k.Keys[name] = e
+	if k.Default == "" {
+		k.Default = name
+	}
+	return e
+}
+
+// Use makes name the default profile, or the profile for role when role is set.
+func (k *Keyring) Use(name, role string) error {
+	if _, err := k.Get(name); err != nil {
+		return err
+	}
+	switch role {
+	case "":
+		k.Default = name
+	case RoleAuthor, RoleLibrarian:
+		if k.Roles == nil {
+			k.Roles = make(map[string]string)
+		}
+		k.Roles[role] = name
+	default:
+		return fmt.Errorf("unknown role %q (want %s or %s)", role, RoleAuthor, RoleLibrarian)
+	}
+	return nil
+}
+
+// Profile returns the profile to sign with for role: the role's profile if one
+// is set, else the default.
+func (k *Keyring) Profile(role string) string {
+	if name, ok := k.Roles[role]; ok {
+		if _, exists := k.Keys[name]; exists {
+			return name
+		}
+	}
+	return k.Default
+}
+
+// Decrypt returns the hex secret key of an entry.
+func (e *Entry) Decrypt(password string) (string, error) {
+	sk, err := nip49.Decrypt(e.Ncryptsec, password)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt key %q (wrong passphrase?): %w", e.Name, err)
+	}
+	return sk, nil
+}
+
+// Unlock decrypts an entry into a signer.
+func (e *Entry) Unlock(password string) (*signer.Key, error) {
+	sk, err := e.Decrypt(password)
+	if err != nil {
+		return nil, err
+	}
+	return signer.FromHex(sk)
+}
@@ -0,0 +1,154 @@
+package keyring
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip49"
+)
+
+// open_keyring opens an empty keyring in a temporary config directory.
+func open_keyring(t *testing.T) *Keyring {
+	t.Helper()
+	t.Setenv("KETAB_HOME", filepath.Join(t.TempDir(), "ketab"))
+	k, err := Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	k := open_keyring(t)
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+
+	entry, err := k.Add("author", sk, "correct horse", nip49.ClientDoesNotTrackThisData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Pubkey != pk || entry.Ncryptsec == "" || k.Default != "author" {
+		t.Errorf("entry = %+v, default = %q", entry, k.Default)
+	}
+	got, err := entry.Decrypt("correct horse")
+	if err != nil || got != sk {
+		t.Errorf("Decrypt = %q, %v; want the secret key back", got, err)
+	}
+	if _, err := entry.Decrypt("wrong"); err == nil {
+		t.Error("decrypted with the wrong passphrase")
+	}
+	key, err := entry.Unlock("correct horse")
+	if err != nil || key.PublicKey() != pk {
+		t.Errorf("Unlock: %v", err)
+	}
+
+	// An exported ncryptsec imports under another name with its passphrase only.
+	if _, err := k.AddEncrypted("copy", entry.Ncryptsec, "wrong"); err == nil {
+		t.Error("imported an ncryptsec with the wrong passphrase")
+	}
+	copied, err := k.AddEncrypted("copy", entry.Ncryptsec, "correct horse")
+	if err != nil || copied.Pubkey != pk || k.Default != "author" {
+		t.Errorf("AddEncrypted = %+v, %v; default = %q", copied, err, k.Default)
+	}
+
+	for name, password := range map[string]string{"author": "p", "Bad Name": "p", "empty": ""} {
+		if _, err := k.Add(name, sk, password, nip49.ClientDoesNotTrackThisData); err == nil {
+			t.Errorf("Add(%q, password %q) succeeded", name, password)
+		}
+	}
+}
+
+func TestSave(t *testing.T) {
+	k := open_keyring(t)
+	sk := nostr.GeneratePrivateKey()
+	if _, err := k.Add("author", sk, "pass", nip49.ClientDoesNotTrackThisData); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(k.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("keyring mode = %o, want 600", mode)
+	}
+	dir, err := os.Stat(filepath.Dir(k.Path()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := dir.Mode().Perm(); mode != 0700 {
+		t.Errorf("config directory mode = %o, want 700", mode)
+	}
+	if _, err := os.Stat(k.Path() + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temp file left behind: %v", err)
+	}
+
+	loaded, err := Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := loaded.Get("author")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Name != "author" || loaded.Default != "author" {
+		t.Errorf("loaded entry %q, default %q", entry.Name, loaded.Default)
+	}
+	if got, err := entry.Decrypt("pass"); err != nil || got != sk {
+		t.Errorf("loaded key does not decrypt: %v", err)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	k := open_keyring(t)
+	for _, name := range []string{"main", "writer", "shelf"} {
+		if _, err := k.AddEncrypted(name, encrypted(t), "pass"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if k.Profile(RoleAuthor) != "main" || k.Profile(RoleLibrarian) != "main" {
+		t.Errorf("without roles: author %q, librarian %q; want the first key", k.Profile(RoleAuthor), k.Profile(RoleLibrarian))
+	}
+
+	if err := k.Use("writer", RoleAuthor); err != nil {
+		t.Fatal(err)
+	}
+	if k.Profile(RoleAuthor) != "writer" || k.Profile(RoleLibrarian) != "main" {
+		t.Errorf("author role: author %q, librarian %q", k.Profile(RoleAuthor), k.Profile(RoleLibrarian))
+	}
+	if err := k.Use("shelf", ""); err != nil {
+		t.Fatal(err)
+	}
+	if k.Profile(RoleAuthor) != "writer" || k.Profile(RoleLibrarian) != "shelf" {
+		t.Errorf("new default: author %q, librarian %q", k.Profile(RoleAuthor), k.Profile(RoleLibrarian))
+	}
+
+	// A role naming a key that no longer exists falls back to the default.
+	delete(k.Keys, "writer")
+	if k.Profile(RoleAuthor) != "shelf" {
+		t.Errorf("removed role key: author %q, want shelf", k.Profile(RoleAuthor))
+	}
+
+	if err := k.Use("missing", ""); err == nil {
+		t.Error("used a key that does not exist")
+	}
+	if err := k.Use("main", "reader"); err == nil {
+		t.Error("used an unknown role")
+	}
+}
+
+// encrypted returns a new key encrypted with the passphrase "pass" at the
+// lowest work factor, to keep tests fast.
+func encrypted(t *testing.T) string {
+	t.Helper()
+	ncryptsec, err := nip49.Encrypt(nostr.GeneratePrivateKey(), "pass", 1, nip49.ClientDoesNotTrackThisData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ncryptsec
+}
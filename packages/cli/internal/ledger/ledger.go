@@ -0,0 +1,206 @@
+// Package ledger records what has been published from a book directory,
+// so publishing can skip events whose content has not changed.
+//
+// The ledger lives at <book-dir>/.ketab/state.json.
+package ledger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Version is the current ledger file format version.
+const Version = 1
+
+// Dir and File locate the ledger inside a book directory.
+const (
+	Dir  = ".ketab"
+	File = "state.json"
+)
+
+// Ledger is the publish ledger of a book directory.
+type Ledger struct {
+	Version int `json:"version"`
+
+	// Entries is keyed by event coordinate (<kind>:<pubkey>:<d-tag>).
+	Entries map[string]*Entry `json:"entries"`
+
+	path string
+}
+
+// Entry records the last published version of one addressable event.
+type Entry struct {
+	Kind        int                     `json:"kind"`
+	DTag        string                  `json:"d_tag"`
+	ContentHash string                  `json:"content_hash"`
+	EventID     string                  `json:"event_id"`
+	CreatedAt   int64                   `json:"created_at"`
+	PublishedAt int64                   `json:"published_at,omitempty"` // First publish time (chapters, books)
+	Relays      map[string]*RelayStatus `json:"relays"`
+
+	// DeletedAt and DeletionID record a NIP-09 deletion request sent by
+	// `ketab unpublish`. Publishing a new version clears them.
+	DeletedAt  int64  `json:"deleted_at,omitempty"`
+	DeletionID string `json:"deletion_id,omitempty"`
+}
+
+// RelayStatus records whether a relay accepted the entry's event.
+type RelayStatus struct {
+	Accepted bool   `json:"accepted"`
+	Message  string `json:"message,omitempty"`
+	At       int64  `json:"at"`
+}
+
+// Path returns the ledger path for a book directory.
+func Path(book_dir string) string {
+	return filepath.Join(book_dir, Dir, File)
+}
+
+// Load reads the ledger of a book directory. A missing ledger is not an error:
+// an empty one is returned.
+func Load(book_dir string) (*Ledger, error) {
+	l := &Ledger{
+		Version: Version,
+		Entries: make(map[string]*Entry),
+		path:    Path(book_dir),
+	}
+	data, err := os.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", l.path, err)
+	}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", l.path, err)
+	}
+	if l.Version > Version {
+		return nil, fmt.Errorf("%s has version %d, this ketab supports up to %d", l.path, l.Version, Version)
+	}
+	if l.Entries == nil {
+		l.Entries = make(map[string]*Entry)
+	}
+	return l, nil
+}
+
+// Save writes the ledger atomically (write to a temp file, then rename).
+func (l *Ledger) Save() error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(l.path), err)
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal ledger: %w", err)
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, l.path)
+}
+
+// Get returns the entry for an event's coordinate, or nil.
+func (l *Ledger) Get(event *nostr.Event) *Entry {
+	return l.Entries[Coordinate(event)]
+}
+
+// PublishedAt returns the recorded first-publish time of every entry, keyed by coordinate.
+func (l *Ledger) PublishedAt() map[string]int64 {
+	out := make(map[string]int64)
+	for coord, e := range l.Entries {
+		if e.PublishedAt != 0 {
+			out[coord] = e.PublishedAt
+		}
+	}
+	return out
+}
+
+// Record stores the outcome of publishing a signed event. results maps relay URL
+// to the publish error (nil when accepted). When the event ID is unchanged, relay
+// statuses are merged with the previous ones; otherwise they are replaced.
+func (l *Ledger) Record(event *nostr.Event, published_at int64, results map[string]error) *Entry {
+	coord := Coordinate(event)
+	entry := l.Entries[coord]
+	if entry == nil || entry.EventID != event.ID {
+		entry = &Entry{Relays: make(map[string]*RelayStatus)}
+		l.Entries[coord] = entry
+	}
+	entry.Kind = event.Kind
+	entry.DTag = event.Tags.GetD()
+	entry.ContentHash = Hash(event)
+	entry.EventID = event.ID
+	entry.CreatedAt = int64(event.CreatedAt)
+	if published_at != 0 {
+		entry.PublishedAt = published_at
+	}
+	now := time.Now().Unix()
+	for url, err := range results {
+		status := &RelayStatus{Accepted: err == nil, At: now}
+		if err != nil {
+			status.Message = err.Error()
+		}
+		entry.Relays[url] = status
+	}
+	return entry
+}
+
+// MarkDeleted records that a deletion request covering the event at coord was
+// accepted. The entry is created when coord was never recorded.
+func (l *Ledger) MarkDeleted(coord string, kind int, d_tag string, deletion *nostr.Event) *Entry {
+	entry := l.Entries[coord]
+	if entry == nil {
+		entry = &Entry{Kind: kind, DTag: d_tag, Relays: make(map[string]*RelayStatus)}
+		l.Entries[coord] = entry
+	}
+	entry.DeletedAt = int64(deletion.CreatedAt)
+	entry.DeletionID = deletion.ID
+	return entry
+}
+
+// Deleted returns the coordinates of the entries marked deleted.
+func (l *Ledger) Deleted() map[string]bool {
+	out := make(map[string]bool)
+	for coord, e := range l.Entries {
+		if e.DeletedAt != 0 {
+			out[coord] = true
+		}
+	}
+	return out
+}
+
+// Unchanged reports whether the entry was published with the same content hash.
+func (e *Entry) Unchanged(event *nostr.Event) bool {
+	return e != nil && e.ContentHash == Hash(event)
+}
+
+// PendingRelays returns the relays in urls that have not accepted the entry's event.
+func (e *Entry) PendingRelays(urls []string) []string {
+	var pending []string
+	for _, url := range urls {
+		if status, ok := e.Relays[url]; !ok || !status.Accepted {
+			pending = append(pending, url)
+		}
+	}
+	return pending
+}
+
+// Coordinate returns an event's coordinate (<kind>:<pubkey>:<d-tag>).
+func Coordinate(event *nostr.Event) string {
+	return fmt.Sprintf("%d:%s:%s", event.Kind, event.PubKey, event.Tags.GetD())
+}
+
+// Hash returns the content hash of an event: SHA-256 over its pubkey, kind, tags
+// and content. created_at, id and sig are excluded, so re-signing the same
+// content yields the same hash.
+func Hash(event *nostr.Event) string {
+	data, _ := json.Marshal([]any{event.PubKey, event.Kind, event.Tags, event.Content})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
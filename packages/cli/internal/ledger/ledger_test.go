@@ -0,0 +1,166 @@
+package ledger
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// sign returns a kind 38893 event with d-tag d and content, signed by sk at created_at.
+func sign(t *testing.T, sk string, created_at nostr.Timestamp, d, content string) *nostr.Event {
+	t.Helper()
+	event := &nostr.Event{Kind: 38893, CreatedAt: created_at, Tags: nostr.Tags{{"d", d}}, Content: content}
+	if err := event.Sign(sk); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestHash(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	event := sign(t, sk, 100, "k1", "body")
+	resigned := sign(t, sk, 200, "k1", "body")
+	if Hash(event) != Hash(resigned) {
+		t.Error("re-signing the same content at another time changed the hash")
+	}
+
+	changes := map[string]*nostr.Event{
+		"pubkey":  sign(t, nostr.GeneratePrivateKey(), 100, "k1", "body"),
+		"tags":    sign(t, sk, 100, "k2", "body"),
+		"content": sign(t, sk, 100, "k1", "other"),
+	}
+	kind := *event
+	kind.Kind = 38891
+	changes["kind"] = &kind
+	for field, changed := range changes {
+		if Hash(changed) == Hash(event) {
+			t.Errorf("changing the %s kept the hash", field)
+		}
+	}
+}
+
+func TestRecord(t *testing.T) {
+	l, err := Load(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk := nostr.GeneratePrivateKey()
+	event := sign(t, sk, 100, "k1", "body")
+
+	entry := l.Record(event, 90, map[string]error{"wss://a": nil, "wss://b": errors.New("blocked")})
+	if entry.CreatedAt != 100 || entry.PublishedAt != 90 || entry.EventID != event.ID || entry.DTag != "k1" {
+		t.Errorf("entry = %+v", entry)
+	}
+	if !entry.Relays["wss://a"].Accepted || entry.Relays["wss://b"].Accepted || entry.Relays["wss://b"].Message != "blocked" {
+		t.Errorf("relays = a:%+v b:%+v", entry.Relays["wss://a"], entry.Relays["wss://b"])
+	}
+
+	// The same event sent again merges relay statuses and keeps published_at.
+	entry = l.Record(event, 0, map[string]error{"wss://b": nil})
+	if !entry.Relays["wss://a"].Accepted || !entry.Relays["wss://b"].Accepted || entry.PublishedAt != 90 {
+		t.Errorf("after resend: %+v", entry)
+	}
+
+	// A new version replaces them.
+	edited := sign(t, sk, 300, "k1", "edited")
+	entry = l.Record(edited, 0, map[string]error{"wss://b": nil})
+	if _, ok := entry.Relays["wss://a"]; ok || entry.CreatedAt != 300 || entry.EventID != edited.ID {
+		t.Errorf("after edit: %+v", entry)
+	}
+	if l.Get(edited) != entry || len(l.Entries) != 1 {
+		t.Errorf("got %d entries, want the edit recorded at the same coordinate", len(l.Entries))
+	}
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	l, err := Load(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk := nostr.GeneratePrivateKey()
+	relays := []string{"wss://a", "wss://b"}
+	event := sign(t, sk, 100, "k1", "body")
+	if entry := l.Get(event); entry.Unchanged(event) {
+		t.Error("an event never published is unchanged")
+	}
+
+	l.Record(event, 0, map[string]error{"wss://a": nil, "wss://b": errors.New("timeout")})
+	resigned := sign(t, sk, 200, "k1", "body")
+	entry := l.Get(resigned)
+	if !entry.Unchanged(resigned) {
+		t.Error("re-signed content is not unchanged")
+	}
+	if pending := entry.PendingRelays(relays); len(pending) != 1 || pending[0] != "wss://b" {
+		t.Errorf("PendingRelays = %v, want [wss://b]", pending)
+	}
+	if entry.Unchanged(sign(t, sk, 200, "k1", "edited")) {
+		t.Error("edited content is unchanged")
+	}
+
+	l.Record(event, 0, map[string]error{"wss://b": nil})
+	if pending := l.Get(event).PendingRelays(relays); len(pending) != 0 {
+		t.Errorf("PendingRelays = %v after every relay accepted", pending)
+	}
+}
+
+func TestSave(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk := nostr.GeneratePrivateKey()
+	event := sign(t, sk, 100, "k1", "body")
+	l.Record(event, 90, map[string]error{"wss://a": nil})
+	if err := l.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(Path(dir) + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temp file left behind: %v", err)
+	}
+
+	loaded, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := loaded.Get(event)
+	if entry == nil || entry.EventID != event.ID || entry.CreatedAt != 100 || entry.PublishedAt != 90 || !entry.Relays["wss://a"].Accepted {
+		t.Fatalf("loaded entry = %+v", entry)
+	}
+
+	// A failed write leaves the saved ledger intact.
+	before, err := os.ReadFile(Path(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(Path(dir)+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	loaded.Record(sign(t, sk, 200, "k1", "edited"), 0, nil)
+	if err := loaded.Save(); err == nil {
+		t.Fatal("Save succeeded without its temp file")
+	}
+	after, err := os.ReadFile(Path(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Error("a failed save changed the ledger")
+	}
+}
+
+func TestLoadNewerVersion(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, Dir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(Path(dir), []byte(`{"version": 99, "entries": {}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil {
+		t.Error("loaded a ledger from a newer version")
+	}
+}
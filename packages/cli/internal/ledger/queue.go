@@ -0,0 +1,119 @@
+package ledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// QueueFile is the resumable publish queue inside a book directory's Dir.
+const QueueFile = "queue.json"
+
+// Queue holds signed events that some relays have not accepted yet, so that
+// `ketab publish --resume` can send them again without rebuilding or
+// re-signing anything.
+type Queue struct {
+	Version int          `json:"version"`
+	Items   []*QueueItem `json:"items"` // In publish order
+
+	path string
+}
+
+// QueueItem is a signed event and the relays still missing it.
+type QueueItem struct {
+	Section   string       `json:"section"` // KETABS, CHAPTERS, BOOK, LIBRARY
+	Label     string       `json:"label"`
+	Event     *nostr.Event `json:"event"`
+	Relays    []string     `json:"relays"`
+	LastError string       `json:"last_error,omitempty"`
+}
+
+// QueuePath returns the queue path for a book directory.
+func QueuePath(book_dir string) string {
+	return filepath.Join(book_dir, Dir, QueueFile)
+}
+
+// LoadQueue reads the publish queue of a book directory. A missing queue is
+// not an error: an empty one is returned.
+func LoadQueue(book_dir string) (*Queue, error) {
+	q := &Queue{Version: Version, path: QueuePath(book_dir)}
+	data, err := os.ReadFile(q.path)
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", q.path, err)
+	}
+	if err := json.Unmarshal(data, q); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", q.path, err)
+	}
+	if q.Version > Version {
+		return nil, fmt.Errorf("%s has version %d, this ketab supports up to %d", q.path, q.Version, Version)
+	}
+	return q, nil
+}
+
+// Save writes the queue atomically, or removes the file once the queue is empty.
+func (q *Queue) Save() error {
+	if len(q.Items) == 0 {
+		if err := os.Remove(q.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", q.path, err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(q.path), err)
+	}
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue: %w", err)
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, q.path)
+}
+
+// Put queues a signed event for relays. An item for the same coordinate is
+// replaced in place: a newer version supersedes whatever was still pending.
+func (q *Queue) Put(item *QueueItem) {
+	coord := Coordinate(item.Event)
+	for i, existing := range q.Items {
+		if Coordinate(existing.Event) == coord {
+			q.Items[i] = item
+			return
+		}
+	}
+	q.Items = append(q.Items, item)
+}
+
+// Remove drops the item for an event's coordinate, if any.
+func (q *Queue) Remove(event *nostr.Event) {
+	coord := Coordinate(event)
+	for i, existing := range q.Items {
+		if Coordinate(existing.Event) == coord {
+			q.Items = append(q.Items[:i], q.Items[i+1:]...)
+			return
+		}
+	}
+}
+
+// RemoveCoordinates drops the items whose coordinate is in coords.
+func (q *Queue) RemoveCoordinates(coords map[string]bool) {
+	kept := q.Items[:0]
+	for _, item := range q.Items {
+		if !coords[Coordinate(item.Event)] {
+			kept = append(kept, item)
+		}
+	}
+	q.Items = kept
+}
+
+// Len returns the number of queued events.
+func (q *Queue) Len() int {
+	return len(q.Items)
+}
@@ -0,0 +1,322 @@
+// Package library keeps local manifests of the libraries (kind 38890) a
+// librarian publishes, and merges them with the latest library event on relays
+// so that publishing one book never drops the others.
+//
+// Manifests live in libraries.json in the CLI config directory.
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/signer"
+	core "github.com/joinnextblock/ketab-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// File is the manifest file name inside signer.ConfigDir.
+const File = "libraries.json"
+
+// DefaultDescription is the description of libraries created without one.
+const DefaultDescription = "Books published on Nostr. Read by citizens."
+
+// Store is the set of local library manifests.
+type Store struct {
+	// Default is the d-tag of the library used when a command is not given --library.
+	Default   string              `json:"default,omitempty"`
+	Libraries map[string]*Library `json:"libraries"`
+
+	path string
+}
+
+// Library is the local manifest of one library.
+type Library struct {
+	D           string `json:"d"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Pubkey      string `json:"pubkey"` // Librarian
+
+	// Block is the City Protocol block coordinate the library is anchored to.
+	Block string `json:"block,omitempty"`
+
+	// Books is the ordered book list.
+	Books []Book `json:"books"`
+
+	// Removed holds the coordinates of books removed locally, so that a merge
+	// with an older relay copy does not bring them back.
+	Removed []string `json:"removed,omitempty"`
+
+	// UpdatedAt is the created_at of the last library event published or merged.
+	UpdatedAt int64 `json:"updated_at,omitempty"`
+}
+
+// Book is a book in a library.
+type Book struct {
+	D      string `json:"d"`
+	Title  string `json:"title"`
+	Author string `json:"author"` // Book author pubkey
+}
+
+// Coordinate returns the book's coordinate (38891:<author>:<d>).
+func (b Book) Coordinate() string {
+	return fmt.Sprintf("%d:%s:%s", core.KindBook, b.Author, b.D)
+}
+
+// Open reads the manifests from the config directory. A missing file is not
+// an error: an empty store is returned.
+func Open() (*Store, error) {
+	dir, err := signer.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{Libraries: make(map[string]*Library), path: filepath.Join(dir, File)}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.path, err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	if s.Libraries == nil {
+		s.Libraries = make(map[string]*Library)
+	}
+	return s, nil
+}
+
+// Path returns the manifest file path.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Save writes the manifests atomically.
+func (s *Store) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(s.path), err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal libraries: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Create adds a new library manifest with a random UUID d-tag (or d, if set).
+// The first library created becomes the default.
+func (s *Store) Create(d, name, description, pubkey, block string) (*Library, error) {
+	if d == "" {
+		d = book.NewUUID()
+	}
+	if _, exists := s.Libraries[d]; exists {
+		return nil, fmt.Errorf("library %s already exists in %s", d, s.path)
+	}
+	if description == "" {
+		description = DefaultDescription
+	}
+	lib := &Library{D: d, Name: name, Description: description, Pubkey: pubkey, Block: block, Books: []Book{}}
+	s.Libraries[d] = lib
+	if s.Default == "" {
+		s.Default = d
+	}
+	return lib, nil
+}
+
+// Get returns a library by d-tag, or the default library for an empty d.
+func (s *Store) Get(d string) (*Library, error) {
+	if d == "" {
+		d = s.Default
+	}
+	if d == "" {
+		return nil, fmt.Errorf("no library yet — run `ketab library create <name>`")
+	}
+	lib, ok := s.Libraries[d]
+	if !ok {
+		return nil, fmt.Errorf("no library %s in %s (see `ketab library show`)", d, s.path)
+	}
+	return lib, nil
+}
+
+// Add stores a library manifest, e.g. one adopted from relays.
+func (s *Store) Add(lib *Library) {
+	s.Libraries[lib.D] = lib
+	if s.Default == "" {
+		s.Default = lib.D
+	}
+}
+
+// List returns the libraries sorted by name.
+func (s *Store) List() []*Library {
+	libs := make([]*Library, 0, len(s.Libraries))
+	for _, lib := range s.Libraries {
+		libs = append(libs, lib)
+	}
+	sort.Slice(libs, func(i, j int) bool { return libs[i].Name < libs[j].Name })
+	return libs
+}
+
+// Coordinate returns the library's coordinate (38890:<pubkey>:<d>).
+func (l *Library) Coordinate() string {
+	return fmt.Sprintf("%d:%s:%s", core.KindLibrary, l.Pubkey, l.D)
+}
+
+// Index returns the position of the book with the given d-tag or coordinate, or -1.
+func (l *Library) Index(book string) int {
+	for i, b := range l.Books {
+		if b.D == book || b.Coordinate() == book {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddBook inserts a book at position (0-based; negative or past the end
+// appends). A book already in the library has its title updated in place and
+// is moved only when position is given.
+func (l *Library) AddBook(book Book, position int) {
+	l.unremove(book.Coordinate())
+	if i := l.Index(book.Coordinate()); i >= 0 {
+		if book.Title != "" {
+			l.Books[i].Title = book.Title
+		}
+		if position >= 0 {
+			l.Move(book.Coordinate(), position)
+		}
+		return
+	}
+	if position < 0 || position > len(l.Books) {
+		position = len(l.Books)
+	}
+	l.Books = append(l.Books[:position], append([]Book{book}, l.Books[position:]...)...)
+}
+
+// RemoveBook removes a book by d-tag or coordinate and remembers the removal.
+func (l *Library) RemoveBook(book string) (Book, error) {
+	i := l.Index(book)
+	if i < 0 {
+		return Book{}, fmt.Errorf("book %s is not in library %q", book, l.Name)
+	}
+	removed := l.Books[i]
+	l.Books = append(l.Books[:i], l.Books[i+1:]...)
+	l.Removed = append(l.Removed, removed.Coordinate())
+	return removed, nil
+}
+
+// Move moves a book to position (0-based, clamped).
+func (l *Library) Move(book string, position int) error {
+	i := l.Index(book)
+	if i < 0 {
+		return fmt.Errorf("book %s is not in library %q", book, l.Name)
+	}
+	b := l.Books[i]
+	l.Books = append(l.Books[:i], l.Books[i+1:]...)
+	if position < 0 {
+		position = 0
+	}
+	if position > len(l.Books) {
+		position = len(l.Books)
+	}
+	l.Books = append(l.Books[:position], append([]Book{b}, l.Books[position:]...)...)
+	return nil
+}
+
+// Reorder puts the given books (d-tags or coordinates) first, in that order,
+// followed by the remaining books in their current order.
+func (l *Library) Reorder(books []string) error {
+	var ordered []Book
+	taken := make(map[int]bool)
+	for _, book := range books {
+		i := l.Index(book)
+		if i < 0 {
+			return fmt.Errorf("book %s is not in library %q", book, l.Name)
+		}
+		if taken[i] {
+			return fmt.Errorf("book %s is listed twice", book)
+		}
+		taken[i] = true
+		ordered = append(ordered, l.Books[i])
+	}
+	for i, b := range l.Books {
+		if !taken[i] {
+			ordered = append(ordered, b)
+		}
+	}
+	l.Books = ordered
+	return nil
+}
+
+// Merge folds a library fetched from relays into the manifest. A remote copy
+// no newer than the last one published or merged is ignored: the manifest
+// already has its books, and a relay that missed an update must not bring
+// back removed ones. A newer copy decides the name, description and order;
+// books only the manifest has follow, except those removed locally.
+func (l *Library) Merge(remote *Library) {
+	if remote.UpdatedAt <= l.UpdatedAt {
+		return
+	}
+	removed := make(map[string]bool)
+	for _, coord := range l.Removed {
+		removed[coord] = true
+	}
+	titles := make(map[string]string)
+	for _, b := range l.Books {
+		titles[b.Coordinate()] = b.Title
+	}
+
+	merged := []Book{}
+	seen := make(map[string]bool)
+	for _, b := range append(append([]Book{}, remote.Books...), l.Books...) {
+		coord := b.Coordinate()
+		if seen[coord] || removed[coord] {
+			continue
+		}
+		seen[coord] = true
+		if b.Title == "" {
+			b.Title = titles[coord]
+		}
+		merged = append(merged, b)
+	}
+	l.Books = merged
+	l.Name = remote.Name
+	l.Description = remote.Description
+	if remote.Block != "" {
+		l.Block = remote.Block
+	}
+	l.UpdatedAt = remote.UpdatedAt
+}
+
+// Published records that the library was published as event: the removals
+// are now on relays, so the tombstones are no longer needed.
+func (l *Library) Published(event *nostr.Event) {
+	l.UpdatedAt = int64(event.CreatedAt)
+	l.Removed = nil
+}
+
+func (l *Library) unremove(coord string) {
+	kept := l.Removed[:0]
+	for _, c := range l.Removed {
+		if c != coord {
+			kept = append(kept, c)
+		}
+	}
+	l.Removed = kept
+}
+
+// ParseBookRef parses a 38891 coordinate (38891:<author>:<d>) into a Book.
+func ParseBookRef(coord string) (Book, bool) {
+	parts := strings.SplitN(coord, ":", 3)
+	if len(parts) != 3 || parts[0] != fmt.Sprint(core.KindBook) || !nostr.IsValidPublicKey(parts[1]) || parts[2] == "" {
+		return Book{}, false
+	}
+	return Book{Author: parts[1], D: parts[2]}, true
+}
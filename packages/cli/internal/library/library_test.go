@@ -0,0 +1,106 @@
+package library
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var (
+	author = pubkey()
+	other  = pubkey()
+)
+
+func pubkey() string {
+	pk, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	return pk
+}
+
+func ds(books []Book) string {
+	var out []string
+	for _, b := range books {
+		out = append(out, b.D)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestMergeOlderRemote(t *testing.T) {
+	local := &Library{Name: "Local", Books: []Book{{D: "one", Author: author}}, UpdatedAt: 200}
+	local.Merge(&Library{Name: "Remote", Books: []Book{{D: "two", Author: author}}, UpdatedAt: 200})
+	if local.Name != "Local" || ds(local.Books) != "one" {
+		t.Errorf("a remote copy no newer than the manifest changed it: %q %s", local.Name, ds(local.Books))
+	}
+}
+
+func TestMergeNewerRemote(t *testing.T) {
+	local := &Library{
+		Name:        "Local",
+		Description: "Old",
+		Block:       "38808:clock:old",
+		Books: []Book{
+			{D: "one", Title: "One", Author: author},
+			{D: "local", Title: "Local only", Author: author},
+			{D: "two", Title: "Two", Author: author},
+		},
+		UpdatedAt: 100,
+	}
+	remote := &Library{
+		Name:        "Remote",
+		Description: "New",
+		Books: []Book{
+			{D: "two", Author: author},
+			{D: "three", Title: "Three", Author: other},
+			{D: "one", Title: "One", Author: author},
+		},
+		UpdatedAt: 200,
+	}
+	local.Merge(remote)
+
+	// The remote order comes first, then books only the manifest has.
+	if got := ds(local.Books); got != "two,three,one,local" {
+		t.Errorf("books = %s, want two,three,one,local", got)
+	}
+	if local.Books[0].Title != "Two" {
+		t.Errorf("untitled remote book did not keep the local title: %q", local.Books[0].Title)
+	}
+	if local.Name != "Remote" || local.Description != "New" || local.UpdatedAt != 200 {
+		t.Errorf("merged library = %q %q %d", local.Name, local.Description, local.UpdatedAt)
+	}
+	if local.Block != "38808:clock:old" {
+		t.Errorf("a remote copy without a block dropped the local one: %q", local.Block)
+	}
+}
+
+func TestMergeKeepsRemovals(t *testing.T) {
+	local := &Library{
+		Books:     []Book{{D: "one", Author: author}, {D: "two", Author: author}},
+		UpdatedAt: 100,
+	}
+	if _, err := local.RemoveBook("two"); err != nil {
+		t.Fatal(err)
+	}
+	remote := &Library{Books: []Book{{D: "one", Author: author}, {D: "two", Author: author}}, UpdatedAt: 200}
+	local.Merge(remote)
+	if got := ds(local.Books); got != "one" {
+		t.Errorf("books = %s, want the removed book to stay removed", got)
+	}
+
+	// Adding the book back lifts the tombstone.
+	local.AddBook(Book{D: "two", Author: author}, -1)
+	local.Merge(&Library{Books: []Book{{D: "two", Author: author}}, UpdatedAt: 300})
+	if got := ds(local.Books); got != "two,one" {
+		t.Errorf("books = %s, want two,one", got)
+	}
+	if len(local.Removed) != 0 {
+		t.Errorf("Removed = %v after the book was added back", local.Removed)
+	}
+}
+
+func TestMergeSameDTagOtherAuthor(t *testing.T) {
+	local := &Library{Books: []Book{{D: "book", Author: author}}, UpdatedAt: 100}
+	local.Merge(&Library{Books: []Book{{D: "book", Author: other}}, UpdatedAt: 200})
+	if len(local.Books) != 2 || local.Books[0].Author != other || local.Books[1].Author != author {
+		t.Errorf("books = %+v, want both authors' books", local.Books)
+	}
+}
@@ -0,0 +1,137 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/fetch"
+	core "github.com/joinnextblock/ketab-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// FetchLatest fetches the newest library event for pubkey and d from relays
+// and parses it. It returns nil, nil when no relay has one.
+func FetchLatest(ctx context.Context, pool *nostr.SimplePool, relays []string, pubkey, d string) (*Library, error) {
+	events := fetch.FetchLatest(ctx, pool, relays, nostr.Filter{
+		Kinds:   []int{core.KindLibrary},
+		Authors: []string{pubkey},
+		Tags:    nostr.TagMap{"d": []string{d}},
+	})
+	event, ok := events[d]
+	if !ok {
+		return nil, nil
+	}
+	return FromEvent(event)
+}
+
+// FromEvent parses a library event. Its books come from the ordered `books`
+// content array, as {d, title} objects or, as published by older CLIs,
+// coordinate strings; book authors are taken from the 38891 'a' tags (the
+// librarian when a book has none). Books only present as 'a' tags follow.
+func FromEvent(event *nostr.Event) (*Library, error) {
+	if event.Kind != core.KindLibrary {
+		return nil, fmt.Errorf("expected library event (kind %d), got kind %d", core.KindLibrary, event.Kind)
+	}
+	var content struct {
+		Name        string            `json:"name"`
+		Description string            `json:"description"`
+		Books       []json.RawMessage `json:"books"`
+	}
+	if err := json.Unmarshal([]byte(event.Content), &content); err != nil {
+		return nil, fmt.Errorf("invalid library content: %w", err)
+	}
+
+	lib := &Library{
+		D:           event.Tags.GetD(),
+		Name:        content.Name,
+		Description: content.Description,
+		Pubkey:      event.PubKey,
+		Books:       []Book{},
+		UpdatedAt:   int64(event.CreatedAt),
+	}
+
+	// Book coordinates from 'a' tags, in tag order
+	var tagged []Book
+	authors := make(map[string]string) // d -> author
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "a" {
+			continue
+		}
+		if strings.HasPrefix(tag[1], "38808:") {
+			lib.Block = tag[1]
+			continue
+		}
+		if b, ok := ParseBookRef(tag[1]); ok {
+			tagged = append(tagged, b)
+			authors[b.D] = b.Author
+		}
+	}
+
+	for _, raw := range content.Books {
+		var b Book
+		var coord string
+		if json.Unmarshal(raw, &coord) == nil {
+			parsed, ok := ParseBookRef(coord)
+			if !ok {
+				continue
+			}
+			b = parsed
+		} else {
+			var entry core.LibraryBook
+			if json.Unmarshal(raw, &entry) != nil || entry.D == "" {
+				continue
+			}
+			b = Book{D: entry.D, Title: entry.Title, Author: authors[entry.D]}
+			if b.Author == "" {
+				b.Author = event.PubKey
+			}
+		}
+		if lib.Index(b.Coordinate()) < 0 {
+			lib.Books = append(lib.Books, b)
+		}
+	}
+	for _, b := range tagged {
+		if lib.Index(b.Coordinate()) < 0 {
+			lib.Books = append(lib.Books, b)
+		}
+	}
+	return lib, nil
+}
+
+// FillTitles looks up the titles of books that have none from their book events.
+func FillTitles(ctx context.Context, pool *nostr.SimplePool, relays []string, lib *Library) {
+	by_author := make(map[string][]string)
+	for _, b := range lib.Books {
+		if b.Title == "" {
+			by_author[b.Author] = append(by_author[b.Author], b.D)
+		}
+	}
+	for author, ds := range by_author {
+		events := fetch.FetchLatest(ctx, pool, relays, nostr.Filter{
+			Kinds:   []int{core.KindBook},
+			Authors: []string{author},
+			Tags:    nostr.TagMap{"d": ds},
+		})
+		for i, b := range lib.Books {
+			if event, ok := events[b.D]; ok && b.Author == author && b.Title == "" {
+				lib.Books[i].Title = BookTitle(event)
+			}
+		}
+	}
+}
+
+// BookTitle returns the title of a book event, from its content or title tag.
+func BookTitle(event *nostr.Event) string {
+	var content struct {
+		Title string `json:"title"`
+	}
+	if json.Unmarshal([]byte(event.Content), &content) == nil && content.Title != "" {
+		return content.Title
+	}
+	if tag := event.Tags.GetFirst([]string{"title", ""}); tag != nil {
+		return tag.Value()
+	}
+	return ""
+}
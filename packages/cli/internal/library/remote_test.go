@@ -0,0 +1,111 @@
+package library
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/relay"
+	core "github.com/joinnextblock/ketab-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// sign returns an event of kind with content and tags, signed by sk.
+func sign(t *testing.T, sk string, kind int, content string, tags ...nostr.Tag) *nostr.Event {
+	t.Helper()
+	event := &nostr.Event{Kind: kind, CreatedAt: 100, Content: content, Tags: tags}
+	if err := event.Sign(sk); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestFromEvent(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	librarian, _ := nostr.GetPublicKey(sk)
+	content := `{"name":"Shelf","description":"Books","books":[` +
+		`{"d":"one","title":"One"},` +
+		`"38891:` + other + `:legacy",` +
+		`{"d":"own","title":"Own"},` +
+		`{"d":""},"not a coordinate"]}`
+	event := sign(t, sk, core.KindLibrary, content,
+		nostr.Tag{"d", "shelf"},
+		nostr.Tag{"a", "38808:clock:org.cityprotocol:block:1:h"},
+		nostr.Tag{"a", "38891:" + author + ":tagged"},
+		nostr.Tag{"a", "38891:" + author + ":one"},
+	)
+
+	lib, err := FromEvent(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lib.D != "shelf" || lib.Name != "Shelf" || lib.Description != "Books" || lib.Pubkey != librarian || lib.UpdatedAt != 100 {
+		t.Errorf("library = %+v", lib)
+	}
+	if lib.Block != "38808:clock:org.cityprotocol:block:1:h" {
+		t.Errorf("Block = %q", lib.Block)
+	}
+	want := []Book{
+		{D: "one", Title: "One", Author: author},
+		{D: "legacy", Author: other},
+		{D: "own", Title: "Own", Author: librarian},
+		{D: "tagged", Author: author},
+	}
+	if len(lib.Books) != len(want) {
+		t.Fatalf("books = %+v, want %+v", lib.Books, want)
+	}
+	for i := range want {
+		if lib.Books[i] != want[i] {
+			t.Errorf("book %d = %+v, want %+v", i, lib.Books[i], want[i])
+		}
+	}
+
+	if _, err := FromEvent(sign(t, sk, core.KindBook, "{}")); err == nil {
+		t.Error("parsed a book event as a library")
+	}
+	if _, err := FromEvent(sign(t, sk, core.KindLibrary, "not json")); err == nil {
+		t.Error("parsed invalid library content")
+	}
+}
+
+func TestFillTitles(t *testing.T) {
+	store, err := relay.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(relay.New(store))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	for _, event := range []*nostr.Event{
+		sign(t, sk, core.KindBook, `{"title":"From content"}`, nostr.Tag{"d", "content"}),
+		sign(t, sk, core.KindBook, `{}`, nostr.Tag{"d", "tag"}, nostr.Tag{"title", "From tag"}),
+		sign(t, sk, core.KindBook, `{"title":"Replaced"}`, nostr.Tag{"d", "titled"}),
+	} {
+		if _, err := store.Save(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lib := &Library{Books: []Book{
+		{D: "content", Author: pk},
+		{D: "tag", Author: pk},
+		{D: "titled", Title: "Kept", Author: pk},
+		{D: "missing", Author: pk},
+	}}
+	pool := nostr.NewSimplePool(ctx)
+	FillTitles(ctx, pool, []string{url}, lib)
+
+	want := []string{"From content", "From tag", "Kept", ""}
+	for i, title := range want {
+		if lib.Books[i].Title != title {
+			t.Errorf("%s: title = %q, want %q", lib.Books[i].D, lib.Books[i].Title, title)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package markdown
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// delimiter is a run of emphasis markers: "*", "**", "_", "__" or "~~".
+type delimiter struct {
+	marker    string
+	start     int // byte offset in the text
+	can_open  bool
+	can_close bool
+	tag       string // set once paired: "<em>", "</em>", ...
+}
+
+// emphasis_tags maps a marker to the element it produces.
+var emphasis_tags = map[string]string{
+	"*":  "em",
+	"_":  "em",
+	"**": "strong",
+	"__": "strong",
+	"~~": "del",
+}
+
+// emphasis renders *em*, **strong** and ~~strike~~ markers. Markers pair
+// only with a later marker of the same kind, and an opener left inside a
+// pair stays literal, so the elements always nest properly: "*a **b* c**"
+// renders as "<em>a **b</em> c**". Underscores inside words are literal.
+func emphasis(s string) string {
+	var delims []*delimiter
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c != '*' && c != '_' && c != '~' {
+			i++
+			continue
+		}
+		n := 1
+		for i+n < len(s) && s[i+n] == c {
+			n++
+		}
+		before, _ := utf8.DecodeLastRuneInString(s[:i])
+		after, _ := utf8.DecodeRuneInString(s[i+n:])
+		open := i+n < len(s) && !unicode.IsSpace(after)
+		close := i > 0 && !unicode.IsSpace(before)
+		if c == '_' {
+			open = open && (i == 0 || !is_word(before))
+			close = close && (i+n == len(s) || !is_word(after))
+		}
+
+		var markers []string
+		switch {
+		case c == '~' && n == 2:
+			markers = []string{"~~"}
+		case c == '~':
+		case n == 1:
+			markers = []string{string(c)}
+		case n == 2:
+			markers = []string{strings.Repeat(string(c), 2)}
+		case n == 3 && close && !open:
+			markers = []string{string(c), strings.Repeat(string(c), 2)}
+		case n == 3:
+			markers = []string{strings.Repeat(string(c), 2), string(c)}
+		}
+		offset := i
+		for _, m := range markers {
+			delims = append(delims, &delimiter{marker: m, start: offset, can_open: open, can_close: close})
+			offset += len(m)
+		}
+		i += n
+	}
+
+	var stack []*delimiter
+	for _, d := range delims {
+		if d.can_close {
+			j := len(stack) - 1
+			for j >= 0 && stack[j].marker != d.marker {
+				j--
+			}
+			if j >= 0 {
+				stack[j].tag = "<" + emphasis_tags[d.marker] + ">"
+				d.tag = "</" + emphasis_tags[d.marker] + ">"
+				stack = stack[:j]
+				continue
+			}
+		}
+		if d.can_open {
+			stack = append(stack, d)
+		}
+	}
+
+	var out strings.Builder
+	last := 0
+	for _, d := range delims {
+		if d.tag == "" {
+			continue
+		}
+		out.WriteString(s[last:d.start])
+		out.WriteString(d.tag)
+		last = d.start + len(d.marker)
+	}
+	out.WriteString(s[last:])
+	return out.String()
+}
+
+func is_word(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,224 @@
+// Package markdown renders ketab bodies to HTML or XHTML. It covers what
+// ketab bodies use: ATX headings, paragraphs, emphasis, links, images, inline
+// and fenced code, blockquotes, flat lists and horizontal rules. Raw HTML is
+// escaped.
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	heading_re  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	rule_re     = regexp.MustCompile(`^\s*([-*_])(\s*([-*_]))*\s*$`)
+	bullet_re   = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	ordered_re  = regexp.MustCompile(`^\s*(\d+)[.)]\s+(.*)$`)
+	code_span   = regexp.MustCompile("`+([^`]+?)`+")
+	image_re    = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)(?:\s+&#34;([^"]*?)&#34;)?\)`)
+	link_re     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)(?:\s+&#34;([^"]*?)&#34;)?\)`)
+	note_ref_re = regexp.MustCompile(`\[\^?([0-9A-Za-z-]+)\]`)
+)
+
+// Renderer renders markdown documents. The zero value renders HTML.
+type Renderer struct {
+	// XHTML closes void elements (<hr/>, <br/>, <img/>) so the output is
+	// well-formed XML, as EPUB content documents require.
+	XHTML bool
+
+	// NoteRef, if set, returns the markup replacing a footnote reference
+	// ("[1]" or "[^1]") with the given label, or "" to leave it as text.
+	NoteRef func(label string) string
+
+	// Image, if set, returns the markup for an image in place of an img
+	// element. Its arguments are already escaped.
+	Image func(src, alt string) string
+}
+
+// Render converts markdown to HTML.
+func (r *Renderer) Render(md string) string {
+	lines := strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n")
+	var out strings.Builder
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			i++
+
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence := trimmed[:3]
+			var code []string
+			i++
+			for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+				code = append(code, lines[i])
+				i++
+			}
+			i++ // closing fence
+			fmt.Fprintf(&out, "<pre><code>%s</code></pre>\n", html.EscapeString(strings.Join(code, "\n")))
+
+		case heading_re.MatchString(trimmed):
+			m := heading_re.FindStringSubmatch(trimmed)
+			fmt.Fprintf(&out, "<h%d>%s</h%d>\n", len(m[1]), r.Inline(m[2]), len(m[1]))
+			i++
+
+		case is_rule(trimmed):
+			out.WriteString(r.void("hr") + "\n")
+			i++
+
+		case strings.HasPrefix(trimmed, ">"):
+			var quote []string
+			for i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">") {
+				q := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quote = append(quote, strings.TrimPrefix(q, " "))
+				i++
+			}
+			fmt.Fprintf(&out, "<blockquote>\n%s</blockquote>\n", r.Render(strings.Join(quote, "\n")))
+
+		case bullet_re.MatchString(line) || ordered_re.MatchString(line):
+			ordered := !bullet_re.MatchString(line)
+			tag := "ul"
+			if ordered {
+				tag = "ol"
+			}
+			var items []string
+			for i < len(lines) {
+				l := lines[i]
+				switch {
+				case !ordered && bullet_re.MatchString(l):
+					items = append(items, bullet_re.FindStringSubmatch(l)[1])
+				case ordered && ordered_re.MatchString(l):
+					items = append(items, ordered_re.FindStringSubmatch(l)[2])
+				case strings.TrimSpace(l) != "" && len(items) > 0 && (l[0] == ' ' || l[0] == '\t'):
+					items[len(items)-1] += " " + strings.TrimSpace(l)
+				default:
+					goto done
+				}
+				i++
+			}
+		done:
+			fmt.Fprintf(&out, "<%s>\n", tag)
+			for _, item := range items {
+				fmt.Fprintf(&out, "<li>%s</li>\n", r.Inline(item))
+			}
+			fmt.Fprintf(&out, "</%s>\n", tag)
+
+		default:
+			var para []string
+			for i < len(lines) && strings.TrimSpace(lines[i]) != "" && !starts_block(lines[i]) {
+				para = append(para, lines[i])
+				i++
+			}
+			if len(para) == 0 {
+				// Always consume at least one line
+				para = append(para, line)
+				i++
+			}
+			fmt.Fprintf(&out, "<p>%s</p>\n", r.paragraph(para))
+		}
+	}
+	return out.String()
+}
+
+// is_rule reports whether a trimmed line is a horizontal rule (---, ***, ___).
+func is_rule(trimmed string) bool {
+	return rule_re.MatchString(trimmed) && len(strings.ReplaceAll(trimmed, " ", "")) >= 3
+}
+
+// starts_block reports whether a line interrupts a paragraph.
+func starts_block(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return heading_re.MatchString(trimmed) ||
+		strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") ||
+		strings.HasPrefix(trimmed, ">") ||
+		bullet_re.MatchString(line) ||
+		is_rule(trimmed)
+}
+
+// paragraph renders paragraph lines; a line ending in two spaces or a
+// backslash breaks the line.
+func (r *Renderer) paragraph(lines []string) string {
+	var parts []string
+	for k, line := range lines {
+		text := strings.TrimSpace(line)
+		hard := strings.HasSuffix(line, "  ") || strings.HasSuffix(text, "\\")
+		text = strings.TrimSuffix(text, "\\")
+		part := r.Inline(text)
+		if hard && k < len(lines)-1 {
+			part += r.void("br")
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Inline renders the inline markup of one line of text.
+func (r *Renderer) Inline(text string) string {
+	s := html.EscapeString(text)
+
+	// Code spans, and the markup generated for images, links and footnote
+	// references, are set aside so emphasis markers inside them (such as the
+	// underscores of a URL) are left alone
+	var held []string
+	hold := func(markup string) string {
+		held = append(held, markup)
+		return fmt.Sprintf("\x00%d\x00", len(held)-1)
+	}
+	s = code_span.ReplaceAllStringFunc(s, func(m string) string {
+		return hold("<code>" + code_span.FindStringSubmatch(m)[1] + "</code>")
+	})
+
+	s = image_re.ReplaceAllStringFunc(s, func(m string) string {
+		g := image_re.FindStringSubmatch(m)
+		if r.Image != nil {
+			return hold(r.Image(safe_url(g[2]), g[1]))
+		}
+		return hold(r.void(fmt.Sprintf(`img src="%s" alt="%s"%s`, safe_url(g[2]), g[1], title_attr(g[3]))))
+	})
+	s = link_re.ReplaceAllStringFunc(s, func(m string) string {
+		g := link_re.FindStringSubmatch(m)
+		return hold(fmt.Sprintf(`<a href="%s"%s>%s</a>`, safe_url(g[2]), title_attr(g[3]), emphasis(g[1])))
+	})
+	if r.NoteRef != nil {
+		s = note_ref_re.ReplaceAllStringFunc(s, func(m string) string {
+			if ref := r.NoteRef(note_ref_re.FindStringSubmatch(m)[1]); ref != "" {
+				return hold(ref)
+			}
+			return m
+		})
+	}
+	s = emphasis(s)
+
+	// Later markup may hold earlier placeholders (a code span in a link)
+	for k := len(held) - 1; k >= 0; k-- {
+		s = strings.Replace(s, fmt.Sprintf("\x00%d\x00", k), held[k], 1)
+	}
+	return s
+}
+
+// void returns a void element, self-closed in XHTML mode.
+func (r *Renderer) void(element string) string {
+	if r.XHTML {
+		return "<" + element + "/>"
+	}
+	return "<" + element + ">"
+}
+
+// safe_url drops javascript: and data: URLs (other than images).
+func safe_url(url string) string {
+	lower := strings.ToLower(html.UnescapeString(url))
+	if strings.HasPrefix(lower, "javascript:") || strings.HasPrefix(lower, "vbscript:") ||
+		(strings.HasPrefix(lower, "data:") && !strings.HasPrefix(lower, "data:image/")) {
+		return "#"
+	}
+	return url
+}
+
+func title_attr(title string) string {
+	if title == "" {
+		return ""
+	}
+	return fmt.Sprintf(` title="%s"`, title)
+}
@@ -0,0 +1,58 @@
+package markdown
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestInline(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"*em* and **strong** and ~~gone~~", "<em>em</em> and <strong>strong</strong> and <del>gone</del>"},
+		{"***both***", "<strong><em>both</em></strong>"},
+		{"[docs](https://example.com/_private_/x)", `<a href="https://example.com/_private_/x">docs</a>`},
+		{"see [**bold** link](https://a.example/x_y_z) _here_", `see <a href="https://a.example/x_y_z"><strong>bold</strong> link</a> <em>here</em>`},
+		{"![a_b_c](https://a.example/img_1_.png)", `<img src="https://a.example/img_1_.png" alt="a_b_c">`},
+		{"*a **b* c**", "<em>a **b</em> c**"},
+		{"snake_case_name", "snake_case_name"},
+		{"`a_b_` and _c_", "<code>a_b_</code> and <em>c</em>"},
+		{"[`x_y`](https://a.example/_x_)", `<a href="https://a.example/_x_"><code>x_y</code></a>`},
+		{"2 * 3 * 4", "2 * 3 * 4"},
+	}
+	r := &Renderer{}
+	for _, tt := range tests {
+		if got := r.Inline(tt.in); got != tt.want {
+			t.Errorf("Inline(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestInlineWellFormed(t *testing.T) {
+	inputs := []string{
+		"*a **b* c**",
+		"**a *b** c*",
+		"~~a *b~~ c*",
+		"_a __b_ c__ [x_](https://a.example/_y) d_",
+		"***a** b*",
+		"*a [b*](https://a.example/) c*",
+	}
+	r := &Renderer{XHTML: true}
+	for _, in := range inputs {
+		out := r.Inline(in)
+		dec := xml.NewDecoder(strings.NewReader("<p>" + out + "</p>"))
+		for {
+			_, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("Inline(%q) = %q is not well-formed: %v", in, out, err)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package markdown
+
+import (
+	"strings"
+
+	"github.com/joinnextblock/ketab-protocol/go-core/footnotes"
+)
+
+// SplitScenes splits text at `---` (or `***`, `___`) rules outside code
+// fences. A piece that is only a sources section stays with the piece before
+// it, joined by the `---` line footnotes.Parse looks for.
+func SplitScenes(text string) []string {
+	var pieces []string
+	var current []string
+	fence := ""
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			switch fence {
+			case "":
+				fence = trimmed[:3]
+			case trimmed[:3]:
+				fence = ""
+			}
+		}
+		if fence == "" && is_rule(trimmed) {
+			pieces = append(pieces, strings.Join(current, "\n"))
+			current = nil
+			continue
+		}
+		current = append(current, line)
+	}
+	pieces = append(pieces, strings.Join(current, "\n"))
+
+	var out []string
+	for _, piece := range pieces {
+		if len(out) > 0 && footnotes.IsSourcesSection(piece) {
+			out[len(out)-1] = strings.TrimSpace(out[len(out)-1]) + "\n\n---\n\n" + strings.TrimSpace(piece)
+			continue
+		}
+		out = append(out, piece)
+	}
+	return out
+}
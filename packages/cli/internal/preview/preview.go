@@ -0,0 +1,315 @@
+// Package preview serves a book directory as a local web reader: the cover
+// and acts → chapters table of contents, then each chapter with its ketabs in
+// publishing order, footnotes and prev/next navigation. Pages reload in the
+// browser when files in the book directory change.
+package preview
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/book"
+	"github.com/joinnextblock/ketab-protocol/cli/internal/markdown"
+	"github.com/joinnextblock/ketab-protocol/go-core/footnotes"
+)
+
+// reload_path is the server-sent events endpoint pages listen on.
+const reload_path = "/__reload"
+
+// Server serves the preview of one book directory. The book is loaded again
+// on every page request, so pages always show what is on disk.
+type Server struct {
+	Dir string
+
+	// Interval is how often the book directory is checked for changes.
+	Interval time.Duration
+
+	watcher *watcher
+	mux     *http.ServeMux
+}
+
+// New returns a server previewing the book in dir.
+func New(dir string) (*Server, error) {
+	abs_dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid directory: %w", err)
+	}
+	s := &Server{Dir: abs_dir, Interval: 500 * time.Millisecond}
+	s.watcher = new_watcher(abs_dir)
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("/", s.serve_index)
+	s.mux.HandleFunc("/chapter/", s.serve_chapter)
+	s.mux.HandleFunc("/files/", s.serve_file)
+	s.mux.HandleFunc(reload_path, s.watcher.serve)
+	return s, nil
+}
+
+// Watch checks the book directory for changes every Interval until done is
+// closed, telling open pages to reload after each change.
+func (s *Server) Watch(done <-chan struct{}) {
+	s.watcher.run(s.Interval, done)
+}
+
+// ServeHTTP serves the reader pages.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mux.ServeHTTP(w, req)
+}
+
+// chapter_link is a chapter in reading order, for navigation.
+type chapter_link struct {
+	Number string
+	Title  string
+	Href   string
+}
+
+// reading_order lists the chapters of bk the way the book event lists them:
+// acts in order, chapters in act order. Chapters missing on disk are left
+// out, as they are when publishing.
+func reading_order(bk *book.Book) []chapter_link {
+	var links []chapter_link
+	for _, ref := range bk.Metadata.GetAllChapters() {
+		ch, ok := bk.Chapters[ref.ChapterNumber]
+		if !ok {
+			continue
+		}
+		links = append(links, chapter_link{
+			Number: ch.Metadata.ChapterNumber,
+			Title:  chapter_title(ch),
+			Href:   "/chapter/" + url.PathEscape(ref.ChapterNumber),
+		})
+	}
+	return links
+}
+
+// chapter_title is the title the chapter event carries.
+func chapter_title(ch *book.Chapter) string {
+	return fmt.Sprintf("Chapter %s: %s", ch.Metadata.ChapterNumber, ch.Metadata.ChapterTitle)
+}
+
+// index_page is the data of the table of contents.
+type index_page struct {
+	Title       string
+	Author      string
+	Cover       string
+	Summary     string
+	Description template.HTML
+	Acts        []index_act
+	Reload      string
+}
+
+type index_act struct {
+	Title    string
+	Chapters []index_chapter
+}
+
+type index_chapter struct {
+	chapter_link
+	Ketabs []index_ketab
+}
+
+type index_ketab struct {
+	Title string
+	Href  string
+}
+
+func (s *Server) serve_index(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+	bk, err := book.Load(s.Dir)
+	if err != nil {
+		s.serve_error(w, err)
+		return
+	}
+
+	md := &markdown.Renderer{}
+	page := index_page{
+		Title:       bk.Metadata.BookTitle,
+		Author:      bk.Metadata.Author,
+		Cover:       s.cover_url(bk.Metadata.Image),
+		Summary:     bk.Metadata.Summary,
+		Description: template.HTML(md.Render(bk.Metadata.Description)),
+		Reload:      reload_path,
+	}
+	for _, act := range bk.Metadata.Acts {
+		ia := index_act{Title: act.Title}
+		for _, ref := range act.Chapters {
+			ch, ok := bk.Chapters[ref.ChapterNumber]
+			if !ok {
+				continue
+			}
+			ic := index_chapter{chapter_link: chapter_link{
+				Number: ch.Metadata.ChapterNumber,
+				Title:  chapter_title(ch),
+				Href:   "/chapter/" + url.PathEscape(ref.ChapterNumber),
+			}}
+			for _, k := range ch.Ketabs {
+				ic.Ketabs = append(ic.Ketabs, index_ketab{
+					Title: k.Item.Title,
+					Href:  ic.Href + "#" + ketab_anchor(k),
+				})
+			}
+			ia.Chapters = append(ia.Chapters, ic)
+		}
+		page.Acts = append(page.Acts, ia)
+	}
+	render_page(w, http.StatusOK, index_template, page)
+}
+
+// chapter_page is the data of one chapter.
+type chapter_page struct {
+	Book   string
+	Title  string
+	Ketabs []ketab_section
+	Prev   *chapter_link
+	Next   *chapter_link
+	Reload string
+}
+
+type ketab_section struct {
+	Anchor    string
+	Title     string
+	Body      template.HTML
+	Footnotes []footnote_item
+}
+
+type footnote_item struct {
+	Anchor string
+	Label  string
+	Text   template.HTML
+}
+
+func (s *Server) serve_chapter(w http.ResponseWriter, req *http.Request) {
+	num := strings.TrimPrefix(req.URL.Path, "/chapter/")
+	bk, err := book.Load(s.Dir)
+	if err != nil {
+		s.serve_error(w, err)
+		return
+	}
+	ch, ok := bk.GetChapter(num)
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	page := chapter_page{
+		Book:   bk.Metadata.BookTitle,
+		Title:  chapter_title(ch),
+		Reload: reload_path,
+	}
+	order := reading_order(bk)
+	for i, link := range order {
+		if link.Href != "/chapter/"+url.PathEscape(num) {
+			continue
+		}
+		if i > 0 {
+			page.Prev = &order[i-1]
+		}
+		if i < len(order)-1 {
+			page.Next = &order[i+1]
+		}
+	}
+	for _, k := range ch.Ketabs {
+		page.Ketabs = append(page.Ketabs, render_ketab(k))
+	}
+	render_page(w, http.StatusOK, chapter_template, page)
+}
+
+// render_ketab renders a ketab body with its sources section as footnotes.
+// Anchors are prefixed with the ketab's d-tag, since every ketab numbers its
+// footnotes from 1.
+func render_ketab(k book.Ketab) ketab_section {
+	anchor := ketab_anchor(k)
+	body := footnotes.Parse(k.Body)
+	text, notes := body.Prose, body.Sources
+	labels := make(map[string]bool)
+	for _, note := range notes {
+		labels[note.Label] = true
+	}
+	note_anchor := func(label string) string {
+		return anchor + "-fn-" + label
+	}
+	md := &markdown.Renderer{NoteRef: func(label string) string {
+		if !labels[label] {
+			return ""
+		}
+		return fmt.Sprintf(`<sup class="note-ref"><a href="#%s">%s</a></sup>`, note_anchor(label), label)
+	}}
+
+	section := ketab_section{
+		Anchor: anchor,
+		Title:  k.Item.Title,
+		Body:   template.HTML(md.Render(text)),
+	}
+	for _, note := range notes {
+		section.Footnotes = append(section.Footnotes, footnote_item{
+			Anchor: note_anchor(note.Label),
+			Label:  note.Label,
+			Text:   template.HTML(md.Inline(note.Text)),
+		})
+	}
+	return section
+}
+
+func ketab_anchor(k book.Ketab) string {
+	if k.Item.UUID != "" {
+		return "k-" + k.Item.UUID
+	}
+	return fmt.Sprintf("k-%d", k.Item.Number)
+}
+
+// cover_url returns the URL of the cover image: remote URLs as they are,
+// paths under /files/ relative to the book directory.
+func (s *Server) cover_url(image string) string {
+	if image == "" {
+		return ""
+	}
+	if u, err := url.Parse(image); err == nil && u.Scheme != "" {
+		return image
+	}
+	return "/files/" + strings.TrimPrefix(filepath.ToSlash(image), "/")
+}
+
+// serve_file serves files of the book directory, such as a local cover
+// image. Hidden files (like the .ketab ledger) are not served.
+func (s *Server) serve_file(w http.ResponseWriter, req *http.Request) {
+	rel := strings.TrimPrefix(req.URL.Path, "/files/")
+	for _, part := range strings.Split(rel, "/") {
+		if part == "" || strings.HasPrefix(part, ".") {
+			http.NotFound(w, req)
+			return
+		}
+	}
+	path := filepath.Join(s.Dir, filepath.FromSlash(rel))
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		http.NotFound(w, req)
+		return
+	}
+	http.ServeFile(w, req, path)
+}
+
+// serve_error shows why the book could not be loaded. The page keeps
+// listening for changes, so fixing the file brings the book back.
+func (s *Server) serve_error(w http.ResponseWriter, err error) {
+	render_page(w, http.StatusInternalServerError, error_template, struct {
+		Error  string
+		Dir    string
+		Reload string
+	}{err.Error(), s.Dir, reload_path})
+}
+
+func render_page(w http.ResponseWriter, status int, tmpl *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		fmt.Fprintf(w, "<pre>template error: %s</pre>", template.HTMLEscapeString(err.Error()))
+	}
+}
@@ -0,0 +1,115 @@
+package preview
+
+import "html/template"
+
+const style = `
+body { margin: 0; background: #fbfaf7; color: #222; font: 18px/1.65 Georgia, "Times New Roman", serif; }
+main { max-width: 42rem; margin: 0 auto; padding: 2rem 1.25rem 4rem; }
+a { color: #7a3e12; }
+header.book { text-align: center; margin-bottom: 2.5rem; }
+header.book img { max-width: 16rem; max-height: 24rem; box-shadow: 0 4px 18px rgba(0,0,0,.2); }
+.author { font-style: italic; color: #555; }
+.summary { color: #444; }
+.act h2 { border-bottom: 1px solid #ddd; padding-bottom: .25rem; }
+.toc { list-style: none; padding-left: 0; }
+.toc ol { list-style: none; padding-left: 1.25rem; font-size: .9em; }
+.crumb { font-size: .85em; color: #777; }
+.ketab-title { font-size: .8em; letter-spacing: .08em; text-transform: uppercase; color: #888; margin-top: 2.5rem; }
+hr.ketab-break { border: 0; text-align: center; margin: 2.5rem 0; }
+hr.ketab-break::after { content: "* * *"; color: #999; }
+blockquote { margin-left: 0; padding-left: 1rem; border-left: 3px solid #ddd; color: #555; }
+pre { background: #f1eee8; padding: .75rem; overflow-x: auto; font-size: .85em; }
+img { max-width: 100%; }
+sup.note-ref { line-height: 0; font-size: .7em; }
+.footnotes { font-size: .85em; color: #555; border-top: 1px solid #e4e0d8; margin-top: 1.5rem; padding-top: .5rem; }
+.footnotes li:target { background: #fff2c6; }
+nav.chapters { display: flex; justify-content: space-between; gap: 1rem; margin-top: 3rem; padding-top: 1rem; border-top: 1px solid #ddd; font-size: .9em; }
+.error { background: #fde8e8; border: 1px solid #f5b5b5; padding: 1rem; white-space: pre-wrap; }
+`
+
+const reload_script = `
+<script>
+new EventSource({{.Reload}}).addEventListener("reload", function () { location.reload(); });
+</script>`
+
+var index_template = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>` + style + `</style>
+</head>
+<body>
+<main>
+<header class="book">
+{{if .Cover}}<img src="{{.Cover}}" alt="Cover of {{.Title}}">{{end}}
+<h1>{{.Title}}</h1>
+{{if .Author}}<p class="author">{{.Author}}</p>{{end}}
+{{if .Summary}}<p class="summary">{{.Summary}}</p>{{end}}
+</header>
+{{.Description}}
+{{range .Acts}}
+<section class="act">
+{{if .Title}}<h2>{{.Title}}</h2>{{end}}
+<ul class="toc">
+{{range .Chapters}}<li><a href="{{.Href}}">{{.Title}}</a>
+{{if .Ketabs}}<ol>{{range .Ketabs}}<li><a href="{{.Href}}">{{.Title}}</a></li>{{end}}</ol>{{end}}
+</li>
+{{end}}
+</ul>
+</section>
+{{end}}
+</main>` + reload_script + `
+</body>
+</html>
+`))
+
+var chapter_template = template.Must(template.New("chapter").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}} · {{.Book}}</title>
+<style>` + style + `</style>
+</head>
+<body>
+<main>
+<p class="crumb"><a href="/">{{.Book}}</a></p>
+<h1>{{.Title}}</h1>
+{{range $i, $k := .Ketabs}}
+{{if $i}}<hr class="ketab-break">{{end}}
+<section class="ketab" id="{{$k.Anchor}}">
+{{if $k.Title}}<p class="ketab-title">{{$k.Title}}</p>{{end}}
+{{$k.Body}}
+{{if $k.Footnotes}}<ol class="footnotes">
+{{range $k.Footnotes}}<li id="{{.Anchor}}" value="{{.Label}}">{{.Text}}</li>
+{{end}}</ol>{{end}}
+</section>
+{{end}}
+<nav class="chapters">
+<span>{{with .Prev}}<a href="{{.Href}}" rel="prev">← {{.Title}}</a>{{end}}</span>
+<span>{{with .Next}}<a href="{{.Href}}" rel="next">{{.Title}} →</a>{{end}}</span>
+</nav>
+</main>` + reload_script + `
+</body>
+</html>
+`))
+
+var error_template = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Preview error</title>
+<style>` + style + `</style>
+</head>
+<body>
+<main>
+<h1>Could not load the book</h1>
+<p>{{.Dir}}</p>
+<div class="error">{{.Error}}</div>
+<p>The page reloads when the book directory changes.</p>
+</main>` + reload_script + `
+</body>
+</html>
+`))
@@ -0,0 +1,112 @@
+package preview
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// watcher polls a book directory and notifies the pages listening on the
+// reload endpoint when anything in it changes. Hidden files and directories
+// (like the .ketab ledger) are ignored.
+type watcher struct {
+	dir string
+
+	mu        sync.Mutex
+	listeners map[chan struct{}]bool
+}
+
+func new_watcher(dir string) *watcher {
+	return &watcher{dir: dir, listeners: make(map[chan struct{}]bool)}
+}
+
+// run polls every interval until done is closed.
+func (w *watcher) run(interval time.Duration, done <-chan struct{}) {
+	last := w.fingerprint()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if current := w.fingerprint(); current != last {
+				last = current
+				w.notify()
+			}
+		}
+	}
+}
+
+// fingerprint hashes the path, size and modification time of every file in
+// the directory.
+func (w *watcher) fingerprint() uint64 {
+	h := fnv.New64a()
+	filepath.WalkDir(w.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != w.dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return h.Sum64()
+}
+
+func (w *watcher) notify() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.listeners {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// serve streams a "reload" server-sent event after each change.
+func (w *watcher) serve(rw http.ResponseWriter, req *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-store")
+	fmt.Fprint(rw, ": connected\n\n")
+	flusher.Flush()
+
+	ch := make(chan struct{}, 1)
+	w.mu.Lock()
+	w.listeners[ch] = true
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.listeners, ch)
+		w.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ch:
+			fmt.Fprint(rw, "event: reload\ndata: changed\n\n")
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,455 @@
+// Package publisher publishes events to relays over one pooled connection per
+// relay, with bounded parallelism and a structured result per event per relay.
+// Transient failures are retried with exponential backoff, and each relay is
+// rate limited by its own token bucket. Relays that answer auth-required are
+// authenticated with NIP-42 when Options.Auth is set.
+package publisher
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Default option values.
+const (
+	DefaultConcurrency = 8
+	DefaultTimeout     = 10 * time.Second
+	DefaultRateLimit   = 5.0 // Events per second per relay
+	DefaultBurst       = 10
+)
+
+// Options configures a Publisher.
+type Options struct {
+	// Concurrency is the maximum number of events in flight at once.
+	Concurrency int
+
+	// Timeout bounds connecting to a relay and waiting for its OK for one attempt.
+	Timeout time.Duration
+
+	// Retry is the retry policy; the zero value means DefaultRetryPolicy.
+	Retry RetryPolicy
+
+	// RateLimit and Burst size each relay's token bucket.
+	RateLimit float64
+	Burst     int
+
+	// Auth signs NIP-42 AUTH events (kind 22242), normally with the key the
+	// published events are signed with. When nil, auth-required rejections are
+	// returned as they are.
+	Auth func(event *nostr.Event) error
+}
+
+// Status is the outcome of publishing one event to one relay.
+type Status string
+
+const (
+	// StatusAccepted means the relay answered OK true.
+	StatusAccepted Status = "accepted"
+
+	// StatusRejected means the relay answered OK false (see Message).
+	StatusRejected Status = "rejected"
+
+	// StatusFailed means no OK was received (connection error, timeout, ...).
+	StatusFailed Status = "failed"
+)
+
+// RelayResult is the outcome of publishing one event to one relay.
+type RelayResult struct {
+	URL      string
+	Status   Status
+	Message  string   // OK message (rejected) or error text (failed)
+	Reason   string   // NIP-01 prefix of a rejection ("rate-limited", "invalid", ...)
+	Notices  []string // NOTICEs the relay sent while the event was in flight
+	Err      error
+	Attempts int
+	Duration time.Duration
+
+	// Authenticated is set when the relay asked for NIP-42 AUTH and got it.
+	Authenticated bool
+}
+
+// Result is the outcome of publishing one event to a set of relays.
+type Result struct {
+	Event  *nostr.Event
+	Relays []*RelayResult // In the order the relays were given
+}
+
+// Job is an event to publish and the relays to publish it to.
+type Job struct {
+	Event  *nostr.Event
+	Relays []string // nil means every relay the Publisher was created with
+}
+
+// Publisher holds one connection per relay for the session.
+type Publisher struct {
+	relays []string
+	opts   Options
+
+	mu    sync.Mutex
+	conns map[string]*conn
+
+	result_mu sync.Mutex
+}
+
+// conn is a lazily dialed, reused relay connection.
+type conn struct {
+	url string
+
+	mu            sync.Mutex
+	relay         *nostr.Relay
+	authed        *nostr.Relay // The connection that completed AUTH, if any
+	dial_failures int          // Consecutive failed dials
+	dial_err      error        // Error of the last failed dial
+	redial_at     time.Time    // No redial before this time after a failed dial
+	dead          error        // Set once dial_failures reaches the retry limit
+
+	bucket *bucket
+
+	notice_mu sync.Mutex
+	notices   []notice
+}
+
+type notice struct {
+	at   time.Time
+	text string
+}
+
+// New creates a Publisher for relays. Connections are opened on first use.
+func New(relays []string, opts Options) *Publisher {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Retry.MaxAttempts <= 0 {
+		opts.Retry = DefaultRetryPolicy
+	}
+	if opts.RateLimit <= 0 {
+		opts.RateLimit = DefaultRateLimit
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = DefaultBurst
+	}
+	return &Publisher{
+		relays: relays,
+		opts:   opts,
+		conns:  make(map[string]*conn),
+	}
+}
+
+// Relays returns the relays the Publisher was created with.
+func (p *Publisher) Relays() []string {
+	return p.relays
+}
+
+// Publish publishes one signed event to relays (nil means all) concurrently.
+func (p *Publisher) Publish(ctx context.Context, event *nostr.Event, relays []string) *Result {
+	results := p.PublishBatch(ctx, []Job{{Event: event, Relays: relays}}, nil)
+	return results[0]
+}
+
+// PublishBatch publishes signed events with at most Options.Concurrency events
+// in flight. Each event goes to all of its relays concurrently. Results are
+// returned in job order.
+//
+// on_result, if not nil, is called once per event as soon as every relay has
+// answered. Calls are serialized, so it may print or update shared state.
+func (p *Publisher) PublishBatch(ctx context.Context, jobs []Job, on_result func(*Result)) []*Result {
+	results := make([]*Result, len(jobs))
+	sem := make(chan struct{}, p.opts.Concurrency)
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, job Job) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = p.publish_one(ctx, job)
+			if on_result != nil {
+				p.result_mu.Lock()
+				on_result(results[i])
+				p.result_mu.Unlock()
+			}
+		}(i, job)
+	}
+	wg.Wait()
+	return results
+}
+
+// Close closes every open connection.
+func (p *Publisher) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.conns {
+		c.mu.Lock()
+		if c.relay != nil {
+			c.relay.Close()
+			c.relay = nil
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (p *Publisher) publish_one(ctx context.Context, job Job) *Result {
+	relays := job.Relays
+	if relays == nil {
+		relays = p.relays
+	}
+	result := &Result{Event: job.Event, Relays: make([]*RelayResult, len(relays))}
+	var wg sync.WaitGroup
+	for i, url := range relays {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			result.Relays[i] = p.publish_to(ctx, job.Event, url)
+		}(i, url)
+	}
+	wg.Wait()
+	return result
+}
+
+// publish_to sends an event to one relay, retrying transient failures with
+// backoff until the retry policy is exhausted or ctx is done.
+func (p *Publisher) publish_to(ctx context.Context, event *nostr.Event, url string) *RelayResult {
+	start := time.Now()
+	c := p.get_conn(url)
+	var rr *RelayResult
+	auth_tried := false
+	for attempt := 1; ; attempt++ {
+		rr = p.attempt(ctx, c, event)
+		rr.Attempts = attempt
+		if rr.Reason == ReasonAuthRequired && p.opts.Auth != nil && !auth_tried {
+			// Authenticate and resend right away; this does not count as a retry.
+			auth_tried = true
+			if err := c.authenticate(ctx, p.opts.Timeout, p.opts.Auth); err != nil {
+				rr.Message += " (AUTH failed: " + err.Error() + ")"
+				rr.Err = errors.New(rr.Message)
+				break
+			}
+			attempt--
+			continue
+		}
+		if !retryable(rr) || c.down() || attempt >= p.opts.Retry.MaxAttempts || ctx.Err() != nil {
+			break
+		}
+		delay := p.opts.Retry.Backoff(attempt + 1)
+		if rr.Reason == ReasonRateLimited {
+			c.bucket.throttle(delay)
+		}
+		if !sleep(ctx, delay) {
+			break
+		}
+	}
+	rr.URL = url
+	rr.Duration = time.Since(start)
+	rr.Authenticated = auth_tried && rr.Status == StatusAccepted
+	return rr
+}
+
+// attempt makes one try at sending an event over a relay's connection.
+func (p *Publisher) attempt(ctx context.Context, c *conn, event *nostr.Event) *RelayResult {
+	start := time.Now()
+	rr := &RelayResult{}
+
+	err := c.bucket.wait(ctx)
+	if err == nil {
+		attempt_ctx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+		defer cancel()
+		var relay *nostr.Relay
+		relay, err = c.connect(attempt_ctx, p.opts.Retry)
+		if err == nil {
+			err = relay.Publish(attempt_ctx, *event)
+		}
+	}
+	rr.Notices = c.notices_since(start)
+	rr.Err = err
+
+	switch {
+	case err == nil:
+		rr.Status = StatusAccepted
+	case strings.HasPrefix(err.Error(), "msg: "):
+		// go-nostr reports OK false as "msg: <reason>"
+		rr.Message = strings.TrimPrefix(err.Error(), "msg: ")
+		rr.Reason = Reason(rr.Message)
+		rr.Err = errors.New(rr.Message)
+		rr.Status = StatusRejected
+		if rr.Reason == ReasonDuplicate {
+			// The relay already has the event
+			rr.Status = StatusAccepted
+			rr.Err = nil
+		}
+	default:
+		rr.Status = StatusFailed
+		rr.Message = err.Error()
+	}
+	return rr
+}
+
+// sleep waits for d or until ctx is done, reporting whether d elapsed.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func (p *Publisher) get_conn(url string) *conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.conns[url]
+	if !ok {
+		c = &conn{url: url, bucket: new_bucket(p.opts.RateLimit, p.opts.Burst)}
+		p.conns[url] = c
+	}
+	return c
+}
+
+// connect returns the open connection, dialing it if needed. A connection that
+// dropped is redialed. Failed dials back off like publish attempts: until the
+// next redial is due, callers get the last dial error without a new dial, and
+// after retry.MaxAttempts consecutive failures the relay is considered down for
+// the session, so it is not redialed for every event.
+func (c *conn) connect(ctx context.Context, retry RetryPolicy) (*nostr.Relay, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.relay != nil && c.relay.IsConnected() {
+		return c.relay, nil
+	}
+	if c.dead != nil {
+		return nil, c.dead
+	}
+	if time.Now().Before(c.redial_at) {
+		return nil, c.dial_err
+	}
+	// Dial with a background context: the connection outlives this event.
+	relay := nostr.NewRelay(context.Background(), c.url, nostr.WithNoticeHandler(c.on_notice))
+	if err := relay.Connect(ctx); err != nil {
+		c.relay = nil
+		c.dial_err = err
+		c.dial_failures++
+		if c.dial_failures >= retry.MaxAttempts {
+			c.dead = err
+		}
+		c.redial_at = time.Now().Add(retry.Backoff(c.dial_failures + 1))
+		return nil, err
+	}
+	c.relay = relay
+	c.dial_failures = 0
+	return relay, nil
+}
+
+// authenticate answers the relay's NIP-42 challenge on the current connection.
+// Concurrent events that hit auth-required together share one AUTH.
+func (c *conn) authenticate(ctx context.Context, timeout time.Duration, sign func(*nostr.Event) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.relay == nil {
+		return errors.New("not connected")
+	}
+	if c.authed == c.relay {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := c.relay.Auth(ctx, sign); err != nil {
+		return strip_msg(err)
+	}
+	c.authed = c.relay
+	return nil
+}
+
+// strip_msg removes go-nostr's "msg: " prefix from an OK false error.
+func strip_msg(err error) error {
+	if msg, ok := strings.CutPrefix(err.Error(), "msg: "); ok {
+		return errors.New(msg)
+	}
+	return err
+}
+
+// down reports whether the relay has been given up on for the session.
+func (c *conn) down() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dead != nil
+}
+
+func (c *conn) on_notice(text string) {
+	c.notice_mu.Lock()
+	defer c.notice_mu.Unlock()
+	c.notices = append(c.notices, notice{at: time.Now(), text: text})
+}
+
+func (c *conn) notices_since(start time.Time) []string {
+	c.notice_mu.Lock()
+	defer c.notice_mu.Unlock()
+	var out []string
+	for _, n := range c.notices {
+		if !n.at.Before(start) {
+			out = append(out, n.text)
+		}
+	}
+	return out
+}
+
+// Accepted returns the relays that accepted the event.
+func (r *Result) Accepted() []string {
+	var urls []string
+	for _, rr := range r.Relays {
+		if rr.Status == StatusAccepted {
+			urls = append(urls, rr.URL)
+		}
+	}
+	return urls
+}
+
+// Confirmed reports whether at least one relay accepted the event.
+func (r *Result) Confirmed() bool {
+	return len(r.Accepted()) > 0
+}
+
+// Errors maps every relay to its publish error (nil when accepted).
+func (r *Result) Errors() map[string]error {
+	errs := make(map[string]error, len(r.Relays))
+	for _, rr := range r.Relays {
+		errs[rr.URL] = rr.Err
+	}
+	return errs
+}
+
+// Summary counts results by how many relays accepted them.
+type Summary struct {
+	Events    int // Events published
+	Confirmed int // Accepted by every relay
+	Partial   int // Accepted by some, but not all, relays
+	Failed    int // Accepted by no relay
+}
+
+// Summarize counts results.
+func Summarize(results []*Result) Summary {
+	var s Summary
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		s.Events++
+		switch accepted := len(r.Accepted()); {
+		case accepted == 0:
+			s.Failed++
+		case accepted == len(r.Relays):
+			s.Confirmed++
+		default:
+			s.Partial++
+		}
+	}
+	return s
+}
@@ -0,0 +1,80 @@
+package publisher
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/relay"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// auth_relay starts an in-memory relay that requires NIP-42 AUTH and returns
+// its websocket URL.
+func auth_relay(t *testing.T) (string, *relay.Store) {
+	t.Helper()
+	store, err := relay.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rl := relay.New(store)
+	rl.RequireAuth = true
+	server := httptest.NewServer(rl)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http"), store
+}
+
+func signed_note(t *testing.T, sk, content string) *nostr.Event {
+	t.Helper()
+	event := &nostr.Event{Kind: 1, CreatedAt: nostr.Now(), Content: content, Tags: nostr.Tags{}}
+	if err := event.Sign(sk); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestPublishAuthenticates(t *testing.T) {
+	url, store := auth_relay(t)
+	sk := nostr.GeneratePrivateKey()
+	pub := New([]string{url}, Options{
+		Timeout: 5 * time.Second,
+		Auth:    func(event *nostr.Event) error { return event.Sign(sk) },
+	})
+	defer pub.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rr := pub.Publish(ctx, signed_note(t, sk, "hello"), nil).Relays[0]
+	if rr.Status != StatusAccepted {
+		t.Fatalf("status = %s (%s), want accepted", rr.Status, rr.Message)
+	}
+	if !rr.Authenticated {
+		t.Error("Authenticated = false, want true")
+	}
+	if store.Len() != 1 {
+		t.Errorf("relay stored %d events, want 1", store.Len())
+	}
+
+	// The connection stays authenticated for the next event
+	if rr := pub.Publish(ctx, signed_note(t, sk, "again"), nil).Relays[0]; rr.Status != StatusAccepted || rr.Authenticated {
+		t.Errorf("second event: status = %s, authenticated = %v; want accepted without a new AUTH", rr.Status, rr.Authenticated)
+	}
+}
+
+func TestPublishWithoutAuth(t *testing.T) {
+	url, store := auth_relay(t)
+	pub := New([]string{url}, Options{Timeout: 5 * time.Second, Retry: RetryPolicy{MaxAttempts: 1}})
+	defer pub.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rr := pub.Publish(ctx, signed_note(t, nostr.GeneratePrivateKey(), "hello"), nil).Relays[0]
+	if rr.Status != StatusRejected || rr.Reason != ReasonAuthRequired {
+		t.Errorf("status = %s, reason = %q; want rejected with %s", rr.Status, rr.Reason, ReasonAuthRequired)
+	}
+	if store.Len() != 0 {
+		t.Errorf("relay stored %d events, want 0", store.Len())
+	}
+}
@@ -0,0 +1,166 @@
+package publisher
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NIP-01 machine-readable prefixes of OK false (and CLOSED) messages.
+const (
+	ReasonDuplicate    = "duplicate"
+	ReasonPow          = "pow"
+	ReasonBlocked      = "blocked"
+	ReasonRateLimited  = "rate-limited"
+	ReasonInvalid      = "invalid"
+	ReasonRestricted   = "restricted"
+	ReasonMute         = "mute"
+	ReasonError        = "error"
+	ReasonAuthRequired = "auth-required"
+)
+
+// Reason returns the NIP-01 prefix of an OK message ("rate-limited: slow down"
+// gives "rate-limited"), or "" when the message has none.
+func Reason(message string) string {
+	prefix, _, ok := strings.Cut(message, ":")
+	if !ok {
+		return ""
+	}
+	prefix = strings.TrimSpace(prefix)
+	switch prefix {
+	case ReasonDuplicate, ReasonPow, ReasonBlocked, ReasonRateLimited, ReasonInvalid,
+		ReasonRestricted, ReasonMute, ReasonError, ReasonAuthRequired:
+		return prefix
+	}
+	return ""
+}
+
+// RetryPolicy controls how often and how long a failed publish is retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of tries per event per relay (1 disables retries).
+	MaxAttempts int
+
+	// BaseDelay is the backoff before the second attempt; it doubles on every
+	// further attempt, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy retries four times, backing off for up to fifteen seconds in total.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// Backoff returns the delay before attempt (1-based; attempt 1 has none):
+// exponential in the attempt number, with "equal jitter" — a random delay
+// between half and all of the exponential value — so that many events
+// retrying against one relay do not come back in lockstep.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt <= 1 {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := 2; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryable reports whether a relay result is worth another attempt in this
+// session: connection failures, rate limiting and relay-side errors are;
+// policy rejections (invalid, blocked, pow, ...) are not.
+func retryable(rr *RelayResult) bool {
+	switch rr.Status {
+	case StatusFailed:
+		return true
+	case StatusRejected:
+		return rr.Reason == ReasonRateLimited || rr.Reason == ReasonError
+	}
+	return false
+}
+
+// Resumable reports whether the event may still be accepted by this relay if it
+// is sent again later (by `ketab publish --resume`): everything retryable, plus
+// auth-required rejections.
+func (rr *RelayResult) Resumable() bool {
+	return retryable(rr) || (rr.Status == StatusRejected && rr.Reason == ReasonAuthRequired)
+}
+
+// bucket is a per-relay token bucket: events are sent at most rate per second,
+// with bursts of up to burst events. A rate-limited answer pauses the bucket
+// and halves its rate for the rest of the session.
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	paused time.Time // No tokens are handed out before this time
+}
+
+// min_rate is the floor a relay's rate is halved down to.
+const min_rate = 0.2
+
+func new_bucket(rate float64, burst int) *bucket {
+	return &bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait blocks until a token is available or ctx is done.
+func (b *bucket) wait(ctx context.Context) error {
+	for {
+		d := b.reserve()
+		if d == 0 {
+			return nil
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// reserve takes a token and returns 0, or returns how long to wait for one.
+func (b *bucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if now.Before(b.paused) {
+		return b.paused.Sub(now)
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// throttle pauses the bucket for d and halves its rate.
+func (b *bucket) throttle(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until := time.Now().Add(d); until.After(b.paused) {
+		b.paused = until
+		b.last = until
+	}
+	b.rate /= 2
+	if b.rate < min_rate {
+		b.rate = min_rate
+	}
+	b.tokens = 0
+}
@@ -0,0 +1,270 @@
+package relay
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip42"
+)
+
+// broadcast_timeout bounds sending a new event to the subscribed clients.
+const broadcast_timeout = 5 * time.Second
+
+// max_message caps the size of a client message (chapters can be large).
+const max_message = 8 << 20
+
+// Relay serves a Store over the Nostr websocket protocol. It accepts EVENT,
+// REQ and CLOSE messages; subscriptions stay open after EOSE and receive the
+// matching events published later.
+type Relay struct {
+	// Name and Description are returned in the NIP-11 information document.
+	Name        string
+	Description string
+
+	// RequireAuth makes the relay send each connection a NIP-42 challenge and
+	// reject its EVENT messages with auth-required until it answers with a
+	// valid AUTH event. Reading stays open.
+	RequireAuth bool
+
+	// OnEvent, if set, is called for every event the relay accepts.
+	OnEvent func(event *nostr.Event)
+
+	store *Store
+
+	mu      sync.Mutex
+	clients map[*client]bool
+}
+
+// New returns a relay serving store.
+func New(store *Store) *Relay {
+	return &Relay{
+		Name:        "ketab dev relay",
+		Description: "Local relay for Ketab Protocol development",
+		store:       store,
+		clients:     make(map[*client]bool),
+	}
+}
+
+// client is one websocket connection and its subscriptions.
+type client struct {
+	conn *websocket.Conn
+	url  string // the relay URL AUTH events must name
+
+	mu   sync.Mutex // serializes writes and guards subs and pubkey
+	subs map[string]nostr.Filters
+
+	challenge string
+	pubkey    string // set once the client has authenticated
+}
+
+// ServeHTTP upgrades websocket requests and answers NIP-11 requests
+// (Accept: application/nostr+json) with the relay information document.
+func (r *Relay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		if strings.Contains(req.Header.Get("Accept"), "application/nostr+json") {
+			w.Header().Set("Content-Type", "application/nostr+json")
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			nips := []int{1, 9, 11}
+			if r.RequireAuth {
+				nips = append(nips, 42)
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"name":           r.Name,
+				"description":    r.Description,
+				"supported_nips": nips,
+				"software":       "ketab",
+			})
+			return
+		}
+		fmt.Fprintf(w, "%s: connect with a Nostr client (ws://%s)\n", r.Name, req.Host)
+		return
+	}
+
+	conn, err := websocket.Accept(w, req, &websocket.AcceptOptions{InsecureSkipVerify: true})
+	if err != nil {
+		return
+	}
+	conn.SetReadLimit(max_message)
+	c := &client{conn: conn, url: relay_url(req), subs: make(map[string]nostr.Filters)}
+	r.mu.Lock()
+	r.clients[c] = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.clients, c)
+		r.mu.Unlock()
+		conn.CloseNow()
+	}()
+
+	ctx := req.Context()
+	if r.RequireAuth {
+		c.challenge = new_challenge()
+		c.send(ctx, nostr.AuthEnvelope{Challenge: &c.challenge})
+	}
+	for {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		r.handle(ctx, c, string(data))
+	}
+}
+
+// handle answers one client message.
+func (r *Relay) handle(ctx context.Context, c *client, message string) {
+	switch env := nostr.ParseMessage(message).(type) {
+	case *nostr.EventEnvelope:
+		event := &env.Event
+		if !event.CheckID() {
+			c.send(ctx, nostr.OKEnvelope{EventID: event.ID, OK: false, Reason: "invalid: event id does not match its content"})
+			return
+		}
+		if ok, err := event.CheckSignature(); !ok || err != nil {
+			c.send(ctx, nostr.OKEnvelope{EventID: event.ID, OK: false, Reason: "invalid: bad signature"})
+			return
+		}
+		if r.RequireAuth && c.authed() == "" {
+			c.send(ctx, nostr.OKEnvelope{EventID: event.ID, OK: false, Reason: "auth-required: authenticate to publish"})
+			return
+		}
+		stored, err := r.store.Save(event)
+		switch {
+		case errors.Is(err, ErrDuplicate) || errors.Is(err, ErrOutdated):
+			c.send(ctx, nostr.OKEnvelope{EventID: event.ID, OK: true, Reason: err.Error()})
+			return
+		case err != nil && !stored:
+			c.send(ctx, nostr.OKEnvelope{EventID: event.ID, OK: false, Reason: err.Error()})
+			return
+		case err != nil:
+			c.send(ctx, nostr.OKEnvelope{EventID: event.ID, OK: false, Reason: "error: " + err.Error()})
+			return
+		}
+		c.send(ctx, nostr.OKEnvelope{EventID: event.ID, OK: true})
+		if r.OnEvent != nil {
+			r.OnEvent(event)
+		}
+		r.broadcast(event)
+
+	case *nostr.ReqEnvelope:
+		c.mu.Lock()
+		c.subs[env.SubscriptionID] = env.Filters
+		c.mu.Unlock()
+		seen := make(map[string]bool)
+		for _, filter := range env.Filters {
+			for _, event := range r.store.Query(filter) {
+				if seen[event.ID] {
+					continue
+				}
+				seen[event.ID] = true
+				id := env.SubscriptionID
+				c.send(ctx, nostr.EventEnvelope{SubscriptionID: &id, Event: *event})
+			}
+		}
+		eose := nostr.EOSEEnvelope(env.SubscriptionID)
+		c.send(ctx, &eose)
+
+	case *nostr.AuthEnvelope:
+		if !r.RequireAuth {
+			c.send(ctx, nostr.OKEnvelope{EventID: env.Event.ID, OK: false, Reason: "error: this relay does not ask for AUTH"})
+			return
+		}
+		if !env.Event.CheckID() {
+			c.send(ctx, nostr.OKEnvelope{EventID: env.Event.ID, OK: false, Reason: "invalid: event id does not match its content"})
+			return
+		}
+		pubkey, ok := nip42.ValidateAuthEvent(&env.Event, c.challenge, c.url)
+		if !ok {
+			c.send(ctx, nostr.OKEnvelope{EventID: env.Event.ID, OK: false, Reason: "invalid: AUTH event does not answer the challenge for " + c.url})
+			return
+		}
+		c.mu.Lock()
+		c.pubkey = pubkey
+		c.mu.Unlock()
+		c.send(ctx, nostr.OKEnvelope{EventID: env.Event.ID, OK: true})
+
+	case *nostr.CloseEnvelope:
+		c.mu.Lock()
+		delete(c.subs, string(*env))
+		c.mu.Unlock()
+
+	case nil:
+		notice := nostr.NoticeEnvelope("error: could not parse message")
+		c.send(ctx, &notice)
+
+	default:
+		notice := nostr.NoticeEnvelope(fmt.Sprintf("error: %s messages are not supported", env.Label()))
+		c.send(ctx, &notice)
+	}
+}
+
+// broadcast sends event to every open subscription it matches. Clients that
+// do not take it within broadcast_timeout miss it.
+func (r *Relay) broadcast(event *nostr.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), broadcast_timeout)
+	defer cancel()
+
+	r.mu.Lock()
+	clients := make([]*client, 0, len(r.clients))
+	for c := range r.clients {
+		clients = append(clients, c)
+	}
+	r.mu.Unlock()
+
+	for _, c := range clients {
+		c.mu.Lock()
+		var ids []string
+		for id, filters := range c.subs {
+			if filters.Match(event) {
+				ids = append(ids, id)
+			}
+		}
+		c.mu.Unlock()
+		for _, id := range ids {
+			c.send(ctx, nostr.EventEnvelope{SubscriptionID: &id, Event: *event})
+		}
+	}
+}
+
+// authed returns the pubkey the client authenticated as, or "".
+func (c *client) authed() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pubkey
+}
+
+// relay_url returns the URL clients connected to, which their AUTH events
+// name in their relay tag.
+func relay_url(req *http.Request) string {
+	scheme := "ws"
+	if req.TLS != nil {
+		scheme = "wss"
+	}
+	return scheme + "://" + req.Host + req.URL.Path
+}
+
+// new_challenge returns a random NIP-42 challenge.
+func new_challenge() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (c *client) send(ctx context.Context, env json.Marshaler) {
+	data, err := env.MarshalJSON()
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.conn.Write(ctx, websocket.MessageText, data)
+}
@@ -0,0 +1,119 @@
+package relay
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// serve starts rl over httptest and returns its websocket URL.
+func serve(t *testing.T, rl *Relay) string {
+	t.Helper()
+	server := httptest.NewServer(rl)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func connect(ctx context.Context, t *testing.T, url string) *nostr.Relay {
+	t.Helper()
+	conn, err := nostr.RelayConnect(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func next(t *testing.T, sub *nostr.Subscription) *nostr.Event {
+	t.Helper()
+	select {
+	case event := <-sub.Events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+		return nil
+	}
+}
+
+func TestRelaySubscription(t *testing.T) {
+	url := serve(t, New(open_store(t)))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+
+	publisher := connect(ctx, t, url)
+	stored := sign(t, sk, 38893, 100, "stored", nostr.Tag{"d", "k1"}, nostr.Tag{"t", "ketab"})
+	if err := publisher.Publish(ctx, *stored); err != nil {
+		t.Fatal(err)
+	}
+	if err := publisher.Publish(ctx, *sign(t, sk, 1, 100, "not matched")); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := connect(ctx, t, url)
+	sub, err := reader.Subscribe(ctx, nostr.Filters{{Kinds: []int{38893}, Authors: []string{pk}, Tags: nostr.TagMap{"t": []string{"ketab"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := next(t, sub); got.ID != stored.ID {
+		t.Fatalf("stored event = %s, want %s", got.Content, stored.Content)
+	}
+	select {
+	case <-sub.EndOfStoredEvents:
+	case event := <-sub.Events:
+		t.Fatalf("got %s before EOSE, want only the stored event", event.Content)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no EOSE")
+	}
+
+	// Events published after EOSE arrive on the open subscription
+	live := sign(t, sk, 38893, 200, "live", nostr.Tag{"d", "k2"}, nostr.Tag{"t", "ketab"})
+	if err := publisher.Publish(ctx, *sign(t, sk, 1, 200, "still not matched")); err != nil {
+		t.Fatal(err)
+	}
+	if err := publisher.Publish(ctx, *live); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(t, sub); got.ID != live.ID {
+		t.Fatalf("live event = %s, want %s", got.Content, live.Content)
+	}
+}
+
+func TestRelayRejectsBadEvents(t *testing.T) {
+	url := serve(t, New(open_store(t)))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn := connect(ctx, t, url)
+
+	event := sign(t, nostr.GeneratePrivateKey(), 1, 100, "signed")
+	event.Content = "tampered"
+	if err := conn.Publish(ctx, *event); err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Errorf("tampered event: error = %v, want invalid", err)
+	}
+}
+
+func TestRelayRequireAuth(t *testing.T) {
+	rl := New(open_store(t))
+	rl.RequireAuth = true
+	url := serve(t, rl)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sk := nostr.GeneratePrivateKey()
+	conn := connect(ctx, t, url)
+
+	err := conn.Publish(ctx, *sign(t, sk, 1, 100, "before auth"))
+	if err == nil || !strings.Contains(err.Error(), "auth-required") {
+		t.Fatalf("event before AUTH: error = %v, want auth-required", err)
+	}
+	if err := conn.Auth(ctx, func(event *nostr.Event) error { return event.Sign(sk) }); err != nil {
+		t.Fatalf("AUTH failed: %v", err)
+	}
+	if err := conn.Publish(ctx, *sign(t, sk, 1, 100, "after auth")); err != nil {
+		t.Errorf("event after AUTH: %v", err)
+	}
+}
@@ -0,0 +1,302 @@
+// Package relay is a minimal Nostr relay for offline development and tests:
+// NIP-01 messaging with replaceable and addressable event semantics, NIP-09
+// deletions, NIP-11 relay information and optional NIP-42 authentication,
+// backed by a JSON-lines file.
+package relay
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Rejection reasons, prefixed as NIP-01 OK messages expect.
+var (
+	ErrDuplicate = errors.New("duplicate: already have this event")
+	ErrOutdated  = errors.New("duplicate: already have a newer version of this event")
+	ErrDeleted   = errors.New("blocked: this event was deleted by its author")
+)
+
+// max_line caps the size of one stored event when the file is read.
+const max_line = 16 << 20
+
+// Store keeps the events of the relay in memory and, unless it was opened
+// without a path, appends every accepted event to a JSON-lines file. The file
+// is replayed and compacted when the store is opened.
+type Store struct {
+	mu   sync.RWMutex
+	path string
+	file *os.File
+
+	events      map[string]*nostr.Event // id -> event
+	replaceable map[string]string       // "<kind>:<pubkey>:<d>" -> id of the latest version
+	deleted_ids map[string]string       // deleted event id -> pubkey that deleted it
+	deleted_at  map[string]int64        // deleted coordinate -> created_at of the deletion
+}
+
+// Open loads the store at path, creating it if needed. An empty path keeps
+// events in memory only.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:        path,
+		events:      make(map[string]*nostr.Event),
+		replaceable: make(map[string]string),
+		deleted_ids: make(map[string]string),
+		deleted_at:  make(map[string]int64),
+	}
+	if path == "" {
+		return s, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create relay directory: %w", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), max_line)
+		line := 0
+		for scanner.Scan() {
+			line++
+			var event nostr.Event
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			_, _ = s.apply(&event)
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	s.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Close closes the store file.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// Len returns the number of stored events.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.events)
+}
+
+// Save stores a signed event, applying NIP-01 replacement and NIP-09
+// deletion rules. It reports whether the event was stored: ephemeral events
+// (kinds 20000–29999) are not, but are not rejected either. Events that lose
+// to a stored version, were deleted or are already stored return one of the
+// Err* reasons.
+func (s *Store) Save(event *nostr.Event) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, err := s.apply(event)
+	if !stored || err != nil || s.file == nil {
+		return stored, err
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return true, err
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return true, fmt.Errorf("failed to write %s: %w", s.path, err)
+	}
+	return true, nil
+}
+
+// Query returns the stored events matching filter, newest first, at most
+// filter.Limit of them when it is set.
+func (s *Store) Query(filter nostr.Filter) []*nostr.Event {
+	if filter.LimitZero {
+		return nil
+	}
+	s.mu.RLock()
+	var out []*nostr.Event
+	if len(filter.IDs) > 0 {
+		for _, id := range filter.IDs {
+			if event, ok := s.events[id]; ok && filter.Matches(event) {
+				out = append(out, event)
+			}
+		}
+	} else {
+		for _, event := range s.events {
+			if filter.Matches(event) {
+				out = append(out, event)
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CreatedAt != out[j].CreatedAt {
+			return out[i].CreatedAt > out[j].CreatedAt
+		}
+		return out[i].ID < out[j].ID
+	})
+	if filter.Limit > 0 && len(out) > filter.Limit {
+		out = out[:filter.Limit]
+	}
+	return out
+}
+
+// apply adds event to the in-memory indexes. The caller holds the lock.
+func (s *Store) apply(event *nostr.Event) (bool, error) {
+	if _, ok := s.events[event.ID]; ok {
+		return false, ErrDuplicate
+	}
+	if pubkey, ok := s.deleted_ids[event.ID]; ok && pubkey == event.PubKey {
+		return false, ErrDeleted
+	}
+	if nostr.IsEphemeralKind(event.Kind) {
+		return false, nil
+	}
+
+	key := replaceable_key(event)
+	if key != "" {
+		if at, ok := s.deleted_at[key]; ok && int64(event.CreatedAt) <= at {
+			return false, ErrDeleted
+		}
+		if id, ok := s.replaceable[key]; ok {
+			current := s.events[id]
+			if current.CreatedAt > event.CreatedAt || (current.CreatedAt == event.CreatedAt && current.ID < event.ID) {
+				return false, ErrOutdated
+			}
+			delete(s.events, id)
+		}
+		s.replaceable[key] = event.ID
+	}
+
+	if event.Kind == nostr.KindDeletion {
+		s.apply_deletion(event)
+	}
+	s.events[event.ID] = event
+	return true, nil
+}
+
+// apply_deletion removes the events a NIP-09 deletion request names by `e`
+// id or `a` coordinate, when they belong to its author, and remembers them
+// so they are not accepted again.
+func (s *Store) apply_deletion(deletion *nostr.Event) {
+	for _, tag := range deletion.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "e":
+			id := tag[1]
+			if target, ok := s.events[id]; ok {
+				if target.PubKey != deletion.PubKey || target.Kind == nostr.KindDeletion {
+					continue
+				}
+				s.remove(target)
+			}
+			s.deleted_ids[id] = deletion.PubKey
+		case "a":
+			parts := strings.SplitN(tag[1], ":", 3)
+			if len(parts) != 3 || parts[1] != deletion.PubKey {
+				continue
+			}
+			kind, err := strconv.Atoi(parts[0])
+			if err != nil || kind == nostr.KindDeletion {
+				continue
+			}
+			coord := tag[1]
+			if nostr.IsReplaceableKind(kind) {
+				coord = fmt.Sprintf("%d:%s:", kind, parts[1])
+			}
+			if at := int64(deletion.CreatedAt); at > s.deleted_at[coord] {
+				s.deleted_at[coord] = at
+			}
+			if id, ok := s.replaceable[coord]; ok && s.events[id].CreatedAt <= deletion.CreatedAt {
+				s.remove(s.events[id])
+			}
+		}
+	}
+}
+
+func (s *Store) remove(event *nostr.Event) {
+	delete(s.events, event.ID)
+	if key := replaceable_key(event); key != "" && s.replaceable[key] == event.ID {
+		delete(s.replaceable, key)
+	}
+}
+
+// compact rewrites the store file with the stored events only, oldest first.
+func (s *Store) compact() error {
+	events := make([]*nostr.Event, 0, len(s.events))
+	for _, event := range s.events {
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].CreatedAt != events[j].CreatedAt {
+			return events[i].CreatedAt < events[j].CreatedAt
+		}
+		return events[i].ID < events[j].ID
+	})
+
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	w := bufio.NewWriter(f)
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// replaceable_key returns the key under which only the latest version of an
+// event is kept: "<kind>:<pubkey>:" for replaceable kinds (0, 3,
+// 10000–19999), "<kind>:<pubkey>:<d>" for addressable ones (30000–39999),
+// else "".
+func replaceable_key(event *nostr.Event) string {
+	switch {
+	case nostr.IsReplaceableKind(event.Kind):
+		return fmt.Sprintf("%d:%s:", event.Kind, event.PubKey)
+	case nostr.IsAddressableKind(event.Kind):
+		return fmt.Sprintf("%d:%s:%s", event.Kind, event.PubKey, event.Tags.GetD())
+	}
+	return ""
+}
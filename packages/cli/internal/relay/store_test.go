@@ -0,0 +1,180 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// sign returns a signed event of kind by sk at created_at with tags.
+func sign(t *testing.T, sk string, kind int, created_at int64, content string, tags ...nostr.Tag) *nostr.Event {
+	t.Helper()
+	event := &nostr.Event{Kind: kind, CreatedAt: nostr.Timestamp(created_at), Content: content, Tags: nostr.Tags(tags)}
+	if event.Tags == nil {
+		event.Tags = nostr.Tags{}
+	}
+	if err := event.Sign(sk); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func open_store(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func save(t *testing.T, s *Store, event *nostr.Event, want error) {
+	t.Helper()
+	stored, err := s.Save(event)
+	if !errors.Is(err, want) {
+		t.Fatalf("Save(%s) error = %v, want %v", event.Content, err, want)
+	}
+	if stored != (want == nil) {
+		t.Fatalf("Save(%s) stored = %v, want %v", event.Content, stored, want == nil)
+	}
+}
+
+// addressable returns the events stored under kind and d.
+func addressable(s *Store, pk string, kind int, d string) []*nostr.Event {
+	return s.Query(nostr.Filter{Kinds: []int{kind}, Authors: []string{pk}, Tags: nostr.TagMap{"d": []string{d}}})
+}
+
+func TestAddressableReplacement(t *testing.T) {
+	s := open_store(t)
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	d := nostr.Tag{"d", "ketab-1"}
+
+	save(t, s, sign(t, sk, 38893, 100, "v1", d), nil)
+	save(t, s, sign(t, sk, 38893, 200, "v2", d), nil)
+	save(t, s, sign(t, sk, 38893, 150, "older", d), ErrOutdated)
+	save(t, s, sign(t, sk, 38893, 150, "other d", nostr.Tag{"d", "ketab-2"}), nil)
+
+	got := addressable(s, pk, 38893, "ketab-1")
+	if len(got) != 1 || got[0].Content != "v2" {
+		t.Fatalf("ketab-1 = %v, want only v2", got)
+	}
+	if s.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", s.Len())
+	}
+
+	// Another author's event with the same d-tag is kept apart
+	other := nostr.GeneratePrivateKey()
+	save(t, s, sign(t, other, 38893, 50, "theirs", d), nil)
+	if got := addressable(s, pk, 38893, "ketab-1"); len(got) != 1 || got[0].Content != "v2" {
+		t.Errorf("ketab-1 after another author's event = %v, want only v2", got)
+	}
+}
+
+func TestReplacementTieBreak(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	d := nostr.Tag{"d", "same-second"}
+	a := sign(t, sk, 30023, 100, "a", d)
+	b := sign(t, sk, 30023, 100, "b", d)
+	low, high := a, b
+	if high.ID < low.ID {
+		low, high = high, low
+	}
+
+	// The lowest id wins whichever arrives first
+	for _, order := range [][]*nostr.Event{{low, high}, {high, low}} {
+		s := open_store(t)
+		save(t, s, order[0], nil)
+		if order[1] == high {
+			save(t, s, order[1], ErrOutdated)
+		} else {
+			save(t, s, order[1], nil)
+		}
+		got := addressable(s, pk, 30023, "same-second")
+		if len(got) != 1 || got[0].ID != low.ID {
+			t.Errorf("%s then %s: kept %v, want %s", order[0].Content, order[1].Content, got, low.Content)
+		}
+	}
+}
+
+func TestDeletionByID(t *testing.T) {
+	s := open_store(t)
+	sk := nostr.GeneratePrivateKey()
+	note := sign(t, sk, 1, 100, "note")
+	save(t, s, note, nil)
+
+	// Only the author can delete
+	stranger := nostr.GeneratePrivateKey()
+	save(t, s, sign(t, stranger, 5, 110, "stranger deletion", nostr.Tag{"e", note.ID}), nil)
+	if len(s.Query(nostr.Filter{IDs: []string{note.ID}})) != 1 {
+		t.Fatal("a deletion by another pubkey removed the event")
+	}
+
+	save(t, s, sign(t, sk, 5, 120, "deletion", nostr.Tag{"e", note.ID}), nil)
+	if len(s.Query(nostr.Filter{IDs: []string{note.ID}})) != 0 {
+		t.Fatal("deleted event is still stored")
+	}
+	save(t, s, note, ErrDeleted)
+}
+
+func TestDeletionByCoordinate(t *testing.T) {
+	s := open_store(t)
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	d := nostr.Tag{"d", "chapter-1"}
+	coord := fmt.Sprintf("30023:%s:chapter-1", pk)
+
+	save(t, s, sign(t, sk, 30023, 100, "v1", d), nil)
+	save(t, s, sign(t, sk, 5, 200, "deletion", nostr.Tag{"a", coord}), nil)
+	if got := addressable(s, pk, 30023, "chapter-1"); len(got) != 0 {
+		t.Fatalf("chapter-1 after deletion = %v, want none", got)
+	}
+
+	// Versions up to the deletion stay deleted; a later one republishes
+	save(t, s, sign(t, sk, 30023, 150, "before deletion", d), ErrDeleted)
+	save(t, s, sign(t, sk, 30023, 200, "same second", d), ErrDeleted)
+	save(t, s, sign(t, sk, 30023, 300, "republished", d), nil)
+	if got := addressable(s, pk, 30023, "chapter-1"); len(got) != 1 || got[0].Content != "republished" {
+		t.Errorf("chapter-1 after republishing = %v, want republished", got)
+	}
+
+	// A deletion older than the stored version leaves it alone
+	save(t, s, sign(t, sk, 5, 250, "stale deletion", nostr.Tag{"a", coord}), nil)
+	if got := addressable(s, pk, 30023, "chapter-1"); len(got) != 1 {
+		t.Errorf("stale deletion removed the republished version")
+	}
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	d := nostr.Tag{"d", "book"}
+	note := sign(t, sk, 1, 100, "note")
+	save(t, s, note, nil)
+	save(t, s, sign(t, sk, 38891, 100, "v1", d), nil)
+	save(t, s, sign(t, sk, 38891, 200, "v2", d), nil)
+	save(t, s, sign(t, sk, 5, 300, "deletion", nostr.Tag{"e", note.ID}), nil)
+	s.Close()
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Len() != 2 {
+		t.Errorf("Len() after reopening = %d, want 2 (v2 and the deletion)", s.Len())
+	}
+	if got := addressable(s, pk, 38891, "book"); len(got) != 1 || got[0].Content != "v2" {
+		t.Errorf("book after reopening = %v, want v2", got)
+	}
+	save(t, s, note, ErrDeleted)
+}
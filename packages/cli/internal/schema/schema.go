@@ -0,0 +1,167 @@
+// Package schema generates JSON Schemas from Go types and checks JSON
+// documents against them, reporting problems with their line and column.
+//
+// Only the subset of JSON Schema the book files need is supported: types,
+// properties, required, additionalProperties, items, minLength and
+// descriptions.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Draft is the JSON Schema dialect generated schemas declare.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema.
+type Schema struct {
+	Dialect     string `json:"$schema,omitempty"`
+	ID          string `json:"$id,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Type        Types  `json:"type,omitempty"`
+
+	Properties           *Properties `json:"properties,omitempty"`
+	Required             []string    `json:"required,omitempty"`
+	AdditionalProperties *bool       `json:"additionalProperties,omitempty"`
+	Items                *Schema     `json:"items,omitempty"`
+	MinLength            int         `json:"minLength,omitempty"`
+}
+
+// Types are the JSON types a value may have: "object", "array", "string",
+// "integer", "number", "boolean" or "null".
+type Types []string
+
+// Has reports whether t includes kind.
+func (t Types) Has(kind string) bool {
+	for _, k := range t {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON writes a single type as a string and several as an array.
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// Properties are an object schema's properties, in declaration order.
+type Properties struct {
+	names  []string
+	by_name map[string]*Schema
+}
+
+// Get returns the schema of property name, or nil.
+func (p *Properties) Get(name string) *Schema {
+	if p == nil {
+		return nil
+	}
+	return p.by_name[name]
+}
+
+// Names returns the property names in order.
+func (p *Properties) Names() []string {
+	if p == nil {
+		return nil
+	}
+	return p.names
+}
+
+func (p *Properties) set(name string, s *Schema) {
+	if p.by_name == nil {
+		p.by_name = make(map[string]*Schema)
+	}
+	if _, ok := p.by_name[name]; !ok {
+		p.names = append(p.names, name)
+	}
+	p.by_name[name] = s
+}
+
+// MarshalJSON writes the properties in declaration order.
+func (p *Properties) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, name := range p.names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(p.by_name[name])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Field describes a struct field beyond what its type and json tag say.
+// Fields are keyed "<Type>.<Field>", such as "SingleBookFile.Title".
+type Field struct {
+	Description string
+
+	// Required fields must be present and, for strings, not empty.
+	Required bool
+}
+
+// Generate builds the schema of a Go type as encoding/json reads it: structs
+// become objects that allow only their json-tagged fields, slices arrays (or
+// null, which decodes to an empty slice), and strings, numbers and booleans
+// themselves.
+func Generate(t reflect.Type, fields map[string]Field) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: Types{"string"}}
+	case reflect.Bool:
+		return &Schema{Type: Types{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: Types{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Types{"number"}}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: Types{"array", "null"}, Items: Generate(t.Elem(), fields)}
+	case reflect.Struct:
+		closed := false
+		s := &Schema{Type: Types{"object"}, Properties: &Properties{}, AdditionalProperties: &closed}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			property := Generate(f.Type, fields)
+			field := fields[t.Name()+"."+f.Name]
+			property.Description = field.Description
+			if field.Required {
+				s.Required = append(s.Required, name)
+				if property.Type.Has("string") {
+					property.MinLength = 1
+				}
+			}
+			s.Properties.set(name, property)
+		}
+		return s
+	}
+	return &Schema{}
+}
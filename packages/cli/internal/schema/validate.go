@@ -0,0 +1,271 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Error is a place where a JSON document breaks its schema.
+type Error struct {
+	Line   int
+	Column int
+
+	// Path locates the value, such as "acts[0].chapters[2]"; empty for the
+	// document itself.
+	Path string
+
+	// Keyword is the schema keyword that failed: "type", "required",
+	// "additionalProperties", "minLength", or "syntax" for malformed JSON.
+	Keyword string
+
+	Message string
+}
+
+func (e Error) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+	}
+	return fmt.Sprintf("%d:%d: %s: %s", e.Line, e.Column, e.Path, e.Message)
+}
+
+// Validate checks a JSON document against s. Malformed JSON yields a single
+// "syntax" error.
+func Validate(s *Schema, data []byte) []Error {
+	p := &parser{data: data, dec: json.NewDecoder(bytes.NewReader(data))}
+	p.dec.UseNumber()
+	syntax_error := func(offset int, message string) []Error {
+		line, column := Position(data, offset)
+		return []Error{{Line: line, Column: column, Keyword: "syntax", Message: message}}
+	}
+	root, err := p.value()
+	if err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			return syntax_error(int(syntax.Offset), syntax.Error())
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return syntax_error(len(data), "unexpected end of JSON input")
+		}
+		return syntax_error(int(p.dec.InputOffset()), err.Error())
+	}
+	rest := data[p.dec.InputOffset():]
+	if trimmed := bytes.TrimLeft(rest, " \t\r\n"); len(trimmed) > 0 {
+		return syntax_error(len(data)-len(trimmed), "unexpected data after the top-level value")
+	}
+
+	v := &validator{data: data}
+	v.check(s, root, "")
+	return v.errors
+}
+
+// Position turns a byte offset in data into a 1-based line and column;
+// columns count characters, not bytes.
+func Position(data []byte, offset int) (line, column int) {
+	offset = min(max(offset, 0), len(data))
+	before := data[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	if i := bytes.LastIndexByte(before, '\n'); i >= 0 {
+		before = before[i+1:]
+	}
+	return line, utf8.RuneCount(before) + 1
+}
+
+// node is a parsed JSON value and the offset it starts at.
+type node struct {
+	kind   string // "object", "array", "string", "number", "boolean" or "null"
+	offset int
+	text   string // a string's value or a number's literal
+
+	keys     []string
+	key_offs []int
+	fields   map[string]*node
+	items    []*node
+}
+
+type parser struct {
+	data []byte
+	dec  *json.Decoder
+}
+
+// start returns the offset of the next token, past whitespace and the
+// separators the decoder consumes silently.
+func (p *parser) start() int {
+	i := int(p.dec.InputOffset())
+	for i < len(p.data) && strings.IndexByte(" \t\r\n,:", p.data[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+func (p *parser) value() (*node, error) {
+	n := &node{offset: p.start()}
+	tok, err := p.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '{' {
+			n.kind = "object"
+			n.fields = make(map[string]*node)
+			for p.dec.More() {
+				key_off := p.start()
+				key, err := p.dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				field, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				name := key.(string)
+				if _, dup := n.fields[name]; !dup {
+					n.keys = append(n.keys, name)
+					n.key_offs = append(n.key_offs, key_off)
+				}
+				n.fields[name] = field
+			}
+		} else {
+			n.kind = "array"
+			for p.dec.More() {
+				item, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				n.items = append(n.items, item)
+			}
+		}
+		if _, err := p.dec.Token(); err != nil {
+			return nil, err
+		}
+	case string:
+		n.kind, n.text = "string", t
+	case json.Number:
+		n.kind, n.text = "number", t.String()
+	case bool:
+		n.kind = "boolean"
+	case nil:
+		n.kind = "null"
+	}
+	return n, nil
+}
+
+type validator struct {
+	data   []byte
+	errors []Error
+}
+
+func (v *validator) fail(offset int, path, keyword, format string, args ...any) {
+	line, column := Position(v.data, offset)
+	v.errors = append(v.errors, Error{
+		Line:    line,
+		Column:  column,
+		Path:    path,
+		Keyword: keyword,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) check(s *Schema, n *node, path string) {
+	if s == nil || len(s.Type) == 0 {
+		return
+	}
+	if !has_type(n, s.Type) {
+		v.fail(n.offset, path, "type", "expected %s, found %s", article(s.Type[0]), article(n.kind))
+		return
+	}
+
+	switch n.kind {
+	case "string":
+		if s.MinLength > 0 && utf8.RuneCountInString(n.text) < s.MinLength {
+			v.fail(n.offset, path, "minLength", "must not be empty")
+		}
+	case "array":
+		for i, item := range n.items {
+			v.check(s.Items, item, fmt.Sprintf("%s[%d]", path, i))
+		}
+	case "object":
+		for _, name := range s.Required {
+			if _, ok := n.fields[name]; !ok {
+				v.fail(n.offset, path, "required", "missing required property %q", name)
+			}
+		}
+		closed := s.AdditionalProperties != nil && !*s.AdditionalProperties
+		for i, name := range n.keys {
+			property := s.Properties.Get(name)
+			if property == nil {
+				if closed {
+					message := fmt.Sprintf("unknown property %q", name)
+					if guess := closest(name, s.Properties.Names()); guess != "" {
+						message += fmt.Sprintf(" (did you mean %q?)", guess)
+					}
+					v.fail(n.key_offs[i], path, "additionalProperties", "%s", message)
+				}
+				continue
+			}
+			child := name
+			if path != "" {
+				child = path + "." + name
+			}
+			v.check(property, n.fields[name], child)
+		}
+	}
+}
+
+func has_type(n *node, types Types) bool {
+	if n.kind == "number" && !types.Has("number") {
+		_, err := strconv.ParseInt(n.text, 10, 64)
+		return err == nil && types.Has("integer")
+	}
+	return types.Has(n.kind)
+}
+
+func article(kind string) string {
+	switch kind {
+	case "object", "array", "integer":
+		return "an " + kind
+	case "null":
+		return "null"
+	}
+	return "a " + kind
+}
+
+// closest returns the name nearest to typo, if any is near enough to be a
+// likely misspelling.
+func closest(typo string, names []string) string {
+	best, best_distance := "", 3
+	for _, name := range names {
+		if d := distance(strings.ToLower(typo), name); d < best_distance {
+			best, best_distance = name, d
+		}
+	}
+	return best
+}
+
+// distance is the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		cur := make([]int, len(br)+1)
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(br)]
+}
@@ -0,0 +1,151 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip46"
+)
+
+// BunkerTimeout bounds connecting to a remote signer and each signing request.
+// It is generous because the signer may ask its owner to approve the request.
+var BunkerTimeout = 2 * time.Minute
+
+// client_key_file is the NIP-46 client key inside ConfigDir. Reusing one key
+// lets a bunker remember that it already authorized this CLI.
+const client_key_file = "bunker-client.key"
+
+// Bunker signs through an NIP-46 remote signer.
+type Bunker struct {
+	client *nip46.BunkerClient
+	pool   *nostr.SimplePool
+	cancel context.CancelFunc
+	pk     string
+}
+
+// ConnectBunker connects to the remote signer of a bunker://<pubkey>?relay=...&secret=...
+// URI and asks it for the pubkey it signs with. on_auth is called with the URL
+// when the bunker wants its owner to approve the connection in a browser.
+func ConnectBunker(ctx context.Context, uri string, on_auth func(auth_url string)) (*Bunker, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "bunker" {
+		return nil, fmt.Errorf("invalid bunker URI %q (want bunker://<pubkey>?relay=wss://...)", uri)
+	}
+	target := parsed.Host
+	if !nostr.IsValidPublicKey(target) {
+		return nil, fmt.Errorf("bunker URI: %q is not a valid hex pubkey", target)
+	}
+	relays := parsed.Query()["relay"]
+	if len(relays) == 0 {
+		return nil, fmt.Errorf("bunker URI has no relay= parameter")
+	}
+
+	client_sk, err := load_client_key()
+	if err != nil {
+		return nil, err
+	}
+
+	// The client subscribes for responses for as long as the signer is open,
+	// so it gets its own context rather than the caller's.
+	session_ctx, cancel := context.WithCancel(context.Background())
+	pool := nostr.NewSimplePool(session_ctx)
+	b := &Bunker{
+		client: nip46.NewBunker(session_ctx, client_sk, target, relays, pool, on_auth),
+		pool:   pool,
+		cancel: cancel,
+	}
+
+	ctx, cancel_connect := context.WithTimeout(ctx, BunkerTimeout)
+	defer cancel_connect()
+	if _, err := b.client.RPC(ctx, "connect", []string{target, parsed.Query().Get("secret")}); err != nil {
+		b.Close()
+		return nil, fmt.Errorf("bunker connect failed: %w", err)
+	}
+	if b.pk, err = b.client.GetPublicKey(ctx); err != nil {
+		b.Close()
+		return nil, fmt.Errorf("bunker get_public_key failed: %w", err)
+	}
+	if !nostr.IsValidPublicKey(b.pk) {
+		b.Close()
+		return nil, fmt.Errorf("bunker returned an invalid pubkey %q", b.pk)
+	}
+	return b, nil
+}
+
+// PublicKey implements Signer.
+func (b *Bunker) PublicKey() string {
+	return b.pk
+}
+
+// Sign implements Signer. The signed event is checked (id, signature, pubkey,
+// and that it is the event that was sent) before it is accepted.
+func (b *Bunker) Sign(ctx context.Context, event *nostr.Event) error {
+	ctx, cancel := context.WithTimeout(ctx, BunkerTimeout)
+	defer cancel()
+	event.PubKey = b.pk
+	sent := *event
+	sent.Tags = slices.Clone(event.Tags)
+	if err := b.client.SignEvent(ctx, event); err != nil {
+		return fmt.Errorf("bunker sign_event failed: %w", err)
+	}
+	return check_signed(&sent, event)
+}
+
+// check_signed returns an error unless signed is sent as signed by its
+// pubkey: a bunker must not change what it was asked to sign.
+func check_signed(sent, signed *nostr.Event) error {
+	switch {
+	case signed.PubKey != sent.PubKey:
+		return fmt.Errorf("bunker signed with %s, expected %s", signed.PubKey, sent.PubKey)
+	case signed.Kind != sent.Kind:
+		return fmt.Errorf("bunker changed the event kind from %d to %d", sent.Kind, signed.Kind)
+	case signed.CreatedAt != sent.CreatedAt:
+		return fmt.Errorf("bunker changed the event created_at from %d to %d", sent.CreatedAt, signed.CreatedAt)
+	case signed.Content != sent.Content:
+		return fmt.Errorf("bunker changed the event content")
+	case !slices.EqualFunc(signed.Tags, sent.Tags, slices.Equal):
+		return fmt.Errorf("bunker changed the event tags")
+	}
+	return nil
+}
+
+// Close implements Signer.
+func (b *Bunker) Close() error {
+	b.cancel()
+	b.pool.Close("signer closed")
+	return nil
+}
+
+// load_client_key returns the persistent NIP-46 client key, creating it on first use.
+func load_client_key() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, client_key_file)
+	if data, err := os.ReadFile(path); err == nil {
+		sk := strings.TrimSpace(string(data))
+		if _, err := nostr.GetPublicKey(sk); err != nil {
+			return "", fmt.Errorf("invalid bunker client key in %s: %w", path, err)
+		}
+		return sk, nil
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	sk := nostr.GeneratePrivateKey()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	if err := os.WriteFile(path, []byte(sk+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return sk, nil
+}
@@ -0,0 +1,120 @@
+package signer
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joinnextblock/ketab-protocol/cli/internal/relay"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip46"
+)
+
+// run_responder answers NIP-46 requests for sk on the relay at url until ctx
+// is done.
+func run_responder(ctx context.Context, t *testing.T, url, sk string) {
+	t.Helper()
+	pk, _ := nostr.GetPublicKey(sk)
+	conn, err := nostr.RelayConnect(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := conn.Subscribe(ctx, nostr.Filters{{
+		Kinds: []int{nostr.KindNostrConnect},
+		Tags:  nostr.TagMap{"p": []string{pk}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-sub.EndOfStoredEvents
+
+	responder := nip46.NewStaticKeySigner(sk)
+	go func() {
+		defer conn.Close()
+		for event := range sub.Events {
+			_, _, response, err := responder.HandleRequest(ctx, event)
+			if err != nil {
+				continue
+			}
+			conn.Publish(ctx, response)
+		}
+	}()
+}
+
+func TestBunker(t *testing.T) {
+	t.Setenv("KETAB_HOME", t.TempDir())
+	store, err := relay.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(relay.New(store))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	run_responder(ctx, t, url, sk)
+
+	b, err := ConnectBunker(ctx, "bunker://"+pk+"?relay="+url+"&secret=s3cret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if b.PublicKey() != pk {
+		t.Errorf("PublicKey() = %s, want %s", b.PublicKey(), pk)
+	}
+
+	event := &nostr.Event{Kind: 1, CreatedAt: nostr.Now(), Content: "signed remotely", Tags: nostr.Tags{{"t", "ketab"}}}
+	if err := b.Sign(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+	if event.PubKey != pk {
+		t.Errorf("signed by %s, want %s", event.PubKey, pk)
+	}
+	if ok, err := event.CheckSignature(); !ok || err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+	if event.Content != "signed remotely" || len(event.Tags) != 1 {
+		t.Errorf("signed event changed: %+v", event)
+	}
+}
+
+func TestConnectBunkerInvalidURI(t *testing.T) {
+	for _, uri := range []string{
+		"nostrconnect://abc",
+		"bunker://not-a-pubkey?relay=ws://127.0.0.1:1",
+		"bunker://" + strings.Repeat("a", 64),
+	} {
+		if _, err := ConnectBunker(context.Background(), uri, nil); err == nil {
+			t.Errorf("ConnectBunker(%q) succeeded, want an error", uri)
+		}
+	}
+}
+
+func TestCheckSigned(t *testing.T) {
+	sent := nostr.Event{PubKey: "pk", Kind: 1, CreatedAt: 100, Content: "text", Tags: nostr.Tags{{"t", "ketab"}}}
+	if err := check_signed(&sent, &sent); err != nil {
+		t.Errorf("unchanged event: %v", err)
+	}
+	tests := map[string]func(e *nostr.Event){
+		"pubkey":     func(e *nostr.Event) { e.PubKey = "other" },
+		"kind":       func(e *nostr.Event) { e.Kind = 0 },
+		"created_at": func(e *nostr.Event) { e.CreatedAt = 1 },
+		"content":    func(e *nostr.Event) { e.Content = "other" },
+		"tag value":  func(e *nostr.Event) { e.Tags = nostr.Tags{{"t", "other"}} },
+		"extra tag":  func(e *nostr.Event) { e.Tags = append(e.Tags, nostr.Tag{"p", "pk"}) },
+		"no tags":    func(e *nostr.Event) { e.Tags = nil },
+	}
+	for name, change := range tests {
+		signed := sent
+		signed.Tags = nostr.Tags{{"t", "ketab"}}
+		change(&signed)
+		if err := check_signed(&sent, &signed); err == nil {
+			t.Errorf("%s changed: accepted", name)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Package signer signs events on behalf of an author without the rest of the
+// CLI handling secret keys: a local nsec, an NIP-49 encrypted keyfile, or a
+// NIP-46 remote signer ("bunker").
+package signer
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/nbd-wtf/go-nostr/nip49"
+)
+
+// Signer signs events for one pubkey.
+type Signer interface {
+	// PublicKey returns the hex pubkey events are signed with.
+	PublicKey() string
+
+	// Sign sets the event's pubkey, id and sig.
+	Sign(ctx context.Context, event *nostr.Event) error
+
+	// Close releases the signer's resources (relay connections, ...).
+	Close() error
+}
+
+// Key signs with a secret key held in process memory.
+type Key struct {
+	sk string
+	pk string
+}
+
+// FromNsec returns a Key for a bech32 nsec.
+func FromNsec(nsec string) (*Key, error) {
+	prefix, data, err := nip19.Decode(strings.TrimSpace(nsec))
+	if err != nil {
+		return nil, fmt.Errorf("invalid nsec: %w", err)
+	}
+	if prefix != "nsec" {
+		return nil, fmt.Errorf("expected nsec, got %s", prefix)
+	}
+	// go-nostr nip19.Decode returns hex string for nsec
+	switch v := data.(type) {
+	case string:
+		return FromHex(v)
+	case []byte:
+		return FromHex(hex.EncodeToString(v))
+	default:
+		return nil, fmt.Errorf("unexpected nsec data type: %T", data)
+	}
+}
+
+// FromHex returns a Key for a hex secret key.
+func FromHex(sk string) (*Key, error) {
+	pk, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive pubkey: %w", err)
+	}
+	return &Key{sk: sk, pk: pk}, nil
+}
+
+// OpenKeyfile decrypts a file holding an NIP-49 ncryptsec with password.
+func OpenKeyfile(path, password string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyfile: %w", err)
+	}
+	ncryptsec := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(ncryptsec, "ncryptsec1") {
+		return nil, fmt.Errorf("%s does not hold an ncryptsec", path)
+	}
+	sk, err := nip49.Decrypt(ncryptsec, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s (wrong password?): %w", path, err)
+	}
+	return FromHex(sk)
+}
+
+// PublicKey implements Signer.
+func (k *Key) PublicKey() string {
+	return k.pk
+}
+
+// Sign implements Signer.
+func (k *Key) Sign(ctx context.Context, event *nostr.Event) error {
+	return event.Sign(k.sk)
+}
+
+// Close implements Signer.
+func (k *Key) Close() error {
+	return nil
+}
+
+// ConfigDir returns the directory the CLI keeps per-user state in:
+// $KETAB_HOME, or "ketab" under the user config directory.
+func ConfigDir() (string, error) {
+	if dir := os.Getenv("KETAB_HOME"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("no config directory (set KETAB_HOME): %w", err)
+	}
+	return filepath.Join(dir, "ketab"), nil
+}
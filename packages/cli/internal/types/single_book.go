@@ -3,6 +3,9 @@ package types
 
 // SingleBookFile represents the new unified book.json file structure.
 type SingleBookFile struct {
+	// Schema points editors at the book.json schema; it is not published.
+	Schema string `json:"$schema,omitempty"`
+
 	Title       string    `json:"title"`
 	Slug        string    `json:"slug"`
 	UUID        string    `json:"uuid"`
@@ -12,7 +15,12 @@ type SingleBookFile struct {
 	Image       string    `json:"image,omitempty"`
 	Thumb       string    `json:"thumb,omitempty"`
 	RefBlockID  string    `json:"ref_block_id,omitempty"`
+	Signer      string    `json:"signer,omitempty"`
 	Acts        []SingleAct `json:"acts"`
+
+	// Shape is the book-shape layout older book.json files still carry. Only
+	// its discussion_id fields are read.
+	Shape [][]ShapeChapter `json:"shape,omitempty"`
 }
 
 // SingleAct represents an act in the single file format.
@@ -26,14 +34,28 @@ type SingleChapter struct {
 	Number string        `json:"number"`
 	Title  string        `json:"title"`
 	UUID   string        `json:"uuid"`
+	Topics []string      `json:"topics,omitempty"`
 	Ketabs []SingleKetab `json:"ketabs"`
+
+	DiscussionID string `json:"discussion_id,omitempty"`
+
+	// Carried over from chapter-metadata.json by ketab migrate: the first
+	// publish time, tags other than topics, and the chapter's coordinate.
+	PublishedAt int64      `json:"published_at,omitempty"`
+	Tags        [][]string `json:"tags,omitempty"`
+	Coordinate  string     `json:"coordinate,omitempty"`
 }
 
 // SingleKetab represents a ketab with file reference.
 type SingleKetab struct {
-	Title string `json:"title"`
-	UUID  string `json:"uuid"`
-	File  string `json:"file"`
+	Title  string   `json:"title"`
+	UUID   string   `json:"uuid"`
+	File   string   `json:"file"`
+	Topics []string `json:"topics,omitempty"`
+
+	// Number is the ketab's 1-based index when it is not its position in
+	// the chapter, as legacy scene numbers with gaps are.
+	Number int `json:"number,omitempty"`
 }
 
 // ToBookMetadata converts SingleBookFile to the legacy BookMetadata format.
@@ -47,6 +69,8 @@ func (s *SingleBookFile) ToBookMetadata() *BookMetadata {
 				ChapterNumber: ch.Number,
 				ChapterTitle:  ch.Title,
 				ChapterUUID:   ch.UUID,
+				Coordinate:    ch.Coordinate,
+				DiscussionID:  s.discussion_id(ch),
 			})
 		}
 		acts = append(acts, ActRef{
@@ -64,6 +88,8 @@ func (s *SingleBookFile) ToBookMetadata() *BookMetadata {
 		Description: s.Description,
 		Image:       s.Image,
 		Thumb:       s.Thumb,
+		RefBlockID:  s.RefBlockID,
+		Signer:      s.Signer,
 		Acts:        acts,
 	}
 }
@@ -83,9 +109,10 @@ func (s *SingleBookFile) ToBookShape() *BookShape {
 				})
 			}
 			actChapters = append(actChapters, ShapeChapter{
-				Title:  ch.Title,
-				DTag:   ch.UUID,
-				Ketabs: ketabs,
+				Title:        ch.Title,
+				DTag:         ch.UUID,
+				DiscussionID: s.discussion_id(ch),
+				Ketabs:       ketabs,
 			})
 		}
 		shape = append(shape, actChapters)
@@ -99,6 +126,23 @@ func (s *SingleBookFile) ToBookShape() *BookShape {
 	}
 }
 
+// discussion_id returns the chapter's discussion thread: its own
+// discussion_id, else that of the legacy shape entry with the same d_tag (or,
+// for entries without one, the same title).
+func (s *SingleBookFile) discussion_id(ch SingleChapter) string {
+	if ch.DiscussionID != "" {
+		return ch.DiscussionID
+	}
+	for _, act := range s.Shape {
+		for _, shape_ch := range act {
+			if shape_ch.DTag == ch.UUID || (shape_ch.DTag == "" && shape_ch.Title == ch.Title) {
+				return shape_ch.DiscussionID
+			}
+		}
+	}
+	return ""
+}
+
 // GetChapterMetadata returns ChapterMetadata for a specific chapter number.
 func (s *SingleBookFile) GetChapterMetadata(chapterNum string) *ChapterMetadata {
 	for _, act := range s.Acts {
@@ -106,19 +150,32 @@ func (s *SingleBookFile) GetChapterMetadata(chapterNum string) *ChapterMetadata
 			if ch.Number == chapterNum {
 				var scenes []SceneRef
 				for i, ketab := range ch.Ketabs {
+					number := ketab.Number
+					if number == 0 {
+						number = i + 1
+					}
 					scenes = append(scenes, SceneRef{
-						SceneNumber: i + 1,
+						SceneNumber: number,
 						SceneFile:   ketab.File,
 						SceneTitle:  ketab.Title,
 						KetabUUID:   ketab.UUID,
+						Topics:      ketab.Topics,
 					})
 				}
-				
+
+				var tags [][]string
+				for _, topic := range ch.Topics {
+					tags = append(tags, []string{"t", topic})
+				}
+				tags = append(tags, ch.Tags...)
+
 				return &ChapterMetadata{
 					ChapterTitle:  ch.Title,
 					ChapterNumber: ch.Number,
 					ChapterUUID:   ch.UUID,
+					PublishedAt:   ch.PublishedAt,
 					Scenes:        scenes,
+					Tags:          tags,
 				}
 			}
 		}
@@ -12,6 +12,7 @@ type BookMetadata struct {
 	Thumb       string            `json:"thumb,omitempty"`
 	Signer      string            `json:"signer,omitempty"`
 	BookUUID    string            `json:"book_uuid"`
+	RefBlockID  string            `json:"ref_block_id,omitempty"`
 	Acts        []ActRef          `json:"acts"`
 }
 
@@ -30,6 +31,7 @@ type ChapterRef struct {
 	ChapterTitle  string `json:"chapter_title"`
 	ChapterUUID   string `json:"chapter_uuid"`
 	Coordinate    string `json:"coordinate,omitempty"`
+	DiscussionID  string `json:"discussion_id,omitempty"` // Event id, nevent, naddr or coordinate of the chapter's discussion thread
 }
 
 // ActRef is a reference to an act in book-metadata.json.
@@ -48,9 +50,10 @@ type BookShape struct {
 
 // ShapeChapter is a chapter in book-shape.json.
 type ShapeChapter struct {
-	Title  string       `json:"title"`
-	DTag   string       `json:"d_tag"`
-	Ketabs []ShapeKetab `json:"ketabs"`
+	Title        string       `json:"title"`
+	DTag         string       `json:"d_tag"`
+	DiscussionID string       `json:"discussion_id,omitempty"`
+	Ketabs       []ShapeKetab `json:"ketabs"`
 }
 
 // ShapeKetab is a ketab reference in book-shape.json.
@@ -76,16 +79,18 @@ type ChapterMetadata struct {
 type KetabRef struct {
 	KetabNumber int    `json:"ketab_number"`
 	KetabFile   string `json:"ketab_file"`
-	KetabTitle  string `json:"ketab_title"`
-	KetabUUID   string `json:"ketab_uuid"`
+	KetabTitle  string   `json:"ketab_title"`
+	KetabUUID   string   `json:"ketab_uuid"`
+	Topics      []string `json:"topics,omitempty"`
 }
 
 // SceneRef is a scene reference in chapter-metadata.json (new format).
 type SceneRef struct {
 	SceneNumber int    `json:"scene_number"`
 	SceneFile   string `json:"scene_file"`
-	SceneTitle  string `json:"scene_title"`
-	KetabUUID   string `json:"ketab_uuid"`
+	SceneTitle  string   `json:"scene_title"`
+	KetabUUID   string   `json:"ketab_uuid"`
+	Topics      []string `json:"topics,omitempty"`
 }
 
 // GetKetabs returns a unified list of ketab items from either format.
@@ -100,6 +105,7 @@ func (c *ChapterMetadata) GetKetabs() []KetabItem {
 				File:   s.SceneFile,
 				Title:  s.SceneTitle,
 				UUID:   s.KetabUUID,
+				Topics: s.Topics,
 			})
 		}
 		return items
@@ -112,17 +118,30 @@ func (c *ChapterMetadata) GetKetabs() []KetabItem {
 			File:   k.KetabFile,
 			Title:  k.KetabTitle,
 			UUID:   k.KetabUUID,
+			Topics: k.Topics,
 		})
 	}
 	return items
 }
 
+// GetTopics returns the chapter's topic tags (the values of its "t" tags).
+func (c *ChapterMetadata) GetTopics() []string {
+	var topics []string
+	for _, tag := range c.Tags {
+		if len(tag) >= 2 && tag[0] == "t" && tag[1] != "" {
+			topics = append(topics, tag[1])
+		}
+	}
+	return topics
+}
+
 // KetabItem is a unified ketab/scene item.
 type KetabItem struct {
 	Number int
 	File   string
 	Title  string
 	UUID   string
+	Topics []string // Ketab-specific topic tags, in addition to the chapter's
 }
 
 // KetabContent is the JSON content for a ketab event (kind 38893).
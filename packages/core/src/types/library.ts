@@ -30,6 +30,16 @@ export interface LibraryContent {
   reader_count: number;
   /** Total chapters across all books (can be 0) */
   chapter_count: number;
+  /** Ordered books in the library (authoritative order; `a` tags only index them) */
+  books?: LibraryBook[];
+}
+
+/** One entry of a library's ordered books list */
+export interface LibraryBook {
+  /** Book d-tag */
+  d: string;
+  /** Book title */
+  title: string;
 }
 
 /** Library identifier (d-tag value, scoped to founder pubkey) */
@@ -0,0 +1,298 @@
+package engagement
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DefaultMinScore is the lowest similarity a fuzzy match may have: at most a
+// quarter of the highlighted characters differ from the current body.
+const DefaultMinScore = 0.75
+
+// max_pattern caps the runes matched by edit distance at once. Longer
+// highlights are anchored by their head and tail.
+const max_pattern = 256
+
+// Anchor locates a highlighted passage in a ketab.
+type Anchor struct {
+	// Ketab is the ketab the passage belongs to (the highlighted target
+	// itself when it has no children).
+	Ketab *Target
+
+	// Start and End are rune offsets into Ketab.Body.
+	Start int
+	End   int
+
+	// Score is 1 for a match after normalization (case, whitespace and
+	// markdown emphasis are ignored), else the fuzzy similarity
+	// (1 - edit distance / length).
+	Score float64
+}
+
+// Exact reports whether the passage was found without fuzzy matching.
+func (a *Anchor) Exact() bool {
+	return a.Score == 1
+}
+
+// Resolver anchors NIP-84 highlights to the ketabs of a book. Highlights
+// made on the book or on a compiled chapter are searched for in the ketabs
+// below their target; the `context` tag disambiguates repeated passages and
+// anchors highlights whose own text no longer matches.
+type Resolver struct {
+	// MinScore is the lowest accepted fuzzy similarity (DefaultMinScore).
+	MinScore float64
+
+	by_ref map[string]*Target
+}
+
+// NewResolver indexes the targets of book by coordinate and event id.
+func NewResolver(book *Target) *Resolver {
+	r := &Resolver{MinScore: DefaultMinScore, by_ref: make(map[string]*Target)}
+	var index func(t *Target)
+	index = func(t *Target) {
+		r.by_ref[t.Coordinate] = t
+		if t.EventID != "" {
+			r.by_ref[t.EventID] = t
+		}
+		for _, child := range t.Children {
+			index(child)
+		}
+	}
+	index(book)
+	return r
+}
+
+// Resolve anchors a kind 9802 highlight event, or returns nil if it
+// references no known target or its passage is not found.
+func (r *Resolver) Resolve(event *nostr.Event) *Anchor {
+	context := ""
+	if tag := event.Tags.GetFirst([]string{"context", ""}); tag != nil {
+		context = tag.Value()
+	}
+	for _, name := range []string{"a", "e"} {
+		for _, tag := range event.Tags {
+			if len(tag) < 2 || tag[0] != name {
+				continue
+			}
+			if t, ok := r.by_ref[tag[1]]; ok {
+				return r.Locate(t, event.Content, context)
+			}
+		}
+	}
+	return nil
+}
+
+// Locate finds text, highlighted in target with the given surrounding context
+// (optional), in the leaf targets below target. The best scoring ketab wins;
+// ties go to the first in reading order.
+func (r *Resolver) Locate(target *Target, text, context string) *Anchor {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	var best *Anchor
+	for _, ketab := range leaves(target) {
+		start, end, score := r.locate(ketab.Body, text, context)
+		if score < r.MinScore || start < 0 {
+			continue
+		}
+		if best == nil || score > best.Score {
+			best = &Anchor{Ketab: ketab, Start: start, End: end, Score: score}
+		}
+		if score == 1 {
+			break
+		}
+	}
+	return best
+}
+
+// leaves returns the targets without children below t, in order.
+func leaves(t *Target) []*Target {
+	if len(t.Children) == 0 {
+		return []*Target{t}
+	}
+	var out []*Target
+	for _, child := range t.Children {
+		out = append(out, leaves(child)...)
+	}
+	return out
+}
+
+// locate returns the rune range of text in body and its score. The passage
+// is first searched for inside the context, when the context contains it and
+// is itself found in body.
+func (r *Resolver) locate(body, text, context string) (int, int, float64) {
+	b := normalize(body)
+	t := normalize(text)
+	if len(b.runes) == 0 || len(t.runes) == 0 {
+		return -1, -1, 0
+	}
+	if c := normalize(context); len(c.runes) > len(t.runes) && index_runes(c.runes, t.runes) >= 0 {
+		if cs, ce, c_score := find(b.runes, c.runes, r.MinScore); cs >= 0 {
+			// Search the passage in the context's span first
+			if s, e, score := find(b.runes[cs:ce], t.runes, r.MinScore); s >= 0 {
+				start, end := b.original(cs+s, cs+e)
+				return start, end, min(c_score, score)
+			}
+		}
+	}
+	s, e, score := find(b.runes, t.runes, r.MinScore)
+	if s < 0 {
+		return -1, -1, 0
+	}
+	start, end := b.original(s, e)
+	return start, end, score
+}
+
+// find returns the range of pattern in text, exactly (score 1) or by edit
+// distance, or -1 when no range scores at least min_score.
+func find(text, pattern []rune, min_score float64) (int, int, float64) {
+	if i := index_runes(text, pattern); i >= 0 {
+		return i, i + len(pattern), 1
+	}
+	if len(pattern) <= max_pattern {
+		start, end, distance := approximate(text, pattern)
+		score := 1 - float64(distance)/float64(len(pattern))
+		if score < min_score {
+			return -1, -1, 0
+		}
+		start, end = whole_words(text, start, end)
+		return start, end, score
+	}
+
+	// Anchor long passages by their head, then their tail around where it
+	// should follow.
+	half := max_pattern / 2
+	head, tail := pattern[:half], pattern[len(pattern)-half:]
+	hs, _, hd := approximate(text, head)
+	if hs < 0 {
+		return -1, -1, 0
+	}
+	slack := len(pattern) / 4
+	from := min(max(hs+len(pattern)-half-slack, hs), len(text))
+	to := min(hs+len(pattern)+slack, len(text))
+	ts, te, td := approximate(text[from:to], tail)
+	if ts < 0 {
+		return -1, -1, 0
+	}
+	score := 1 - float64(hd+td)/float64(2*half)
+	if score < min_score {
+		return -1, -1, 0
+	}
+	start, end := whole_words(text, hs, from+te)
+	return start, end, score
+}
+
+// whole_words widens a fuzzy match that starts or ends inside a word to the
+// whole word.
+func whole_words(text []rune, start, end int) (int, int) {
+	word := func(i int) bool {
+		return i >= 0 && i < len(text) && (unicode.IsLetter(text[i]) || unicode.IsDigit(text[i]))
+	}
+	for word(start-1) && word(start) {
+		start--
+	}
+	for word(end-1) && word(end) {
+		end++
+	}
+	return start, end
+}
+
+// approximate returns the substring of text with the smallest edit distance
+// to pattern (Sellers' algorithm), preferring the earliest.
+func approximate(text, pattern []rune) (int, int, int) {
+	type cell struct{ cost, start int }
+	m := len(pattern)
+	prev := make([]cell, m+1)
+	cur := make([]cell, m+1)
+	for i := range prev {
+		prev[i] = cell{i, 0}
+	}
+	best_start, best_end, best := -1, -1, m+1
+	for j := 1; j <= len(text); j++ {
+		cur[0] = cell{0, j}
+		for i := 1; i <= m; i++ {
+			c := cell{prev[i-1].cost, prev[i-1].start}
+			if pattern[i-1] != text[j-1] {
+				c.cost++
+			}
+			if skip := cur[i-1].cost + 1; skip < c.cost {
+				c = cell{skip, cur[i-1].start}
+			}
+			if extra := prev[i].cost + 1; extra < c.cost {
+				c = cell{extra, prev[i].start}
+			}
+			cur[i] = c
+		}
+		if cur[m].cost < best {
+			best, best_start, best_end = cur[m].cost, cur[m].start, j
+		}
+		prev, cur = cur, prev
+	}
+	if best_start < 0 && m > 0 {
+		return -1, -1, m
+	}
+	return best_start, best_end, best
+}
+
+func index_runes(text, pattern []rune) int {
+	for i := 0; i+len(pattern) <= len(text); i++ {
+		match := true
+		for k, r := range pattern {
+			if text[i+k] != r {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// normalized is text folded for matching, with the rune offset in the
+// original text of every folded rune.
+type normalized struct {
+	runes  []rune
+	offset []int
+}
+
+// normalize lowercases s, collapses whitespace and drops markdown emphasis
+// markers, which rendered highlights do not contain.
+func normalize(s string) normalized {
+	var n normalized
+	space := true // drop leading whitespace
+	for i, r := range []rune(s) {
+		switch {
+		case unicode.IsSpace(r):
+			if !space {
+				n.runes = append(n.runes, ' ')
+				n.offset = append(n.offset, i)
+			}
+			space = true
+			continue
+		case r == '*' || r == '_' || r == '`' || r == '~':
+			continue
+		}
+		n.runes = append(n.runes, unicode.ToLower(r))
+		n.offset = append(n.offset, i)
+		space = false
+	}
+	if len(n.runes) > 0 && n.runes[len(n.runes)-1] == ' ' {
+		n.runes = n.runes[:len(n.runes)-1]
+		n.offset = n.offset[:len(n.offset)-1]
+	}
+	return n
+}
+
+// original maps the folded range [s, e) back to rune offsets in the text,
+// or returns -1 for an empty or out of range match.
+func (n normalized) original(s, e int) (int, int) {
+	if s < 0 || e <= s || e > len(n.offset) {
+		return -1, -1
+	}
+	return n.offset[s], n.offset[e-1] + 1
+}
@@ -0,0 +1,140 @@
+package engagement
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// chapter returns a chapter target whose ketabs have the given bodies.
+func chapter(bodies ...string) *Target {
+	ch := &Target{Coordinate: "30023:pk:ch"}
+	for i, body := range bodies {
+		ch.Children = append(ch.Children, &Target{Coordinate: fmt.Sprintf("38893:pk:k%d", i+1), Body: body})
+	}
+	return ch
+}
+
+// passage returns the rune range of s in body.
+func passage(body, s string) (int, int) {
+	i := strings.Index(body, s)
+	start := len([]rune(body[:i]))
+	return start, start + len([]rune(s))
+}
+
+func TestLocateNormalized(t *testing.T) {
+	body := "Héllo **Big**  World, again."
+	ch := chapter(body)
+	anchor := NewResolver(ch).Locate(ch, "big WORLD", "")
+	if anchor == nil || !anchor.Exact() {
+		t.Fatalf("anchor = %+v, want an exact match", anchor)
+	}
+	// The range maps through the dropped markers and collapsed spaces.
+	if got := string([]rune(body)[anchor.Start:anchor.End]); got != "Big**  World" {
+		t.Errorf("anchored %q, want %q", got, "Big**  World")
+	}
+}
+
+func TestLocateContext(t *testing.T) {
+	ch := chapter("No cats here.", "The cat sat. Later the cat ran off.")
+	r := NewResolver(ch)
+
+	anchor := r.Locate(ch, "the cat", "Later the cat ran")
+	if anchor == nil || anchor.Ketab != ch.Children[1] {
+		t.Fatalf("anchor = %+v, want the second ketab", anchor)
+	}
+	if start, end := passage(anchor.Ketab.Body, "the cat ran"); anchor.Start != start || anchor.End != end-4 {
+		t.Errorf("context anchored [%d, %d), want [%d, %d)", anchor.Start, anchor.End, start, end-4)
+	}
+
+	anchor = r.Locate(ch, "the cat", "")
+	if anchor == nil || anchor.Start != 0 || anchor.End != 7 {
+		t.Errorf("without context: anchor = %+v, want the first occurrence", anchor)
+	}
+
+	// A context not in the body leaves the passage itself to decide.
+	anchor = r.Locate(ch, "the cat", "Meanwhile the cat slept")
+	if anchor == nil || anchor.Start != 0 {
+		t.Errorf("unknown context: anchor = %+v, want the first occurrence", anchor)
+	}
+}
+
+func TestLocateLongPassage(t *testing.T) {
+	var words []string
+	for i := range 80 {
+		words = append(words, fmt.Sprintf("word%d", i))
+	}
+	text := strings.Join(words, " ")
+	if len([]rune(text)) <= max_pattern {
+		t.Fatalf("passage has %d runes, want more than %d", len([]rune(text)), max_pattern)
+	}
+	body := "Before the passage. " + text + " After it."
+	ch := chapter(body)
+	start, end := passage(body, text)
+	r := NewResolver(ch)
+
+	// Edits in the middle of a long passage leave its head and tail to anchor it.
+	edited := strings.Replace(text, "word40 word41", "words forty and forty-one", 1)
+	anchor := r.Locate(ch, edited, "")
+	if anchor == nil || anchor.Start != start || anchor.End != end {
+		t.Errorf("middle edit: anchor = %+v, want [%d, %d)", anchor, start, end)
+	}
+
+	// Typos in the head lower the score.
+	typo := "wrod0 wrod1" + strings.TrimPrefix(text, "word0 word1")
+	anchor = r.Locate(ch, typo, "")
+	if anchor == nil || anchor.Exact() || anchor.Start != start || anchor.End != end {
+		t.Errorf("head typo: anchor = %+v, want a fuzzy [%d, %d)", anchor, start, end)
+	}
+
+	// A tail missing from the body does not anchor.
+	missing := text + strings.Repeat(" unrelated", 20)
+	if anchor := r.Locate(ch, missing, ""); anchor != nil {
+		t.Errorf("missing tail: anchor = %+v, want none", anchor)
+	}
+}
+
+func TestOriginal(t *testing.T) {
+	n := normalize("a **b**  c")
+	if start, end := n.original(2, 5); start != 4 || end != 10 {
+		t.Errorf("original(2, 5) = %d, %d, want 4, 10", start, end)
+	}
+	for _, r := range [][2]int{{2, 2}, {0, 0}, {3, 1}, {0, 6}} {
+		if start, end := n.original(r[0], r[1]); start != -1 || end != -1 {
+			t.Errorf("original(%d, %d) = %d, %d, want -1, -1", r[0], r[1], start, end)
+		}
+	}
+}
+
+func TestLocateNoEmptyMatch(t *testing.T) {
+	ch := chapter("abc", "a b", "x")
+	r := NewResolver(ch)
+	r.MinScore = 0
+	for _, text := range []string{"xyz", "qqqq", "b"} {
+		anchor := r.Locate(ch, text, "")
+		if anchor != nil && anchor.End <= anchor.Start {
+			t.Errorf("%q: empty anchor %+v", text, anchor)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	ch := chapter("First ketab.", "Second ketab text.")
+	ch.Children[1].EventID = "eventid"
+	r := NewResolver(ch)
+
+	by_coord := &nostr.Event{Kind: 9802, Content: "ketab text", Tags: nostr.Tags{{"a", ch.Coordinate}}}
+	if anchor := r.Resolve(by_coord); anchor == nil || anchor.Ketab != ch.Children[1] {
+		t.Errorf("by coordinate: anchor = %+v, want the second ketab", anchor)
+	}
+	by_id := &nostr.Event{Kind: 9802, Content: "ketab text", Tags: nostr.Tags{{"e", "eventid"}}}
+	if anchor := r.Resolve(by_id); anchor == nil || anchor.Ketab != ch.Children[1] {
+		t.Errorf("by event id: anchor = %+v, want the second ketab", anchor)
+	}
+	unknown := &nostr.Event{Kind: 9802, Content: "ketab", Tags: nostr.Tags{{"a", "30023:pk:other"}}}
+	if anchor := r.Resolve(unknown); anchor != nil {
+		t.Errorf("unknown target: anchor = %+v, want none", anchor)
+	}
+}
@@ -0,0 +1,64 @@
+package engagement
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrNoAmount is returned by Bolt11Msats for invoices without an amount.
+var ErrNoAmount = errors.New("invoice has no amount")
+
+// bolt11 multipliers, in millisatoshis per unit (1 BTC = 10^11 msat).
+var multipliers = map[byte]int64{
+	'm': 100_000_000,
+	'u': 100_000,
+	'n': 100,
+}
+
+// Bolt11Msats returns the amount of a BOLT-11 invoice in millisatoshis. The
+// amount is read from the human-readable part (ln<currency><amount>), so the
+// invoice signature is not checked.
+func Bolt11Msats(invoice string) (int64, error) {
+	invoice = strings.ToLower(strings.TrimSpace(invoice))
+	invoice = strings.TrimPrefix(invoice, "lightning:")
+	sep := strings.LastIndexByte(invoice, '1')
+	if !strings.HasPrefix(invoice, "ln") || sep < 0 {
+		return 0, fmt.Errorf("not a bolt11 invoice")
+	}
+	hrp := invoice[2:sep]
+
+	// The currency prefix is letters; the amount starts at the first digit.
+	start := strings.IndexAny(hrp, "0123456789")
+	if start < 0 {
+		return 0, ErrNoAmount
+	}
+	amount := hrp[start:]
+
+	unit := amount[len(amount)-1]
+	if unit >= '0' && unit <= '9' {
+		// Whole bitcoins
+		n, err := strconv.ParseInt(amount, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid invoice amount %q", amount)
+		}
+		return n * 100_000_000_000, nil
+	}
+	n, err := strconv.ParseInt(amount[:len(amount)-1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid invoice amount %q", amount)
+	}
+	if unit == 'p' {
+		// Pico-bitcoin: 10 p = 1 msat
+		if n%10 != 0 {
+			return 0, fmt.Errorf("invalid invoice amount %q: sub-millisatoshi", amount)
+		}
+		return n / 10, nil
+	}
+	per_unit, ok := multipliers[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid invoice multiplier %q", string(unit))
+	}
+	return n * per_unit, nil
+}
@@ -0,0 +1,346 @@
+// Package engagement aggregates the engagement a book receives on Nostr:
+// NIP-22 comments (kind 1111), NIP-84 highlights (kind 9802), NIP-57 zap
+// receipts (kind 9735) and NIP-18 reposts (kinds 6 and 16) that reference the
+// `a` coordinate (or event id) of the book, one of its chapters or a ketab.
+//
+// Zap receipts are only counted when they agree with the zap request they
+// embed (see Zap). Their signer is not checked against the nostrPubkey of
+// the recipient's LNURL server, which would take a request to that server
+// per recipient, so anyone can still publish a receipt that passes: zap
+// totals are indicative, not proof of payment.
+//
+// Aggregate works on events already at hand; Fetch queries relays first.
+package engagement
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Kinds are the engagement event kinds.
+var Kinds = []int{
+	nostr.KindComment,
+	nostr.KindHighlights,
+	nostr.KindZap,
+	nostr.KindRepost,
+	nostr.KindGenericRepost,
+}
+
+// Target is an event engagement is counted for: a book, chapter or ketab.
+// Children roll their engagement up into their parent's totals.
+type Target struct {
+	// Coordinate is the target's address (<kind>:<pubkey>:<d-tag>).
+	Coordinate string
+
+	// EventID is the id of the current version, to match `e` references (optional).
+	EventID string
+
+	// Title is a display title.
+	Title string
+
+	// Body is the target's text, used to locate highlights (optional).
+	Body string
+
+	Children []*Target
+}
+
+// Stats are engagement counts.
+type Stats struct {
+	Comments   int   `json:"comments"`
+	Highlights int   `json:"highlights"`
+	Zaps       int   `json:"zaps"`
+	ZapMsats   int64 `json:"zap_msats"` // Sum of the bolt11 amounts, in millisatoshis
+	Reposts    int   `json:"reposts"`
+}
+
+// Total returns the number of engagement events counted.
+func (s Stats) Total() int {
+	return s.Comments + s.Highlights + s.Zaps + s.Reposts
+}
+
+func (s *Stats) add(o Stats) {
+	s.Comments += o.Comments
+	s.Highlights += o.Highlights
+	s.Zaps += o.Zaps
+	s.ZapMsats += o.ZapMsats
+	s.Reposts += o.Reposts
+}
+
+// Node is the engagement of one target.
+type Node struct {
+	Target *Target
+
+	// Own counts the events that reference this target; Total adds those of
+	// every descendant.
+	Own   Stats
+	Total Stats
+
+	// Comments are the threads rooted at this target, oldest first.
+	Comments []*Comment
+
+	// Highlights are the passages highlighted in this target, oldest first.
+	Highlights []*Highlight
+
+	// Zaps are the zap receipts for this target, oldest first.
+	Zaps []*Zap
+
+	Children []*Node
+}
+
+// Comment is a NIP-22 comment and its replies.
+type Comment struct {
+	Event   *nostr.Event
+	Replies []*Comment
+}
+
+// Highlight is a NIP-84 highlight.
+type Highlight struct {
+	Event *nostr.Event
+
+	// Text is the highlighted passage (the event content); Context is the
+	// surrounding text from the `context` tag, if any.
+	Text    string
+	Context string
+
+	// Anchor locates the passage in a ketab of the book, nil when it is not
+	// found (see Resolver).
+	Anchor *Anchor
+}
+
+// Zap is a NIP-57 zap receipt. A receipt is counted only when its
+// `description` tag holds a validly signed zap request (kind 9734) that names
+// the same `a` and `e` targets as the receipt, and whose `amount` tag, if it
+// has one, equals the bolt11 amount.
+type Zap struct {
+	Event *nostr.Event
+
+	// Msats is the amount of the bolt11 invoice, 0 if it has none.
+	Msats int64
+
+	// Sender is the pubkey of the zap request.
+	Sender string
+}
+
+// Aggregate attributes events to the targets of book and builds the
+// engagement tree. Events that reference no target are ignored; duplicate
+// events are counted once.
+func Aggregate(book *Target, events []*nostr.Event) *Node {
+	root := new_node(book)
+	by_ref := make(map[string]*Node)
+	var index func(n *Node)
+	index = func(n *Node) {
+		by_ref[n.Target.Coordinate] = n
+		if n.Target.EventID != "" {
+			by_ref[n.Target.EventID] = n
+		}
+		for _, child := range n.Children {
+			index(child)
+		}
+	}
+	index(root)
+
+	resolver := NewResolver(book)
+	sorted := unique(events)
+	comments := make(map[string]*Comment) // id -> comment
+	var pending []*Comment                // comments whose parent is another comment
+	for _, event := range sorted {
+		switch event.Kind {
+		case nostr.KindComment:
+			node := find_target(by_ref, event, "A", "E", "a", "e")
+			if node == nil {
+				continue
+			}
+			c := &Comment{Event: event}
+			comments[event.ID] = c
+			node.Own.Comments++
+			if parent := comment_parent(event); parent != "" && by_ref[parent] == nil {
+				pending = append(pending, c)
+			} else {
+				node.Comments = append(node.Comments, c)
+			}
+		case nostr.KindHighlights:
+			node := find_target(by_ref, event, "a", "e")
+			if node == nil {
+				continue
+			}
+			node.Own.Highlights++
+			node.Highlights = append(node.Highlights, new_highlight(event, resolver))
+		case nostr.KindZap:
+			node := find_target(by_ref, event, "a", "e")
+			if node == nil {
+				continue
+			}
+			zap := new_zap(event)
+			if zap == nil {
+				continue
+			}
+			node.Own.Zaps++
+			node.Own.ZapMsats += zap.Msats
+			node.Zaps = append(node.Zaps, zap)
+		case nostr.KindRepost, nostr.KindGenericRepost:
+			node := find_target(by_ref, event, "a", "e")
+			if node == nil {
+				continue
+			}
+			node.Own.Reposts++
+		}
+	}
+
+	// Attach replies to their parent comment. A reply whose parent was not
+	// fetched is shown at the top level of its target.
+	for _, c := range pending {
+		if parent, ok := comments[comment_parent(c.Event)]; ok {
+			parent.Replies = append(parent.Replies, c)
+			continue
+		}
+		node := find_target(by_ref, c.Event, "A", "E", "a", "e")
+		node.Comments = append(node.Comments, c)
+	}
+	for _, n := range by_ref {
+		sort.SliceStable(n.Comments, func(i, j int) bool {
+			return n.Comments[i].Event.CreatedAt < n.Comments[j].Event.CreatedAt
+		})
+	}
+
+	root.sum()
+	return root
+}
+
+// Find returns the node of the target with the given coordinate, or nil.
+func (n *Node) Find(coordinate string) *Node {
+	if n.Target.Coordinate == coordinate {
+		return n
+	}
+	for _, child := range n.Children {
+		if found := child.Find(coordinate); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func new_node(t *Target) *Node {
+	n := &Node{Target: t}
+	for _, child := range t.Children {
+		n.Children = append(n.Children, new_node(child))
+	}
+	return n
+}
+
+// sum computes Total bottom-up.
+func (n *Node) sum() Stats {
+	n.Total = n.Own
+	for _, child := range n.Children {
+		n.Total.add(child.sum())
+	}
+	return n.Total
+}
+
+// unique drops duplicate events and sorts the rest oldest first.
+func unique(events []*nostr.Event) []*nostr.Event {
+	seen := make(map[string]bool)
+	var out []*nostr.Event
+	for _, event := range events {
+		if event == nil || seen[event.ID] {
+			continue
+		}
+		seen[event.ID] = true
+		out = append(out, event)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt < out[j].CreatedAt })
+	return out
+}
+
+// find_target returns the node referenced by the first tag, in the order of
+// names, whose value is a known coordinate or event id.
+func find_target(by_ref map[string]*Node, event *nostr.Event, names ...string) *Node {
+	for _, name := range names {
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == name {
+				if n, ok := by_ref[tag[1]]; ok {
+					return n
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// comment_parent returns the id of the comment a NIP-22 reply answers (its
+// lowercase `e` tag), or "" for a top-level comment.
+func comment_parent(event *nostr.Event) string {
+	if k := event.Tags.GetFirst([]string{"k", ""}); k != nil && k.Value() != "1111" {
+		return ""
+	}
+	if e := event.Tags.GetFirst([]string{"e", ""}); e != nil {
+		return e.Value()
+	}
+	return ""
+}
+
+func new_highlight(event *nostr.Event, resolver *Resolver) *Highlight {
+	h := &Highlight{Event: event, Text: strings.TrimSpace(event.Content)}
+	if tag := event.Tags.GetFirst([]string{"context", ""}); tag != nil {
+		h.Context = tag.Value()
+	}
+	h.Anchor = resolver.Resolve(event)
+	return h
+}
+
+// new_zap reads a zap receipt, or returns nil when it does not agree with
+// the zap request it embeds (see Zap).
+func new_zap(event *nostr.Event) *Zap {
+	tag := event.Tags.GetFirst([]string{"description", ""})
+	if tag == nil {
+		return nil
+	}
+	var request nostr.Event
+	if request.UnmarshalJSON([]byte(tag.Value())) != nil || request.Kind != nostr.KindZapRequest {
+		return nil
+	}
+	if ok, err := request.CheckSignature(); !ok || err != nil {
+		return nil
+	}
+	if !same_values(event, &request, "a") || !same_values(event, &request, "e") {
+		return nil
+	}
+
+	zap := &Zap{Event: event, Sender: request.PubKey}
+	if tag := event.Tags.GetFirst([]string{"bolt11", ""}); tag != nil {
+		zap.Msats, _ = Bolt11Msats(tag.Value())
+	}
+	if tag := request.Tags.GetFirst([]string{"amount", ""}); tag != nil {
+		amount, err := strconv.ParseInt(tag.Value(), 10, 64)
+		if err != nil || amount != zap.Msats {
+			return nil
+		}
+	}
+	return zap
+}
+
+// same_values reports whether the receipt and the zap request have the same
+// values for tags named name.
+func same_values(receipt, request *nostr.Event, name string) bool {
+	values := func(event *nostr.Event) map[string]bool {
+		set := make(map[string]bool)
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == name {
+				set[tag[1]] = true
+			}
+		}
+		return set
+	}
+	a, b := values(receipt), values(request)
+	if len(a) != len(b) {
+		return false
+	}
+	for v := range a {
+		if !b[v] {
+			return false
+		}
+	}
+	return true
+}
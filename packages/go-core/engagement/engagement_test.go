@@ -0,0 +1,60 @@
+package engagement
+
+import (
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// zap_receipt returns a zap receipt for coord, paid with invoice, embedding a
+// zap request with the given tags signed by sender.
+func zap_receipt(t *testing.T, sender, coord, invoice string, request_tags nostr.Tags) *nostr.Event {
+	t.Helper()
+	request := nostr.Event{Kind: nostr.KindZapRequest, CreatedAt: 100, Tags: request_tags}
+	if err := request.Sign(sender); err != nil {
+		t.Fatal(err)
+	}
+	receipt := &nostr.Event{
+		Kind:      nostr.KindZap,
+		CreatedAt: 101,
+		Tags: nostr.Tags{
+			{"a", coord},
+			{"bolt11", invoice},
+			{"description", request.String()},
+		},
+	}
+	if err := receipt.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatal(err)
+	}
+	return receipt
+}
+
+func TestZapReceipts(t *testing.T) {
+	book := &Target{Coordinate: "38891:" + nostr.GeneratePrivateKey() + ":book"}
+	other := "38891:" + nostr.GeneratePrivateKey() + ":other"
+	sender := nostr.GeneratePrivateKey()
+	sender_pk, _ := nostr.GetPublicKey(sender)
+
+	valid := zap_receipt(t, sender, book.Coordinate, "lnbc10u1pxyz", nostr.Tags{{"a", book.Coordinate}, {"amount", "1000000"}})
+	no_amount := zap_receipt(t, sender, book.Coordinate, "lnbc2u1pxyz", nostr.Tags{{"a", book.Coordinate}})
+	wrong_target := zap_receipt(t, sender, book.Coordinate, "lnbc10u1pxyz", nostr.Tags{{"a", other}})
+	wrong_amount := zap_receipt(t, sender, book.Coordinate, "lnbc10m1pxyz", nostr.Tags{{"a", book.Coordinate}, {"amount", "1000000"}})
+	forged := zap_receipt(t, sender, book.Coordinate, "lnbc10u1pxyz", nostr.Tags{{"a", book.Coordinate}})
+	forged.Tags = forged.Tags[:2] // no zap request
+	if err := forged.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatal(err)
+	}
+
+	node := Aggregate(book, []*nostr.Event{valid, no_amount, wrong_target, wrong_amount, forged})
+	if node.Own.Zaps != 2 {
+		t.Errorf("Zaps = %d, want 2", node.Own.Zaps)
+	}
+	if node.Own.ZapMsats != 1_200_000 {
+		t.Errorf("ZapMsats = %d, want 1200000", node.Own.ZapMsats)
+	}
+	for _, zap := range node.Zaps {
+		if zap.Sender != sender_pk {
+			t.Errorf("Sender = %s, want %s", zap.Sender, sender_pk)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package engagement
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// max_refs caps the tag values per filter; relays reject very large filters.
+const max_refs = 100
+
+// Fetch queries relays for the engagement events referencing book or any of
+// its descendants (by `a`/`A` coordinate and `e`/`E` event id) and aggregates
+// them. It returns an error only if book has no coordinate; relays that fail
+// are skipped.
+func Fetch(ctx context.Context, pool *nostr.SimplePool, relays []string, book *Target) (*Node, error) {
+	if book == nil || book.Coordinate == "" {
+		return nil, fmt.Errorf("book has no coordinate")
+	}
+	var coordinates, ids []string
+	var walk func(t *Target)
+	walk = func(t *Target) {
+		coordinates = append(coordinates, t.Coordinate)
+		if t.EventID != "" {
+			ids = append(ids, t.EventID)
+		}
+		for _, child := range t.Children {
+			walk(child)
+		}
+	}
+	walk(book)
+
+	var filters []nostr.Filter
+	for _, tag := range []string{"a", "A"} {
+		for _, chunk := range chunks(coordinates) {
+			filters = append(filters, nostr.Filter{Kinds: Kinds, Tags: nostr.TagMap{tag: chunk}})
+		}
+	}
+	for _, tag := range []string{"e", "E"} {
+		for _, chunk := range chunks(ids) {
+			filters = append(filters, nostr.Filter{Kinds: Kinds, Tags: nostr.TagMap{tag: chunk}})
+		}
+	}
+
+	var events []*nostr.Event
+	for _, filter := range filters {
+		for ie := range pool.FetchMany(ctx, relays, filter) {
+			events = append(events, ie.Event)
+		}
+	}
+	return Aggregate(book, events), nil
+}
+
+func chunks(values []string) [][]string {
+	var out [][]string
+	for len(values) > max_refs {
+		out = append(out, values[:max_refs])
+		values = values[max_refs:]
+	}
+	if len(values) > 0 {
+		out = append(out, values)
+	}
+	return out
+}
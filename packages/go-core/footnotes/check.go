@@ -0,0 +1,183 @@
+package footnotes
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Problem codes are stable, machine-readable identifiers for each kind of
+// citation problem.
+const (
+	CodeDanglingCitation = "dangling_citation"
+	CodeUnusedSource     = "unused_source"
+	CodeDuplicateSource  = "duplicate_source"
+)
+
+// Problem is a citation without a source, a source never cited, or a source
+// label listed twice.
+type Problem struct {
+	// Code is a machine-readable identifier (one of the Code* constants).
+	Code string `json:"code"`
+
+	Label string `json:"label"`
+
+	// Line and Column locate the marker or entry in the body, 1-based.
+	Line   int `json:"line"`
+	Column int `json:"column"`
+
+	// Message is a human-readable description.
+	Message string `json:"message"`
+}
+
+// String formats the problem as "line:column: message".
+func (p Problem) String() string {
+	return fmt.Sprintf("%d:%d: %s", p.Line, p.Column, p.Message)
+}
+
+// Check lists every citation marker without a matching source and every
+// source no marker cites, in the order they appear in the body.
+func (b *Body) Check() []Problem {
+	var problems []Problem
+	sources := make(map[string]bool)
+	for _, s := range b.Sources {
+		if sources[s.Label] {
+			problems = append(problems, Problem{
+				Code:    CodeDuplicateSource,
+				Label:   s.Label,
+				Line:    s.Line,
+				Column:  1,
+				Message: fmt.Sprintf("source %s is listed more than once", s.Label),
+			})
+		}
+		sources[s.Label] = true
+	}
+
+	cited := make(map[string]bool)
+	for _, r := range b.References {
+		cited[r.Label] = true
+		if !sources[r.Label] {
+			problems = append(problems, Problem{
+				Code:    CodeDanglingCitation,
+				Label:   r.Label,
+				Line:    r.Line,
+				Column:  r.Column,
+				Message: fmt.Sprintf("citation %s has no source", marker(r.Label, r.Footnote)),
+			})
+		}
+	}
+	reported := make(map[string]bool)
+	for _, s := range b.Sources {
+		if !cited[s.Label] && !reported[s.Label] {
+			reported[s.Label] = true
+			problems = append(problems, Problem{
+				Code:    CodeUnusedSource,
+				Label:   s.Label,
+				Line:    s.Line,
+				Column:  1,
+				Message: fmt.Sprintf("source %s is never cited", s.Label),
+			})
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Line != problems[j].Line {
+			return problems[i].Line < problems[j].Line
+		}
+		return problems[i].Column < problems[j].Column
+	})
+	return problems
+}
+
+// Renumber relabels the body's citations start, start+1, ... in the order
+// they are first cited, then any sources never cited in their listed order,
+// and sorts the sources section to match. Markers keep their style ("[1]"
+// or "[^1]") and entries theirs ("1." or "[1]"); headings stay at the top of
+// the section. It returns the label after the last one used, so several
+// bodies can be numbered in sequence, and reparses the body.
+func (b *Body) Renumber(start int) int {
+	labels := make(map[string]string)
+	next := start
+	assign := func(label string) {
+		if _, ok := labels[label]; !ok {
+			labels[label] = strconv.Itoa(next)
+			next++
+		}
+	}
+	for _, r := range b.References {
+		assign(r.Label)
+	}
+	for _, s := range b.Sources {
+		assign(s.Label)
+	}
+
+	// Prose: replace markers from the end so offsets stay valid
+	prose := b.Prose
+	for i := len(b.References) - 1; i >= 0; i-- {
+		r := b.References[i]
+		end := r.Offset + len(marker(r.Label, r.Footnote))
+		prose = prose[:r.Offset] + marker(labels[r.Label], r.Footnote) + prose[end:]
+	}
+
+	// Sources section: headings, then each entry with its continuation
+	// lines, ordered by their new labels
+	type entry struct {
+		number int
+		lines  []string
+	}
+	var head []string
+	var entries []entry
+	spaced := false
+	for _, line := range strings.Split(b.Section, "\n") {
+		if m := entry_re.FindStringSubmatchIndex(line); m != nil {
+			from, to := m[2], m[3]
+			if from < 0 {
+				from, to = m[4], m[5]
+			}
+			label := labels[line[from:to]]
+			n, _ := strconv.Atoi(label)
+			entries = append(entries, entry{number: n, lines: []string{line[:from] + label + line[to:]}})
+			continue
+		}
+		if len(entries) == 0 {
+			head = append(head, line)
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			spaced = true
+			continue
+		}
+		last := &entries[len(entries)-1]
+		last.lines = append(last.lines, line)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].number < entries[j].number })
+
+	blocks := []string{strings.TrimSpace(strings.Join(head, "\n"))}
+	if blocks[0] == "" {
+		blocks = nil
+	}
+	var list []string
+	for _, e := range entries {
+		list = append(list, strings.Join(e.lines, "\n"))
+	}
+	sep := "\n"
+	if spaced {
+		sep = "\n\n"
+	}
+	if len(list) > 0 {
+		blocks = append(blocks, strings.Join(list, sep))
+	}
+
+	renumbered := &Body{Prose: prose, Section: strings.Join(blocks, "\n\n")}
+	*b = *Parse(renumbered.String())
+	return next
+}
+
+// marker formats a citation marker.
+func marker(label string, footnote bool) string {
+	if footnote {
+		return "[^" + label + "]"
+	}
+	return "[" + label + "]"
+}
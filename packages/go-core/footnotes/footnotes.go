@@ -0,0 +1,285 @@
+// Package footnotes parses the citations of ketab bodies.
+//
+// A ketab body is markdown whose prose may cite sources with superscript
+// markers, "[1]" (or "[^1]" in markdown footnote syntax), followed by a "---"
+// rule and a sources section listing them (see PROTOCOL.md):
+//
+//	By 1495, Columbus had shipped over 500 enslaved people to Spain.[1]
+//
+//	---
+//
+//	**Sources**
+//
+//	1. Las Casas, *Historia de las Indias*, Book I, Ch. 88
+//
+// Parse splits a body into its prose, the references in it and its sources.
+// Check lists citations without a source and sources never cited, and
+// Renumber relabels them 1, 2, 3... in reading order.
+package footnotes
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// entry_re matches a sources entry: "1. text", "1) text", "[1] text" or
+	// "[^1]: text".
+	entry_re = regexp.MustCompile(`^\s*(?:(\d+)[.)]|\[\^?([0-9A-Za-z_-]+)\]:?)\s+(.+)$`)
+
+	// heading_re matches the heading lines of a sources section, such as
+	// "**Sources**", "## Notes" or "References:".
+	heading_re = regexp.MustCompile(`^(?:\*\*[^*]+\*\*:?|#{1,6}\s+.+|[A-Z][\w ]{0,30}:)$`)
+
+	// marker_re matches a citation marker in prose.
+	marker_re = regexp.MustCompile(`\[(\^?)([0-9A-Za-z_-]+)\]`)
+
+	code_span_re = regexp.MustCompile("`+[^`]+?`+")
+)
+
+// Body is a ketab body split into its prose and its sources section.
+type Body struct {
+	// Prose is the text before the sources section: the whole body when it
+	// has none.
+	Prose string
+
+	// Section is the sources section as written after the rule: headings,
+	// entries and their continuation lines. Empty when the body has none.
+	Section string
+
+	// References are the citation markers in Prose, in reading order.
+	References []Reference
+
+	// Sources are the entries of Section, in order.
+	Sources []Source
+}
+
+// Reference is a citation marker in a body's prose.
+type Reference struct {
+	Label string
+
+	// Footnote is set for markers written "[^label]" rather than "[label]".
+	Footnote bool
+
+	// Offset is the byte offset of the marker's "[" in Prose.
+	Offset int
+
+	// Line and Column locate the marker in the body, 1-based. Columns count
+	// characters, not bytes.
+	Line   int
+	Column int
+}
+
+// Source is an entry of a body's sources section.
+type Source struct {
+	Label string
+
+	// Text is the entry's text, continuation lines joined by spaces.
+	Text string
+
+	// Line is the 1-based line of the entry in the body.
+	Line int
+}
+
+// Parse splits a ketab body into its prose and its sources section: the text
+// after the last "---" rule outside code fences, when that text has at least
+// one numbered or bracketed entry. Citation markers are found in the prose,
+// outside code spans, code fences and links; plain brackets only count when
+// they hold a number, so "[sic]" is not a citation but "[^sic]" is.
+func Parse(body string) *Body {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	lines := strings.Split(body, "\n")
+
+	sep := -1
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			switch fence {
+			case "":
+				fence = trimmed[:3]
+			case trimmed[:3]:
+				fence = ""
+			}
+		}
+		if fence == "" && trimmed == "---" {
+			sep = i
+		}
+	}
+
+	b := &Body{Prose: body}
+	if sep >= 0 {
+		for i, line := range lines[sep+1:] {
+			if m := entry_re.FindStringSubmatch(line); m != nil {
+				b.Sources = append(b.Sources, Source{
+					Label: first(m[1], m[2]),
+					Text:  strings.TrimSpace(m[3]),
+					Line:  sep + i + 2,
+				})
+				continue
+			}
+			// Continuation lines of the previous entry
+			text := strings.TrimSpace(line)
+			if len(b.Sources) > 0 && text != "" && (line[0] == ' ' || line[0] == '\t') {
+				b.Sources[len(b.Sources)-1].Text += " " + text
+			}
+		}
+		if len(b.Sources) > 0 {
+			b.Prose = strings.TrimRight(strings.Join(lines[:sep], "\n"), "\n ")
+			b.Section = strings.TrimSpace(strings.Join(lines[sep+1:], "\n"))
+		}
+	}
+	b.References = references(b.Prose)
+	return b
+}
+
+// String reassembles the body: its prose, then the rule and sources section
+// if it has one.
+func (b *Body) String() string {
+	if b.Section == "" {
+		return b.Prose
+	}
+	return b.Prose + "\n\n---\n\n" + b.Section
+}
+
+// SectionParts splits Section into its headings (such as "**Sources**"),
+// which may be empty, and its entries with their continuation lines.
+func (b *Body) SectionParts() (heading, entries string) {
+	lines := strings.Split(b.Section, "\n")
+	for i, line := range lines {
+		if entry_re.MatchString(line) {
+			return strings.TrimSpace(strings.Join(lines[:i], "\n")), strings.Join(lines[i:], "\n")
+		}
+	}
+	return strings.TrimSpace(b.Section), ""
+}
+
+// Labels returns the source labels, in order.
+func (b *Body) Labels() []string {
+	labels := make([]string, len(b.Sources))
+	for i, s := range b.Sources {
+		labels[i] = s.Label
+	}
+	return labels
+}
+
+// Source returns the first source labelled label, if any.
+func (b *Body) Source(label string) (Source, bool) {
+	for _, s := range b.Sources {
+		if s.Label == label {
+			return s, true
+		}
+	}
+	return Source{}, false
+}
+
+// IsSourcesSection reports whether text is only a sources section: entries,
+// their continuation lines and headings. Text after a "---" rule that is a
+// sources section belongs to the ketab before the rule.
+func IsSourcesSection(text string) bool {
+	entries := 0
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+		case entry_re.MatchString(line):
+			entries++
+		case entries > 0 && (line[0] == ' ' || line[0] == '\t'):
+		case heading_re.MatchString(trimmed):
+		default:
+			return false
+		}
+	}
+	return entries > 0
+}
+
+// references finds the citation markers in prose.
+func references(prose string) []Reference {
+	var refs []Reference
+	offset := 0
+	fence := ""
+	for i, line := range strings.Split(prose, "\n") {
+		line_offset := offset
+		offset += len(line) + 1
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			switch fence {
+			case "":
+				fence = trimmed[:3]
+			case trimmed[:3]:
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" {
+			continue
+		}
+
+		// Blank out code spans, keeping byte offsets
+		masked := code_span_re.ReplaceAllStringFunc(line, func(span string) string {
+			return strings.Repeat(" ", len(span))
+		})
+		last_end := -1
+		for _, m := range marker_re.FindAllStringSubmatchIndex(masked, -1) {
+			start, end := m[0], m[1]
+			caret := m[3] > m[2]
+			label := masked[m[4]:m[5]]
+			cited := caret || is_number(label)
+
+			var before, after byte
+			if start > 0 {
+				before = masked[start-1]
+			}
+			if end < len(masked) {
+				after = masked[end]
+			}
+			switch {
+			case !cited:
+			case before == '\\' || before == '[' || before == '!':
+				// Escaped, a wikilink or an image
+				cited = false
+			case before == ']' && start != last_end:
+				// A reference link, "[text][1]"
+				cited = false
+			case after == '(' || after == ']':
+				// A link, "[1](url)", or inside a wikilink
+				cited = false
+			case after == ':' && strings.TrimSpace(masked[:start]) == "":
+				// A link or footnote definition, "[1]: url"
+				cited = false
+			}
+			if !cited {
+				continue
+			}
+			last_end = end
+			refs = append(refs, Reference{
+				Label:    label,
+				Footnote: caret,
+				Offset:   line_offset + start,
+				Line:     i + 1,
+				Column:   utf8.RuneCountInString(line[:start]) + 1,
+			})
+		}
+	}
+	return refs
+}
+
+func is_number(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,138 @@
+package footnotes
+
+import (
+	"reflect"
+	"testing"
+)
+
+const body = "Über 500 people[1] were shipped,[^note] see `code[2]` and [a link](https://x.example/).\n" +
+	"Not citations: [sic], \\[4], ![5](img.png), [text][6] and [[7]].\n" +
+	"```\n[8] in a fence\n```\n" +
+	"Cited again.[1] [9]\n" +
+	"\n---\n\n" +
+	"**Sources**\n\n" +
+	"1. Las Casas, *Historia*,\n" +
+	"   Book I\n" +
+	"[^note]: A note\n" +
+	"10) Never cited\n"
+
+func TestParse(t *testing.T) {
+	b := Parse(body)
+
+	want_refs := []Reference{
+		{Label: "1", Line: 1, Column: 16},
+		{Label: "note", Footnote: true, Line: 1, Column: 33},
+		{Label: "1", Line: 6, Column: 13},
+		{Label: "9", Line: 6, Column: 17},
+	}
+	if len(b.References) != len(want_refs) {
+		t.Fatalf("References = %+v, want %d", b.References, len(want_refs))
+	}
+	for i, want := range want_refs {
+		got := b.References[i]
+		if got.Label != want.Label || got.Footnote != want.Footnote || got.Line != want.Line || got.Column != want.Column {
+			t.Errorf("reference %d = %+v, want %+v", i, got, want)
+		}
+		if m := marker(got.Label, got.Footnote); b.Prose[got.Offset:got.Offset+len(m)] != m {
+			t.Errorf("reference %d offset %d does not point at %s", i, got.Offset, m)
+		}
+	}
+
+	want_sources := []Source{
+		{Label: "1", Text: "Las Casas, *Historia*, Book I", Line: 12},
+		{Label: "note", Text: "A note", Line: 14},
+		{Label: "10", Text: "Never cited", Line: 15},
+	}
+	if !reflect.DeepEqual(b.Sources, want_sources) {
+		t.Errorf("Sources = %+v, want %+v", b.Sources, want_sources)
+	}
+	if b.Prose != body[:len(body)-len(b.Section)-len("\n\n---\n\n\n")] {
+		t.Errorf("Prose = %q", b.Prose)
+	}
+	heading, entries := b.SectionParts()
+	if heading != "**Sources**" || entries[:3] != "1. " {
+		t.Errorf("SectionParts = %q, %q", heading, entries)
+	}
+	if got := Parse(b.String()); !reflect.DeepEqual(got.Sources, b.Sources) || got.Prose != b.Prose {
+		t.Errorf("String() does not parse back to the same body:\n%s", b.String())
+	}
+}
+
+func TestParseWithoutSources(t *testing.T) {
+	tests := map[string]string{
+		"rule before prose": "One[1].\n\n---\n\nMore prose, not sources.",
+		"rule in a fence":   "One[1].\n\n```\n---\n1. not a source\n```",
+		"no rule":           "One[1].",
+	}
+	for name, text := range tests {
+		b := Parse(text)
+		if b.Prose != text || b.Section != "" || len(b.Sources) != 0 {
+			t.Errorf("%s: Prose %q, Section %q, %d sources; want the whole body as prose", name, b.Prose, b.Section, len(b.Sources))
+		}
+		if len(b.References) != 1 {
+			t.Errorf("%s: %d references, want 1", name, len(b.References))
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	b := Parse("First[1] and second[2].\nThird[^5].\n\n---\n\n1. One\n3. Three\n1. Again\n4. Four\n")
+	// Problems are sorted by position, whatever their code.
+	want := []Problem{
+		{Code: CodeDanglingCitation, Label: "2", Line: 1, Column: 20},
+		{Code: CodeDanglingCitation, Label: "5", Line: 2, Column: 6},
+		{Code: CodeUnusedSource, Label: "3", Line: 7, Column: 1},
+		{Code: CodeDuplicateSource, Label: "1", Line: 8, Column: 1},
+		{Code: CodeUnusedSource, Label: "4", Line: 9, Column: 1},
+	}
+
+	got := b.Check()
+	if len(got) != len(want) {
+		t.Fatalf("Check = %v, want %d problems", got, len(want))
+	}
+	for i := range want {
+		g := got[i]
+		if g.Code != want[i].Code || g.Label != want[i].Label || g.Line != want[i].Line || g.Column != want[i].Column {
+			t.Errorf("problem %d = %+v, want %+v", i, g, want[i])
+		}
+	}
+	if got[0].String() != "1:20: citation [2] has no source" {
+		t.Errorf("String() = %q", got[0].String())
+	}
+
+	if problems := Parse("Cited[1].\n\n---\n\n1. Source\n").Check(); len(problems) != 0 {
+		t.Errorf("Check = %v, want none", problems)
+	}
+}
+
+func TestRenumber(t *testing.T) {
+	b := Parse("A[7] b[^x] c[7].\n\n---\n\n**Notes**\n\n[^x]: X\n7. Seven\n   continued\n9. Unused\n")
+	if next := b.Renumber(3); next != 6 {
+		t.Errorf("Renumber returned %d, want 6", next)
+	}
+	want := "A[3] b[^4] c[3].\n\n---\n\n**Notes**\n\n3. Seven\n   continued\n[^4]: X\n5. Unused"
+	if b.String() != want {
+		t.Errorf("renumbered body:\n%s\nwant:\n%s", b.String(), want)
+	}
+	if labels := b.Labels(); !reflect.DeepEqual(labels, []string{"3", "4", "5"}) {
+		t.Errorf("Labels = %v", labels)
+	}
+	if s, ok := b.Source("4"); !ok || s.Text != "X" {
+		t.Errorf("Source(4) = %+v, %v", s, ok)
+	}
+}
+
+func TestIsSourcesSection(t *testing.T) {
+	tests := map[string]bool{
+		"**Sources**\n\n1. One\n   more\n2. Two": true,
+		"## References\n[1] One":                 true,
+		"Notes:\n[^a]: A":                        true,
+		"**Sources**":                            false,
+		"1. One\n\nThen a paragraph.":            false,
+	}
+	for text, want := range tests {
+		if got := IsSourcesSection(text); got != want {
+			t.Errorf("IsSourcesSection(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
@@ -1,8 +1,9 @@
 // Package core provides core types, constants, and utilities for Ketab Protocol.
-// Ketab Protocol defines Nostr event kinds 38890-38892 for decentralized book libraries.
+// Ketab Protocol defines Nostr event kinds 38890-38893 for decentralized book libraries,
+// and builds on NIP-23 long-form content (kind 30023) for chapters.
 package core
 
-// Event kinds for Ketab Protocol (38890-38892)
+// Event kinds for Ketab Protocol (38890-38893)
 const (
 	// KindLibrary is the event kind for Library events (38890).
 	// Library events define book curation containers.
@@ -15,6 +16,14 @@ const (
 	// KindLibraryEntry is the event kind for Library Entry events (38892).
 	// Library Entry events define library-specific metadata about curated books.
 	KindLibraryEntry = 38892
+
+	// KindKetab is the event kind for Ketab events (38893).
+	// Ketab events are the atomic content unit within a chapter.
+	KindKetab = 38893
+
+	// KindChapter is the event kind for Chapter events (30023).
+	// Chapters are NIP-23 long-form content compiled from their ketabs.
+	KindChapter = 30023
 )
 
 // Protocol constants
@@ -28,10 +37,12 @@ const (
 )
 
 // KetabProtocolKinds contains all Ketab Protocol event kinds.
+// KindChapter is not included: it is a NIP-23 kind the protocol reuses.
 var KetabProtocolKinds = map[int]bool{
 	KindLibrary:      true,
 	KindBook:         true,
 	KindLibraryEntry: true,
+	KindKetab:        true,
 }
 
 // IsKetabProtocolKind returns true if the kind is a Ketab Protocol event kind.
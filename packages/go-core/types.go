@@ -26,6 +26,11 @@ var (
 	// ErrMissingRefBookID is returned when ref_book_id is missing.
 	ErrMissingRefBookID = errors.New("ref_book_id is required")
 
+	// ErrMissingBody is returned when a required body field is empty.
+	ErrMissingBody = errors.New("body is required")
+
+	// ErrInvalidIndex is returned when a ketab index is negative.
+	ErrInvalidIndex = errors.New("index must be a non-negative integer")
 )
 
 // LibraryContent represents the content structure for Library events (kind 38890).
@@ -63,6 +68,19 @@ type LibraryContent struct {
 
 	// ReaderCount is the total number of unique readers (can be 0).
 	ReaderCount int `json:"reader_count"`
+
+	// Books is the ordered list of books in the library. The order is
+	// authoritative; 'a' tags only index the books for relays.
+	Books []LibraryBook `json:"books,omitempty"`
+}
+
+// LibraryBook is one entry of a library's ordered books list.
+type LibraryBook struct {
+	// D is the book's d-tag.
+	D string `json:"d"`
+
+	// Title is the book title.
+	Title string `json:"title"`
 }
 
 // Validate checks if the LibraryContent has required fields per LIBRARY-01.
@@ -203,3 +221,30 @@ func (e *LibraryEntryContent) Validate() error {
 	}
 	return nil
 }
+
+// KetabContent represents the content structure for Ketab events (kind 38893).
+// Per KETAB-01 specification.
+type KetabContent struct {
+	// Title is the ketab title.
+	Title string `json:"title"`
+
+	// Index is the 0-based position within the parent chapter.
+	Index int `json:"index"`
+
+	// Body is the markdown body, with optional footnotes after a `---` separator.
+	Body string `json:"body"`
+}
+
+// Validate checks if the KetabContent has required fields per KETAB-01.
+func (k *KetabContent) Validate() error {
+	if k.Title == "" {
+		return ErrMissingTitle
+	}
+	if k.Index < 0 {
+		return ErrInvalidIndex
+	}
+	if k.Body == "" {
+		return ErrMissingBody
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity is the severity of a validation violation.
+type Severity string
+
+const (
+	// SeverityError marks a violation that makes the event invalid.
+	SeverityError Severity = "error"
+
+	// SeverityWarning marks a violation that does not make the event invalid
+	// but deviates from the specification's recommendations.
+	SeverityWarning Severity = "warning"
+)
+
+// Violation codes are stable, machine-readable identifiers for each kind of problem.
+const (
+	CodeUnknownKind    = "unknown_kind"
+	CodeWrongKind      = "wrong_kind"
+	CodeMissingTag     = "missing_tag"
+	CodeInvalidTag     = "invalid_tag"
+	CodeInvalidJSON    = "invalid_json"
+	CodeMissingField   = "missing_field"
+	CodeInvalidField   = "invalid_field"
+	CodePubkeyMismatch = "pubkey_mismatch"
+	CodeEmptyContent   = "empty_content"
+)
+
+// Violation is a single problem found while validating an event.
+type Violation struct {
+	// Code is a machine-readable identifier (one of the Code* constants).
+	Code string `json:"code"`
+
+	// Severity is either SeverityError or SeverityWarning.
+	Severity Severity `json:"severity"`
+
+	// Message is a human-readable description.
+	Message string `json:"message"`
+
+	// Path is the JSON path into the event content (e.g. "$.shape"), if any.
+	Path string `json:"path,omitempty"`
+
+	// Tag is the tag name the violation refers to (e.g. "a"), if any.
+	Tag string `json:"tag,omitempty"`
+
+	// TagIndex is the index into event.Tags of the offending tag, if any.
+	TagIndex *int `json:"tag_index,omitempty"`
+}
+
+// String formats the violation as a single line.
+func (v Violation) String() string {
+	location := ""
+	switch {
+	case v.Path != "":
+		location = " at " + v.Path
+	case v.TagIndex != nil:
+		location = fmt.Sprintf(" at tags[%d]", *v.TagIndex)
+	case v.Tag != "":
+		location = fmt.Sprintf(" at tag '%s'", v.Tag)
+	}
+	return fmt.Sprintf("%s [%s]%s: %s", v.Severity, v.Code, location, v.Message)
+}
+
+// Report lists every violation found while validating an event.
+type Report struct {
+	// Kind is the kind of the validated event.
+	Kind int `json:"kind"`
+
+	// EventID is the ID of the validated event (may be empty for unsigned events).
+	EventID string `json:"event_id,omitempty"`
+
+	// Violations is every problem found, in the order they were detected.
+	Violations []Violation `json:"violations"`
+}
+
+// Valid returns true if the report contains no error-level violations.
+func (r *Report) Valid() bool {
+	return len(r.Errors()) == 0
+}
+
+// Errors returns the error-level violations.
+func (r *Report) Errors() []Violation {
+	return r.filter(SeverityError)
+}
+
+// Warnings returns the warning-level violations.
+func (r *Report) Warnings() []Violation {
+	return r.filter(SeverityWarning)
+}
+
+// String formats the report as one violation per line.
+func (r *Report) String() string {
+	if len(r.Violations) == 0 {
+		return "ok"
+	}
+	lines := make([]string, 0, len(r.Violations))
+	for _, v := range r.Violations {
+		lines = append(lines, v.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *Report) filter(severity Severity) []Violation {
+	var out []Violation
+	for _, v := range r.Violations {
+		if v.Severity == severity {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// add_error records an error-level violation.
+func (r *Report) add_error(code, path, message string) {
+	r.Violations = append(r.Violations, Violation{Code: code, Severity: SeverityError, Message: message, Path: path})
+}
+
+// add_warning records a warning-level violation.
+func (r *Report) add_warning(code, path, message string) {
+	r.Violations = append(r.Violations, Violation{Code: code, Severity: SeverityWarning, Message: message, Path: path})
+}
+
+// add_tag_error records an error-level violation about a tag.
+// tag_index is -1 when the tag is missing altogether.
+func (r *Report) add_tag_error(code, tag string, tag_index int, message string) {
+	r.Violations = append(r.Violations, tag_violation(code, SeverityError, tag, tag_index, message))
+}
+
+// add_tag_warning records a warning-level violation about a tag.
+// tag_index is -1 when the tag is missing altogether.
+func (r *Report) add_tag_warning(code, tag string, tag_index int, message string) {
+	r.Violations = append(r.Violations, tag_violation(code, SeverityWarning, tag, tag_index, message))
+}
+
+func tag_violation(code string, severity Severity, tag string, tag_index int, message string) Violation {
+	v := Violation{Code: code, Severity: severity, Message: message, Tag: tag}
+	if tag_index >= 0 {
+		idx := tag_index
+		v.TagIndex = &idx
+	}
+	return v
+}
+
+// to_result converts the report into the legacy single-message ValidationResult.
+// The first error becomes the message; valid_message is used when there are none.
+func (r *Report) to_result(valid_message string) ValidationResult {
+	for _, v := range r.Violations {
+		if v.Severity == SeverityError {
+			return ValidationResult{Valid: false, Message: v.Message}
+		}
+	}
+	return ValidationResult{Valid: true, Message: valid_message}
+}
@@ -1,4 +1,8 @@
 // Package validation provides event validators for Ketab Protocol.
+//
+// The Check* functions return a Report listing every violation found.
+// The Validate* functions are compatibility wrappers that return a
+// single-message ValidationResult describing the first error.
 package validation
 
 import (
@@ -26,12 +30,43 @@ func ValidateEvent(event *nostr.Event) ValidationResult {
 		return ValidateBookEvent(event)
 	case core.KindLibraryEntry:
 		return ValidateLibraryEntryEvent(event)
+	case core.KindKetab:
+		return ValidateKetabEvent(event)
+	case core.KindChapter:
+		return ValidateChapterEvent(event)
+	default:
+		return CheckEvent(event).to_result("")
+	}
+}
+
+// CheckEvent validates a Ketab Protocol event based on its kind.
+// Returns a Report listing every violation found.
+func CheckEvent(event *nostr.Event) *Report {
+	switch event.Kind {
+	case core.KindLibrary:
+		return CheckLibraryEvent(event)
+	case core.KindBook:
+		return CheckBookEvent(event)
+	case core.KindLibraryEntry:
+		return CheckLibraryEntryEvent(event)
+	case core.KindKetab:
+		return CheckKetabEvent(event)
+	case core.KindChapter:
+		return CheckChapterEvent(event)
 	default:
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Unknown Ketab Protocol kind: %d", event.Kind)}
+		report := new_report(event)
+		report.add_error(CodeUnknownKind, "", fmt.Sprintf("Unknown Ketab Protocol kind: %d", event.Kind))
+		return report
 	}
 }
 
 // ValidateLibraryEvent validates Library events (kind 38890) per LIBRARY-01 specification.
+// See CheckLibraryEvent for the rules.
+func ValidateLibraryEvent(event *nostr.Event) ValidationResult {
+	return CheckLibraryEvent(event).to_result("Valid Library event")
+}
+
+// CheckLibraryEvent validates Library events (kind 38890) per LIBRARY-01 specification.
 //
 // Required tags:
 //   - d: Library identifier (any non-empty string, scoped to pubkey)
@@ -42,141 +77,185 @@ func ValidateEvent(event *nostr.Event) ValidationResult {
 //   - name, description, founder_pubkey, protocol_version
 //   - ref_library_pubkey, ref_library_id, ref_clock_pubkey
 //   - book_count, reader_count (can be 0)
-func ValidateLibraryEvent(event *nostr.Event) ValidationResult {
+//
+// Optional content fields:
+//   - books: ordered [{d, title}] list; every d must be non-empty, and a book
+//     without a matching 38891 'a' tag is a warning
+func CheckLibraryEvent(event *nostr.Event) *Report {
+	report := new_report(event)
 	if event.Kind != core.KindLibrary {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Expected kind %d for Library event, got %d", core.KindLibrary, event.Kind)}
+		report.add_error(CodeWrongKind, "", fmt.Sprintf("Expected kind %d for Library event, got %d", core.KindLibrary, event.Kind))
+		return report
 	}
 
 	// Must have d tag (library identifier)
-	d_tag := get_tag_value(event, "d")
-	if d_tag == "" {
-		return ValidationResult{Valid: false, Message: "Missing 'd' tag (library identifier)"}
-	}
+	check_d_tag(report, event, "library identifier")
 
 	// Must have block coordinate a tag (format: 38808:clock_pubkey:org.cityprotocol:block:<height>:<hash>)
-	a_tags := get_tag_values(event, "a")
 	has_block_coord := false
-	for _, a_tag := range a_tags {
+	for _, a_tag := range get_tag_values(event, "a") {
 		if strings.HasPrefix(a_tag, "38808:") {
 			has_block_coord = true
 			break
 		}
 	}
 	if !has_block_coord {
-		return ValidationResult{Valid: false, Message: "Missing block coordinate 'a' tag (format: 38808:clock_pubkey:org.cityprotocol:block:<height>:<hash>)"}
+		report.add_tag_error(CodeMissingTag, "a", -1, "Missing block coordinate 'a' tag (format: 38808:clock_pubkey:org.cityprotocol:block:<height>:<hash>)")
 	}
 
 	// Must have p tags (library pubkey and clock pubkey)
-	p_tags := get_tag_values(event, "p")
-	if len(p_tags) < 2 {
-		return ValidationResult{Valid: false, Message: "Missing required 'p' tags (need library pubkey and clock pubkey)"}
+	if len(get_tag_values(event, "p")) < 2 {
+		report.add_tag_error(CodeMissingTag, "p", -1, "Missing required 'p' tags (need library pubkey and clock pubkey)")
 	}
 
 	// Content must be valid JSON
-	var content_data map[string]any
-	if err := json.Unmarshal([]byte(event.Content), &content_data); err != nil {
-		return ValidationResult{Valid: false, Message: "Content must be valid JSON"}
+	content_data, ok := parse_json_content(report, event)
+	if !ok {
+		return report
 	}
 
 	// Check required string fields
-	required_string_fields := []string{
+	check_required_strings(report, content_data,
 		"name", "description", "founder_pubkey", "protocol_version",
 		"ref_library_pubkey", "ref_library_id", "ref_clock_pubkey",
+	)
+
+	// Check required count fields (can be 0)
+	check_required_present(report, content_data, "book_count", "reader_count")
+
+	check_library_books(report, event, content_data)
+
+	return report
+}
+
+// check_library_books checks the optional ordered books list of a library.
+func check_library_books(report *Report, event *nostr.Event, content_data map[string]any) {
+	raw, present := content_data["books"]
+	if !present {
+		return
 	}
-	for _, field := range required_string_fields {
-		val, ok := content_data[field]
+	books, ok := raw.([]any)
+	if !ok {
+		report.add_error(CodeInvalidField, "$.books", "Content field 'books' must be an array of {d, title} objects")
+		return
+	}
+	indexed := make(map[string]bool)
+	for _, a := range get_tag_values(event, "a") {
+		if parts := strings.SplitN(a, ":", 3); len(parts) == 3 && parts[0] == fmt.Sprint(core.KindBook) {
+			indexed[parts[2]] = true
+		}
+	}
+	for i, raw_book := range books {
+		path := fmt.Sprintf("$.books[%d]", i)
+		book, ok := raw_book.(map[string]any)
 		if !ok {
-			return ValidationResult{Valid: false, Message: fmt.Sprintf("Content must include '%s'", field)}
+			report.add_error(CodeInvalidField, path, "Library book must be a {d, title} object")
+			continue
 		}
-		if str, ok := val.(string); !ok || str == "" {
-			return ValidationResult{Valid: false, Message: fmt.Sprintf("Content field '%s' must be a non-empty string", field)}
+		d, _ := book["d"].(string)
+		if d == "" {
+			report.add_error(CodeMissingField, path+".d", "Library book is missing its 'd' (book d-tag)")
+			continue
 		}
-	}
-
-	// Check required count fields (can be 0)
-	required_count_fields := []string{"book_count", "reader_count"}
-	for _, field := range required_count_fields {
-		if _, ok := content_data[field]; !ok {
-			return ValidationResult{Valid: false, Message: fmt.Sprintf("Content must include '%s'", field)}
+		if !indexed[d] {
+			report.add_warning(CodeMissingTag, path, fmt.Sprintf("Library book '%s' has no matching 'a' tag (38891:<pubkey>:%s)", d, d))
 		}
 	}
-
-	return ValidationResult{Valid: true, Message: "Valid Library event"}
 }
 
 // ValidateBookEvent validates Book events (kind 38891) per LIBRARY-01 specification.
+// See CheckBookEvent for the rules.
+func ValidateBookEvent(event *nostr.Event) ValidationResult {
+	return CheckBookEvent(event).to_result("Valid Book event")
+}
+
+// CheckBookEvent validates Book events (kind 38891) per LIBRARY-01 specification.
 //
 // Required tags:
 //   - d: Book identifier (any non-empty string, scoped to pubkey)
 //   - p: Author pubkey
 //
+// Recommended tags (warning when absent or malformed):
+//   - a: Chapter coordinates (format: 30023:<pubkey>:<chapter_d-tag>)
+//
 // Required content fields:
 //   - title, description, author, published_at, shape
 //   - ref_book_pubkey, ref_book_id
 //
 // Validation: ref_book_pubkey must match event's pubkey
-func ValidateBookEvent(event *nostr.Event) ValidationResult {
+func CheckBookEvent(event *nostr.Event) *Report {
+	report := new_report(event)
 	if event.Kind != core.KindBook {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Expected kind %d for Book event, got %d", core.KindBook, event.Kind)}
+		report.add_error(CodeWrongKind, "", fmt.Sprintf("Expected kind %d for Book event, got %d", core.KindBook, event.Kind))
+		return report
 	}
 
 	// Must have d tag (book identifier)
-	d_tag := get_tag_value(event, "d")
-	if d_tag == "" {
-		return ValidationResult{Valid: false, Message: "Missing 'd' tag (book identifier)"}
-	}
+	check_d_tag(report, event, "book identifier")
 
 	// Must have p tag (author pubkey)
-	p_tags := get_tag_values(event, "p")
-	if len(p_tags) == 0 {
-		return ValidationResult{Valid: false, Message: "Missing required 'p' tag (author pubkey)"}
+	if len(get_tag_values(event, "p")) == 0 {
+		report.add_tag_error(CodeMissingTag, "p", -1, "Missing required 'p' tag (author pubkey)")
+	}
+
+	// Should have chapter a tags (for relay indexing)
+	has_chapter_coord := false
+	for i, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "a" && strings.HasPrefix(tag[1], core.ChapterIDPrefix) {
+			has_chapter_coord = true
+			if !is_chapter_coordinate(tag[1]) {
+				report.add_tag_warning(CodeInvalidTag, "a", i, fmt.Sprintf("Malformed chapter coordinate '%s' (format: 30023:<pubkey>:<chapter_d-tag>)", tag[1]))
+			}
+		}
+	}
+	if !has_chapter_coord {
+		report.add_tag_warning(CodeMissingTag, "a", -1, "No chapter 'a' tags (format: 30023:<pubkey>:<chapter_d-tag>); relays cannot index chapters")
 	}
 
 	// Content must be valid JSON
-	var content_data map[string]any
-	if err := json.Unmarshal([]byte(event.Content), &content_data); err != nil {
-		return ValidationResult{Valid: false, Message: "Content must be valid JSON"}
+	content_data, ok := parse_json_content(report, event)
+	if !ok {
+		return report
 	}
 
 	// Check required string fields
-	required_string_fields := []string{
+	check_required_strings(report, content_data,
 		"title", "description", "author",
 		// "ref_book_pubkey", "ref_book_id",
-	}
-	for _, field := range required_string_fields {
-		val, ok := content_data[field]
-		if !ok {
-			return ValidationResult{Valid: false, Message: fmt.Sprintf("Content must include '%s'", field)}
-		}
-		if str, ok := val.(string); !ok || str == "" {
-			return ValidationResult{Valid: false, Message: fmt.Sprintf("Content field '%s' must be a non-empty string", field)}
-		}
-	}
+	)
 
 	// Check published_at (required, numeric)
-	if _, ok := content_data["published_at"]; !ok {
-		return ValidationResult{Valid: false, Message: "Content must include 'published_at'"}
-	}
+	check_required_present(report, content_data, "published_at")
 
 	// Check shape array (required — array of acts, each act is an array of chapters)
-	shape, ok := content_data["shape"]
-	if !ok {
-		return ValidationResult{Valid: false, Message: "Content must include 'shape' array"}
-	}
-	if _, ok := shape.([]any); !ok {
-		return ValidationResult{Valid: false, Message: "Content field 'shape' must be an array"}
+	if shape, ok := content_data["shape"]; !ok {
+		report.add_error(CodeMissingField, "$.shape", "Content must include 'shape' array")
+	} else if acts, ok := shape.([]any); !ok {
+		report.add_error(CodeInvalidField, "$.shape", "Content field 'shape' must be an array")
+	} else {
+		for i, act := range acts {
+			if _, ok := act.([]any); !ok {
+				report.add_warning(CodeInvalidField, fmt.Sprintf("$.shape[%d]", i), "Each act in 'shape' must be an array of chapters")
+			}
+		}
 	}
 
 	// Validate ref_book_pubkey matches event's pubkey
 	ref_book_pubkey, _ := content_data["ref_book_pubkey"].(string)
 	if ref_book_pubkey != event.PubKey {
-		return ValidationResult{Valid: false, Message: "ref_book_pubkey must match event's pubkey (author identity)"}
+		report.add_error(CodePubkeyMismatch, "$.ref_book_pubkey", "ref_book_pubkey must match event's pubkey (author identity)")
 	}
 
-	return ValidationResult{Valid: true, Message: "Valid Book event"}
+	return report
 }
 
 // ValidateLibraryEntryEvent validates Library Entry events (kind 38892) per LIBRARY-01 specification.
+// See CheckLibraryEntryEvent for the rules.
+func ValidateLibraryEntryEvent(event *nostr.Event) ValidationResult {
+	return CheckLibraryEntryEvent(event).to_result("Valid Library Entry event")
+}
+
+// CheckLibraryEntryEvent validates Library Entry events (kind 38892) per LIBRARY-01 specification.
 //
 // Required tags:
 //   - d: Entry identifier (any non-empty string, scoped to pubkey)
@@ -186,22 +265,20 @@ func ValidateBookEvent(event *nostr.Event) ValidationResult {
 // Required content fields:
 //   - added_at
 //   - ref_library_owner_pubkey, ref_library_id, ref_book_coordinate, ref_book_pubkey, ref_book_id
-func ValidateLibraryEntryEvent(event *nostr.Event) ValidationResult {
+func CheckLibraryEntryEvent(event *nostr.Event) *Report {
+	report := new_report(event)
 	if event.Kind != core.KindLibraryEntry {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Expected kind %d for Library Entry event, got %d", core.KindLibraryEntry, event.Kind)}
+		report.add_error(CodeWrongKind, "", fmt.Sprintf("Expected kind %d for Library Entry event, got %d", core.KindLibraryEntry, event.Kind))
+		return report
 	}
 
 	// Must have d tag (entry identifier)
-	d_tag := get_tag_value(event, "d")
-	if d_tag == "" {
-		return ValidationResult{Valid: false, Message: "Missing 'd' tag (entry identifier)"}
-	}
+	check_d_tag(report, event, "entry identifier")
 
 	// Must have a tags (book coordinate and library coordinate)
-	a_tags := get_tag_values(event, "a")
 	has_book_coord := false
 	has_library_coord := false
-	for _, a_tag := range a_tags {
+	for _, a_tag := range get_tag_values(event, "a") {
 		if strings.HasPrefix(a_tag, "38891:") {
 			has_book_coord = true
 		}
@@ -210,48 +287,195 @@ func ValidateLibraryEntryEvent(event *nostr.Event) ValidationResult {
 		}
 	}
 	if !has_book_coord {
-		return ValidationResult{Valid: false, Message: "Missing book coordinate 'a' tag (format: 38891:<author_pubkey>:<book_id>)"}
+		report.add_tag_error(CodeMissingTag, "a", -1, "Missing book coordinate 'a' tag (format: 38891:<author_pubkey>:<book_id>)")
 	}
 	if !has_library_coord {
-		return ValidationResult{Valid: false, Message: "Missing library coordinate 'a' tag (format: 38890:<library_owner_pubkey>:<library_id>)"}
+		report.add_tag_error(CodeMissingTag, "a", -1, "Missing library coordinate 'a' tag (format: 38890:<library_owner_pubkey>:<library_id>)")
 	}
 
 	// Must have p tags (library owner pubkey and book author pubkey)
-	p_tags := get_tag_values(event, "p")
-	if len(p_tags) < 2 {
-		return ValidationResult{Valid: false, Message: "Missing required 'p' tags (need library owner pubkey and book author pubkey)"}
+	if len(get_tag_values(event, "p")) < 2 {
+		report.add_tag_error(CodeMissingTag, "p", -1, "Missing required 'p' tags (need library owner pubkey and book author pubkey)")
 	}
 
 	// Content must be valid JSON
-	var content_data map[string]any
-	if err := json.Unmarshal([]byte(event.Content), &content_data); err != nil {
-		return ValidationResult{Valid: false, Message: "Content must be valid JSON"}
+	content_data, ok := parse_json_content(report, event)
+	if !ok {
+		return report
 	}
 
 	// Check required string fields
-	required_string_fields := []string{
+	check_required_strings(report, content_data,
 		"ref_library_owner_pubkey", "ref_library_id", "ref_book_coordinate",
 		"ref_book_pubkey", "ref_book_id",
+	)
+
+	// Check added_at (required, numeric)
+	check_required_present(report, content_data, "added_at")
+
+	return report
+}
+
+// ValidateKetabEvent validates Ketab events (kind 38893) per KETAB-01 specification.
+// See CheckKetabEvent for the rules.
+func ValidateKetabEvent(event *nostr.Event) ValidationResult {
+	return CheckKetabEvent(event).to_result("Valid Ketab event")
+}
+
+// CheckKetabEvent validates Ketab events (kind 38893) per KETAB-01 specification.
+//
+// Required tags:
+//   - d: Ketab identifier (any non-empty string, scoped to pubkey)
+//   - a: Parent chapter coordinate (format: 30023:<pubkey>:<chapter_d-tag>)
+//
+// Required content fields:
+//   - title (non-empty string), index (non-negative integer), body (non-empty string)
+func CheckKetabEvent(event *nostr.Event) *Report {
+	report := new_report(event)
+	if event.Kind != core.KindKetab {
+		report.add_error(CodeWrongKind, "", fmt.Sprintf("Expected kind %d for Ketab event, got %d", core.KindKetab, event.Kind))
+		return report
+	}
+
+	// Must have d tag (ketab identifier)
+	check_d_tag(report, event, "ketab identifier")
+
+	// Must have parent chapter a tag (format: 30023:<pubkey>:<chapter_d-tag>)
+	has_chapter_coord := false
+	for i, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "a" || !strings.HasPrefix(tag[1], core.ChapterIDPrefix) {
+			continue
+		}
+		if is_chapter_coordinate(tag[1]) {
+			has_chapter_coord = true
+		} else {
+			report.add_tag_error(CodeInvalidTag, "a", i, fmt.Sprintf("Malformed chapter coordinate '%s' (format: 30023:<pubkey>:<chapter_d-tag>)", tag[1]))
+		}
+	}
+	if !has_chapter_coord {
+		report.add_tag_error(CodeMissingTag, "a", -1, "Missing parent chapter 'a' tag (format: 30023:<pubkey>:<chapter_d-tag>)")
+	}
+
+	// Content must be valid JSON
+	content_data, ok := parse_json_content(report, event)
+	if !ok {
+		return report
+	}
+
+	// Check required string fields
+	check_required_strings(report, content_data, "title", "body")
+
+	// Check index (required, 0-based integer)
+	if index_val, ok := content_data["index"]; !ok {
+		report.add_error(CodeMissingField, "$.index", "Content must include 'index'")
+	} else if index, ok := index_val.(float64); !ok || index < 0 || index != float64(int64(index)) {
+		report.add_error(CodeInvalidField, "$.index", "Content field 'index' must be a non-negative integer")
 	}
-	for _, field := range required_string_fields {
+
+	return report
+}
+
+// ValidateChapterEvent validates Chapter events (kind 30023) per NIP-23 and KETAB-01.
+// See CheckChapterEvent for the rules.
+func ValidateChapterEvent(event *nostr.Event) ValidationResult {
+	return CheckChapterEvent(event).to_result("Valid Chapter event")
+}
+
+// CheckChapterEvent validates Chapter events (kind 30023) per NIP-23 and KETAB-01.
+//
+// Required tags:
+//   - d: Chapter identifier (any non-empty string, scoped to pubkey)
+//   - title: Chapter title (NIP-23)
+//
+// Recommended tags (warning when absent):
+//   - published_at: Unix timestamp (NIP-23)
+//
+// Content is markdown (the compiled view of the chapter's ketabs) and must not be empty.
+func CheckChapterEvent(event *nostr.Event) *Report {
+	report := new_report(event)
+	if event.Kind != core.KindChapter {
+		report.add_error(CodeWrongKind, "", fmt.Sprintf("Expected kind %d for Chapter event, got %d", core.KindChapter, event.Kind))
+		return report
+	}
+
+	// Must have d tag (chapter identifier)
+	check_d_tag(report, event, "chapter identifier")
+
+	// Must have title tag (NIP-23)
+	if get_tag_value(event, "title") == "" {
+		report.add_tag_error(CodeMissingTag, "title", -1, "Missing 'title' tag (chapter title)")
+	}
+
+	// Should have published_at tag (NIP-23)
+	if get_tag_value(event, "published_at") == "" {
+		report.add_tag_warning(CodeMissingTag, "published_at", -1, "Missing 'published_at' tag (NIP-23)")
+	}
+
+	// Content is markdown, not JSON
+	if strings.TrimSpace(event.Content) == "" {
+		report.add_error(CodeEmptyContent, "", "Content must be non-empty markdown")
+	}
+
+	return report
+}
+
+// Helper functions
+
+// new_report creates an empty report for event.
+func new_report(event *nostr.Event) *Report {
+	return &Report{Kind: event.Kind, EventID: event.ID, Violations: []Violation{}}
+}
+
+// check_d_tag records an error if the event has no non-empty d tag.
+func check_d_tag(report *Report, event *nostr.Event, description string) {
+	if get_tag_value(event, "d") == "" {
+		report.add_tag_error(CodeMissingTag, "d", -1, fmt.Sprintf("Missing 'd' tag (%s)", description))
+	}
+}
+
+// parse_json_content decodes the event content as a JSON object.
+// Records an error and returns false if it is not valid JSON.
+func parse_json_content(report *Report, event *nostr.Event) (map[string]any, bool) {
+	var content_data map[string]any
+	if err := json.Unmarshal([]byte(event.Content), &content_data); err != nil {
+		report.add_error(CodeInvalidJSON, "$", "Content must be valid JSON")
+		return nil, false
+	}
+	return content_data, true
+}
+
+// check_required_strings records an error for each field that is missing or not a non-empty string.
+func check_required_strings(report *Report, content_data map[string]any, fields ...string) {
+	for _, field := range fields {
 		val, ok := content_data[field]
 		if !ok {
-			return ValidationResult{Valid: false, Message: fmt.Sprintf("Content must include '%s'", field)}
+			report.add_error(CodeMissingField, "$."+field, fmt.Sprintf("Content must include '%s'", field))
+			continue
 		}
 		if str, ok := val.(string); !ok || str == "" {
-			return ValidationResult{Valid: false, Message: fmt.Sprintf("Content field '%s' must be a non-empty string", field)}
+			report.add_error(CodeInvalidField, "$."+field, fmt.Sprintf("Content field '%s' must be a non-empty string", field))
 		}
 	}
+}
 
-	// Check added_at (required, numeric)
-	if _, ok := content_data["added_at"]; !ok {
-		return ValidationResult{Valid: false, Message: "Content must include 'added_at'"}
+// check_required_present records an error for each field that is missing (any value is accepted).
+func check_required_present(report *Report, content_data map[string]any, fields ...string) {
+	for _, field := range fields {
+		if _, ok := content_data[field]; !ok {
+			report.add_error(CodeMissingField, "$."+field, fmt.Sprintf("Content must include '%s'", field))
+		}
 	}
-
-	return ValidationResult{Valid: true, Message: "Valid Library Entry event"}
 }
 
-// Helper functions
+// is_chapter_coordinate reports whether a is a well-formed chapter coordinate
+// (30023:<64-char hex pubkey>:<non-empty d-tag>).
+func is_chapter_coordinate(a string) bool {
+	parts := strings.SplitN(a, ":", 3)
+	if len(parts) != 3 || parts[0] != fmt.Sprint(core.KindChapter) {
+		return false
+	}
+	return nostr.IsValid32ByteHex(parts[1]) && parts[2] != ""
+}
 
 // get_tag_value returns the first value of a tag with the given name.
 func get_tag_value(event *nostr.Event, tag_name string) string {
@@ -0,0 +1,246 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+
+	core "github.com/joinnextblock/ketab-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var pubkey = strings.Repeat("ab", 32)
+
+// violation is the part of a Violation the tests compare; index is -1 when
+// the violation has no TagIndex.
+type violation struct {
+	code     string
+	severity Severity
+	path     string
+	tag      string
+	index    int
+}
+
+func summarize(report *Report) []violation {
+	out := []violation{}
+	for _, v := range report.Violations {
+		index := -1
+		if v.TagIndex != nil {
+			index = *v.TagIndex
+		}
+		out = append(out, violation{v.Code, v.Severity, v.Path, v.Tag, index})
+	}
+	return out
+}
+
+func check(t *testing.T, name string, report *Report, want []violation) {
+	t.Helper()
+	got := summarize(report)
+	if len(got) != len(want) {
+		t.Errorf("%s: got %d violations, want %d:\n%s", name, len(got), len(want), report)
+		return
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%s: violation %d = %+v, want %+v", name, i, got[i], want[i])
+		}
+	}
+}
+
+var book_content = `{"title":"T","description":"D","author":"A","published_at":1,"shape":[["c1"]],"ref_book_pubkey":"` +
+	pubkey + `","ref_book_id":"b"}`
+
+func TestCheckBookEvent(t *testing.T) {
+	chapter := "30023:" + pubkey + ":c1"
+	tests := []struct {
+		name  string
+		event nostr.Event
+		want  []violation
+	}{
+		{
+			name: "valid",
+			event: nostr.Event{Kind: core.KindBook, PubKey: pubkey, Content: book_content,
+				Tags: nostr.Tags{{"d", "b"}, {"p", pubkey}, {"a", chapter}}},
+			want: []violation{},
+		},
+		{
+			name: "every violation in one event",
+			event: nostr.Event{Kind: core.KindBook, PubKey: pubkey,
+				Content: `{"title":"T","description":"","published_at":1,"ref_book_pubkey":"other"}`},
+			want: []violation{
+				{CodeMissingTag, SeverityError, "", "d", -1},
+				{CodeMissingTag, SeverityError, "", "p", -1},
+				{CodeMissingTag, SeverityWarning, "", "a", -1},
+				{CodeInvalidField, SeverityError, "$.description", "", -1},
+				{CodeMissingField, SeverityError, "$.author", "", -1},
+				{CodeMissingField, SeverityError, "$.shape", "", -1},
+				{CodePubkeyMismatch, SeverityError, "$.ref_book_pubkey", "", -1},
+			},
+		},
+		{
+			name: "malformed coordinate and act",
+			event: nostr.Event{Kind: core.KindBook, PubKey: pubkey,
+				Content: strings.Replace(book_content, `[["c1"]]`, `[["c1"],"c2"]`, 1),
+				Tags:    nostr.Tags{{"d", "b"}, {"p", pubkey}, {"a", "30023:nothex:c1"}}},
+			want: []violation{
+				{CodeInvalidTag, SeverityWarning, "", "a", 2},
+				{CodeInvalidField, SeverityWarning, "$.shape[1]", "", -1},
+			},
+		},
+		{
+			name: "content is not JSON",
+			event: nostr.Event{Kind: core.KindBook, PubKey: pubkey, Content: "# Title",
+				Tags: nostr.Tags{{"d", "b"}, {"p", pubkey}, {"a", chapter}}},
+			want: []violation{{CodeInvalidJSON, SeverityError, "$", "", -1}},
+		},
+		{
+			name:  "wrong kind",
+			event: nostr.Event{Kind: core.KindKetab},
+			want:  []violation{{CodeWrongKind, SeverityError, "", "", -1}},
+		},
+	}
+	for _, test := range tests {
+		check(t, test.name, CheckBookEvent(&test.event), test.want)
+	}
+}
+
+func TestCheckKetabEvent(t *testing.T) {
+	chapter := "30023:" + pubkey + ":c1"
+	tests := []struct {
+		name  string
+		event nostr.Event
+		want  []violation
+	}{
+		{
+			name: "valid",
+			event: nostr.Event{Kind: core.KindKetab, Content: `{"title":"K","index":0,"body":"Text"}`,
+				Tags: nostr.Tags{{"d", "k"}, {"a", chapter}}},
+			want: []violation{},
+		},
+		{
+			name: "malformed parent and bad fields",
+			event: nostr.Event{Kind: core.KindKetab, Content: `{"body":"","index":1.5}`,
+				Tags: nostr.Tags{{"d", "k"}, {"a", "30023:" + pubkey + ":"}}},
+			want: []violation{
+				{CodeInvalidTag, SeverityError, "", "a", 1},
+				{CodeMissingTag, SeverityError, "", "a", -1},
+				{CodeMissingField, SeverityError, "$.title", "", -1},
+				{CodeInvalidField, SeverityError, "$.body", "", -1},
+				{CodeInvalidField, SeverityError, "$.index", "", -1},
+			},
+		},
+		{
+			name: "no index",
+			event: nostr.Event{Kind: core.KindKetab, Content: `{"title":"K","body":"Text"}`,
+				Tags: nostr.Tags{{"a", chapter}}},
+			want: []violation{
+				{CodeMissingTag, SeverityError, "", "d", -1},
+				{CodeMissingField, SeverityError, "$.index", "", -1},
+			},
+		},
+		{
+			name: "negative index",
+			event: nostr.Event{Kind: core.KindKetab, Content: `{"title":"K","index":-1,"body":"Text"}`,
+				Tags: nostr.Tags{{"d", "k"}, {"a", chapter}}},
+			want: []violation{{CodeInvalidField, SeverityError, "$.index", "", -1}},
+		},
+	}
+	for _, test := range tests {
+		check(t, test.name, CheckKetabEvent(&test.event), test.want)
+	}
+}
+
+func TestCheckChapterEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		event nostr.Event
+		want  []violation
+	}{
+		{
+			name: "valid",
+			event: nostr.Event{Kind: core.KindChapter, Content: "Text",
+				Tags: nostr.Tags{{"d", "c"}, {"title", "C"}, {"published_at", "1"}}},
+			want: []violation{},
+		},
+		{
+			name: "no published_at",
+			event: nostr.Event{Kind: core.KindChapter, Content: "Text",
+				Tags: nostr.Tags{{"d", "c"}, {"title", "C"}}},
+			want: []violation{{CodeMissingTag, SeverityWarning, "", "published_at", -1}},
+		},
+		{
+			name:  "empty",
+			event: nostr.Event{Kind: core.KindChapter, Content: " \n"},
+			want: []violation{
+				{CodeMissingTag, SeverityError, "", "d", -1},
+				{CodeMissingTag, SeverityError, "", "title", -1},
+				{CodeMissingTag, SeverityWarning, "", "published_at", -1},
+				{CodeEmptyContent, SeverityError, "", "", -1},
+			},
+		},
+	}
+	for _, test := range tests {
+		check(t, test.name, CheckChapterEvent(&test.event), test.want)
+	}
+}
+
+func TestReportSeverities(t *testing.T) {
+	event := nostr.Event{Kind: core.KindChapter, Content: ""}
+	report := CheckEvent(&event)
+	if report.Valid() {
+		t.Error("report with errors is valid")
+	}
+	if len(report.Errors()) != 3 || len(report.Warnings()) != 1 {
+		t.Errorf("got %d errors and %d warnings, want 3 and 1", len(report.Errors()), len(report.Warnings()))
+	}
+
+	event.Tags = nostr.Tags{{"d", "c"}, {"title", "C"}}
+	event.Content = "Text"
+	if report := CheckEvent(&event); !report.Valid() || len(report.Warnings()) != 1 {
+		t.Errorf("warnings only: Valid() = %v with %d warnings, want true with 1", report.Valid(), len(report.Warnings()))
+	}
+
+	v := Violation{Code: CodeInvalidTag, Severity: SeverityWarning, Message: "m", Tag: "a", TagIndex: new(int)}
+	if got, want := v.String(), "warning [invalid_tag] at tags[0]: m"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		event nostr.Event
+		want  ValidationResult
+	}{
+		{
+			name:  "first error",
+			event: nostr.Event{Kind: core.KindChapter, Tags: nostr.Tags{{"d", "c"}}},
+			want:  ValidationResult{Valid: false, Message: "Missing 'title' tag (chapter title)"},
+		},
+		{
+			name:  "warnings only",
+			event: nostr.Event{Kind: core.KindChapter, Content: "Text", Tags: nostr.Tags{{"d", "c"}, {"title", "C"}}},
+			want:  ValidationResult{Valid: true, Message: "Valid Chapter event"},
+		},
+		{
+			name: "book",
+			event: nostr.Event{Kind: core.KindBook, PubKey: pubkey, Content: book_content,
+				Tags: nostr.Tags{{"d", "b"}, {"p", pubkey}}},
+			want: ValidationResult{Valid: true, Message: "Valid Book event"},
+		},
+		{
+			name:  "ketab",
+			event: nostr.Event{Kind: core.KindKetab, Content: "{}", Tags: nostr.Tags{{"d", "k"}}},
+			want:  ValidationResult{Valid: false, Message: "Missing parent chapter 'a' tag (format: 30023:<pubkey>:<chapter_d-tag>)"},
+		},
+		{
+			name:  "unknown kind",
+			event: nostr.Event{Kind: 1},
+			want:  ValidationResult{Valid: false, Message: "Unknown Ketab Protocol kind: 1"},
+		},
+	}
+	for _, test := range tests {
+		if got := ValidateEvent(&test.event); got != test.want {
+			t.Errorf("%s: ValidateEvent = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}